@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cacheCmd.AddCommand(cacheCleanCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the caches of the steps",
+	Long:  "The caches given in `caches` of the steps are Docker volumes kept between runs, which you can manage with the subcommands of this command.",
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean [cacheName...]",
+	Short: "Remove the volumes of the caches of the steps",
+	Long:  "This removes the Docker volumes of the given caches, or of all the caches if none is given. They are created again empty by the next steps using them. Volumes in use by a container are not removed.",
+	Run:   CleanCaches,
+}
+
+// CleanCaches command invoked from command line removes the volumes of the caches of the steps
+func CleanCaches(_ *cobra.Command, args []string) {
+	removed, err := docker.RemoveCaches(args)
+	for _, name := range removed {
+		logger.Bullet("Removed cache '%s'", name)
+	}
+	if err != nil {
+		logger.Log.Fatalf("Failed to remove caches: %s", err.Error())
+	}
+	if len(removed) == 0 {
+		fmt.Println("No caches to remove")
+	}
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/leopardslab/dunner/pkg/dunner"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -15,18 +17,152 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Quiet mode
+	doCmd.Flags().BoolP("quiet", "q", false, "Quiet mode, printing only errors, overrides verbose mode")
+	if err := viper.BindPFlag("Quiet", doCmd.Flags().Lookup("quiet")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Dry-run mode
-	doCmd.Flags().Bool("dry-run", false, "Dry-run of the command")
+	doCmd.Flags().Bool("dry-run", false, "Print the execution plan without running any containers")
 	if err := viper.BindPFlag("Dry-run", doCmd.Flags().Lookup("dry-run")); err != nil {
 		log.Fatal(err)
 	}
 
+	// Explain mode
+	doCmd.Flags().Bool("explain", false, "Print the docker run command lines equivalent to the steps without running any containers")
+	if err := viper.BindPFlag("Explain", doCmd.Flags().Lookup("explain")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Many tasks
+	doCmd.Flags().Bool("tasks", false, "Run many tasks separated by '+', each with the arguments after it, like: build ./cmd + test + lint. They run all at once in asynchronous mode")
+	if err := viper.BindPFlag("Tasks", doCmd.Flags().Lookup("tasks")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Force-pull
-	doCmd.Flags().Bool("force-pull", false, "Force pulling of images from Docker Hub")
+	doCmd.Flags().Bool("force-pull", false, "Force pulling of images from Docker Hub, unless their pull policy is never")
 	if err := viper.BindPFlag("Force-pull", doCmd.Flags().Lookup("force-pull")); err != nil {
 		log.Fatal(err)
 	}
 
+	// Registry
+	doCmd.Flags().String("registry", "", "Registry that images given without one are pulled from, overriding the task file")
+	if err := viper.BindPFlag("Registry", doCmd.Flags().Lookup("registry")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Max-parallel
+	doCmd.Flags().Int("max-parallel", 1, "Maximum number of follow tasks to run in parallel, 0 means no limit")
+	if err := viper.BindPFlag("Max-parallel", doCmd.Flags().Lookup("max-parallel")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Step filters
+	doCmd.Flags().StringSlice("only", nil, "Run only the step with the given name, can be repeated")
+	if err := viper.BindPFlag("Only", doCmd.Flags().Lookup("only")); err != nil {
+		log.Fatal(err)
+	}
+	doCmd.Flags().StringSlice("skip", nil, "Skip the step with the given name, can be repeated")
+	if err := viper.BindPFlag("Skip", doCmd.Flags().Lookup("skip")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Output format
+	doCmd.Flags().StringP("output", "o", "text", "Output format of the step results, one of: text, json")
+	if err := viper.BindPFlag("Output", doCmd.Flags().Lookup("output")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Named arguments
+	doCmd.Flags().StringSlice("arg", nil, "Named argument of the form name=value, referred to as ${name} in commands, can be repeated")
+	if err := viper.BindPFlag("Arg", doCmd.Flags().Lookup("arg")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Environment variables
+	doCmd.Flags().StringSlice("env", nil, "Environment variable of the form KEY=VALUE passed to every step, overriding the task file, can be repeated")
+	if err := viper.BindPFlag("Env", doCmd.Flags().Lookup("env")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Watch mode
+	doCmd.Flags().StringSlice("watch", nil, "Re-run the task when files matching the glob change, can be repeated")
+	if err := viper.BindPFlag("Watch", doCmd.Flags().Lookup("watch")); err != nil {
+		log.Fatal(err)
+	}
+
+	// No summary
+	doCmd.Flags().Bool("no-summary", false, "Do not print the summary of how long the steps took at the end of the run")
+	if err := viper.BindPFlag("No-summary", doCmd.Flags().Lookup("no-summary")); err != nil {
+		log.Fatal(err)
+	}
+
+	// No hooks
+	doCmd.Flags().Bool("no-hooks", false, "Do not run the before and after hooks of the task file around the task")
+	if err := viper.BindPFlag("No-hooks", doCmd.Flags().Lookup("no-hooks")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Exec in an existing container
+	doCmd.Flags().String("exec-in", "", "Run the commands of the steps in the given running container, instead of new containers of their images")
+	if err := viper.BindPFlag("Exec-in", doCmd.Flags().Lookup("exec-in")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Init process
+	doCmd.Flags().Bool("init", false, "Run an init process in the containers of the steps, forwarding signals and reaping zombie processes")
+	if err := viper.BindPFlag("Init", doCmd.Flags().Lookup("init")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep containers
+	doCmd.Flags().Bool("keep-containers", false, "Keep the containers of the steps running once done, rather than removing them, to debug them")
+	if err := viper.BindPFlag("Keep-containers", doCmd.Flags().Lookup("keep-containers")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Container names
+	doCmd.Flags().String("container-name-template", "", "Name the containers of the steps after a template like dunner-{task}-{step}-{run}, {run} being a short ID of the run, rather than random names")
+	if err := viper.BindPFlag("Container-name-template", doCmd.Flags().Lookup("container-name-template")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Output prefixes
+	doCmd.Flags().Bool("prefix", false, "Prefix every output line of the steps with their task and step number, like [build/1]")
+	if err := viper.BindPFlag("Prefix", doCmd.Flags().Lookup("prefix")); err != nil {
+		log.Fatal(err)
+	}
+	doCmd.Flags().Bool("color", false, "Color the output prefixes of the steps, unless the output is not a terminal")
+	if err := viper.BindPFlag("Color", doCmd.Flags().Lookup("color")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Stop timeout
+	doCmd.Flags().Duration("stop-timeout", 10*time.Second, "How long the containers have to exit on Ctrl+C or SIGTERM, before they are killed")
+	if err := viper.BindPFlag("Stop-timeout", doCmd.Flags().Lookup("stop-timeout")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Timeout of the run
+	doCmd.Flags().Duration("timeout", 0, "Maximum duration of the run, after which the running steps are stopped like on SIGTERM, no limit if zero")
+	if err := viper.BindPFlag("Timeout", doCmd.Flags().Lookup("timeout")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Force running the tasks whose inputs did not change
+	doCmd.Flags().Bool("force", false, "Run the tasks with `inputs` even if their inputs did not change since they last succeeded")
+	if err := viper.BindPFlag("Force-run", doCmd.Flags().Lookup("force")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Fail fast
+	doCmd.Flags().Bool("fail-fast", true, "Stop at the first task that fails when running many tasks, use --fail-fast=false to run them all")
+	if err := viper.BindPFlag("Fail-fast", doCmd.Flags().Lookup("fail-fast")); err != nil {
+		log.Fatal(err)
+	}
+
 }
 
 var doCmd = &cobra.Command{
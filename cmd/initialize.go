@@ -9,12 +9,18 @@ import (
 
 func init() {
 	rootCmd.AddCommand(initCmd)
+
+	// Overwrite the task file
+	initCmd.Flags().BoolP("force", "f", false, "Overwrite the task file if it already exists")
+	if err := viper.BindPFlag("Force", initCmd.Flags().Lookup("force")); err != nil {
+		log.Fatal(err)
+	}
 }
 
 var initCmd = &cobra.Command{
 	Use:     "init",
 	Short:   "Generates a dunner task file `.dunner.yaml`",
-	Long:    "You can initialize any project with dunner task file. It generates a default task file `.dunner.yaml`, you can customize it based on needs. You can override the name of task file using -t flag.",
+	Long:    "You can initialize any project with dunner task file. It generates a default task file `.dunner.yaml`, you can customize it based on needs. You can override the name of task file using -t flag. An existing task file is only overwritten with --force.",
 	Run:     Initialize,
 	Args:    cobra.MaximumNArgs(1),
 	Aliases: []string{"i"},
@@ -23,7 +29,7 @@ var initCmd = &cobra.Command{
 // Initialize command invoked from command line generates a dunner task file with default template
 func Initialize(_ *cobra.Command, args []string) {
 	var dunnerFile = viper.GetString("DunnerTaskFile")
-	if err := initialize.InitProject(dunnerFile, args); err != nil {
+	if err := initialize.InitProject(dunnerFile, args, viper.GetBool("Force")); err != nil {
 		logger.Log.Fatalf("Failed to initialize project: %s", err.Error())
 	}
 	logger.Log.Infof("Dunner task file `%s` created. Please make any required changes.", dunnerFile)
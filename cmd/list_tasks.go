@@ -4,18 +4,26 @@ import (
 	"github.com/leopardslab/dunner/internal/logger"
 	"github.com/leopardslab/dunner/pkg/dunner"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func init() {
 	rootCmd.AddCommand(listTasksCmd)
+
+	// List steps
+	listTasksCmd.Flags().String("list-steps", "", "List the resolved steps of the given task, with follow tasks expanded, in place of the tasks")
+	if err := viper.BindPFlag("List-steps", listTasksCmd.Flags().Lookup("list-steps")); err != nil {
+		log.Fatal(err)
+	}
 }
 
 var listTasksCmd = &cobra.Command{
-	Use:   "tasks",
-	Short: "Lists all available tasks in dunner task file",
-	Long:  "This lists all the available tasks in dunner task file, `.dunner.yaml` file by default or file passed to `-t` flag",
-	Run:   ListTasks,
-	Args:  cobra.NoArgs,
+	Use:     "tasks",
+	Short:   "Lists all available tasks in dunner task file",
+	Long:    "This lists all the available tasks in dunner task file, `.dunner.yaml` file by default or file passed to `-t` flag. With `-v` flag, the steps of every task are listed as well. With `--list-steps <task>`, the steps the task would run are listed with their image, command, user, environment variables and mounts.",
+	Run:     ListTasks,
+	Args:    cobra.NoArgs,
+	Aliases: []string{"list"},
 }
 
 // ListTasks command invoked from command line lists all available dunner tasks
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/docker/docker/client"
 	"github.com/leopardslab/dunner/internal/logger"
@@ -31,13 +32,25 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	// Verbose Mode
-	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Verbose mode")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Verbose mode, logging at debug level unless --log-level is given")
 	if err := viper.BindPFlag("Verbose", rootCmd.PersistentFlags().Lookup("verbose")); err != nil {
 		log.Fatal(err)
 	}
 
+	// Log level
+	rootCmd.PersistentFlags().String("log-level", "", "Level of the messages of dunner that are logged to stderr, one of: "+strings.Join(logger.LogLevels, ", ")+", info by default")
+	if err := viper.BindPFlag("Log-level", rootCmd.PersistentFlags().Lookup("log-level")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Verbose Docker output
+	rootCmd.PersistentFlags().Bool("verbose-docker", false, "Stream the progress of pulling images, layer by layer, to stderr")
+	if err := viper.BindPFlag("Verbose-docker", rootCmd.PersistentFlags().Lookup("verbose-docker")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Dunner task file
-	rootCmd.PersistentFlags().StringP("task-file", "t", ".dunner.yaml", "Task file to be run")
+	rootCmd.PersistentFlags().StringP("task-file", "t", ".dunner.yaml", "Task file to be run, looked up as .dunner.yaml, dunner.yaml, dunner.json or dunner.toml in the parent directories by default, - to read it from stdin, overrides DUNNER_TASK_FILE")
 	if err := rootCmd.MarkPersistentFlagFilename("task-file", "yaml", "yml"); err != nil {
 		log.Fatal(err)
 	}
@@ -45,6 +58,12 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Format of the task file
+	rootCmd.PersistentFlags().String("task-file-format", "", "Format of the task file, one of: yaml, json, toml, given by its extension by default, required to read it from stdin")
+	if err := viper.BindPFlag("Task-file-format", rootCmd.PersistentFlags().Lookup("task-file-format")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Environment file
 	rootCmd.PersistentFlags().StringP("env-file", "e", ".env", "Environment file")
 	if err := rootCmd.MarkPersistentFlagFilename("env-file", "env"); err != nil {
@@ -69,6 +88,18 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Docker socket
+	rootCmd.PersistentFlags().Bool("no-docker-socket", false, "Refuse to mount the Docker socket into containers of steps with `dockerSocket`")
+	if err := viper.BindPFlag("No-docker-socket", rootCmd.PersistentFlags().Lookup("no-docker-socket")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Privileged containers
+	rootCmd.PersistentFlags().Bool("no-privileged", false, "Refuse to run containers of steps with `privileged`")
+	if err := viper.BindPFlag("No-privileged", rootCmd.PersistentFlags().Lookup("no-privileged")); err != nil {
+		log.Fatal(err)
+	}
+
 }
 
 // Execute method executes the 'Run' method of rootCmd.
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the dunner task file `.dunner.yaml`",
+	Long:  "You can save the JSON Schema printed by this command and refer to it from your editor, for example with a `# yaml-language-server: $schema=dunner.schema.json` comment at the top of `.dunner.yaml`, to get the fields of the task file completed and validated as you type.",
+	Run:   PrintSchema,
+	Args:  cobra.NoArgs,
+}
+
+// PrintSchema command invoked from command line, prints the JSON Schema of the dunner task file
+func PrintSchema(_ *cobra.Command, args []string) {
+	schema, err := config.Schema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(schema))
+}
@@ -17,7 +17,7 @@ func init() {
 var validateCmd = &cobra.Command{
 	Use:     "validate",
 	Short:   "Validate the dunner task file `.dunner.yaml`",
-	Long:    "You can validate task file `.dunner.yaml` with this command to see if there are any parse errors",
+	Long:    "You can validate task file `.dunner.yaml` with this command to see if there are any parse errors. All the problems found are listed, including follow tasks that do not exist or follow each other in a cycle, without running anything or connecting to Docker.",
 	Run:     Validate,
 	Args:    cobra.NoArgs,
 	Aliases: []string{"v"},
@@ -35,7 +35,7 @@ func Validate(_ *cobra.Command, args []string) {
 
 	errs := configs.Validate()
 	if len(errs) != 0 {
-		fmt.Println("Validation failed with following errors:")
+		fmt.Printf("Validation failed with following %d errors:\n", len(errs))
 		for _, err := range errs {
 			logger.ErrorOutput(err.Error())
 		}
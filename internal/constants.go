@@ -5,19 +5,26 @@ const DefaultTaskFilePermission = 0644
 
 // DefaultTaskFileContents is the default dunner taskfile contents, used when initialized with dunner
 const DefaultTaskFileContents = `# This is an example dunner task file. Please make any required changes.
+# Run a task with 'dunner do <task>', list the tasks with 'dunner tasks' and check this file
+# with 'dunner validate'.
+
 # (Optional) Set any environment variables to be exported in the container
 # for every step of every task (can be overridden)
 envs:
   - PERM=775
 
 # (Optional) List of directories that are to be mounted on the container
-# for every step of every task (can be overridden)
+# for every step of every task, as <host directory>:<container directory>:<mode>
+# where the mode is r for read-only (the default) or w for read-write
 mounts:
   - /tmp:/tmp:w
 
 # List of all task objects
 tasks:
   build:
+    # (Optional) Short description of the task, shown by 'dunner tasks'
+    description: Install the dependencies of the project
+
     # (Optional) Set any environment variables to be exported in the container
     # for every step of 'build' task (can be overridden)
     envs:
@@ -28,12 +35,13 @@ tasks:
     mounts:
       - /tmp:/tmp:w
 
-    # List of all step objects for 'build' task
+    # List of all step objects for 'build' task, run one after the other
     steps:
       - name: setup
         # Image name that has to be pulled from a registry
         image: node:latest
-        # List of commands that has to be run inside the container
+        # List of commands that has to be run inside the container, the current
+        # directory being mounted on the container as its working directory
         commands:
           - ["npm", "--version"]
           - ["npm", "install"]
@@ -47,3 +55,12 @@ tasks:
 
 // DefaultDunnerTaskFileName is the default dunner task file name
 const DefaultDunnerTaskFileName = ".dunner.yaml"
+
+// AlternateDunnerTaskFileName is the task file name looked up along with the default one
+const AlternateDunnerTaskFileName = "dunner.yaml"
+
+// TaskFileNames are the task file names looked up in the current directory and its parents, in this order
+var TaskFileNames = []string{DefaultDunnerTaskFileName, AlternateDunnerTaskFileName, "dunner.json", "dunner.toml"}
+
+// StdinTaskFileName is the task file name for which the task file is read from the standard input
+const StdinTaskFileName = "-"
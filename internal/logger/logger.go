@@ -1,8 +1,14 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/sirupsen/logrus"
@@ -16,8 +22,38 @@ func init() {
 	Log.Formatter = new(logrus.TextFormatter)                                     // Default
 	Log.Formatter.(*logrus.TextFormatter).FullTimestamp = true                    // Enable timestamp
 	Log.Formatter.(*logrus.TextFormatter).TimestampFormat = "2006-01-02 15:04:05" // Customize timestamp format
-	Log.Level = logrus.TraceLevel
-	Log.Out = os.Stdout
+	Log.Level = logrus.InfoLevel
+	// The messages of dunner are kept apart from the output of the commands, which is written to stdout
+	Log.Out = os.Stderr
+}
+
+// LogLevels are the levels of the messages of dunner that can be logged, from the most to the least verbose
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+var logLevels = map[string]logrus.Level{
+	"debug": logrus.DebugLevel,
+	"info":  logrus.InfoLevel,
+	"warn":  logrus.WarnLevel,
+	"error": logrus.ErrorLevel,
+}
+
+// InitLogLevel sets the level of the messages of dunner that are logged: the given level if not empty, debug in
+// verbose mode, and info otherwise. Only errors are logged in quiet mode, whatever the level.
+func InitLogLevel(level string, verbose bool, quiet bool) error {
+	logLevel := logrus.InfoLevel
+	if level != "" {
+		var known bool
+		if logLevel, known = logLevels[level]; !known {
+			return fmt.Errorf("dunner: invalid log level '%s', must be one of: %s", level, strings.Join(LogLevels, ", "))
+		}
+	} else if verbose {
+		logLevel = logrus.DebugLevel
+	}
+	if quiet {
+		logLevel = logrus.ErrorLevel
+	}
+	Log.Level = logLevel
+	return nil
 }
 
 // InitColorOutput disables colorized output if no-color flag is passed
@@ -47,6 +83,138 @@ func NewErrWriter() *ErrWriter {
 
 // Write function to implement io.Writer interface
 func (*ErrWriter) Write(b []byte) (n int, err error) {
-	_, e := color.New(color.FgRed).Fprintln(os.Stderr, string(b))
+	_, e := color.New(color.FgRed).Fprintln(os.Stderr, strings.TrimSuffix(string(b), "\n"))
 	return len(b), e
 }
+
+// PrefixWriter is an io.Writer that writes every line of the output to the underlying writer with a prefix,
+// so that output of commands running concurrently can be told apart.
+type PrefixWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+// NewPrefixWriter returns a pointer to new PrefixWriter object writing to the given writer
+func NewPrefixWriter(out io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, prefix: prefix}
+}
+
+// Write function to implement io.Writer interface. Incomplete lines are held back until they are completed,
+// or `Flush` is called.
+func (w *PrefixWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return len(b), err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes the incomplete line held back, if any, to the underlying writer
+func (w *PrefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeLine(append(w.buf, '\n'))
+	w.buf = nil
+	return err
+}
+
+func (w *PrefixWriter) writeLine(line []byte) error {
+	_, err := w.out.Write(append([]byte(w.prefix), line...))
+	return err
+}
+
+// prefixColors are the colors of the output prefixes, picked by the text of the prefix
+var prefixColors = []color.Attribute{color.FgCyan, color.FgMagenta, color.FgYellow, color.FgGreen, color.FgBlue}
+
+// ColorPrefix returns the prefix in one of the colors of prefixes, always the same for the same prefix so that the
+// output of a step keeps its color. It is returned as it is when colored output is disabled, like when the output
+// is not a terminal or with the no-color flag.
+func ColorPrefix(prefix string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(prefix))
+	return color.New(prefixColors[hash.Sum32()%uint32(len(prefixColors))]).Sprint(prefix)
+}
+
+// RedactedSecret is the text that secrets are replaced with in the output
+const RedactedSecret = "****"
+
+// RedactWriter is an io.Writer that replaces secrets in every line of the output before writing it to the
+// underlying writer, so that they are not leaked in the output of commands.
+type RedactWriter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	replacer *strings.Replacer
+	buf      []byte
+}
+
+// NewRedactWriter returns a pointer to new RedactWriter object writing to the given writer
+func NewRedactWriter(out io.Writer, secrets []string) *RedactWriter {
+	return &RedactWriter{out: out, replacer: secretsReplacer(secrets)}
+}
+
+// Write function to implement io.Writer interface. Incomplete lines are held back until they are completed,
+// or `Flush` is called, so that a secret split across writes is still redacted.
+func (w *RedactWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, b...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+	err := w.writeRedacted(w.buf[:i+1])
+	w.buf = w.buf[i+1:]
+	return len(b), err
+}
+
+// Flush writes the incomplete line held back, if any, to the underlying writer
+func (w *RedactWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeRedacted(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *RedactWriter) writeRedacted(b []byte) error {
+	_, err := io.WriteString(w.out, w.replacer.Replace(string(b)))
+	return err
+}
+
+// Redact returns the text with the given secrets replaced
+func Redact(text string, secrets []string) string {
+	return secretsReplacer(secrets).Replace(text)
+}
+
+// secretsReplacer replaces the longest secrets first, so that a secret containing another one is fully redacted
+func secretsReplacer(secrets []string) *strings.Replacer {
+	sorted := append([]string{}, secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	var oldnew []string
+	for _, secret := range sorted {
+		if secret != "" {
+			oldnew = append(oldnew, secret, RedactedSecret)
+		}
+	}
+	return strings.NewReplacer(oldnew...)
+}
@@ -3,9 +3,11 @@ package logger
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
@@ -39,6 +41,52 @@ func TestInitColorOutput_True(t *testing.T) {
 	}
 }
 
+func TestColorPrefix(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+
+	color.NoColor = false
+	colored := ColorPrefix("[build/1]")
+	if !strings.HasPrefix(colored, "\x1b[") || !strings.Contains(colored, "[build/1]") {
+		t.Errorf("expected colored prefix, got: %q", colored)
+	}
+	if again := ColorPrefix("[build/1]"); again != colored {
+		t.Errorf("expected the same color for the same prefix, got: %q and %q", colored, again)
+	}
+
+	color.NoColor = true
+	if plain := ColorPrefix("[build/1]"); plain != "[build/1]" {
+		t.Errorf("expected prefix without color, got: %q", plain)
+	}
+}
+
+func TestInitLogLevel(t *testing.T) {
+	defer func(level logrus.Level) { Log.Level = level }(Log.Level)
+	for _, test := range []struct {
+		level    string
+		verbose  bool
+		quiet    bool
+		expected logrus.Level
+	}{
+		{"", false, false, logrus.InfoLevel},
+		{"", true, false, logrus.DebugLevel},
+		{"warn", false, false, logrus.WarnLevel},
+		{"error", true, false, logrus.ErrorLevel},
+		{"debug", false, true, logrus.ErrorLevel},
+	} {
+		if err := InitLogLevel(test.level, test.verbose, test.quiet); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if Log.Level != test.expected {
+			t.Errorf("expected log level %v with level %q, verbose %t and quiet %t, got: %v", test.expected, test.level, test.verbose, test.quiet, Log.Level)
+		}
+	}
+
+	expected := "dunner: invalid log level 'trace', must be one of: debug, info, warn, error"
+	if err := InitLogLevel("trace", false, false); err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s, got: %v", expected, err)
+	}
+}
+
 func ExampleBullet() {
 	arg := "foobar"
 
@@ -46,3 +94,45 @@ func ExampleBullet() {
 
 	// Output: • setup foobar
 }
+
+func TestPrefixWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewPrefixWriter(buf, "[test] ")
+
+	fmt.Fprint(w, "first line\nsecond ")
+	fmt.Fprint(w, "line\nlast")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[test] first line\n[test] second line\n[test] last\n"
+	if got := buf.String(); got != expected {
+		t.Fatalf("expected: %q, got: %q", expected, got)
+	}
+}
+
+func TestRedactWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewRedactWriter(buf, []string{"s3cr3t", "s3cr3t-token", ""})
+
+	fmt.Fprint(w, "token is s3cr3t-to")
+	fmt.Fprint(w, "ken\npassword is s3c")
+	fmt.Fprint(w, "r3t")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "token is ****\npassword is ****"
+	if got := buf.String(); got != expected {
+		t.Fatalf("expected: %q, got: %q", expected, got)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	if got := Redact("TOKEN=s3cr3t", []string{"s3cr3t"}); got != "TOKEN=****" {
+		t.Fatalf("expected secret to be redacted, got: %q", got)
+	}
+	if got := Redact("TOKEN=s3cr3t", nil); got != "TOKEN=s3cr3t" {
+		t.Fatalf("expected text to be unchanged without secrets, got: %q", got)
+	}
+}
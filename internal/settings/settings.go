@@ -1,6 +1,8 @@
 package settings
 
 import (
+	"time"
+
 	"github.com/leopardslab/dunner/internal"
 
 	"github.com/spf13/viper"
@@ -21,9 +23,13 @@ func Init() {
 	// Automatic binding of environment variables
 	viper.SetEnvPrefix("dunner")
 	viper.AutomaticEnv()
+	// The task file is set with DUNNER_TASK_FILE. It overrides the auto-discovery of the task file, but not the
+	// `--task-file` flag.
+	_ = viper.BindEnv("DunnerTaskFile", "DUNNER_TASK_FILE")
 
 	// Files
 	viper.SetDefault("DunnerTaskFile", internal.DefaultDunnerTaskFileName)
+	viper.SetDefault("Task-file-format", "")
 	viper.SetDefault("DotenvFile", ".env")
 	viper.SetDefault("GlobalLogFile", "/var/log/dunner/logs/")
 	viper.SetDefault("LocalLogFile", nil)
@@ -34,9 +40,33 @@ func Init() {
 	// Modes
 	viper.SetDefault("Async", false)
 	viper.SetDefault("Verbose", false)
+	viper.SetDefault("Log-level", "")
+	viper.SetDefault("Verbose-docker", false)
+	viper.SetDefault("Quiet", false)
 	viper.SetDefault("Dry-run", false)
+	viper.SetDefault("Explain", false)
+	viper.SetDefault("Tasks", false)
 	viper.SetDefault("No-color", false)
 	viper.SetDefault("Force-pull", false)
+	viper.SetDefault("Registry", "")
+	viper.SetDefault("Max-parallel", 1)
+	viper.SetDefault("Output", "text")
+	viper.SetDefault("No-docker-socket", false)
+	viper.SetDefault("No-privileged", false)
+	viper.SetDefault("No-summary", false)
+	viper.SetDefault("No-hooks", false)
+	viper.SetDefault("Fail-fast", true)
+	viper.SetDefault("List-steps", "")
+	viper.SetDefault("Exec-in", "")
+	viper.SetDefault("Init", false)
+	viper.SetDefault("Keep-containers", false)
+	viper.SetDefault("Container-name-template", "")
+	viper.SetDefault("Prefix", false)
+	viper.SetDefault("Color", false)
+	viper.SetDefault("Stop-timeout", 10*time.Second)
+	viper.SetDefault("Timeout", time.Duration(0))
+	viper.SetDefault("Force", false)
+	viper.SetDefault("Force-run", false)
 
 	// Constants
 	viper.SetDefault("DockerAPIVersion", "1.39")
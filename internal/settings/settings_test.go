@@ -2,10 +2,13 @@ package settings
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/leopardslab/dunner/internal"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -13,19 +16,81 @@ func TestInit(t *testing.T) {
 	Init()
 	fmt.Print(viper.AllSettings())
 	defaultSettings := map[string]interface{}{
-		"dunnertaskfile":   internal.DefaultDunnerTaskFileName,
-		"dotenvfile":       ".env",
-		"globallogfile":    "/var/log/dunner/logs/",
-		"workingdirectory": "./",
-		"async":            false,
-		"verbose":          false,
-		"dry-run":          false,
-		"force-pull":       false,
-		"dockerapiversion": "1.39",
-		"no-color":         false,
+		"dunnertaskfile":          internal.DefaultDunnerTaskFileName,
+		"task-file-format":        "",
+		"dotenvfile":              ".env",
+		"globallogfile":           "/var/log/dunner/logs/",
+		"workingdirectory":        "./",
+		"async":                   false,
+		"verbose":                 false,
+		"log-level":               "",
+		"verbose-docker":          false,
+		"quiet":                   false,
+		"dry-run":                 false,
+		"explain":                 false,
+		"tasks":                   false,
+		"force-pull":              false,
+		"registry":                "",
+		"max-parallel":            1,
+		"output":                  "text",
+		"no-docker-socket":        false,
+		"no-privileged":           false,
+		"no-summary":              false,
+		"no-hooks":                false,
+		"fail-fast":               true,
+		"list-steps":              "",
+		"exec-in":                 "",
+		"init":                    false,
+		"keep-containers":         false,
+		"container-name-template": "",
+		"prefix":                  false,
+		"color":                   false,
+		"stop-timeout":            10 * time.Second,
+		"timeout":                 time.Duration(0),
+		"force":                   false,
+		"force-run":               false,
+		"dockerapiversion":        "1.39",
+		"no-color":                false,
 	}
 
 	if !reflect.DeepEqual(viper.AllSettings(), defaultSettings) {
 		t.Fatal("Default not equal to as expected")
 	}
 }
+
+func TestInitWithTaskFileFromEnv(t *testing.T) {
+	defer viper.Reset()
+	if err := os.Setenv("DUNNER_TASK_FILE", "ci.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("DUNNER_TASK_FILE")
+	Init()
+
+	if taskFile := viper.GetString("DunnerTaskFile"); taskFile != "ci.yaml" {
+		t.Fatalf("expected task file of DUNNER_TASK_FILE: ci.yaml, got: %s", taskFile)
+	}
+}
+
+func TestInitWithTaskFileFlagOverridingEnv(t *testing.T) {
+	defer viper.Reset()
+	if err := os.Setenv("DUNNER_TASK_FILE", "ci.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("DUNNER_TASK_FILE")
+	Init()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("task-file", internal.DefaultDunnerTaskFileName, "")
+	if err := viper.BindPFlag("DunnerTaskFile", flags.Lookup("task-file")); err != nil {
+		t.Fatal(err)
+	}
+
+	if taskFile := viper.GetString("DunnerTaskFile"); taskFile != "ci.yaml" {
+		t.Fatalf("expected task file of DUNNER_TASK_FILE when flag is not set: ci.yaml, got: %s", taskFile)
+	}
+	if err := flags.Set("task-file", "build.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if taskFile := viper.GetString("DunnerTaskFile"); taskFile != "build.yaml" {
+		t.Fatalf("expected task file of flag: build.yaml, got: %s", taskFile)
+	}
+}
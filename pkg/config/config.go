@@ -5,9 +5,10 @@ For more information on how to write a task file for Dunner, please refer to the
 following link of an article on Dunner repository's Wiki:
 https://github.com/leopardslab/dunner/dunner/wiki/User-Guide#how-to-write-a-dunner-file
 
-Usage
+# Usage
 
 You can use the library by creating a dunner task file. For example,
+
 	# .dunner.yaml
 	prepare:
 	  - image: node
@@ -28,15 +29,22 @@ package config
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/joho/godotenv"
@@ -54,6 +62,27 @@ var log = logger.Log
 var dotEnv map[string]string
 var hostDirpattern = "`\\$(?P<name>[^`]+)`"
 var hostDirRegex = regexp.MustCompile(hostDirpattern)
+var namedVolumeRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// BuiltinEnvNames are the names of the built-in environment variables describing the step that every step sees
+var BuiltinEnvNames = []string{"DUNNER_TASK", "DUNNER_STEP", "DUNNER_STEP_INDEX"}
+
+// argVariableRegex matches the argument variables of mounts, like `$1` or `${name:-default}`, which are replaced
+// with the arguments only once the step is run
+var argVariableRegex = regexp.MustCompile(`\$([1-9][0-9]*|\{[^}]*\})`)
+
+// argPlaceholder replaces the argument variables of mounts when they are validated
+const argPlaceholder = "\x00"
+
+var stdin io.Reader = os.Stdin
+var defaultShell = "sh -c"
+var envVarRegex = regexp.MustCompile(`\$\$\{?|\$\{[A-Za-z_][A-Za-z0-9_]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var cacheNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+var platformRegex = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+var sysctlRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-zA-Z0-9_-]+)+$`)
+var imageDigestRegex = regexp.MustCompile(`^(sha256:[a-f0-9]{64}|sha512:[a-f0-9]{128})$`)
+var unknownFieldRegex = regexp.MustCompile(`^(line \d+): field (\S+) not found in type config\.(\w+)$`)
 
 var (
 	uni                     *ut.UniversalTranslator
@@ -90,11 +119,147 @@ var customValidations = []customValidation{
 		validationFn: ParseMountDir,
 	},
 	{
-		tag:         "required_without",
-		translation: "image is required, unless the task has a `follow` field",
+		tag:          "without_image",
+		translation:  "image cannot be given along with build context '{0}', only one of them is allowed",
+		validationFn: ValidateWithoutImage,
+	},
+	{
+		tag:          "builddir",
+		translation:  "build context '{0}' is invalid. Check if the directory exists.",
+		validationFn: ParseBuildDir,
+	},
+	{
+		tag:          "memory",
+		translation:  "memory limit '{0}' is invalid. Use a positive number with an optional unit suffix like 512m or 2g",
+		validationFn: ValidateMemory,
+	},
+	{
+		tag:          "ulimits",
+		translation:  "ulimits are invalid. Use names like nofile with a limit, or soft:hard limits like 1024:65536 with the soft limit not greater than the hard one",
+		validationFn: ValidateUlimits,
+	},
+	{
+		tag:          "sysctls",
+		translation:  "sysctls are invalid. Use namespaced kernel parameters like net.ipv4.ip_forward or kernel.shmmax with a value",
+		validationFn: ValidateSysctls,
+	},
+	{
+		tag:          "backoffstrategy",
+		translation:  "backoff strategy '{0}' is invalid. It must be one of: fixed, exponential",
+		validationFn: ValidateBackoffStrategy,
+	},
+	{
+		tag:          "interactive",
+		translation:  "an interactive step cannot be given stdin, its input is the terminal",
+		validationFn: ValidateInteractive,
+	},
+	{
+		tag:          "envname",
+		translation:  "'{0}' is not a valid name of an environment variable. Use letters, digits and underscores, not starting with a digit",
+		validationFn: ValidateEnvName,
+	},
+	{
+		tag:          "captureas",
+		translation:  "captureAs '{0}' is invalid. Use the name of an environment variable like GIT_SHA, on a step that is not interactive",
+		validationFn: ValidateCaptureAs,
+	},
+	{
+		tag:          "commitas",
+		translation:  "commitAs image '{0}' is invalid. Use an image name with an optional tag like myimage:tag",
+		validationFn: ValidateCommitAs,
+	},
+	{
+		tag:          "gpus",
+		translation:  "gpus '{0}' is invalid. Use all, a number of GPUs, or device= followed by the IDs of the GPUs like device=0,1",
+		validationFn: ValidateGPUs,
+	},
+	{
+		tag:          "tmpfs",
+		translation:  "tmpfs mount '{0}' is invalid. Use an absolute path with the options size and mode, like /scratch:size=64m,mode=1777",
+		validationFn: ValidateTmpfs,
+	},
+	{
+		tag:          "extrahost",
+		translation:  "extra host '{0}' is invalid. Use the form host:ip, like myhost:10.0.0.5",
+		validationFn: ValidateExtraHost,
+	},
+	{
+		tag:          "dns",
+		translation:  "DNS server '{0}' is invalid. Use an IP address, like 10.0.0.2",
+		validationFn: ValidateDNS,
+	},
+	{
+		tag:          "platform",
+		translation:  "platform '{0}' is invalid. Use os/arch with an optional variant, like linux/arm64 or linux/arm/v7",
+		validationFn: ValidatePlatform,
+	},
+	{
+		tag:          "stopsignal",
+		translation:  "stop signal '{0}' is invalid. Use the name of a signal, like SIGTERM or SIGQUIT",
+		validationFn: ValidateStopSignal,
+	},
+	{
+		tag:          "glob",
+		translation:  "input '{0}' is invalid. Use a glob pattern like src/*.go",
+		validationFn: ValidateGlob,
+	},
+	{
+		tag:          "cache",
+		translation:  "cache '{0}' is invalid. Use a name and an absolute path, like gomod:/go/pkg/mod",
+		validationFn: ValidateCache,
+	},
+	{
+		tag:          "pullpolicy",
+		translation:  "pull policy '{0}' is invalid. It must be one of: always, missing, never",
+		validationFn: ValidatePullPolicy,
+	},
+	{
+		tag:          "commanderrormode",
+		translation:  "command error mode '{0}' is invalid. It must be one of: abort, continue",
+		validationFn: ValidateCommandErrorMode,
+	},
+	{
+		tag:          "waitfor",
+		translation:  "waitFor needs either an address of the form host:port or a command, but not both",
+		validationFn: ValidateWaitFor,
+	},
+	{
+		tag:          "registryauth",
+		translation:  "registry auth needs either a username and a password or a token, but not both",
+		validationFn: ValidateRegistryAuth,
+	},
+	{
+		tag:          "stdinfile",
+		translation:  "stdin '{0}' refers to a file that does not exist",
+		validationFn: ValidateStdinFile,
+	},
+	{
+		tag:          "imagedigest",
+		translation:  "image '{0}' has an invalid digest. Pin it like image@sha256:<64 hexadecimal characters>",
+		validationFn: ValidateImageDigest,
+	},
+	{
+		tag:          "followon",
+		translation:  "follow condition '{0}' is invalid. It must be one of: success, failure, always, on a step with `follow`",
+		validationFn: ValidateFollowOn,
+	},
+	{
+		tag:          "argtype",
+		translation:  "argument type '{0}' is invalid. It must be one of: string, int, bool",
+		validationFn: ValidateArgType,
+	},
+	{
+		tag:         "required_without_all",
+		translation: "image is required, unless the task has a `follow` or `build` field",
 	},
 }
 
+// BaseDir returns the directory of the task file, against which relative mount sources are resolved. It is
+// empty if the configs are not read from a task file, in which case they are resolved against the current directory.
+func (configs *Configs) BaseDir() string {
+	return configs.baseDir
+}
+
 // Validate validates config and returns errors.
 func (configs *Configs) Validate() []error {
 	err := initValidator(customValidations)
@@ -105,27 +270,180 @@ func (configs *Configs) Validate() []error {
 	errs := formatErrors(valErrs, "")
 	ctx := context.WithValue(context.Background(), configsKey, configs)
 
-	// Each step is validated separately so that task name can be added in error messages
-	for taskName, task := range configs.Tasks {
-		for _, steps := range task.Steps {
-			taskValErrs := govalidator.VarCtx(ctx, steps, "dive")
-			errs = append(errs, formatErrors(taskValErrs, taskName)...)
+	// Each step is validated separately so that task name and step number can be added in error messages
+	for _, taskName := range configs.TaskNames() {
+		task := configs.Tasks[taskName]
+		if len(task.Steps) == 0 {
+			errs = append(errs, fmt.Errorf("task '%s': at least one step is required", taskName))
+		}
+		argValErrs := govalidator.VarCtx(ctx, task.Args, "dive")
+		errs = append(errs, formatErrors(argValErrs, fmt.Sprintf("task '%s'", taskName))...)
+		errs = append(errs, validateTaskArgs(taskName, task.Args)...)
+		matrixValErrs := govalidator.VarCtx(ctx, task.Matrix, "dive,keys,envname,endkeys")
+		errs = append(errs, formatErrors(matrixValErrs, fmt.Sprintf("task '%s'", taskName))...)
+		for _, values := range task.Matrix {
+			if len(values) == 0 {
+				errs = append(errs, fmt.Errorf("task '%s': every variable of the matrix needs at least one value", taskName))
+				break
+			}
+		}
+		for i, step := range task.Steps {
+			stepValErrs := govalidator.VarCtx(ctx, step, "dive")
+			errs = append(errs, formatErrors(stepValErrs, fmt.Sprintf("task '%s', step %d", taskName, i+1))...)
+		}
+	}
+	for i, step := range configs.Before {
+		stepValErrs := govalidator.VarCtx(ctx, step, "dive")
+		errs = append(errs, formatErrors(stepValErrs, fmt.Sprintf("before hook, step %d", i+1))...)
+	}
+	for i, step := range configs.After {
+		stepValErrs := govalidator.VarCtx(ctx, step, "dive")
+		errs = append(errs, formatErrors(stepValErrs, fmt.Sprintf("after hook, step %d", i+1))...)
+	}
+	errs = append(errs, configs.validateFollowCycles()...)
+	for _, taskName := range configs.TaskNames() {
+		errs = append(errs, validateStepNeeds(taskName, configs.Tasks[taskName].Steps)...)
+	}
+	return append(configs.unknownFields, errs...)
+}
+
+// validateFollowCycles detects tasks that follow each other in a cycle, directly or through other tasks,
+// which would otherwise make the execution recurse endlessly. Each cycle is reported once.
+func (configs *Configs) validateFollowCycles() []error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var errs []error
+	var chain []string
+	state := make(map[string]int)
+	var visit func(taskName string)
+	visit = func(taskName string) {
+		state[taskName] = visiting
+		chain = append(chain, taskName)
+		for _, step := range configs.Tasks[taskName].Steps {
+			follow := strings.TrimSpace(step.Follow)
+			if _, exists := configs.Tasks[follow]; !exists {
+				continue
+			}
+			switch state[follow] {
+			case visiting:
+				var start int
+				for start = range chain {
+					if chain[start] == follow {
+						break
+					}
+				}
+				cycle := append(append([]string{}, chain[start:]...), follow)
+				errs = append(errs, fmt.Errorf("dunner: cyclic task dependency detected: %s", strings.Join(cycle, " -> ")))
+			case unvisited:
+				visit(follow)
+			}
+		}
+		chain = chain[:len(chain)-1]
+		state[taskName] = visited
+	}
+	for _, taskName := range configs.TaskNames() {
+		if state[taskName] == unvisited {
+			visit(taskName)
+		}
+	}
+	return errs
+}
+
+// validateStepNeeds verifies that the steps needed by the steps of a task exist in the task, that setup steps only
+// need the setup steps before them, as they run one after the other, and that steps do not need each other in a
+// cycle, which would make them wait for each other endlessly.
+func validateStepNeeds(taskName string, steps []Step) []error {
+	var errs []error
+	stepsByName := make(map[string]Step)
+	indexes := make(map[string]int)
+	for i, step := range steps {
+		if _, exists := stepsByName[step.Name]; step.Name != "" && !exists {
+			stepsByName[step.Name], indexes[step.Name] = step, i
+		}
+	}
+	for i, step := range steps {
+		for _, need := range step.Needs {
+			needed, exists := stepsByName[need]
+			if !exists {
+				errs = append(errs, fmt.Errorf("task '%s', step %d: needed step '%s' does not exist in the task", taskName, i+1, need))
+			} else if step.Setup && (!needed.Setup || indexes[need] > i) {
+				errs = append(errs, fmt.Errorf("task '%s', step %d: setup step cannot need step '%s', which is not a setup step before it", taskName, i+1, need))
+			}
+		}
+	}
+
+	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var chain []string
+	var visit func(name string)
+	visit = func(name string) {
+		visiting[name] = true
+		chain = append(chain, name)
+		for _, need := range stepsByName[name].Needs {
+			if _, exists := stepsByName[need]; !exists || visited[need] {
+				continue
+			}
+			if visiting[need] {
+				var start int
+				for start = range chain {
+					if chain[start] == need {
+						break
+					}
+				}
+				cycle := append(append([]string{}, chain[start:]...), need)
+				errs = append(errs, fmt.Errorf("dunner: cyclic step dependency detected in '%s' task: %s", taskName, strings.Join(cycle, " -> ")))
+				continue
+			}
+			visit(need)
+		}
+		chain = chain[:len(chain)-1]
+		visiting[name] = false
+		visited[name] = true
+	}
+	for _, step := range steps {
+		if _, exists := stepsByName[step.Name]; exists && !visited[step.Name] {
+			visit(step.Name)
+		}
+	}
+	return errs
+}
+
+// validateTaskArgs verifies that the arguments of a task have distinct names, and that no required argument
+// comes after an optional one, as arguments are passed in order.
+func validateTaskArgs(taskName string, args []TaskArg) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	var optional string
+	for _, arg := range args {
+		if seen[arg.Name] {
+			errs = append(errs, fmt.Errorf("task '%s': argument '%s' is given more than once", taskName, arg.Name))
+		}
+		seen[arg.Name] = true
+		if !arg.Required {
+			if optional == "" {
+				optional = arg.Name
+			}
+		} else if optional != "" {
+			errs = append(errs, fmt.Errorf("task '%s': required argument '%s' cannot come after the optional argument '%s'", taskName, arg.Name, optional))
 		}
 	}
 	return errs
 }
 
-func formatErrors(valErrs error, taskName string) []error {
+func formatErrors(valErrs error, location string) []error {
 	var errs []error
 	if valErrs != nil {
 		if _, ok := valErrs.(*validator.InvalidValidationError); ok {
 			errs = append(errs, valErrs)
 		} else {
 			for _, e := range valErrs.(validator.ValidationErrors) {
-				if taskName == "" {
+				if location == "" {
 					errs = append(errs, fmt.Errorf(e.Translate(trans)))
 				} else {
-					errs = append(errs, fmt.Errorf("task '%s': %s", taskName, e.Translate(trans)))
+					errs = append(errs, fmt.Errorf("%s: %s", location, e.Translate(trans)))
 				}
 			}
 		}
@@ -170,10 +488,13 @@ func initValidator(customValidations []customValidation) error {
 }
 
 // ValidateMountDir verifies that mount values are in proper format
-//		<source>:<destination>:<mode>
-// Format should match, <mode> is optional which is `readOnly` by default and `src` directory exists in host machine
+//
+//	<source>:<destination>:<mode>
+//
+// Format should match, <mode> is optional which is `readOnly` by default and `src` directory exists in host machine.
+// The mode can be followed by the consistency and propagation options of the mount, see `parseMountOptions`.
 func ValidateMountDir(ctx context.Context, fl validator.FieldLevel) bool {
-	value := fl.Field().String()
+	value := argVariableRegex.ReplaceAllString(fl.Field().String(), argPlaceholder)
 	f := func(c rune) bool { return c == ':' }
 	mountValues := strings.FieldsFunc(value, f)
 	if len(mountValues) != 3 {
@@ -182,13 +503,8 @@ func ValidateMountDir(ctx context.Context, fl validator.FieldLevel) bool {
 	if len(mountValues) != 3 {
 		return false
 	}
-	validPerm := false
-	for _, perm := range validDirPermissionModes {
-		if mountValues[2] == perm {
-			validPerm = true
-		}
-	}
-	return validPerm
+	options, err := parseMountOptions(mountValues[2])
+	return err == nil && (options.propagation == "" || !isNamedVolume(mountValues[0]))
 }
 
 // ValidateFollowTaskPresent verifies that referenceed task exists
@@ -203,146 +519,1129 @@ func ValidateFollowTaskPresent(ctx context.Context, fl validator.FieldLevel) boo
 	return false
 }
 
-// ParseMountDir verifies that source directory exists and parses the environment variables used in the config
+// ParseMountDir verifies that source directory exists and parses the environment variables used in the config.
+// A source with argument variables is not checked.
 func ParseMountDir(ctx context.Context, fl validator.FieldLevel) bool {
-	value := fl.Field().String()
+	value := argVariableRegex.ReplaceAllString(fl.Field().String(), argPlaceholder)
 	f := func(c rune) bool { return c == ':' }
 	mountValues := strings.FieldsFunc(value, f)
 	if len(mountValues) == 0 {
 		return false
 	}
+	if strings.Contains(mountValues[0], argPlaceholder) {
+		// The source is only known once the arguments are passed
+		return true
+	}
 	parsedDir, err := lookupDirectory(mountValues[0])
 	if err != nil {
 		return false
 	}
-	return util.DirExists(parsedDir)
+	if isNamedVolume(parsedDir) {
+		return true
+	}
+	var baseDir string
+	if configs, ok := ctx.Value(configsKey).(*Configs); ok {
+		baseDir = configs.baseDir
+	}
+	src, err := mountSource(parsedDir, baseDir)
+	return err == nil && util.DirExists(src)
 }
 
-// GetConfigs reads and parses tasks from the dunner task file.
-// The task file is unmarshalled to an object of struct `Config`
-// The default filename that is being read by Dunner during the time of execution is `dunner.yaml`,
-// but it can be changed using `--task-file` flag in the CLI.
-func GetConfigs(filename string) (*Configs, error) {
-	taskFile, err := getDunnerTaskFile(filename)
-	if err != nil {
-		return nil, err
+// ValidateWithoutImage verifies that image is not given for a step whose image is built
+func ValidateWithoutImage(ctx context.Context, fl validator.FieldLevel) bool {
+	return fl.Parent().FieldByName("Image").String() == ""
+}
+
+// ValidateMemory verifies that the memory limit is a positive number of bytes, with an optional unit suffix
+func ValidateMemory(ctx context.Context, fl validator.FieldLevel) bool {
+	_, err := ParseMemory(fl.Field().String())
+	return err == nil
+}
+
+// ValidateUlimits verifies that the ulimits have known names and valid limits
+func ValidateUlimits(ctx context.Context, fl validator.FieldLevel) bool {
+	ulimits, ok := fl.Field().Interface().(map[string]string)
+	if !ok {
+		return false
 	}
+	_, err := ParseUlimits(ulimits)
+	return err == nil
+}
 
-	fileContents, err := ioutil.ReadFile(taskFile)
+// ValidateSysctls verifies that the sysctls are kernel parameters of the namespaces of the container, which are the
+// only ones it can set, each with a value
+func ValidateSysctls(ctx context.Context, fl validator.FieldLevel) bool {
+	sysctls, ok := fl.Field().Interface().(map[string]string)
+	if !ok {
+		return false
+	}
+	for name, value := range sysctls {
+		if !sysctlRegex.MatchString(name) || !namespacedSysctl(name) || strings.TrimSpace(value) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// namespacedSysctl returns whether the kernel parameter is one of a namespace of the container, those of the network,
+// of the POSIX message queues and of the IPC
+func namespacedSysctl(name string) bool {
+	switch name {
+	case "kernel.msgmax", "kernel.msgmnb", "kernel.msgmni", "kernel.sem", "kernel.shmall", "kernel.shmmax", "kernel.shmmni", "kernel.shm_rmid_forced":
+		return true
+	}
+	return strings.HasPrefix(name, "net.") || strings.HasPrefix(name, "fs.mqueue.")
+}
+
+// ValidateBackoffStrategy verifies that the backoff strategy is one of BackoffFixed and BackoffExponential
+func ValidateBackoffStrategy(ctx context.Context, fl validator.FieldLevel) bool {
+	switch fl.Field().String() {
+	case BackoffFixed, BackoffExponential:
+		return true
+	}
+	return false
+}
+
+// ValidateInteractive verifies that an interactive step is not given stdin, as its input is the terminal
+func ValidateInteractive(ctx context.Context, fl validator.FieldLevel) bool {
+	return fl.Parent().FieldByName("Stdin").String() == ""
+}
+
+// ValidateEnvName verifies that the value is a valid name of an environment variable
+func ValidateEnvName(ctx context.Context, fl validator.FieldLevel) bool {
+	return envNameRegex.MatchString(fl.Field().String())
+}
+
+// ValidateCaptureAs verifies that the output of the step is captured as a valid name of an environment variable,
+// and that the step is not interactive, as the output of an interactive step is the terminal
+func ValidateCaptureAs(ctx context.Context, fl validator.FieldLevel) bool {
+	return envNameRegex.MatchString(fl.Field().String()) && !fl.Parent().FieldByName("Interactive").Bool()
+}
+
+// ValidateCommitAs verifies that the image to commit the container to is a valid image name, with an optional tag
+// but no digest as the digest is only known once the image is committed
+func ValidateCommitAs(ctx context.Context, fl validator.FieldLevel) bool {
+	named, err := reference.ParseNormalizedNamed(fl.Field().String())
 	if err != nil {
-		return nil, err
+		return false
 	}
+	_, hasDigest := named.(reference.Digested)
+	return !hasDigest
+}
 
-	var configs Configs
-	if err := yaml.Unmarshal(fileContents, &configs); err != nil {
-		return nil, err
+// ValidateGPUs verifies that the GPUs are either all, a positive number of GPUs or a list of IDs of GPUs
+func ValidateGPUs(ctx context.Context, fl validator.FieldLevel) bool {
+	_, err := ParseGPUs(fl.Field().String())
+	return err == nil
+}
+
+// ValidateTmpfs verifies that the tmpfs mount has an absolute target and only known options with valid values
+func ValidateTmpfs(ctx context.Context, fl validator.FieldLevel) bool {
+	_, err := ParseTmpfs(fl.Field().String())
+	return err == nil
+}
+
+// ValidateExtraHost verifies that the extra host is of the form host:ip, the IP being either an IPv4 or IPv6
+// address or `host-gateway`
+func ValidateExtraHost(ctx context.Context, fl validator.FieldLevel) bool {
+	// IPv6 addresses contain colons, so the host is everything before the first one
+	parts := strings.SplitN(fl.Field().String(), ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return false
 	}
+	return parts[1] == hostGateway || net.ParseIP(parts[1]) != nil
+}
 
-	loadDotEnv()
-	if err := ParseEnvs(&configs); err != nil {
-		return nil, err
+// hostGateway is the IP of an extra host resolved by Docker to the IP of the host
+const hostGateway = "host-gateway"
+
+// ValidateDNS verifies that the DNS server is an IPv4 or IPv6 address
+func ValidateDNS(ctx context.Context, fl validator.FieldLevel) bool {
+	return net.ParseIP(fl.Field().String()) != nil
+}
+
+// ValidatePlatform verifies that the platform is of the form os/arch, with an optional variant
+func ValidatePlatform(ctx context.Context, fl validator.FieldLevel) bool {
+	return platformRegex.MatchString(fl.Field().String())
+}
+
+// ValidateStopSignal verifies that the stop signal is the name of a known signal, with or without the `SIG` prefix
+func ValidateStopSignal(ctx context.Context, fl validator.FieldLevel) bool {
+	return knownSignals[strings.TrimPrefix(fl.Field().String(), "SIG")]
+}
+
+// knownSignals are the names of the signals that can be sent to a container, without the `SIG` prefix
+var knownSignals = map[string]bool{
+	"ABRT": true, "ALRM": true, "BUS": true, "CHLD": true, "CONT": true, "FPE": true, "HUP": true, "ILL": true,
+	"INT": true, "IO": true, "KILL": true, "PIPE": true, "PROF": true, "PWR": true, "QUIT": true, "SEGV": true,
+	"STKFLT": true, "STOP": true, "SYS": true, "TERM": true, "TRAP": true, "TSTP": true, "TTIN": true, "TTOU": true,
+	"URG": true, "USR1": true, "USR2": true, "VTALRM": true, "WINCH": true, "XCPU": true, "XFSZ": true,
+}
+
+// ValidateGlob verifies that the input is a valid glob pattern
+func ValidateGlob(ctx context.Context, fl validator.FieldLevel) bool {
+	pattern := fl.Field().String()
+	_, err := filepath.Match(pattern, "")
+	return pattern != "" && err == nil
+}
+
+// ValidateCache verifies that the cache has a valid name and an absolute path
+func ValidateCache(ctx context.Context, fl validator.FieldLevel) bool {
+	_, _, err := ParseCache(fl.Field().String())
+	return err == nil
+}
+
+// ValidatePullPolicy verifies that the pull policy is one of the ones known to the docker layer
+func ValidatePullPolicy(ctx context.Context, fl validator.FieldLevel) bool {
+	switch fl.Field().String() {
+	case docker.PullAlways, docker.PullMissing, docker.PullNever:
+		return true
 	}
+	return false
+}
 
-	return &configs, nil
+// ValidateCommandErrorMode verifies that the command error mode is one of the ones known to the docker layer
+func ValidateCommandErrorMode(ctx context.Context, fl validator.FieldLevel) bool {
+	switch fl.Field().String() {
+	case docker.CommandErrorAbort, docker.CommandErrorContinue:
+		return true
+	}
+	return false
 }
 
-// getDunnerTaskFile returns the dunner task file path.
-// If `filename` is not default task file, it returns as-is.
-// It returns task file in current directory if exists
-// this routine keeps going upwards searching for task file
-func getDunnerTaskFile(filename string) (string, error) {
-	if internal.DefaultDunnerTaskFileName != filename {
-		return filename, nil
+// ValidateRegistryAuth verifies that the credentials of a registry are either a username and a password or a token
+func ValidateRegistryAuth(ctx context.Context, fl validator.FieldLevel) bool {
+	hasUsername := fl.Field().String() != ""
+	hasPassword := fl.Parent().FieldByName("Password").String() != ""
+	if fl.Parent().FieldByName("Token").String() != "" {
+		return !hasUsername && !hasPassword
 	}
-	dir, err := os.Getwd()
-	if err != nil {
-		return "", err
+	return hasUsername && hasPassword
+}
+
+// ValidateStdinFile verifies that the file of the stdin of a step exists, if the stdin is given as `@file`
+func ValidateStdinFile(ctx context.Context, fl validator.FieldLevel) bool {
+	var baseDir string
+	if configs, ok := ctx.Value(configsKey).(*Configs); ok {
+		baseDir = configs.baseDir
 	}
-	failErr := fmt.Errorf("failed to find Dunner task file")
+	file, isFile := StdinFile(fl.Field().String(), baseDir)
+	return !isFile || util.FileExists(file)
+}
 
-	for {
-		taskFile := filepath.Join(dir, internal.DefaultDunnerTaskFileName)
-		if util.FileExists(taskFile) {
-			return taskFile, nil
-		}
-		if dir == filepath.Clean(fmt.Sprintf("%c", os.PathSeparator)) || dir == "" {
-			return "", failErr
-		}
-		oldDir := dir
-		dir = filepath.Clean(fmt.Sprintf("%s%c..", dir, os.PathSeparator))
-		if dir == oldDir {
-			return "", failErr
-		}
+// ValidateImageDigest verifies that the digest of the image, if it is pinned by digest, is a sha256 or sha512 digest
+func ValidateImageDigest(ctx context.Context, fl validator.FieldLevel) bool {
+	image := fl.Field().String()
+	if !strings.Contains(image, "@") {
+		return true
 	}
+	_, digest := docker.SplitDigest(image)
+	return imageDigestRegex.MatchString(digest)
 }
 
-func loadDotEnv() {
-	file := viper.GetString("DotenvFile")
-	var err error
-	dotEnv, err = godotenv.Read(file)
-	if err != nil {
-		log.Infof("No environment loaded from %s file: Not found", file)
+// ValidateFollowOn verifies that the condition of running a follow task is a known one, given on a follow step
+func ValidateFollowOn(ctx context.Context, fl validator.FieldLevel) bool {
+	if fl.Parent().FieldByName("Follow").String() == "" {
+		return false
+	}
+	switch fl.Field().String() {
+	case FollowOnSuccess, FollowOnFailure, FollowOnAlways:
+		return true
 	}
+	return false
 }
 
-// ParseEnvs parses the `.env` file as well as the host environment variables.
-// If the same variable is defined in both the `.env` file and in the host environment,
-// priority is given to the .env file.
-//
-// Note: You can change the filename of environment file (default: `.env`) using `--env-file/-e` flag in the CLI.
-func ParseEnvs(configs *Configs) error {
+// ValidateArgType verifies that the type of a task argument is one of the types arguments are checked against
+func ValidateArgType(ctx context.Context, fl validator.FieldLevel) bool {
+	switch fl.Field().String() {
+	case ArgString, ArgInt, ArgBool:
+		return true
+	}
+	return false
+}
 
-	// Parse envs that are global to all
-	for i, envVar := range (*configs).Envs {
-		newEnv, err := obtainEnv(envVar)
+// ValidateWaitFor verifies that exactly one of the address and the command to wait for is given, and that the
+// address is of the form host:port
+func ValidateWaitFor(ctx context.Context, fl validator.FieldLevel) bool {
+	address := fl.Field().String()
+	hasCommand := fl.Parent().FieldByName("Command").Len() > 0
+	if address == "" {
+		return hasCommand
+	}
+	_, _, err := net.SplitHostPort(address)
+	return err == nil && !hasCommand
+}
+
+// ParseMemory returns the number of bytes of a memory limit like `512m`, using the usual Docker unit suffixes
+func ParseMemory(memory string) (int64, error) {
+	bytes, err := units.RAMInBytes(memory)
+	if err != nil {
+		return 0, fmt.Errorf("config: invalid memory limit '%s': %s", memory, err.Error())
+	}
+	if bytes <= 0 {
+		return 0, fmt.Errorf("config: invalid memory limit '%s': must be greater than zero", memory)
+	}
+	return bytes, nil
+}
+
+// ParseUlimits returns the ulimits of a step for the container, sorted by name. A limit is either one number, both
+// the soft and hard limit, or `soft:hard`.
+func ParseUlimits(ulimits map[string]string) ([]*units.Ulimit, error) {
+	var names []string
+	for name := range ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parsed []*units.Ulimit
+	for _, name := range names {
+		ulimit, err := units.ParseUlimit(name + "=" + ulimits[name])
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("config: invalid ulimit %s '%s': %s", name, ulimits[name], err.Error())
 		}
-		(*configs).Envs[i] = newEnv
+		parsed = append(parsed, ulimit)
 	}
-	for k, tasks := range (*configs).Tasks {
+	return parsed, nil
+}
 
-		// Parse envs that are global to all steps of 'k' task
-		for i, envVar := range tasks.Envs {
-			newEnv, err := obtainEnv(envVar)
-			if err != nil {
-				return err
+// ParseGPUs returns the request of the GPUs of a step for the container, the GPUs being either `all`, a number of
+// GPUs, or `device=` followed by the comma separated IDs of the GPUs.
+func ParseGPUs(gpus string) (container.DeviceRequest, error) {
+	request := container.DeviceRequest{Capabilities: [][]string{{"gpu"}}}
+	switch {
+	case gpus == "all":
+		request.Count = -1
+	case strings.HasPrefix(gpus, "device="):
+		for _, id := range strings.Split(strings.TrimPrefix(gpus, "device="), ",") {
+			if id == "" {
+				return container.DeviceRequest{}, fmt.Errorf("config: invalid gpus '%s': the IDs of the GPUs cannot be empty", gpus)
 			}
-			(*configs).Tasks[k].Envs[i] = newEnv
+			request.DeviceIDs = append(request.DeviceIDs, id)
 		}
-
-		for j, step := range tasks.Steps {
-
-			// Parse envs that are defined for an individual step
-			for i, envVar := range step.Envs {
-				newEnv, err := obtainEnv(envVar)
-				if err != nil {
-					return err
-				}
-				(*configs).Tasks[k].Steps[j].Envs[i] = newEnv
-			}
+	default:
+		count, err := strconv.Atoi(gpus)
+		if err != nil || count <= 0 {
+			return container.DeviceRequest{}, fmt.Errorf("config: invalid gpus '%s': must be all, a positive number of GPUs, or device= followed by the IDs of the GPUs", gpus)
 		}
+		request.Count = count
 	}
+	return request, nil
+}
 
-	return nil
+// ParseBuildDir verifies that the build context directory exists, after parsing the environment variables used in it
+func ParseBuildDir(ctx context.Context, fl validator.FieldLevel) bool {
+	parsedDir, err := lookupDirectory(fl.Field().String())
+	if err != nil {
+		return false
+	}
+	return util.DirExists(parsedDir)
 }
 
-func obtainEnv(envVar string) (string, error) {
-	var str = strings.Split(envVar, "=")
-	if len(str) != 2 {
-		return "", fmt.Errorf(
-			`config: invalid format of environment variable: %v`,
-			envVar,
-		)
+// GetConfigs reads and parses tasks from the dunner task file.
+// The task file is unmarshalled to an object of struct `Config`
+// The default filename that is being read by Dunner during the time of execution is `dunner.yaml`,
+// but it can be changed using `--task-file` flag in the CLI. With `--task-file -`, the task file is read from stdin.
+// Task files ending in `.json` or `.toml` are read as JSON or TOML, and YAML otherwise, unless `--task-file-format`
+// is given, which is needed for a task file read from stdin.
+// The task file is given by the `--task-file` flag, else by the DUNNER_TASK_FILE environment variable, else the
+// first `.dunner.yaml` or `dunner.yaml` found in the current directory or its parents.
+func GetConfigs(filename string) (*Configs, error) {
+	fileContents, taskFile, err := readTaskFile(filename)
+	if err != nil {
+		return nil, err
 	}
-	var pattern = "^`\\$.+`$"
-	check, err := regexp.MatchString(pattern, str[1])
+
+	baseDir, err := filepath.Abs(".")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	if check {
-		var key = strings.Replace(
-			strings.Replace(
+	var including []string
+	if taskFile != "" {
+		if taskFile, err = filepath.Abs(taskFile); err != nil {
+			return nil, err
+		}
+		baseDir = filepath.Dir(taskFile)
+		including = []string{taskFile}
+	}
+
+	loadDotEnv()
+	configs, err := loadTaskFile(fileContents, baseDir, including)
+	if err != nil {
+		return nil, err
+	}
+	configs.baseDir = baseDir
+	return configs, nil
+}
+
+// readTaskFile returns the contents of the task file, along with its path. The task file is read from the
+// standard input if the filename is `-`, its path being empty then.
+func readTaskFile(filename string) ([]byte, string, error) {
+	if filename == internal.StdinTaskFileName {
+		fileContents, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, "", fmt.Errorf("config: failed to read task file from stdin: %s", err.Error())
+		}
+		fileContents, err = convertTaskFile(fileContents, "")
+		return fileContents, "", err
+	}
+
+	taskFile, err := getDunnerTaskFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	fileContents, err := ioutil.ReadFile(taskFile)
+	if err != nil {
+		return nil, "", err
+	}
+	fileContents, err = convertTaskFile(fileContents, taskFile)
+	return fileContents, taskFile, err
+}
+
+// convertTaskFile converts the contents of the task file to YAML, as per the format of the task file
+func convertTaskFile(fileContents []byte, taskFile string) ([]byte, error) {
+	format, err := taskFileFormat(taskFile)
+	if err != nil {
+		return nil, err
+	}
+	return toYAML(fileContents, format)
+}
+
+// loadTaskFile parses the contents of a task file of the directory baseDir, merged on top of the task files it
+// includes. The paths of the task files including it, down to it, are given to detect cyclic includes.
+// Relative paths of env files and includes are resolved against the directory of the task file they are in,
+// while the other relative paths are resolved against the directory of the task file run.
+func loadTaskFile(fileContents []byte, baseDir string, including []string) (*Configs, error) {
+	var configs Configs
+	if err := yaml.Unmarshal(fileContents, &configs); err != nil {
+		return nil, err
+	}
+	configs.taskOrder = parseTaskOrder(fileContents)
+	configs.unknownFields = parseUnknownFields(fileContents)
+
+	// Included task files are loaded first, for the steps of this one to use their templates
+	var merged Configs
+	for _, include := range configs.Include {
+		includedFile := include
+		if !filepath.IsAbs(includedFile) {
+			includedFile = filepath.Join(baseDir, includedFile)
+		}
+		for i, taskFile := range including {
+			if taskFile == includedFile {
+				chain := append(append([]string{}, including[i:]...), includedFile)
+				return nil, fmt.Errorf("config: cyclic include of task file %s: %s", include, strings.Join(chain, " -> "))
+			}
+		}
+		includedContents, err := ioutil.ReadFile(includedFile)
+		if err == nil {
+			includedContents, err = toYAML(includedContents, extensionFormat(includedFile))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config: failed to read included task file %s: %s", include, err.Error())
+		}
+		included, err := loadTaskFile(includedContents, filepath.Dir(includedFile), append(including[:len(including):len(including)], includedFile))
+		if err != nil {
+			return nil, err
+		}
+		for i, fieldErr := range included.unknownFields {
+			included.unknownFields[i] = fmt.Errorf("%s: %s", include, fieldErr.Error())
+		}
+		merged.merge(included)
+	}
+
+	templates := make(map[string]Step)
+	for _, source := range []map[string]Step{merged.Templates, configs.Templates} {
+		for name, template := range source {
+			templates[name] = template
+		}
+	}
+	if err := configs.applyTemplates(templates); err != nil {
+		return nil, err
+	}
+	configs.applyTaskImages()
+	configs.applyShells()
+
+	if err := readEnvFiles(&configs, baseDir); err != nil {
+		return nil, err
+	}
+	if err := ParseEnvs(&configs); err != nil {
+		return nil, err
+	}
+	loadEnvFiles(&configs)
+	if len(configs.Include) == 0 {
+		return &configs, nil
+	}
+	merged.merge(&configs)
+	merged.Include = configs.Include
+	return &merged, nil
+}
+
+// merge merges the tasks and globals of other configs into the configs, those of other taking precedence. Lists
+// are appended to, but DNS servers and search domains are replaced, as are tasks, templates, labels and
+// credentials of the same name. The environment variables of other come first, as the first of the variables of
+// the same key is the one passed.
+func (configs *Configs) merge(other *Configs) {
+	configs.Envs = append(append([]string{}, other.Envs...), configs.Envs...)
+	configs.InheritEnv = append(append([]string{}, other.InheritEnv...), configs.InheritEnv...)
+	configs.Mounts = append(configs.Mounts, other.Mounts...)
+	configs.Secrets = append(configs.Secrets, other.Secrets...)
+	configs.Before = append(configs.Before, other.Before...)
+	configs.After = append(configs.After, other.After...)
+	configs.EnvFile = firstNonEmpty(other.EnvFile, configs.EnvFile)
+	configs.Shell = firstNonEmpty(other.Shell, configs.Shell)
+	configs.PullPolicy = firstNonEmpty(other.PullPolicy, configs.PullPolicy)
+	configs.Registry = firstNonEmpty(other.Registry, configs.Registry)
+	configs.Init = configs.Init || other.Init
+	if len(other.DNS) > 0 {
+		configs.DNS = other.DNS
+	}
+	if len(other.DNSSearch) > 0 {
+		configs.DNSSearch = other.DNSSearch
+	}
+	configs.unknownFields = append(configs.unknownFields, other.unknownFields...)
+
+	for name, value := range other.Labels {
+		if configs.Labels == nil {
+			configs.Labels = map[string]string{}
+		}
+		configs.Labels[name] = value
+	}
+	for registry, auth := range other.Auth {
+		if configs.Auth == nil {
+			configs.Auth = map[string]RegistryAuth{}
+		}
+		configs.Auth[registry] = auth
+	}
+	for name, template := range other.Templates {
+		if configs.Templates == nil {
+			configs.Templates = map[string]Step{}
+		}
+		configs.Templates[name] = template
+	}
+
+	// The tasks of other keep the position of the ones they replace, if any, so that the order is still known
+	if len(other.taskOrder) != len(other.Tasks) || len(configs.taskOrder) != len(configs.Tasks) {
+		configs.taskOrder = nil
+	} else {
+		for _, taskName := range other.taskOrder {
+			if _, exists := configs.Tasks[taskName]; !exists {
+				configs.taskOrder = append(configs.taskOrder, taskName)
+			}
+		}
+	}
+	for taskName, task := range other.Tasks {
+		if configs.Tasks == nil {
+			configs.Tasks = map[string]Task{}
+		}
+		configs.Tasks[taskName] = task
+	}
+}
+
+// readEnvFiles reads the environment variables from the `envFile` of global and task levels, which the
+// environment variables of the respective level can refer to, see `ParseEnvs`. Relative paths of env files are
+// resolved against the directory of the task file.
+func readEnvFiles(configs *Configs, baseDir string) error {
+	var err error
+	if configs.fileEnvs, err = readEnvFile(configs.EnvFile, baseDir); err != nil {
+		return err
+	}
+	for taskName, task := range configs.Tasks {
+		if task.fileEnvs, err = readEnvFile(task.EnvFile, baseDir); err != nil {
+			return err
+		}
+		configs.Tasks[taskName] = task
+	}
+	return nil
+}
+
+// loadEnvFiles adds the environment variables read from the env files to the environment variables of the
+// respective level, once these are parsed. Variables defined in `envs` take precedence over the ones from the
+// file. Those of a task with a matrix are added with every combination, see `MatrixTask`.
+func loadEnvFiles(configs *Configs) {
+	configs.Envs = append(configs.Envs, configs.fileEnvs...)
+	for taskName, task := range configs.Tasks {
+		if len(task.Matrix) == 0 {
+			task.Envs = append(task.Envs, task.fileEnvs...)
+			configs.Tasks[taskName] = task
+		}
+	}
+}
+
+// readEnvFile parses the dotenv file and returns its variables in the form `KEY=VALUE`, sorted by key
+func readEnvFile(file string, baseDir string) ([]string, error) {
+	if file == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(baseDir, file)
+	}
+	vars, err := godotenv.Read(file)
+	if err != nil {
+		return nil, fmt.Errorf(`config: failed to read env file %s: %s`, file, err.Error())
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	envs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		envs = append(envs, k+"="+vars[k])
+	}
+	return envs, nil
+}
+
+// parseTaskOrder returns the names of the tasks in the order they are defined in the task file contents
+func parseTaskOrder(fileContents []byte) []string {
+	var ordered struct {
+		Tasks yaml.MapSlice `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(fileContents, &ordered); err != nil {
+		return nil
+	}
+	var taskNames []string
+	for _, item := range ordered.Tasks {
+		taskNames = append(taskNames, fmt.Sprint(item.Key))
+	}
+	return taskNames
+}
+
+// parseUnknownFields returns an error for every field of the task file contents that dunner does not know of
+func parseUnknownFields(fileContents []byte) []error {
+	var configs Configs
+	err := yaml.UnmarshalStrict(fileContents, &configs)
+	typeErr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, e := range typeErr.Errors {
+		if match := unknownFieldRegex.FindStringSubmatch(e); match != nil {
+			// Steps are unmarshalled through the `plainStep` type, see `Step.UnmarshalYAML`
+			typeName := strings.ToLower(strings.TrimPrefix(match[3], "plain"))
+			errs = append(errs, fmt.Errorf("%s: unknown field '%s' in %s", match[1], match[2], typeName))
+		}
+	}
+	return errs
+}
+
+// UnmarshalYAML unmarshals the command given as a plain string, as a list of strings, or as an object with the
+// command as `cmd` and its directory as `dir`, the directory being kept track of by `Step.UnmarshalYAML`
+func (command *Command) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var shellCommand string
+	if err := unmarshal(&shellCommand); err == nil {
+		*command = Command{shellCommand}
+		return nil
+	}
+	var execCommand []string
+	if err := unmarshal(&execCommand); err == nil {
+		*command = execCommand
+		return nil
+	}
+	var dirCommand struct {
+		Dir string  `yaml:"dir"`
+		Cmd Command `yaml:"cmd"`
+	}
+	if err := unmarshal(&dirCommand); err != nil {
+		return err
+	}
+	*command = dirCommand.Cmd
+	return nil
+}
+
+// UnmarshalYAML unmarshals the step, keeping track of the commands given as plain strings so that they can be
+// run with the shell once it is known from the step, task or global configuration, and of the directories of
+// the commands given as objects.
+func (step *Step) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plainStep Step
+	if err := unmarshal((*plainStep)(step)); err != nil {
+		return err
+	}
+
+	var fields yaml.MapSlice
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if key, ok := field.Key.(string); ok {
+			step.fields = append(step.fields, key)
+		}
+		switch field.Key {
+		case "command":
+			if _, ok := field.Value.(yaml.MapSlice); ok {
+				return fmt.Errorf("config: command cannot be given as an object with a `dir`, only the entries of `commands` can")
+			}
+			_, step.shellCommand = field.Value.(string)
+		case "commands":
+			commands, _ := field.Value.([]interface{})
+			for i, command := range commands {
+				if object, ok := command.(yaml.MapSlice); ok {
+					for _, item := range object {
+						switch item.Key {
+						case "dir":
+							if dir, _ := item.Value.(string); dir != "" {
+								if step.CommandDirs == nil {
+									step.CommandDirs = make(map[int]string)
+								}
+								step.CommandDirs[i] = dir
+							}
+						case "cmd":
+							command = item.Value
+						}
+					}
+				}
+				if _, ok := command.(string); ok {
+					if step.shellCommands == nil {
+						step.shellCommands = make(map[int]bool)
+					}
+					step.shellCommands[i] = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applyTemplates bases the steps of the tasks and hooks that `use` a template on the template of that name.
+func (configs *Configs) applyTemplates(templates map[string]Step) error {
+	for taskName, task := range configs.Tasks {
+		for i := range task.Steps {
+			if err := task.Steps[i].applyTemplate(templates, fmt.Sprintf("task '%s', step %d", taskName, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	for j, hooks := range [][]Step{configs.Before, configs.After} {
+		for i := range hooks {
+			if err := hooks[i].applyTemplate(templates, fmt.Sprintf("%s hook, step %d", []string{"before", "after"}[j], i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// templateFieldGroups are the fields replaced together when a step overrides one of them, as they cannot be
+// given along with each other
+var templateFieldGroups = [][]string{{"image", "build"}, {"command", "commands"}}
+
+// applyTemplate bases the step on the template it uses, if any. The fields given in the step replace those of the
+// template, except that the environment variables of both are passed, mounts and tmpfs mounts of both are
+// mounted, and labels and build arguments of both are set, those of the step taking precedence.
+func (step *Step) applyTemplate(templates map[string]Step, location string) error {
+	if step.Use == "" {
+		step.fields = nil
+		return nil
+	}
+	template, exists := templates[step.Use]
+	if !exists {
+		return fmt.Errorf("config: %s: template '%s' does not exist", location, step.Use)
+	}
+	if template.Use != "" {
+		return fmt.Errorf("config: %s: template '%s' cannot use another template", location, step.Use)
+	}
+
+	given := make(map[string]bool)
+	for _, key := range step.fields {
+		given[key] = true
+		for _, group := range templateFieldGroups {
+			if key == group[0] || key == group[1] {
+				given[group[0]], given[group[1]] = true, true
+			}
+		}
+	}
+	based := template
+	based.Use = step.Use
+	basedValue, stepValue := reflect.ValueOf(&based).Elem(), reflect.ValueOf(step).Elem()
+	for i := 0; i < basedValue.NumField(); i++ {
+		if key := strings.Split(basedValue.Type().Field(i).Tag.Get("yaml"), ",")[0]; given[key] {
+			basedValue.Field(i).Set(stepValue.Field(i))
+		}
+	}
+	if given["command"] {
+		based.shellCommand, based.shellCommands, based.CommandDirs = step.shellCommand, step.shellCommands, step.CommandDirs
+	}
+
+	// The first of the variables of the same key is the one passed, so those of the step come first
+	based.Envs = append(append([]string{}, step.Envs...), template.Envs...)
+	based.Mounts = append(append([]string{}, template.Mounts...), step.Mounts...)
+	based.Tmpfs = append(append([]string{}, template.Tmpfs...), step.Tmpfs...)
+	based.Caches = append(append([]string{}, template.Caches...), step.Caches...)
+	based.Labels = mergeStringMaps(template.Labels, step.Labels)
+	based.BuildArgs = mergeStringMaps(template.BuildArgs, step.BuildArgs)
+	based.Sysctls = mergeStringMaps(template.Sysctls, step.Sysctls)
+	*step = based
+	return nil
+}
+
+// mergeStringMaps returns the entries of both maps, those of other replacing the ones of the same key, or nil if
+// both are empty
+func mergeStringMaps(values, other map[string]string) map[string]string {
+	if len(values) == 0 && len(other) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(values)+len(other))
+	for _, source := range []map[string]string{values, other} {
+		for key, value := range source {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// applyTaskImages sets the default image of every task as the image of its steps that have none, nor a `build` or a
+// `follow`, so that they are validated and run with it
+func (configs *Configs) applyTaskImages() {
+	for _, task := range configs.Tasks {
+		if task.Image == "" {
+			continue
+		}
+		for i, step := range task.Steps {
+			if step.Image == "" && step.Build == "" && step.Follow == "" {
+				task.Steps[i].Image = task.Image
+			}
+		}
+	}
+}
+
+// applyShells wraps the commands given as plain strings into an invocation of the shell, which is the first one
+// defined of step, task and global `shell`, or `sh -c` if none is.
+func (configs *Configs) applyShells() {
+	for taskName, task := range configs.Tasks {
+		for i := range task.Steps {
+			task.Steps[i].applyShell(task.Shell, configs.Shell)
+		}
+		configs.Tasks[taskName] = task
+	}
+	// Hooks run around every task, so only the global shell applies to them
+	for _, hooks := range [][]Step{configs.Before, configs.After} {
+		for i := range hooks {
+			hooks[i].applyShell(configs.Shell)
+		}
+	}
+}
+
+// applyShell prepends the shell of the step, or else the first of the shells of the upper levels, to the commands
+// of the step given as plain strings. With `sharedShell`, the commands of `commands` are rather turned into the
+// lines of the script run by the shell.
+func (step *Step) applyShell(shells ...string) {
+	shell := strings.Fields(firstNonEmpty(append(append([]string{step.Shell}, shells...), defaultShell)...))
+	if step.SharedShell && len(step.Commands) > 0 {
+		for j, cmd := range step.Commands {
+			if !step.shellCommands[j] {
+				step.Commands[j] = Command{docker.ShellQuote(cmd...)}
+			}
+		}
+		step.scriptShell, step.shellCommands = shell, nil
+	}
+	if step.shellCommand {
+		step.Command = append(append(Command{}, shell...), step.Command...)
+	}
+	for j := range step.Commands {
+		if step.shellCommands[j] {
+			step.Commands[j] = append(append(Command{}, shell...), step.Commands[j]...)
+		}
+	}
+	step.shellCommand, step.shellCommands = false, nil
+}
+
+// ScriptShell returns the shell running the commands of the step as the lines of one script, nil unless the step
+// has `sharedShell` set. For steps not read from a task file, it is the shell of the step or else the default one.
+func (step Step) ScriptShell() []string {
+	if step.SharedShell && step.scriptShell == nil {
+		return strings.Fields(firstNonEmpty(step.Shell, defaultShell))
+	}
+	return step.scriptShell
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// MatrixCombinations returns the combinations of the values of the matrix of the task, as the environment
+// variables of the form KEY=VALUE of every run of the task. The variables are sorted by name, and the values of
+// the last name vary first. It returns nil if the task has no matrix.
+func (task Task) MatrixCombinations() [][]string {
+	if len(task.Matrix) == 0 {
+		return nil
+	}
+	var names []string
+	for name := range task.Matrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	combinations := [][]string{{}}
+	for _, name := range names {
+		var next [][]string
+		for _, combination := range combinations {
+			for _, value := range task.Matrix[name] {
+				next = append(next, append(append([]string{}, combination...), name+"="+value))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// MatrixTask returns a copy of the task run with one combination of the values of its matrix, as environment
+// variables of the task which take precedence over its other ones. The envs of the task and of its steps, which
+// are left as they are by `ParseEnvs` for a task with a matrix, are parsed with the combination in scope. The
+// variables of the env file of the task come after them.
+func (configs *Configs) MatrixTask(taskName string, combination []string) (Task, error) {
+	task := configs.Tasks[taskName]
+	args := argNames(task)
+	globals := envScope(nil, configs.Envs, configs.fileEnvs)
+
+	// The values of the matrix are escaped, to be taken as they are
+	task.Envs = make([]string, 0, len(combination)+len(task.Envs))
+	for _, env := range combination {
+		task.Envs = append(task.Envs, strings.Replace(env, "$", "$$", -1))
+	}
+	task.Envs = append(task.Envs, configs.Tasks[taskName].Envs...)
+	task.Matrix = nil
+	taskScope, err := interpolateEnvs(task.Envs, envScope(globals, task.fileEnvs), args)
+	if err != nil {
+		return Task{}, err
+	}
+	task.Envs = append(task.Envs, task.fileEnvs...)
+	task.Steps = make([]Step, len(task.Steps))
+	for i, step := range configs.Tasks[taskName].Steps {
+		step.Envs = append([]string{}, step.Envs...)
+		if _, err := interpolateEnvs(step.Envs, taskScope, args); err != nil {
+			return Task{}, err
+		}
+		task.Steps[i] = step
+	}
+	return task, nil
+}
+
+// TaskNames returns the names of all the tasks in the order they are defined in the task file.
+// If the order is not known, as for configs not read from a task file, the names are sorted alphabetically.
+func (configs *Configs) TaskNames() []string {
+	if len(configs.taskOrder) == len(configs.Tasks) {
+		return configs.taskOrder
+	}
+	var taskNames []string
+	for taskName := range configs.Tasks {
+		taskNames = append(taskNames, taskName)
+	}
+	sort.Strings(taskNames)
+	return taskNames
+}
+
+// getDunnerTaskFile returns the dunner task file path.
+// If `filename` is not default task file, it returns as-is.
+// It returns task file in current directory if exists, one of `.dunner.yaml`, `dunner.yaml`, `dunner.json` or `dunner.toml`,
+// this routine keeps going upwards searching for task file
+func getDunnerTaskFile(filename string) (string, error) {
+	if internal.DefaultDunnerTaskFileName != filename {
+		return filename, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	names := internal.TaskFileNames
+	failErr := fmt.Errorf(
+		"config: failed to find Dunner task file %s or %s in %s or any of its parent directories",
+		strings.Join(names[:len(names)-1], ", "), names[len(names)-1], cwd,
+	)
+
+	dir := cwd
+	for {
+		for _, name := range names {
+			taskFile := filepath.Join(dir, name)
+			if util.FileExists(taskFile) {
+				return taskFile, nil
+			}
+		}
+		if dir == filepath.Clean(fmt.Sprintf("%c", os.PathSeparator)) || dir == "" {
+			return "", failErr
+		}
+		oldDir := dir
+		dir = filepath.Clean(fmt.Sprintf("%s%c..", dir, os.PathSeparator))
+		if dir == oldDir {
+			return "", failErr
+		}
+	}
+}
+
+func loadDotEnv() {
+	file := viper.GetString("DotenvFile")
+	var err error
+	dotEnv, err = godotenv.Read(file)
+	if err != nil {
+		log.Debugf("No environment loaded from %s file: Not found", file)
+	}
+}
+
+// ParseEnvs parses the `.env` file as well as the host environment variables.
+// If the same variable is defined in both the `.env` file and in the host environment,
+// priority is given to the .env file.
+// An environment value can be a single variable like "`$ENV_NAME`", or contain variables like `$ENV_NAME` or
+// `${ENV_NAME}` anywhere in it, with `$$` for a literal `$`.
+//
+// The variables of the task file, of the tasks and of the steps are parsed in this order, so that a variable can
+// refer to those of the upper levels and to those before it in its list, see `interpolateEnvs`, as well as to
+// those of the env file of its level or of the upper levels.
+//
+// The variables replaced with arguments once the steps are run, like `${DUNNER_TASK}` or the arguments of the
+// tasks, are left as they are, see `argNames`, as is `$${` escaping them. So is any other variable of the form
+// `${name}` that is not set, as it can be a named argument passed with `--arg`.
+//
+// Note: You can change the filename of environment file (default: `.env`) using `--env-file/-e` flag in the CLI.
+func ParseEnvs(configs *Configs) error {
+	tasks := make([]Task, 0, len((*configs).Tasks))
+	for _, task := range (*configs).Tasks {
+		tasks = append(tasks, task)
+	}
+	globalArgs := argNames(tasks...)
+
+	// Parse envs that are global to all
+	globals, err := interpolateEnvs((*configs).Envs, envScope(nil, configs.fileEnvs), globalArgs)
+	if err != nil {
+		return err
+	}
+	for taskName, tasks := range (*configs).Tasks {
+		taskArgs := argNames(tasks)
+
+		// The envs of a task with a matrix can refer to the variables of the matrix, they are parsed for
+		// every combination once it is run, see `MatrixTask`, and only checked here with the first one
+		if combinations := tasks.MatrixCombinations(); len(combinations) > 0 {
+			if _, err := configs.MatrixTask(taskName, combinations[0]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Parse envs that are global to all steps of the task
+		taskScope, err := interpolateEnvs(tasks.Envs, envScope(globals, tasks.fileEnvs), taskArgs)
+		if err != nil {
+			return err
+		}
+
+		// Parse envs that are defined for an individual step
+		for _, step := range tasks.Steps {
+			if _, err := interpolateEnvs(step.Envs, taskScope, taskArgs); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Parse envs that are defined for the steps of the hooks
+	for _, hooks := range [][]Step{configs.Before, configs.After} {
+		for _, step := range hooks {
+			if _, err := interpolateEnvs(step.Envs, globals, globalArgs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// envScope returns a copy of the scope with the variables of the lists, the first of the variables of the same
+// key taking precedence over the next ones and over those of the scope
+func envScope(scope map[string]string, envs ...[]string) map[string]string {
+	lowerScope := make(map[string]string, len(scope))
+	for _, list := range envs {
+		for _, env := range list {
+			if pair := strings.SplitN(env, "=", 2); len(pair) == 2 {
+				if _, isDefined := lowerScope[pair[0]]; !isDefined {
+					lowerScope[pair[0]] = pair[1]
+				}
+			}
+		}
+	}
+	for key, value := range scope {
+		if _, isDefined := lowerScope[key]; !isDefined {
+			lowerScope[key] = value
+		}
+	}
+	return lowerScope
+}
+
+// argNames returns the names of the variables that are replaced with arguments once the steps of the tasks are
+// run, even if an environment variable of the name is set: the built-in environment variables and the arguments
+// declared by the tasks.
+func argNames(tasks ...Task) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range BuiltinEnvNames {
+		names[name] = true
+	}
+	for _, task := range tasks {
+		for _, arg := range task.Args {
+			names[arg.Name] = true
+		}
+	}
+	return names
+}
+
+// interpolateEnvs parses the environment variables of the list in place, in order. A variable refers to the
+// first variable of the name before it in the list, which is the one passed to the steps, or else to the variable
+// of the upper levels in the given scope, or else to the one of the environment file or of the host. Referring
+// to a variable defined only after it in the list is an error, as its value would not be the one passed. The
+// scope of the lower levels is returned, with the variables of the list overriding those of the given scope.
+// The variables of the form `${name}` named in args are left as they are.
+func interpolateEnvs(envs []string, scope map[string]string, args map[string]bool) (map[string]string, error) {
+	lowerScope := make(map[string]string, len(scope)+len(envs))
+	for key, value := range scope {
+		lowerScope[key] = value
+	}
+	defined := make(map[string]string, len(envs))
+	for i, envVar := range envs {
+		key := strings.SplitN(envVar, "=", 2)[0]
+		for _, match := range envVarRegex.FindAllString(envVar[len(key):], -1) {
+			name := strings.Trim(match, "${}")
+			if _, isDefined := defined[name]; isDefined || name == key || strings.HasPrefix(match, "$$") || isArg(match, args) {
+				continue
+			}
+			for _, later := range envs[i+1:] {
+				if strings.SplitN(later, "=", 2)[0] == name {
+					return nil, fmt.Errorf(`config: environment variable '%s' refers to '%s', which is defined after it`, key, name)
+				}
+			}
+		}
+		newEnv, err := obtainEnv(envVar, func(name string) (string, bool) {
+			if value, isDefined := defined[name]; isDefined {
+				return value, true
+			}
+			value, isSet := scope[name]
+			return value, isSet
+		}, args)
+		if err != nil {
+			return nil, err
+		}
+		envs[i] = newEnv
+		if _, isDefined := defined[key]; !isDefined {
+			defined[key] = strings.SplitN(newEnv, "=", 2)[1]
+			lowerScope[key] = defined[key]
+		}
+	}
+	return lowerScope, nil
+}
+
+// obtainEnv parses the environment variable, looking the variables it refers to up first, before the environment
+// file and the host environment variables. The arguments in args are left as they are, see `interpolateEnvFrom`.
+func obtainEnv(envVar string, lookup func(string) (string, bool), args map[string]bool) (string, error) {
+	var str = strings.Split(envVar, "=")
+	if len(str) != 2 {
+		return "", fmt.Errorf(
+			`config: invalid format of environment variable: %v`,
+			envVar,
+		)
+	}
+	var pattern = "^`\\$.+`$"
+	check, err := regexp.MatchString(pattern, str[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if check {
+		var key = strings.Replace(
+			strings.Replace(
 				str[1],
 				"`",
 				"",
@@ -361,6 +1660,9 @@ func obtainEnv(envVar string) (string, error) {
 		if v, isSet := dotEnv[key]; isSet {
 			val = v
 		}
+		if v, isSet := lookup(key); isSet {
+			val = v
+		}
 		if val == "" {
 			return "", fmt.Errorf(
 				`config: could not find environment variable '%v' in %s file or among host environment variables`,
@@ -371,10 +1673,73 @@ func obtainEnv(envVar string) (string, error) {
 		var newEnv = str[0] + "=" + val
 		return newEnv, nil
 	}
-	return envVar, nil
+	val, err := interpolateEnvFrom(str[1], lookup, args)
+	if err != nil {
+		return "", err
+	}
+	return str[0] + "=" + val, nil
+}
+
+// interpolateEnv replaces the environment variables of the form `$ENV_NAME` or `${ENV_NAME}` in the value with
+// their values from the environment file or the host environment variables. `$$` is replaced by a single `$`.
+func interpolateEnv(value string) (string, error) {
+	return interpolateEnvFrom(value, func(string) (string, bool) { return "", false }, nil)
 }
 
-// ParseStepEnv parses Dir, Mounts, User fields of Step by replacing environment variables with their values
+// interpolateEnvFrom interpolates the environment variables in the value like `interpolateEnv`, those found by
+// lookup taking precedence. If args is not nil, the variables of the form `${name}` named in it or not set are left
+// as they are, to be replaced with the arguments once the step is run, as is `$${` escaping the arguments.
+func interpolateEnvFrom(value string, lookup func(string) (string, bool), args map[string]bool) (string, error) {
+	var gErr error
+	parsed := envVarRegex.ReplaceAllStringFunc(value, func(match string) string {
+		switch {
+		case match == "$${" && args != nil:
+			return match
+		case strings.HasPrefix(match, "$$"):
+			return match[1:]
+		case isArg(match, args):
+			return match
+		}
+		key := strings.Trim(match, "${}")
+		val, isSet := lookup(key)
+		if !isSet {
+			val, isSet = dotEnv[key]
+		}
+		if !isSet {
+			val, isSet = os.LookupEnv(key)
+		}
+		if !isSet && args != nil && strings.HasPrefix(match, "${") {
+			return match
+		}
+		if !isSet && gErr == nil {
+			gErr = fmt.Errorf(
+				`config: could not find environment variable '%v' in %s file or among host environment variables`,
+				key,
+				viper.GetString("DotenvFile"),
+			)
+		}
+		return val
+	})
+	return parsed, gErr
+}
+
+// isArg returns true if the variable matched by envVarRegex is of the form `${name}` and is named in args
+func isArg(match string, args map[string]bool) bool {
+	return strings.HasPrefix(match, "${") && args[strings.Trim(match, "${}")]
+}
+
+// ParseEnv returns the credentials with the environment variables in them replaced by their values
+func (auth RegistryAuth) ParseEnv() (RegistryAuth, error) {
+	var err error
+	for _, value := range []*string{&auth.Username, &auth.Password, &auth.Token} {
+		if *value, err = interpolateEnv(*value); err != nil {
+			return auth, err
+		}
+	}
+	return auth, nil
+}
+
+// ParseStepEnv parses Dir, Build, CommandDirs, Mounts, OutputFile, User fields of Step by replacing environment variables with their values
 func (step *Step) ParseStepEnv() error {
 	parsedDir, err := lookupDirectory(step.Dir)
 	if err != nil {
@@ -382,6 +1747,25 @@ func (step *Step) ParseStepEnv() error {
 	}
 	step.Dir = parsedDir
 
+	parsedBuild, err := lookupDirectory(step.Build)
+	if err != nil {
+		return err
+	}
+	step.Build = parsedBuild
+
+	if step.CommandDirs != nil {
+		// The directories are parsed into a new map, as the step definition can be shared by concurrent steps
+		commandDirs := make(map[int]string, len(step.CommandDirs))
+		for index, dir := range step.CommandDirs {
+			parsedDir, err := lookupDirectory(dir)
+			if err != nil {
+				return err
+			}
+			commandDirs[index] = parsedDir
+		}
+		step.CommandDirs = commandDirs
+	}
+
 	for index, m := range step.Mounts {
 		parsedMount, err := lookupDirectory(m)
 		if err != nil {
@@ -390,6 +1774,12 @@ func (step *Step) ParseStepEnv() error {
 		step.Mounts[index] = parsedMount
 	}
 
+	parsedOutputFile, err := lookupDirectory(step.OutputFile)
+	if err != nil {
+		return err
+	}
+	step.OutputFile = parsedOutputFile
+
 	parsedUser, err := lookupDirectory(step.User)
 	if err != nil {
 		return err
@@ -400,35 +1790,146 @@ func (step *Step) ParseStepEnv() error {
 
 // DecodeMount parses mount format for directories to be mounted as bind volumes.
 // The format to configure a mount is
-// 		<source>:<destination>:<mode>
-// By _mode_, the file permission level is defined in two ways, viz., _read-only_ mode(`r`) and _read-write_ mode(`wr` or `w`)
-func DecodeMount(mounts []string, step *docker.Step) error {
+//
+//	<source>:<destination>:<mode>
+//
+// By _mode_, the file permission level is defined in two ways, viz., _read-only_ mode(`r`) and _read-write_ mode(`wr`, `rw` or `w`)
+// The mode can be followed or replaced by the consistency and propagation options of the mount, like `w,cached`,
+// see `parseMountOptions`.
+// If the source is a name instead of a path (e.g. `mycache:/root/.cache`), it is mounted as a Docker named volume.
+// Relative source paths are resolved against baseDir, the directory of the task file, or the current directory if empty.
+func DecodeMount(mounts []string, baseDir string, step *docker.Step) error {
 	for _, m := range mounts {
 		arr := strings.Split(
 			strings.Trim(strings.Trim(m, `'`), `"`),
 			":",
 		)
-		var readOnly = true
+		var options = mountOptions{readOnly: true}
 		if len(arr) == 3 {
-			if arr[2] == "wr" || arr[2] == "w" {
-				readOnly = false
+			var err error
+			if options, err = parseMountOptions(arr[2]); err != nil {
+				return fmt.Errorf("config: invalid mount '%s': %s", m, err.Error())
 			}
 		}
-		src, err := filepath.Abs(joinPathRelToHome(arr[0]))
-		if err != nil {
-			return err
+		var mountType = mount.TypeBind
+		src := arr[0]
+		if isNamedVolume(src) {
+			mountType = mount.TypeVolume
+			if options.propagation != "" {
+				return fmt.Errorf("config: invalid mount '%s': propagation '%s' only applies to directories of the host, not to named volumes", m, options.propagation)
+			}
+		} else {
+			var err error
+			if src, err = mountSource(src, baseDir); err != nil {
+				return err
+			}
 		}
 
-		(*step).ExtMounts = append((*step).ExtMounts, mount.Mount{
-			Type:     mount.TypeBind,
-			Source:   src,
-			Target:   arr[1],
-			ReadOnly: readOnly,
-		})
+		extMount := mount.Mount{
+			Type:        mountType,
+			Source:      src,
+			Target:      arr[1],
+			ReadOnly:    options.readOnly,
+			Consistency: options.consistency,
+		}
+		if options.propagation != "" {
+			extMount.BindOptions = &mount.BindOptions{Propagation: options.propagation}
+		}
+		(*step).ExtMounts = append((*step).ExtMounts, extMount)
 	}
 	return nil
 }
 
+// mountOptions are the options of a mount given after its destination
+type mountOptions struct {
+	readOnly    bool
+	consistency mount.Consistency
+	propagation mount.Propagation
+}
+
+// parseMountOptions parses the comma-separated options of a mount given after its destination, like `w,cached`.
+// They are the permission mode, `r` for read-only by default or `w`, `wr` and `rw` for read-write, the consistency
+// of the mount on Docker for Mac, one of `consistent`, `cached` and `delegated`, and the propagation of a mounted
+// directory of the host, one of `private`, `rprivate`, `shared`, `rshared`, `slave` and `rslave`. Each of them can
+// be given at most once.
+func parseMountOptions(options string) (mountOptions, error) {
+	parsed := mountOptions{readOnly: true}
+	given := make(map[string]bool)
+	for _, option := range strings.Split(options, ",") {
+		var kind string
+		for _, mode := range validDirPermissionModes {
+			if option == mode {
+				kind, parsed.readOnly = "mode", mode == defaultPermissionMode
+			}
+		}
+		switch consistency := mount.Consistency(option); consistency {
+		case mount.ConsistencyFull, mount.ConsistencyCached, mount.ConsistencyDelegated:
+			kind, parsed.consistency = "consistency", consistency
+		}
+		for _, propagation := range mount.Propagations {
+			if option == string(propagation) {
+				kind, parsed.propagation = "propagation", propagation
+			}
+		}
+		if kind == "" {
+			return parsed, fmt.Errorf("unknown option '%s'", option)
+		}
+		if given[kind] {
+			return parsed, fmt.Errorf("option '%s' is a %s given along with another one", option, kind)
+		}
+		given[kind] = true
+	}
+	return parsed, nil
+}
+
+// ParseTmpfs returns the tmpfs mount of the form `target:options`, like `/scratch:size=64m,mode=1777`. The options
+// are `size`, a number of bytes with an optional unit suffix, and `mode`, the octal file mode of the mount.
+func ParseTmpfs(tmpfs string) (mount.Mount, error) {
+	arr := strings.SplitN(tmpfs, ":", 2)
+	if !path.IsAbs(arr[0]) {
+		return mount.Mount{}, fmt.Errorf("config: invalid tmpfs mount '%s': target '%s' must be an absolute path", tmpfs, arr[0])
+	}
+	m := mount.Mount{Type: mount.TypeTmpfs, Target: arr[0], TmpfsOptions: &mount.TmpfsOptions{}}
+	if len(arr) == 1 || arr[1] == "" {
+		return m, nil
+	}
+	for _, option := range strings.Split(arr[1], ",") {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 {
+			return mount.Mount{}, fmt.Errorf("config: invalid tmpfs mount '%s': option '%s' must be of the form key=value", tmpfs, option)
+		}
+		switch kv[0] {
+		case "size":
+			size, err := units.RAMInBytes(kv[1])
+			if err != nil || size <= 0 {
+				return mount.Mount{}, fmt.Errorf("config: invalid tmpfs mount '%s': size '%s' must be a positive number with an optional unit suffix like 64m", tmpfs, kv[1])
+			}
+			m.TmpfsOptions.SizeBytes = size
+		case "mode":
+			mode, err := strconv.ParseUint(kv[1], 8, 32)
+			if err != nil {
+				return mount.Mount{}, fmt.Errorf("config: invalid tmpfs mount '%s': mode '%s' must be an octal file mode like 1777", tmpfs, kv[1])
+			}
+			m.TmpfsOptions.Mode = os.FileMode(mode)
+		default:
+			return mount.Mount{}, fmt.Errorf("config: invalid tmpfs mount '%s': unknown option '%s', the options are size and mode", tmpfs, kv[0])
+		}
+	}
+	return m, nil
+}
+
+// ParseCache returns the name of a cache of the form `name:path`, and the read-write mount of its volume on the path
+func ParseCache(cache string) (string, mount.Mount, error) {
+	arr := strings.SplitN(cache, ":", 2)
+	if len(arr) != 2 || !cacheNameRegex.MatchString(arr[0]) {
+		return "", mount.Mount{}, fmt.Errorf("config: invalid cache '%s': it must start with a name of letters, digits, '_', '.' or '-'", cache)
+	}
+	if !path.IsAbs(arr[1]) {
+		return "", mount.Mount{}, fmt.Errorf("config: invalid cache '%s': path '%s' must be absolute", cache, arr[1])
+	}
+	return arr[0], mount.Mount{Type: mount.TypeVolume, Source: docker.CacheVolume(arr[0]), Target: arr[1]}, nil
+}
+
 // Replaces dir having any environment variables in form `$ENV_NAME` and returns a parsed string
 func lookupDirectory(dir string) (string, error) {
 	matches := hostDirRegex.FindAllStringSubmatch(dir, -1)
@@ -451,6 +1952,33 @@ func lookupDirectory(dir string) (string, error) {
 	return parsedDir, nil
 }
 
+// isNamedVolume checks if the source of a mount is a Docker volume name rather than a host path
+func isNamedVolume(src string) bool {
+	return namedVolumeRegex.MatchString(src)
+}
+
+// StdinFile returns the path of the file that the stdin of a step is read from if it is given as `@file`, relative
+// paths being resolved against baseDir. It returns false if the stdin is given as it is.
+func StdinFile(stdin string, baseDir string) (string, bool) {
+	if !strings.HasPrefix(stdin, "@") || strings.HasPrefix(stdin, "@@") {
+		return "", false
+	}
+	file := strings.TrimPrefix(stdin, "@")
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(baseDir, file)
+	}
+	return file, true
+}
+
+// mountSource returns the absolute path of the source of a bind mount, relative paths being resolved against baseDir
+func mountSource(src string, baseDir string) (string, error) {
+	src = joinPathRelToHome(src)
+	if !filepath.IsAbs(src) && baseDir != "" {
+		src = filepath.Join(baseDir, src)
+	}
+	return filepath.Abs(src)
+}
+
 func joinPathRelToHome(p string) string {
 	if p[0] == '~' {
 		return path.Join(util.HomeDir, strings.Trim(p, "~"))
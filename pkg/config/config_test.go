@@ -3,17 +3,23 @@ package config
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/leopardslab/dunner/internal"
 	"github.com/leopardslab/dunner/internal/util"
 	"github.com/leopardslab/dunner/pkg/docker"
 	"github.com/spf13/viper"
 	validator "gopkg.in/go-playground/validator.v9"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestGetConfigs(t *testing.T) {
@@ -65,7 +71,7 @@ tasks:
 	var step = Step{
 		Name:     "",
 		Image:    "node:10.15.0",
-		Commands: [][]string{{"node", "--version"}, {"npm", "--version"}},
+		Commands: []Command{{"node", "--version"}, {"npm", "--version"}},
 		User:     "20",
 		Envs:     []string{"MYVAR=MYVAL", "MYUSR=dunner"},
 	}
@@ -75,590 +81,2558 @@ tasks:
 		Steps: []Step{step},
 	}
 	var expected = Configs{
-		Envs:  []string{"GLB=VARBL"},
+		Envs:      []string{"GLB=VARBL"},
+		Tasks:     tasks,
+		baseDir:   filepath.Dir(tmpFile.Name()),
+		taskOrder: []string{"test"},
+	}
+
+	if !reflect.DeepEqual(expected, *pout) {
+		t.Fatalf("Output not equal to expected; %v != %v", expected, *pout)
+	}
+
+}
+
+func TestGetConfigsWithStepTimeout(t *testing.T) {
+	var content = []byte(`
+tasks:
+  test:
+    steps:
+      - image: busybox
+        command: ["sleep", "60"]
+        timeout: 30s`)
+
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 30 * time.Second
+	if got := configs.Tasks["test"].Steps[0].Timeout; got != expected {
+		t.Fatalf("expected timeout: %s, got: %s", expected, got)
+	}
+}
+
+func TestGetConfigsWithEnvFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		".dunner.yaml": `
+envFile: global.env
+envs:
+  - GLB=VARBL
+tasks:
+  test:
+    envFile: test.env
+    envs:
+      - MYVAR=GLBVAL
+    steps:
+      - image: busybox
+        command: ["printenv"]`,
+		"global.env": "# Global variables\nGLB=FROMFILE\nTOKEN=\"abc=def\"\n",
+		"test.env":   "MYVAR=FROMFILE\nTASKVAR='task value' # comment\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expectedGlobal := []string{"GLB=VARBL", "GLB=FROMFILE", "TOKEN=abc=def"}
+	if !reflect.DeepEqual(expectedGlobal, configs.Envs) {
+		t.Errorf("expected global envs: %v, got: %v", expectedGlobal, configs.Envs)
+	}
+	expectedTask := []string{"MYVAR=GLBVAL", "MYVAR=FROMFILE", "TASKVAR=task value"}
+	if !reflect.DeepEqual(expectedTask, configs.Tasks["test"].Envs) {
+		t.Errorf("expected task envs: %v, got: %v", expectedTask, configs.Tasks["test"].Envs)
+	}
+}
+
+func TestGetConfigsWithEnvsReferringToEnvFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		".dunner.yaml": `
+envFile: db.env
+envs:
+  - URL=postgres://$DB_USER@db
+  - DB_HOST=inline
+tasks:
+  test:
+    envFile: test.env
+    envs:
+      - SUITE=${SUITE_NAME}-$DB_USER
+    steps:
+      - image: busybox
+        envs: ["DSN=$URL/$DB_NAME@$DB_HOST"]
+  matrix:
+    envFile: test.env
+    matrix:
+      GO: ["1.13"]
+    envs:
+      - SUITE=$SUITE_NAME-$GO
+    steps:
+      - image: busybox`,
+		"db.env":   "DB_USER=alice\nDB_HOST=fromfile\n",
+		"test.env": "SUITE_NAME=unit\nDB_NAME=tests\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"URL=postgres://alice@db", "DB_HOST=inline", "DB_HOST=fromfile", "DB_USER=alice"}; !reflect.DeepEqual(expected, configs.Envs) {
+		t.Errorf("expected global envs: %v, got: %v", expected, configs.Envs)
+	}
+	if expected := []string{"SUITE=unit-alice", "DB_NAME=tests", "SUITE_NAME=unit"}; !reflect.DeepEqual(expected, configs.Tasks["test"].Envs) {
+		t.Errorf("expected task envs: %v, got: %v", expected, configs.Tasks["test"].Envs)
+	}
+	if expected := []string{"DSN=postgres://alice@db/tests@inline"}; !reflect.DeepEqual(expected, configs.Tasks["test"].Steps[0].Envs) {
+		t.Errorf("expected step envs: %v, got: %v", expected, configs.Tasks["test"].Steps[0].Envs)
+	}
+	task, err := configs.MatrixTask("matrix", []string{"GO=1.13"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"GO=1.13", "SUITE=unit-1.13", "DB_NAME=tests", "SUITE_NAME=unit"}; !reflect.DeepEqual(expected, task.Envs) {
+		t.Errorf("expected envs of the matrix task: %v, got: %v", expected, task.Envs)
+	}
+}
+
+func TestGetConfigsWithMissingEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	taskFile := filepath.Join(dir, ".dunner.yaml")
+	if err := ioutil.WriteFile(taskFile, []byte("envFile: missing.env"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GetConfigs(taskFile)
+
+	expectedErr := fmt.Sprintf("config: failed to read env file %s: open %s: no such file or directory", filepath.Join(dir, "missing.env"), filepath.Join(dir, "missing.env"))
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestGetConfigsWithIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "tasks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".dunner.yaml": `
+include: [tasks/build.yaml, tasks/test.yaml]
+envs:
+  - STAGE=dev
+tasks:
+  lint:
+    steps:
+      - image: golang
+  test:
+    steps:
+      - image: golang`,
+		"tasks/build.yaml": `
+include: [common.yaml]
+registry: mirror.internal
+dns: [10.0.0.2, 10.0.0.3]
+tasks:
+  build:
+    steps:
+      - image: node
+  test:
+    steps:
+      - image: node`,
+		"tasks/common.yaml": `
+envFile: common.env
+labels:
+  team: build
+tasks:
+  setup:
+    steps:
+      - image: alpine`,
+		"tasks/common.env": "STAGE=prod\n",
+		"tasks/test.yaml": `
+registry: test.internal
+dns: [10.0.0.4]
+labels:
+  team: test
+tasks:
+  build:
+    steps:
+      - image: python`,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	images := map[string]string{}
+	for taskName, task := range configs.Tasks {
+		images[taskName] = task.Steps[0].Image
+	}
+	expectedImages := map[string]string{"setup": "alpine", "build": "python", "test": "golang", "lint": "golang"}
+	if !reflect.DeepEqual(expectedImages, images) {
+		t.Errorf("expected images of the tasks: %v, got: %v", expectedImages, images)
+	}
+	if expected := []string{"setup", "build", "test", "lint"}; !reflect.DeepEqual(expected, configs.TaskNames()) {
+		t.Errorf("expected task names: %v, got: %v", expected, configs.TaskNames())
+	}
+	if expected := []string{"STAGE=dev", "STAGE=prod"}; !reflect.DeepEqual(expected, configs.Envs) {
+		t.Errorf("expected envs: %v, got: %v", expected, configs.Envs)
+	}
+	if configs.Registry != "test.internal" || configs.Labels["team"] != "test" {
+		t.Errorf("expected globals of the last include, got registry: %s, labels: %v", configs.Registry, configs.Labels)
+	}
+	if expected := []string{"10.0.0.4"}; !reflect.DeepEqual(expected, configs.DNS) {
+		t.Errorf("expected DNS servers of the last include replacing the others: %v, got: %v", expected, configs.DNS)
+	}
+}
+
+func TestGetConfigsWithCyclicInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		".dunner.yaml": "include: [a.yaml]",
+		"a.yaml":       "include: [b.yaml]",
+		"b.yaml":       "include: [a.yaml]",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	expectedErr := fmt.Sprintf("config: cyclic include of task file a.yaml: %s -> %s -> %s", a, b, a)
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestGetConfigsWithMissingInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	taskFile := filepath.Join(dir, ".dunner.yaml")
+	if err := ioutil.WriteFile(taskFile, []byte("include: [missing.yaml]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GetConfigs(taskFile)
+
+	expectedErr := fmt.Sprintf("config: failed to read included task file missing.yaml: open %s: no such file or directory", filepath.Join(dir, "missing.yaml"))
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestGetConfigsFromStdin(t *testing.T) {
+	defer yamlStdin()()
+	stdin = strings.NewReader(`
+tasks:
+  test:
+    steps:
+      - image: busybox
+        command: ["ls"]`)
+
+	configs, err := GetConfigs("-")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if task, exists := configs.Tasks["test"]; !exists || task.Steps[0].Image != "busybox" {
+		t.Fatalf("expected 'test' task read from stdin, got: %v", configs.Tasks)
+	}
+}
+
+func TestGetConfigsWithTemplates(t *testing.T) {
+	defer yamlStdin()()
+	stdin = strings.NewReader(`
+templates:
+  go:
+    image: golang
+    dir: /src
+    command: go test ./...
+    envs: [GOOS=linux, CGO_ENABLED=0]
+    mounts: ["~/go/pkg:/go/pkg"]
+    labels:
+      team: build
+      lang: go
+    sysctls:
+      net.core.somaxconn: "1024"
+      net.ipv4.ip_forward: "0"
+tasks:
+  test:
+    steps:
+      - use: go
+        envs: [CGO_ENABLED=1]
+        labels:
+          team: test
+        sysctls:
+          net.ipv4.ip_forward: "1"
+      - use: go
+        image: golang:1.12
+        commands: [[go, vet, ./...], go build]
+        dir: ""`)
+
+	configs, err := GetConfigs("-")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	steps := configs.Tasks["test"].Steps
+	expected := Step{
+		Use:     "go",
+		Image:   "golang",
+		Dir:     "/src",
+		Command: Command{"sh", "-c", "go test ./..."},
+		Envs:    []string{"CGO_ENABLED=1", "GOOS=linux", "CGO_ENABLED=0"},
+		Mounts:  []string{"~/go/pkg:/go/pkg"},
+		Labels:  map[string]string{"team": "test", "lang": "go"},
+		Sysctls: map[string]string{"net.core.somaxconn": "1024", "net.ipv4.ip_forward": "1"},
+	}
+	if steps[0].Image != expected.Image || steps[0].Dir != expected.Dir || !reflect.DeepEqual(expected.Command, steps[0].Command) ||
+		!reflect.DeepEqual(expected.Envs, steps[0].Envs) || !reflect.DeepEqual(expected.Mounts, steps[0].Mounts) || !reflect.DeepEqual(expected.Labels, steps[0].Labels) ||
+		!reflect.DeepEqual(expected.Sysctls, steps[0].Sysctls) {
+		t.Errorf("expected step based on the template: %+v, got: %+v", expected, steps[0])
+	}
+	if steps[1].Image != "golang:1.12" || steps[1].Dir != "" || steps[1].Command != nil {
+		t.Errorf("expected image and dir of the step and no command of the template, got: %+v", steps[1])
+	}
+	if expectedCommands := []Command{{"go", "vet", "./..."}, {"sh", "-c", "go build"}}; !reflect.DeepEqual(expectedCommands, steps[1].Commands) {
+		t.Errorf("expected commands: %v, got: %v", expectedCommands, steps[1].Commands)
+	}
+}
+
+func TestGetConfigsWithTaskImage(t *testing.T) {
+	defer yamlStdin()()
+	stdin = strings.NewReader(`
+templates:
+  lint:
+    image: golangci/golangci-lint
+    command: [golangci-lint, run]
+tasks:
+  check:
+    image: golang
+    steps:
+      - command: [go, vet, ./...]
+      - image: golang:1.12
+        command: [go, test, ./...]
+      - use: lint
+      - follow: release
+  release:
+    steps:
+      - command: [goreleaser]`)
+
+	configs, err := GetConfigs("-")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	var images []string
+	for _, step := range configs.Tasks["check"].Steps {
+		images = append(images, step.Image)
+	}
+	if expected := []string{"golang", "golang:1.12", "golangci/golangci-lint", ""}; !reflect.DeepEqual(expected, images) {
+		t.Errorf("expected images of the steps: %q, got: %q", expected, images)
+	}
+	errs := configs.Validate()
+	expected := "task 'release', step 1: image is required, unless the task has a `follow` or `build` field"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestGetConfigsWithMissingTemplate(t *testing.T) {
+	defer yamlStdin()()
+	stdin = strings.NewReader("tasks:\n  test:\n    steps:\n      - use: node\n        image: busybox")
+
+	_, err := GetConfigs("-")
+
+	expectedErr := "config: task 'test', step 1: template 'node' does not exist"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("broken pipe")
+}
+
+func TestGetConfigsFromStdinWithReadError(t *testing.T) {
+	defer func(original io.Reader) { stdin = original }(stdin)
+	stdin = failingReader{}
+
+	_, err := GetConfigs("-")
+
+	expectedErr := "config: failed to read task file from stdin: broken pipe"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestGetConfigsWithShellCommands(t *testing.T) {
+	var content = []byte(`
+shell: bash -c
+tasks:
+  global:
+    steps:
+      - image: busybox
+        command: "echo hi && ls"
+  task:
+    shell: sh -ec
+    steps:
+      - image: busybox
+        commands:
+          - ["ls", "-l"]
+          - "echo hi && ls"
+      - image: busybox
+        shell: ash -c
+        command: "echo hi"
+      - image: busybox
+        command: ["echo", "hi && ls"]`)
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := (Command{"bash", "-c", "echo hi && ls"}), configs.Tasks["global"].Steps[0].Command; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected command with global shell: %q, got: %q", expected, got)
+	}
+	steps := configs.Tasks["task"].Steps
+	if expected := []Command{{"ls", "-l"}, {"sh", "-ec", "echo hi && ls"}}; !reflect.DeepEqual(expected, steps[0].Commands) {
+		t.Errorf("expected commands with task shell: %q, got: %q", expected, steps[0].Commands)
+	}
+	if expected := (Command{"ash", "-c", "echo hi"}); !reflect.DeepEqual(expected, steps[1].Command) {
+		t.Errorf("expected command with step shell: %q, got: %q", expected, steps[1].Command)
+	}
+	if expected := (Command{"echo", "hi && ls"}); !reflect.DeepEqual(expected, steps[2].Command) {
+		t.Errorf("expected exec form command to be unchanged: %q, got: %q", expected, steps[2].Command)
+	}
+}
+
+func TestGetConfigsWithSharedShell(t *testing.T) {
+	var content = []byte(`
+tasks:
+  build:
+    shell: bash -c
+    steps:
+      - image: golang
+        sharedShell: true
+        commands:
+          - cd src
+          - ["go", "test", "-run", "Test Foo"]`)
+	var configs Configs
+	if err := yaml.Unmarshal(content, &configs); err != nil {
+		t.Fatal(err)
+	}
+
+	configs.applyShells()
+
+	step := configs.Tasks["build"].Steps[0]
+	if expected := []Command{{"cd src"}, {"go test -run 'Test Foo'"}}; !reflect.DeepEqual(expected, step.Commands) {
+		t.Errorf("expected commands as lines of a script: %q, got: %q", expected, step.Commands)
+	}
+	if expected := []string{"bash", "-c"}; !reflect.DeepEqual(expected, step.ScriptShell()) {
+		t.Errorf("expected script shell: %q, got: %q", expected, step.ScriptShell())
+	}
+}
+
+func TestGetConfigsWithCommandDirs(t *testing.T) {
+	var content = []byte(`
+tasks:
+  build:
+    steps:
+      - image: busybox
+        commands:
+          - ["ls"]
+          - dir: web
+            cmd: ["npm", "install"]
+          - dir: "` + "`$BUILD_DIR`" + `/api"
+            cmd: "go build ./..."`)
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("BUILD_DIR", "/src")
+	defer os.Unsetenv("BUILD_DIR")
+
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := configs.Tasks["build"].Steps[0]
+	if expected := []Command{{"ls"}, {"npm", "install"}, {"sh", "-c", "go build ./..."}}; !reflect.DeepEqual(expected, step.Commands) {
+		t.Errorf("expected commands: %q, got: %q", expected, step.Commands)
+	}
+	if err := step.ParseStepEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[int]string{1: "web", 2: "/src/api"}; !reflect.DeepEqual(expected, step.CommandDirs) {
+		t.Errorf("expected command directories: %v, got: %v", expected, step.CommandDirs)
+	}
+}
+
+func TestGetConfigsWithCommandDirOnSingleCommand(t *testing.T) {
+	var content = []byte(`
+tasks:
+  build:
+    steps:
+      - image: busybox
+        command:
+          dir: web
+          cmd: ["npm", "install"]`)
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GetConfigs(tmpFile.Name())
+
+	expected := "config: command cannot be given as an object with a `dir`, only the entries of `commands` can"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestGetConfigsWithDefaultShell(t *testing.T) {
+	var content = []byte(`
+tasks:
+  test:
+    steps:
+      - image: busybox
+        command: "echo hi && ls"`)
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := (Command{"sh", "-c", "echo hi && ls"}), configs.Tasks["test"].Steps[0].Command; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected command with default shell: %q, got: %q", expected, got)
+	}
+}
+
+func TestGetConfigsWithUserNames(t *testing.T) {
+	var content = []byte(`
+tasks:
+  test:
+    steps:
+      - image: node
+        user: 20
+      - image: node
+        user: node
+      - image: node
+        user: node:staff`)
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []string{"20", "node", "node:staff"} {
+		if got := configs.Tasks["test"].Steps[i].User; got != expected {
+			t.Errorf("expected user of step %d: %s, got: %s", i+1, expected, got)
+		}
+	}
+}
+
+func TestGetConfigsKeepsTaskOrder(t *testing.T) {
+	var content = []byte(`
+tasks:
+  test:unit:
+    steps:
+      - image: busybox
+  build:
+    steps:
+      - image: busybox
+  test:integration:
+    steps:
+      - image: busybox`)
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"test:unit", "build", "test:integration"}
+	if got := configs.TaskNames(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected task names: %v, got: %v", expected, got)
+	}
+}
+
+func TestTaskNamesWithoutTaskFile(t *testing.T) {
+	configs := &Configs{Tasks: map[string]Task{"test": {}, "build": {}, "lint": {}}}
+
+	expected := []string{"build", "lint", "test"}
+	if got := configs.TaskNames(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected task names: %v, got: %v", expected, got)
+	}
+}
+
+func TestParseEnv_InvalidEnv(t *testing.T) {
+	step := getSampleStep()
+	step.Image = "node:10.15.0"
+	step.Envs = []string{"MYVAR=MYVAL", "MYUSR=dunner=invalid"}
+	var tasks = make(map[string]Task)
+	tasks["test"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	expectedErr := fmt.Errorf(
+		`config: invalid format of environment variable: %s`,
+		"MYUSR=dunner=invalid",
+	)
+
+	if err := ParseEnvs(configs); err.Error() != expectedErr.Error() {
+		t.Fatalf("Did not receive proper error on invalid format of environment variable, %v != %v", err, expectedErr)
+	}
+}
+
+func TestParseEnv_EnvNotExist(t *testing.T) {
+	step := getSampleStep()
+	step.Image = "node:10.15.0"
+	step.Envs = []string{"MYVAR=MYVAL", "MYUSR=`$MYDUNNER`"}
+	var tasks = make(map[string]Task)
+	tasks["test"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	expectedErr := fmt.Errorf(
+		`config: could not find environment variable '%v' in %s file or among host environment variables`,
+		"MYDUNNER",
+		viper.GetString("DotenvFile"),
+	)
+
+	if err := ParseEnvs(configs); err.Error() != expectedErr.Error() {
+		t.Fatalf("Did not receive proper error on invalid format of environment variable, %v != %v", err, expectedErr)
+	}
+}
+
+func TestParseEnv_InterpolatesHostEnv(t *testing.T) {
+	if err := os.Setenv("CI_TOKEN", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("CI_TOKEN")
+	step := getSampleStep()
+	step.Envs = []string{"TOKEN=$CI_TOKEN", "AUTH=token:${CI_TOKEN}", "PRICE=$$5", "PLAIN=value"}
+	var configs = &Configs{
+		Envs:  []string{"GLOBAL=$CI_TOKEN"},
+		Tasks: map[string]Task{"test": {Envs: []string{"TASK=${CI_TOKEN}"}, Steps: []Step{step}}},
+	}
+
+	if err := ParseEnvs(configs); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"TOKEN=secret", "AUTH=token:secret", "PRICE=$5", "PLAIN=value"}
+	if got := configs.Tasks["test"].Steps[0].Envs; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected step envs: %v, got: %v", expected, got)
+	}
+	if got := configs.Tasks["test"].Envs; !reflect.DeepEqual([]string{"TASK=secret"}, got) {
+		t.Errorf("expected task envs: [TASK=secret], got: %v", got)
+	}
+	if got := configs.Envs; !reflect.DeepEqual([]string{"GLOBAL=secret"}, got) {
+		t.Errorf("expected global envs: [GLOBAL=secret], got: %v", got)
+	}
+}
+
+func TestParseEnv_InterpolatesEarlierEnvs(t *testing.T) {
+	if err := os.Setenv("DUNNER_TEST_PREFIX", "/usr"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("DUNNER_TEST_PREFIX")
+	step := getSampleStep()
+	step.Envs = []string{"BASE=/home", "BASE=/ignored", "DATA=${BASE}/data", "APPS=$APP:$LIB", "PRICE=$$BASE"}
+	hook := getSampleStep()
+	hook.Envs = []string{"CACHE=$BASE/cache"}
+	var configs = &Configs{
+		Envs:   []string{"BASE=$DUNNER_TEST_PREFIX/opt", "LIB=$BASE/lib"},
+		Before: []Step{hook},
+		Tasks:  map[string]Task{"test": {Envs: []string{"BASE=/srv", "APP=$BASE/app"}, Steps: []Step{step}}},
+	}
+
+	if err := ParseEnvs(configs); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"BASE=/home", "BASE=/ignored", "DATA=/home/data", "APPS=/srv/app:/usr/opt/lib", "PRICE=$BASE"}
+	if got := configs.Tasks["test"].Steps[0].Envs; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected step envs: %v, got: %v", expected, got)
+	}
+	if expected := []string{"BASE=/srv", "APP=/srv/app"}; !reflect.DeepEqual(expected, configs.Tasks["test"].Envs) {
+		t.Errorf("expected task envs: %v, got: %v", expected, configs.Tasks["test"].Envs)
+	}
+	if expected := []string{"BASE=/usr/opt", "LIB=/usr/opt/lib"}; !reflect.DeepEqual(expected, configs.Envs) {
+		t.Errorf("expected global envs: %v, got: %v", expected, configs.Envs)
+	}
+	if expected := []string{"CACHE=/usr/opt/cache"}; !reflect.DeepEqual(expected, configs.Before[0].Envs) {
+		t.Errorf("expected hook envs: %v, got: %v", expected, configs.Before[0].Envs)
+	}
+}
+
+func TestParseEnv_ForwardReference(t *testing.T) {
+	if err := os.Setenv("BASE", "/host"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("BASE")
+	step := getSampleStep()
+	step.Envs = []string{"BIN=$BASE/bin", "BASE=/opt"}
+	var configs = &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	expectedErr := "config: environment variable 'BIN' refers to 'BASE', which is defined after it"
+	if err := ParseEnvs(configs); err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestParseEnv_LeavesArgs(t *testing.T) {
+	step := getSampleStep()
+	step.Envs = []string{"OUT=${target}", "HOME_DIR=$${HOME}", "PRICE=$$5"}
+	var configs = &Configs{
+		Envs:  []string{"TASK=${DUNNER_TASK}"},
+		Tasks: map[string]Task{"build": {Args: []TaskArg{{Name: "target"}}, Envs: []string{"VERSION=${tag}", "IMAGE=app:$VERSION"}, Steps: []Step{step}}},
+	}
+
+	if err := ParseEnvs(configs); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := []string{"OUT=${target}", "HOME_DIR=$${HOME}", "PRICE=$5"}; !reflect.DeepEqual(expected, configs.Tasks["build"].Steps[0].Envs) {
+		t.Errorf("expected step envs: %v, got: %v", expected, configs.Tasks["build"].Steps[0].Envs)
+	}
+	if expected := []string{"VERSION=${tag}", "IMAGE=app:${tag}"}; !reflect.DeepEqual(expected, configs.Tasks["build"].Envs) {
+		t.Errorf("expected task envs: %v, got: %v", expected, configs.Tasks["build"].Envs)
+	}
+	if expected := []string{"TASK=${DUNNER_TASK}"}; !reflect.DeepEqual(expected, configs.Envs) {
+		t.Errorf("expected global envs: %v, got: %v", expected, configs.Envs)
+	}
+}
+
+func TestParseEnv_InterpolatedEnvNotExist(t *testing.T) {
+	step := getSampleStep()
+	step.Envs = []string{"TOKEN=prefix-$DUNNER_NOT_EXISTING_TOKEN"}
+	var configs = &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	expectedErr := fmt.Sprintf(
+		`config: could not find environment variable '%v' in %s file or among host environment variables`,
+		"DUNNER_NOT_EXISTING_TOKEN",
+		viper.GetString("DotenvFile"),
+	)
+
+	if err := ParseEnvs(configs); err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestConfigs_Validate(t *testing.T) {
+	var tasks = make(map[string]Task)
+	tasks["test"] = Task{Steps: []Step{getSampleStep()}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("Configs Validation failed, expected to pass. got: %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithNoTasks(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("Configs validation failed, expected no error, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithEmptyImageAndCommand(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	step := Step{Image: "", Command: []string{""}}
+	tasks["stats"] = Task{Steps: []Step{step}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d : %s", len(errs), errs)
+	}
+
+	expected1 := "task 'stats', step 1: image is required, unless the task has a `follow` or `build` field"
+	expected2 := "task 'stats', step 1: command[0] is a required field"
+	if errs[0].Error() != expected1 {
+		t.Fatalf("expected: %s, got: %s", expected1, errs[0].Error())
+	}
+	if errs[1].Error() != expected2 {
+		t.Fatalf("expected: %s, got: %s", expected2, errs[1].Error())
+	}
+}
+
+func TestConfigs_ValidateForAliasTask(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	tasks["foo"] = Task{Steps: []Step{{Image: "golang", Command: []string{"go", "version"}}}}
+	tasks["stats"] = Task{Steps: []Step{{Follow: "foo"}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateReportsAllErrors(t *testing.T) {
+	var content = []byte(`
+tasks:
+  build:
+    steps:
+      - image: golang
+        command: ["go", "build"]
+      - command: ["go", "test"]
+        mounts: ["invalid_dir"]
+  empty:
+    steps: []
+  test:
+    steps:
+      - image: golang
+        comand: ["go", "test"]`)
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := configs.Validate()
+
+	expected := []string{
+		"line 14: unknown field 'comand' in step",
+		"task 'build', step 2: image is required, unless the task has a `follow` or `build` field",
+		"task 'build', step 2: mount directory 'invalid_dir' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level",
+		"task 'empty': at least one step is required",
+	}
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected errors: %q, got: %q", expected, got)
+	}
+}
+
+func TestConfigs_ValidateWithBuildContext(t *testing.T) {
+	wd, _ := os.Getwd()
+	tasks := map[string]Task{"build": {Steps: []Step{{Build: wd, Command: []string{"go", "version"}}}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateWithBothImageAndBuild(t *testing.T) {
+	wd, _ := os.Getwd()
+	tasks := map[string]Task{"build": {Steps: []Step{{Image: "golang", Build: wd, Command: []string{"go", "version"}}}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+	expected := fmt.Sprintf("task 'build', step 1: image cannot be given along with build context '%s', only one of them is allowed", wd)
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithInvalidBuildContext(t *testing.T) {
+	tasks := map[string]Task{"build": {Steps: []Step{{Build: "./not_existing_dir", Command: []string{"go", "version"}}}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+	expected := "task 'build', step 1: build context './not_existing_dir' is invalid. Check if the directory exists."
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithResourceLimits(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}, Memory: "512m", CPUs: 1.5}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateWithInvalidResourceLimits(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}, Memory: "lots", CPUs: -1}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d : %s", len(errs), errs)
+	}
+	expected := "task 'build', step 1: memory limit 'lots' is invalid. Use a positive number with an optional unit suffix like 512m or 2g"
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+	expected = "task 'build', step 1: cpus must be 0 or greater"
+	if errs[1].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[1].Error())
+	}
+}
+
+func TestConfigs_ValidateWithInvalidPullPolicy(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}, PullPolicy: "sometimes"}
+	configs := &Configs{PullPolicy: "often", Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d : %s", len(errs), errs)
+	}
+	expected := "pull policy 'often' is invalid. It must be one of: always, missing, never"
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+	expected = "task 'build', step 1: pull policy 'sometimes' is invalid. It must be one of: always, missing, never"
+	if errs[1].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[1].Error())
+	}
+}
+
+func TestConfigs_ValidateWithWaitFor(t *testing.T) {
+	for _, waitFor := range []WaitFor{{Address: "localhost:5432"}, {Command: Command{"pg_isready"}}} {
+		step := Step{Image: "postgres", Command: []string{"ls"}, WaitFor: &waitFor}
+		configs := &Configs{Tasks: map[string]Task{"db": {Steps: []Step{step}}}}
+
+		if errs := configs.Validate(); len(errs) != 0 {
+			t.Errorf("expected no errors for %v, got %d : %s", waitFor, len(errs), errs)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithInvalidWaitFor(t *testing.T) {
+	invalid := []WaitFor{{}, {Address: "localhost"}, {Address: "localhost:5432", Command: Command{"pg_isready"}}}
+	for _, waitFor := range invalid {
+		step := Step{Image: "postgres", Command: []string{"ls"}, WaitFor: &waitFor}
+		configs := &Configs{Tasks: map[string]Task{"db": {Steps: []Step{step}}}}
+
+		errs := configs.Validate()
+
+		expected := "task 'db', step 1: waitFor needs either an address of the form host:port or a command, but not both"
+		if len(errs) != 1 || errs[0].Error() != expected {
+			t.Errorf("expected error for %v: %s, got: %s", waitFor, expected, errs)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	for memory, expected := range map[string]int64{"1024": 1024, "64k": 64 << 10, "512m": 512 << 20, "2g": 2 << 30} {
+		bytes, err := ParseMemory(memory)
+		if err != nil {
+			t.Errorf("expected no error for '%s', got: %s", memory, err)
+		}
+		if bytes != expected {
+			t.Errorf("expected '%s' to be %d bytes, got: %d", memory, expected, bytes)
+		}
+	}
+	if _, err := ParseMemory("0"); err == nil {
+		t.Error("expected error for zero memory limit, got none")
+	}
+}
+
+var followCycleTests = []struct {
+	name  string
+	tasks map[string]Task
+	err   string
+}{
+	{
+		"self",
+		map[string]Task{"run": {Steps: []Step{{Follow: "run"}}}},
+		"dunner: cyclic task dependency detected: run -> run",
+	},
+	{
+		"two tasks",
+		map[string]Task{
+			"run":   {Steps: []Step{{Follow: "build"}}},
+			"build": {Steps: []Step{getSampleStep(), {Follow: "run"}}},
+		},
+		"dunner: cyclic task dependency detected: build -> run -> build",
+	},
+	{
+		"three tasks",
+		map[string]Task{
+			"run":   {Steps: []Step{{Follow: "build"}}},
+			"build": {Steps: []Step{{Follow: "test"}}},
+			"test":  {Steps: []Step{getSampleStep(), {Follow: "run"}}},
+			"lint":  {Steps: []Step{{Follow: "test"}}},
+		},
+		"dunner: cyclic task dependency detected: build -> test -> run -> build",
+	},
+}
+
+func TestConfigs_ValidateWithFollowCycle(t *testing.T) {
+	for _, tt := range followCycleTests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs := &Configs{Tasks: tt.tasks}
+
+			errs := configs.Validate()
+
+			if len(errs) != 1 {
+				t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+			}
+			if errs[0].Error() != tt.err {
+				t.Fatalf("expected: %s, got: %s", tt.err, errs[0].Error())
+			}
+		})
+	}
+}
+
+func TestConfigs_ValidateWithStepNeeds(t *testing.T) {
+	build, lint, test := getSampleStep(), getSampleStep(), getSampleStep()
+	build.Name, lint.Name, test.Name = "build", "lint", "test"
+	test.Needs = []string{"build", "lint"}
+	configs := &Configs{Tasks: map[string]Task{"ci": {Steps: []Step{build, lint, test}}}}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateWithMissingStepNeed(t *testing.T) {
+	test := getSampleStep()
+	test.Name, test.Needs = "test", []string{"build"}
+	configs := &Configs{Tasks: map[string]Task{"ci": {Steps: []Step{test}}}}
+
+	errs := configs.Validate()
+
+	expected := "task 'ci', step 1: needed step 'build' does not exist in the task"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateWithSetupStepNeeds(t *testing.T) {
+	network, volume, test, seed := getSampleStep(), getSampleStep(), getSampleStep(), getSampleStep()
+	network.Name, network.Setup = "network", true
+	volume.Name, volume.Setup, volume.Needs = "volume", true, []string{"network", "seed"}
+	test.Name, test.Needs = "test", []string{"network"}
+	seed.Name, seed.Setup, seed.Needs = "seed", true, []string{"test"}
+	configs := &Configs{Tasks: map[string]Task{"ci": {Steps: []Step{network, volume, test, seed}}}}
+
+	errs := configs.Validate()
+
+	expected := []string{
+		"task 'ci', step 2: setup step cannot need step 'seed', which is not a setup step before it",
+		"task 'ci', step 4: setup step cannot need step 'test', which is not a setup step before it",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
+	}
+}
+
+func TestConfigs_ValidateWithStepNeedsCycle(t *testing.T) {
+	build, test, deploy := getSampleStep(), getSampleStep(), getSampleStep()
+	build.Name, build.Needs = "build", []string{"deploy"}
+	test.Name, test.Needs = "test", []string{"build"}
+	deploy.Name, deploy.Needs = "deploy", []string{"test"}
+	configs := &Configs{Tasks: map[string]Task{"ci": {Steps: []Step{build, test, deploy}}}}
+
+	errs := configs.Validate()
+
+	expected := "dunner: cyclic step dependency detected in 'ci' task: build -> deploy -> test -> build"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateWithSharedFollowTask(t *testing.T) {
+	tasks := map[string]Task{
+		"run":   {Steps: []Step{{Follow: "build"}, {Follow: "test"}}},
+		"test":  {Steps: []Step{{Follow: "build"}}},
+		"build": {Steps: []Step{getSampleStep()}},
+	}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateWithInvalidMountFormat(t *testing.T) {
+	step := getSampleStep()
+	step.Mounts = []string{"invalid_dir"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats', step 1: mount directory 'invalid_dir' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level"
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithValidMountDirectory(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if errs != nil {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithMountDirFromEnv(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if errs != nil {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithNoModeGiven(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if errs != nil {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithInvalidMode(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s:ab", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	expected := fmt.Sprintf("task 'stats', step 1: mount directory '%s' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level", step.Mounts[0])
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithInvalidMountDirectory(t *testing.T) {
+	step := getSampleStep()
+	step.Mounts = []string{"./blah:foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats', step 1: mount directory './blah:foo:w' is invalid. Check if source directory path exists."
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithValidEnvInMountDir(t *testing.T) {
+	os.Setenv("TEST_DIR", util.HomeDir)
+	defer os.Setenv("TEST_DIR", "")
+	step := getSampleStep()
+	step.Mounts = []string{"`$TEST_DIR`:foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected 0 errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateWithEnvInMountDir_Invalid(t *testing.T) {
+	os.Setenv("TEST_DIR", "/test_invalid")
+	defer os.Setenv("TEST_DIR", "")
+	step := getSampleStep()
+	step.Mounts = []string{"`$TEST_DIR`:foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats', step 1: mount directory '`$TEST_DIR`:foo:w' is invalid. Check if source directory path exists."
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithNonExistingEnvInMountDir(t *testing.T) {
+	step := getSampleStep()
+	step.Mounts = []string{"`$TEST_DIR_DUNNER`:foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
 		Tasks: tasks,
 	}
 
-	if !reflect.DeepEqual(expected, *pout) {
-		t.Fatalf("Output not equal to expected; %v != %v", expected, *pout)
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats', step 1: mount directory '`$TEST_DIR_DUNNER`:foo:w' is invalid. Check if source directory path exists."
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func getSampleStep() Step {
+	return Step{Image: "image_name", Command: []string{"node", "--version"}}
+}
+
+func TestInitValidatorForNilTranslation(t *testing.T) {
+	vals := []customValidation{{tag: "foo", translation: "", validationFn: nil}}
+
+	err := initValidator(vals)
+
+	if err != nil {
+		t.Fatalf("expected nil, got %s", err)
+	}
+}
+
+func TestInitValidatorForEmptyTag(t *testing.T) {
+	vals := []customValidation{{tag: "", translation: "",
+		validationFn: func(context.Context, validator.FieldLevel) bool { return false }}}
+
+	err := initValidator(vals)
+
+	expected := "failed to register validation: Function Key cannot be empty"
+	if err == nil {
+		t.Fatalf("expected %s, got %s", expected, err)
+	}
+	if err.Error() != expected {
+		t.Fatalf("expected %s, got %s", expected, err.Error())
+	}
+}
+
+var lookupEnvtests = []struct {
+	in  string
+	out string
+	err error
+}{
+	{"", "", nil},
+	{"foo", "foo", nil},
+	{"/foo/bar", "/foo/bar", nil},
+	{"/foo/`$bar", "/foo/`$bar", nil},
+	{util.HomeDir, util.HomeDir, nil},
+	{"`$HOME`", util.HomeDir, nil},
+	{"`$HOME`/foo", util.HomeDir + "/foo", nil},
+	{"`$HOME`/foo/`$HOME`", util.HomeDir + "/foo/" + util.HomeDir, nil},
+	{"`$INVALID_TEST`/foo", "`$INVALID_TEST`/foo", fmt.Errorf("could not find environment variable 'INVALID_TEST'")},
+}
+
+func TestLookUpDirectory(t *testing.T) {
+	for _, tt := range lookupEnvtests {
+		t.Run(tt.in, func(t *testing.T) {
+			parsedDir, err := lookupDirectory(tt.in)
+			if parsedDir != tt.out {
+				t.Errorf("got %q, want %q", parsedDir, tt.out)
+			}
+			if !reflect.DeepEqual(tt.err, err) {
+				t.Errorf("got %q, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeMount(t *testing.T) {
+	step := &docker.Step{}
+	mounts := []string{fmt.Sprintf("%s:/app:r", util.HomeDir)}
+
+	err := DecodeMount(mounts, "", step)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
+	if (*step).ExtMounts == nil {
+		t.Fatalf("expected ExtMounts to be set, got nil")
+	}
+	if len((*step).ExtMounts) != 1 {
+		t.Fatalf("expected ExtMounts to be of length 1, got %d", len((*step).ExtMounts))
+	}
+	if (*step).ExtMounts[0].Source != util.HomeDir {
+		t.Fatalf("expected ExtMounts to be %s, got %s", util.HomeDir, (*step).ExtMounts[0].Source)
+	}
+}
+
+func TestDecodeMountWithEnvironmentVariable(t *testing.T) {
+	step := &docker.Step{}
+	mounts := []string{"/tmp:/app"}
+
+	err := DecodeMount(mounts, "", step)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
+	if (*step).ExtMounts == nil {
+		t.Fatalf("expected ExtMounts to be set, got nil")
+	}
+	if len((*step).ExtMounts) != 1 {
+		t.Fatalf("expected ExtMounts to be of length 1, got %d", len((*step).ExtMounts))
+	}
+	if (*step).ExtMounts[0].Source != "/tmp" {
+		t.Fatalf("expected ExtMounts Source to be '/tmp', got %s", (*step).ExtMounts[0].Source)
 	}
+	if (*step).ExtMounts[0].Target != "/app" {
+		t.Fatalf("expected ExtMounts Source to be '/app', got %s", (*step).ExtMounts[0].Target)
+	}
+}
+
+func TestDecodeMountWithShorthandHomeDir(t *testing.T) {
+	step := &docker.Step{}
+	mounts := []string{"~/tmp:/app"}
 
+	err := DecodeMount(mounts, "", step)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
+	if (*step).ExtMounts == nil {
+		t.Fatalf("expected ExtMounts to be set, got nil")
+	}
+	if len((*step).ExtMounts) != 1 {
+		t.Fatalf("expected ExtMounts to be of length 1, got %d", len((*step).ExtMounts))
+	}
+	if (*step).ExtMounts[0].Source != fmt.Sprintf("%s/tmp", util.HomeDir) {
+		t.Fatalf("expected ExtMounts Source to be '/tmp', got %s", (*step).ExtMounts[0].Source)
+	}
+	if (*step).ExtMounts[0].Target != "/app" {
+		t.Fatalf("expected ExtMounts Source to be '/app', got %s", (*step).ExtMounts[0].Target)
+	}
 }
 
-func TestParseEnv_InvalidEnv(t *testing.T) {
+func TestDecodeMountWithNamedVolume(t *testing.T) {
+	step := &docker.Step{}
+	mounts := []string{"mycache:/root/.cache:w", "data:/data"}
+
+	err := DecodeMount(mounts, "", step)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
+	expected := []mount.Mount{
+		{Type: mount.TypeVolume, Source: "mycache", Target: "/root/.cache", ReadOnly: false},
+		{Type: mount.TypeVolume, Source: "data", Target: "/data", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(expected, (*step).ExtMounts) {
+		t.Fatalf("expected: %v, got: %v", expected, (*step).ExtMounts)
+	}
+}
+
+func TestDecodeMountWithOptions(t *testing.T) {
+	step := &docker.Step{}
+	mounts := []string{"/tmp:/src:w,cached", "/tmp:/logs:delegated", "/tmp:/shared:rw,rshared", "cache:/cache:consistent"}
+
+	err := DecodeMount(mounts, "", step)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
+	expected := []mount.Mount{
+		{Type: mount.TypeBind, Source: "/tmp", Target: "/src", ReadOnly: false, Consistency: mount.ConsistencyCached},
+		{Type: mount.TypeBind, Source: "/tmp", Target: "/logs", ReadOnly: true, Consistency: mount.ConsistencyDelegated},
+		{Type: mount.TypeBind, Source: "/tmp", Target: "/shared", ReadOnly: false, BindOptions: &mount.BindOptions{Propagation: mount.PropagationRShared}},
+		{Type: mount.TypeVolume, Source: "cache", Target: "/cache", ReadOnly: true, Consistency: mount.ConsistencyFull},
+	}
+	if !reflect.DeepEqual(expected, step.ExtMounts) {
+		t.Fatalf("expected: %v, got: %v", expected, step.ExtMounts)
+	}
+}
+
+func TestDecodeMountWithInvalidOptions(t *testing.T) {
+	for m, expected := range map[string]string{
+		"/tmp:/src:w,fast":        "config: invalid mount '/tmp:/src:w,fast': unknown option 'fast'",
+		"/tmp:/src:cached,r,w":    "config: invalid mount '/tmp:/src:cached,r,w': option 'w' is a mode given along with another one",
+		"cache:/cache:w,rslave":   "config: invalid mount 'cache:/cache:w,rslave': propagation 'rslave' only applies to directories of the host, not to named volumes",
+		"/tmp:/src:cached,cached": "config: invalid mount '/tmp:/src:cached,cached': option 'cached' is a consistency given along with another one",
+	} {
+		err := DecodeMount([]string{m}, "", &docker.Step{})
+
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error: %s, got: %v", expected, err)
+		}
+	}
+}
+
+func TestValidateMountDirWithOptions(t *testing.T) {
+	err := initValidator(customValidations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for m, valid := range map[string]bool{
+		"/tmp:/src":            true,
+		"/tmp:/src:w":          true,
+		"/tmp:/src:rw,cached":  true,
+		"/tmp:/src:rslave":     true,
+		"/tmp:/src:w,fast":     false,
+		"/tmp:/src:r,w":        false,
+		"cache:/cache:rshared": false,
+	} {
+		err := govalidator.Var(m, "mountdir")
+
+		if valid != (err == nil) {
+			t.Errorf("expected mount '%s' to be valid: %t, got error: %v", m, valid, err)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithNamedVolume(t *testing.T) {
 	step := getSampleStep()
-	step.Image = "node:10.15.0"
-	step.Envs = []string{"MYVAR=MYVAL", "MYUSR=dunner=invalid"}
+	step.Mounts = []string{"mycache:/root/.cache:w"}
 	var tasks = make(map[string]Task)
-	tasks["test"] = Task{Steps: []Step{step}}
+	tasks["stats"] = Task{Steps: []Step{step}}
 	var configs = &Configs{
 		Tasks: tasks,
 	}
 
-	expectedErr := fmt.Errorf(
-		`config: invalid format of environment variable: %s`,
-		"MYUSR=dunner=invalid",
-	)
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestGetDunnerTaskFileWithCustomFileFromUser(t *testing.T) {
+	taskFile := ".test_dunner.yaml"
+
+	got, err := getDunnerTaskFile(taskFile)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got != taskFile {
+		t.Fatalf("expected original taskfile from user %s, got %s", taskFile, got)
+	}
+}
+
+func TestGetDunnerTaskFileWithDefaultValue(t *testing.T) {
+	taskFile := internal.DefaultDunnerTaskFileName
+
+	got, err := getDunnerTaskFile(taskFile)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !strings.HasSuffix(got, taskFile) {
+		t.Fatalf("expected taskfile to end with %s, got %s", taskFile, got)
+	}
+}
+
+func TestGetConfigsWhenNotPresentTillRoot(t *testing.T) {
+	taskFile := internal.DefaultDunnerTaskFileName
+	revert := setup(t)
+	defer revert()
+
+	got, err := GetConfigs(taskFile)
+
+	if got != nil {
+		t.Errorf("expected Configs to be nil, got %v", got)
+	}
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	expectedErr := "config: failed to find Dunner task file .dunner.yaml, dunner.yaml, dunner.json or dunner.toml in"
+	if !strings.HasPrefix(err.Error(), expectedErr) {
+		t.Fatalf("expected error: %s, got: %s", expectedErr, err.Error())
+	}
+}
+
+func TestGetDunnerTaskFileFromParentDirectory(t *testing.T) {
+	revert := setup(t)
+	defer revert()
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, internal.AlternateDunnerTaskFileName), []byte("tasks: {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	subDir := filepath.Join(root, "sub", "dir")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(subDir); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := getDunnerTaskFile(internal.DefaultDunnerTaskFileName)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expected := filepath.Join(root, internal.AlternateDunnerTaskFileName)
+	if got != expected {
+		t.Fatalf("expected task file %s, got %s", expected, got)
+	}
+}
+
+// yamlStdin makes the task file read from stdin be read as YAML, and returns a function reverting the stdin and its format
+func yamlStdin() func() {
+	original := stdin
+	viper.Set("Task-file-format", FormatYAML)
+	return func() {
+		stdin = original
+		viper.Set("Task-file-format", "")
+	}
+}
+
+func setup(t *testing.T) func() {
+	folder, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Errorf("Failed to create temp dir: %s", err.Error())
+	}
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed to get working directory: %s", err.Error())
+	}
+
+	if err = os.Chdir(folder); err != nil {
+		t.Errorf("Failed to change working directory: %s", err.Error())
+	}
+	return func() {
+		if err = os.Chdir(previous); err != nil {
+			t.Errorf("Failed to revert change in working directory: %s", err.Error())
+		}
+	}
+}
+
+func TestParseStepEnvToReplaceDirSuccess(t *testing.T) {
+	mainDir := "MY_ENVNAME"
+	os.Setenv(mainDir, "foobar")
+	subDir := "SUBDIR"
+	os.Setenv(subDir, "dunner")
+	defer os.Unsetenv(mainDir)
+	defer os.Unsetenv(subDir)
+	step := &Step{Image: "node", Dir: fmt.Sprintf("/tmp/`$%s`/`$%s`", mainDir, subDir)}
+
+	err := step.ParseStepEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expected := "/tmp/foobar/dunner"
+	if step.Dir != expected {
+		t.Errorf("expected step dir: %s, got: %s", expected, step.Dir)
+	}
+}
+
+func TestParseStepEnvToReplaceDirFailure(t *testing.T) {
+	env := "MY_UNSET_ENV"
+	sErr := os.Unsetenv(env)
+	if sErr != nil {
+		t.Fatalf("failed to setup test environment: %s", sErr)
+	}
+	dir := "/tmp/`$MY_UNSET_ENV`"
+	step := &Step{Image: "node", Dir: dir}
+
+	err := step.ParseStepEnv()
+
+	expectedErr := "could not find environment variable 'MY_UNSET_ENV'"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error %s, got %s", expectedErr, err)
+	}
+	if step.Dir != dir {
+		t.Errorf("expected step dir: %s, got: %s", dir, step.Dir)
+	}
+}
+
+func TestParseStepEnvToReplaceMountSuccess(t *testing.T) {
+	srcDir := "MY_ENVNAME"
+	os.Setenv(srcDir, "foobar")
+	destDir := "SUBDIR"
+	os.Setenv(destDir, "dunner")
+	defer os.Unsetenv(srcDir)
+	defer os.Unsetenv(destDir)
+	step := &Step{Image: "node", Mounts: []string{fmt.Sprintf("/tmp/`$%s`:/tmp/`$%s`/foo:w", srcDir, destDir)}}
+
+	err := step.ParseStepEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expected := "/tmp/foobar:/tmp/dunner/foo:w"
+	if step.Mounts[0] != expected {
+		t.Errorf("expected step mount: %s, got: %s", expected, step.Mounts[0])
+	}
+}
+
+func TestParseStepEnvToReplaceMountFailure(t *testing.T) {
+	srcDir := "MY_ENVNAME"
+	os.Setenv(srcDir, "foobar")
+	defer os.Unsetenv(srcDir)
+	destDir := "SUBDIR"
+	os.Unsetenv(destDir)
+	mount := fmt.Sprintf("/tmp/`$%s`:/tmp/`$%s`/foo:w", srcDir, destDir)
+	step := &Step{Image: "node", Mounts: []string{mount}}
 
-	if err := ParseEnvs(configs); err.Error() != expectedErr.Error() {
-		t.Fatalf("Did not receive proper error on invalid format of environment variable, %v != %v", err, expectedErr)
+	err := step.ParseStepEnv()
+
+	expectedErr := "could not find environment variable 'SUBDIR'"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error %s, got %s", expectedErr, err)
+	}
+	if step.Mounts[0] != mount {
+		t.Errorf("expected step mount: %s, got: %s", mount, step.Mounts[0])
 	}
 }
 
-func TestParseEnv_EnvNotExist(t *testing.T) {
-	step := getSampleStep()
-	step.Image = "node:10.15.0"
-	step.Envs = []string{"MYVAR=MYVAL", "MYUSR=`$MYDUNNER`"}
-	var tasks = make(map[string]Task)
-	tasks["test"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestParseStepEnvToReplaceUserFailure(t *testing.T) {
+	env := "UNSET_USER"
+	sErr := os.Unsetenv(env)
+	if sErr != nil {
+		t.Fatalf("failed to setup test environment: %s", sErr)
 	}
+	user := "`$UNSET_USER`"
+	step := &Step{Image: "node", User: user}
 
-	expectedErr := fmt.Errorf(
-		`config: could not find environment variable '%v' in %s file or among host environment variables`,
-		"MYDUNNER",
-		viper.GetString("DotenvFile"),
-	)
+	err := step.ParseStepEnv()
 
-	if err := ParseEnvs(configs); err.Error() != expectedErr.Error() {
-		t.Fatalf("Did not receive proper error on invalid format of environment variable, %v != %v", err, expectedErr)
+	expectedErr := "could not find environment variable 'UNSET_USER'"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error %s, got %s", expectedErr, err)
+	}
+	if step.User != user {
+		t.Errorf("expected step dir: %s, got: %s", user, step.User)
 	}
 }
 
-func TestConfigs_Validate(t *testing.T) {
-	var tasks = make(map[string]Task)
-	tasks["test"] = Task{Steps: []Step{getSampleStep()}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestParseStepEnvToReplaceUserSuccess(t *testing.T) {
+	step := &Step{Image: "node", User: "`$USER`"}
+
+	err := step.ParseStepEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
 	}
+	if step.User != os.Getenv("USER") {
+		t.Errorf("expected step dir: %s, got: %s", os.Getenv("USER"), step.User)
+	}
+}
 
-	errs := configs.Validate()
+func TestConfigs_ValidateWithTaskArgs(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}}
+	args := []TaskArg{{Name: "env", Required: true}, {Name: "replicas", Type: ArgInt}, {Name: "dry", Type: ArgBool}}
+	configs := &Configs{Tasks: map[string]Task{"deploy": {Args: args, Steps: []Step{step}}}}
 
-	if len(errs) != 0 {
-		t.Fatalf("Configs Validation failed, expected to pass. got: %s", errs)
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
 	}
 }
 
-func TestConfigs_ValidateWithNoTasks(t *testing.T) {
-	tasks := make(map[string]Task, 0)
-	configs := &Configs{Tasks: tasks}
+func TestConfigs_ValidateWithInvalidTaskArgs(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}}
+	args := []TaskArg{{Name: "replicas", Type: "float"}, {Name: "env", Required: true}, {Name: "env"}, {Type: ArgInt}}
+	configs := &Configs{Tasks: map[string]Task{"deploy": {Args: args, Steps: []Step{step}}}}
 
 	errs := configs.Validate()
 
-	if len(errs) != 0 {
-		t.Fatalf("Configs validation failed, expected no error, got %s", errs)
+	expected := []string{
+		"task 'deploy': argument type 'float' is invalid. It must be one of: string, int, bool",
+		"task 'deploy': name is a required field",
+		"task 'deploy': required argument 'env' cannot come after the optional argument 'replicas'",
+		"task 'deploy': argument 'env' is given more than once",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d : %s", len(expected), len(errs), errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected: %s, got: %s", expected[i], errs[i].Error())
+		}
 	}
 }
 
-func TestConfigs_ValidateWithEmptyImageAndCommand(t *testing.T) {
-	tasks := make(map[string]Task, 0)
-	step := Step{Image: "", Command: []string{""}}
-	tasks["stats"] = Task{Steps: []Step{step}}
-	configs := &Configs{Tasks: tasks}
+func TestConfigs_ValidateWithRegistryAuth(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}}
+	auth := map[string]RegistryAuth{
+		"docker.io": {Username: "user", Password: "pass"},
+		"quay.io":   {Token: "t0ken"},
+		"ghcr.io":   {Username: "user", Token: "t0ken"},
+		"gcr.io":    {Username: "user"},
+	}
+	configs := &Configs{Auth: auth, Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
 
 	errs := configs.Validate()
 
 	if len(errs) != 2 {
 		t.Fatalf("expected 2 errors, got %d : %s", len(errs), errs)
 	}
+	expected := "registry auth needs either a username and a password or a token, but not both"
+	for _, err := range errs {
+		if err.Error() != expected {
+			t.Errorf("expected: %s, got: %s", expected, err.Error())
+		}
+	}
+}
 
-	expected1 := "task 'stats': image is required, unless the task has a `follow` field"
-	expected2 := "task 'stats': command[0] is a required field"
-	if errs[0].Error() != expected1 {
-		t.Fatalf("expected: %s, got: %s", expected1, errs[0].Error())
+func TestRegistryAuthParseEnv(t *testing.T) {
+	os.Setenv("DUNNER_REGISTRY_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("DUNNER_REGISTRY_PASSWORD")
+	auth := RegistryAuth{Username: "user", Password: "${DUNNER_REGISTRY_PASSWORD}"}
+
+	parsed, err := auth.ParseEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
 	}
-	if errs[1].Error() != expected2 {
-		t.Fatalf("expected: %s, got: %s", expected2, errs[1].Error())
+	if expected := (RegistryAuth{Username: "user", Password: "s3cr3t"}); parsed != expected {
+		t.Errorf("expected: %v, got: %v", expected, parsed)
+	}
+	if _, err := (RegistryAuth{Token: "$DUNNER_MISSING_TOKEN"}).ParseEnv(); err == nil {
+		t.Error("expected error for missing environment variable, got none")
 	}
 }
 
-func TestConfigs_ValidateForAliasTask(t *testing.T) {
-	tasks := make(map[string]Task, 0)
-	tasks["foo"] = Task{Steps: []Step{{Image: "golang", Command: []string{"go", "version"}}}}
-	tasks["stats"] = Task{Steps: []Step{{Follow: "foo"}}}
-	configs := &Configs{Tasks: tasks}
+func TestDecodeMountWithRelativeSource(t *testing.T) {
+	step := &docker.Step{}
+	mounts := []string{"./src:/app", "data:/data", "/tmp:/tmp"}
 
-	errs := configs.Validate()
+	if err := DecodeMount(mounts, "/home/user/project", step); err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
 
-	if len(errs) != 0 {
+	expected := []string{"/home/user/project/src", "data", "/tmp"}
+	for i, m := range step.ExtMounts {
+		if m.Source != expected[i] {
+			t.Errorf("expected source of mount %d to be %s, got %s", i, expected[i], m.Source)
+		}
+	}
+}
+
+func TestGetConfigsResolvesRelativeMountsAgainstTaskFileDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(`
+tasks:
+  build:
+    steps:
+      - image: busybox
+        command: ["ls"]
+        mounts:
+          - ./src:/app`)
+	taskFile := filepath.Join(dir, ".dunner.yaml")
+	if err := ioutil.WriteFile(taskFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(taskFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := configs.Validate(); len(errs) != 0 {
 		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
 	}
+	if configs.BaseDir() != dir {
+		t.Errorf("expected base directory to be %s, got %s", dir, configs.BaseDir())
+	}
+	step := &docker.Step{}
+	if err := DecodeMount(configs.Tasks["build"].Steps[0].Mounts, configs.BaseDir(), step); err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, "src"); step.ExtMounts[0].Source != expected {
+		t.Errorf("expected mount source to be %s, got %s", expected, step.ExtMounts[0].Source)
+	}
 }
 
-func TestConfigs_ValidateWithInvalidMountFormat(t *testing.T) {
-	step := getSampleStep()
-	step.Mounts = []string{"invalid_dir"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestConfigs_ValidateWithStdinFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "schema.sql"), []byte("SELECT 1;"), 0644); err != nil {
+		t.Fatal(err)
 	}
+	steps := []Step{
+		{Image: "postgres", Command: []string{"psql"}, Stdin: "@schema.sql"},
+		{Image: "postgres", Command: []string{"psql"}, Stdin: "@missing.sql"},
+		{Image: "postgres", Command: []string{"psql"}, Stdin: "SELECT 1;"},
+	}
+	configs := &Configs{baseDir: dir, Tasks: map[string]Task{"db": {Steps: steps}}}
 
 	errs := configs.Validate()
 
 	if len(errs) != 1 {
 		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
 	}
-
-	expected := "task 'stats': mount directory 'invalid_dir' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level"
+	expected := "task 'db', step 2: stdin '@missing.sql' refers to a file that does not exist"
 	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+		t.Errorf("expected: %s, got: %s", expected, errs[0].Error())
 	}
 }
 
-func TestConfigs_ValidateWithValidMountDirectory(t *testing.T) {
-	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
-	}
-
-	errs := configs.Validate()
-
-	if errs != nil {
-		t.Fatalf("expected no errors, got %s", errs)
+func TestStdinFile(t *testing.T) {
+	tests := []struct {
+		stdin  string
+		file   string
+		isFile bool
+	}{
+		{"@data/input.txt", "/project/data/input.txt", true},
+		{"@/tmp/input.txt", "/tmp/input.txt", true},
+		{"@@literal", "", false},
+		{"plain input", "", false},
+	}
+	for _, test := range tests {
+		if file, isFile := StdinFile(test.stdin, "/project"); file != test.file || isFile != test.isFile {
+			t.Errorf("expected file of stdin '%s' to be %q (%v), got %q (%v)", test.stdin, test.file, test.isFile, file, isFile)
+		}
 	}
 }
 
-func TestConfigs_ValidateWithMountDirFromEnv(t *testing.T) {
-	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestConfigs_ValidateWithImageDigest(t *testing.T) {
+	digest := "sha256:4a35e747960bd7f1fd9a8b2a2a4bcd0b86bce7ee2a3d3f9f0b4fd4d1e9ab2d4c"
+	steps := []Step{
+		{Image: "busybox@" + digest, Command: []string{"ls"}},
+		{Image: "busybox:1.31@" + digest, Command: []string{"ls"}},
+		{Image: "busybox@sha256:1234", Command: []string{"ls"}},
+		{Image: "busybox@", Command: []string{"ls"}},
 	}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: steps}}}
 
 	errs := configs.Validate()
 
-	if errs != nil {
-		t.Fatalf("expected no errors, got %s", errs)
+	expected := []string{
+		"task 'build', step 3: image 'busybox@sha256:1234' has an invalid digest. Pin it like image@sha256:<64 hexadecimal characters>",
+		"task 'build', step 4: image 'busybox@' has an invalid digest. Pin it like image@sha256:<64 hexadecimal characters>",
 	}
-}
-
-func TestConfigs_ValidateWithNoModeGiven(t *testing.T) {
-	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d : %s", len(expected), len(errs), errs)
 	}
-
-	errs := configs.Validate()
-
-	if errs != nil {
-		t.Fatalf("expected no errors, got %s", errs)
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected: %s, got: %s", expected[i], errs[i].Error())
+		}
 	}
 }
 
-func TestConfigs_ValidateWithInvalidMode(t *testing.T) {
-	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s:ab", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestConfigs_ValidateWithFollowCondition(t *testing.T) {
+	steps := []Step{
+		{Follow: "notify", On: FollowOnFailure},
+		{Follow: "notify", On: "sometimes"},
+		{Image: "golang", Command: []string{"go", "version"}, On: FollowOnAlways},
 	}
+	notify := Task{Steps: []Step{{Image: "golang", Command: []string{"go", "version"}}}}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: steps}, "notify": notify}}
 
 	errs := configs.Validate()
 
-	expected := fmt.Sprintf("task 'stats': mount directory '%s' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level", step.Mounts[0])
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	expected := []string{
+		"task 'build', step 2: follow condition 'sometimes' is invalid. It must be one of: success, failure, always, on a step with `follow`",
+		"task 'build', step 3: follow condition 'always' is invalid. It must be one of: success, failure, always, on a step with `follow`",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d : %s", len(expected), len(errs), errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected: %s, got: %s", expected[i], errs[i].Error())
+		}
 	}
 }
 
-func TestConfigs_ValidateWithInvalidMountDirectory(t *testing.T) {
-	step := getSampleStep()
-	step.Mounts = []string{"blah:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestConfigs_ValidateWithHooks(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}}
+	configs := &Configs{
+		Before: []Step{step, {Command: []string{"go", "version"}}},
+		After:  []Step{{Follow: "missing"}},
+		Tasks:  map[string]Task{"build": {Steps: []Step{step}}},
 	}
 
 	errs := configs.Validate()
 
-	if len(errs) != 1 {
-		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d : %s", len(errs), errs)
 	}
-
-	expected := "task 'stats': mount directory 'blah:foo:w' is invalid. Check if source directory path exists."
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	if !strings.HasPrefix(errs[0].Error(), "before hook, step 2: ") {
+		t.Errorf("expected error of the second before hook step, got: %s", errs[0])
+	}
+	if !strings.HasPrefix(errs[1].Error(), "after hook, step 1: ") {
+		t.Errorf("expected error of the after hook step, got: %s", errs[1])
 	}
 }
 
-func TestConfigs_ValidateWithValidEnvInMountDir(t *testing.T) {
-	os.Setenv("TEST_DIR", util.HomeDir)
-	defer os.Setenv("TEST_DIR", "")
-	step := getSampleStep()
-	step.Mounts = []string{"`$TEST_DIR`:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestGetConfigsAppliesShellToHooks(t *testing.T) {
+	content := []byte(`
+shell: bash -c
+before:
+  - image: alpine
+    command: echo before
+tasks:
+  build:
+    steps:
+      - image: alpine
+        command: ["ls"]
+`)
+	var configs Configs
+	if err := yaml.Unmarshal(content, &configs); err != nil {
+		t.Fatal(err)
 	}
+	configs.applyShells()
 
-	errs := configs.Validate()
-
-	if len(errs) != 0 {
-		t.Fatalf("expected 0 errors, got %d : %s", len(errs), errs)
+	expected := Command{"bash", "-c", "echo before"}
+	if !reflect.DeepEqual(expected, configs.Before[0].Command) {
+		t.Errorf("expected: %v, got: %v", expected, configs.Before[0].Command)
 	}
 }
 
-func TestConfigs_ValidateWithEnvInMountDir_Invalid(t *testing.T) {
-	os.Setenv("TEST_DIR", "/test_invalid")
-	defer os.Setenv("TEST_DIR", "")
-	step := getSampleStep()
-	step.Mounts = []string{"`$TEST_DIR`:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestParseTmpfs(t *testing.T) {
+	m, err := ParseTmpfs("/scratch:size=64m,mode=1777")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
 	}
-
-	errs := configs.Validate()
-
-	if len(errs) != 1 {
-		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	expected := mount.Mount{Type: mount.TypeTmpfs, Target: "/scratch", TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 64 << 20, Mode: 01777}}
+	if !reflect.DeepEqual(expected, m) {
+		t.Errorf("expected: %v, got: %v", expected, m)
 	}
-
-	expected := "task 'stats': mount directory '`$TEST_DIR`:foo:w' is invalid. Check if source directory path exists."
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	if _, err := ParseTmpfs("/scratch"); err != nil {
+		t.Errorf("expected no error without options, got: %s", err)
 	}
 }
 
-func TestConfigs_ValidateWithNonExistingEnvInMountDir(t *testing.T) {
-	step := getSampleStep()
-	step.Mounts = []string{"`$TEST_DIR_DUNNER`:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestParseTmpfsWithInvalidMounts(t *testing.T) {
+	for tmpfs, expected := range map[string]string{
+		"scratch":                   "config: invalid tmpfs mount 'scratch': target 'scratch' must be an absolute path",
+		"/scratch:size=0":           "config: invalid tmpfs mount '/scratch:size=0': size '0' must be a positive number with an optional unit suffix like 64m",
+		"/scratch:size=lots":        "config: invalid tmpfs mount '/scratch:size=lots': size 'lots' must be a positive number with an optional unit suffix like 64m",
+		"/scratch:mode=rwx":         "config: invalid tmpfs mount '/scratch:mode=rwx': mode 'rwx' must be an octal file mode like 1777",
+		"/scratch:noexec":           "config: invalid tmpfs mount '/scratch:noexec': option 'noexec' must be of the form key=value",
+		"/scratch:size=1m,uid=1000": "config: invalid tmpfs mount '/scratch:size=1m,uid=1000': unknown option 'uid', the options are size and mode",
+	} {
+		if _, err := ParseTmpfs(tmpfs); err == nil || err.Error() != expected {
+			t.Errorf("expected error: %s, got: %v", expected, err)
+		}
 	}
+}
 
-	errs := configs.Validate()
+func TestConfigs_ValidateWithTmpfs(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "version"}, Tmpfs: []string{"/scratch:size=64m", "/tmp:size=big"}}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
 
-	if len(errs) != 1 {
-		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
-	}
+	errs := configs.Validate()
 
-	expected := "task 'stats': mount directory '`$TEST_DIR_DUNNER`:foo:w' is invalid. Check if source directory path exists."
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	expected := "task 'build', step 1: tmpfs mount '/tmp:size=big' is invalid. Use an absolute path with the options size and mode, like /scratch:size=64m,mode=1777"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
 }
 
-func getSampleStep() Step {
-	return Step{Image: "image_name", Command: []string{"node", "--version"}}
-}
-
-func TestInitValidatorForNilTranslation(t *testing.T) {
-	vals := []customValidation{{tag: "foo", translation: "", validationFn: nil}}
+func TestConfigs_ValidateWithExtraHosts(t *testing.T) {
+	hosts := []string{"myhost:10.0.0.5", "v6host:::1", "gateway:host-gateway", "myhost", ":10.0.0.5", "myhost:10.0.0"}
+	step := Step{Image: "busybox", Command: []string{"ls"}, ExtraHosts: hosts}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
 
-	err := initValidator(vals)
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected nil, got %s", err)
+	var expected []string
+	for _, host := range hosts[3:] {
+		expected = append(expected, "task 'build', step 1: extra host '"+host+"' is invalid. Use the form host:ip, like myhost:10.0.0.5")
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
 }
 
-func TestInitValidatorForEmptyTag(t *testing.T) {
-	vals := []customValidation{{tag: "", translation: "",
-		validationFn: func(context.Context, validator.FieldLevel) bool { return false }}}
+func TestConfigs_ValidateWithDNS(t *testing.T) {
+	step := Step{Image: "busybox", Command: []string{"ls"}, DNS: []string{"10.0.0.2", "2001:db8::53", "dns.internal"}}
+	task := Task{DNS: []string{"10.0.0.300"}, DNSSearch: []string{"corp.internal"}, Steps: []Step{step}}
+	configs := &Configs{DNS: []string{"1.1.1.1", ""}, Tasks: map[string]Task{"build": task}}
 
-	err := initValidator(vals)
+	errs := configs.Validate()
 
-	expected := "failed to register validation: Function Key cannot be empty"
-	if err == nil {
-		t.Fatalf("expected %s, got %s", expected, err)
+	expected := []string{
+		"DNS server '' is invalid. Use an IP address, like 10.0.0.2",
+		"DNS server '10.0.0.300' is invalid. Use an IP address, like 10.0.0.2",
+		"task 'build', step 1: DNS server 'dns.internal' is invalid. Use an IP address, like 10.0.0.2",
 	}
-	if err.Error() != expected {
-		t.Fatalf("expected %s, got %s", expected, err.Error())
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
 }
 
-var lookupEnvtests = []struct {
-	in  string
-	out string
-	err error
-}{
-	{"", "", nil},
-	{"foo", "foo", nil},
-	{"/foo/bar", "/foo/bar", nil},
-	{"/foo/`$bar", "/foo/`$bar", nil},
-	{util.HomeDir, util.HomeDir, nil},
-	{"`$HOME`", util.HomeDir, nil},
-	{"`$HOME`/foo", util.HomeDir + "/foo", nil},
-	{"`$HOME`/foo/`$HOME`", util.HomeDir + "/foo/" + util.HomeDir, nil},
-	{"`$INVALID_TEST`/foo", "`$INVALID_TEST`/foo", fmt.Errorf("could not find environment variable 'INVALID_TEST'")},
-}
+func TestConfigs_ValidateWithArgsInMounts(t *testing.T) {
+	mounts := []string{"$1:/out:w", "${src:-./data}:/data", "./$1:/in", "/does-not-exist-${name}/$1:/${name}", "$1"}
+	step := Step{Image: "busybox", Command: []string{"ls"}, Mounts: mounts}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
 
-func TestLookUpDirectory(t *testing.T) {
-	for _, tt := range lookupEnvtests {
-		t.Run(tt.in, func(t *testing.T) {
-			parsedDir, err := lookupDirectory(tt.in)
-			if parsedDir != tt.out {
-				t.Errorf("got %q, want %q", parsedDir, tt.out)
-			}
-			if !reflect.DeepEqual(tt.err, err) {
-				t.Errorf("got %q, want %q", err, tt.err)
-			}
-		})
+	errs := configs.Validate()
+
+	expected := "task 'build', step 1: mount directory '$1' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
 }
 
-func TestDecodeMount(t *testing.T) {
-	step := &docker.Step{}
-	mounts := []string{fmt.Sprintf("%s:/app:r", util.HomeDir)}
+func TestConfigs_ValidateWithInputs(t *testing.T) {
+	step := Step{Image: "golang", Command: []string{"go", "build"}}
+	task := Task{Inputs: []string{"go.mod", "src/*.go", "", "src/[a"}, Steps: []Step{step}}
+	configs := &Configs{Tasks: map[string]Task{"build": task}}
 
-	err := DecodeMount(mounts, step)
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err.Error())
+	expected := []string{
+		"input '' is invalid. Use a glob pattern like src/*.go",
+		"input 'src/[a' is invalid. Use a glob pattern like src/*.go",
 	}
-	if (*step).ExtMounts == nil {
-		t.Fatalf("expected ExtMounts to be set, got nil")
-	}
-	if len((*step).ExtMounts) != 1 {
-		t.Fatalf("expected ExtMounts to be of length 1, got %d", len((*step).ExtMounts))
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
 	}
-	if (*step).ExtMounts[0].Source != util.HomeDir {
-		t.Fatalf("expected ExtMounts to be %s, got %s", util.HomeDir, (*step).ExtMounts[0].Source)
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
 }
 
-func TestDecodeMountWithEnvironmentVariable(t *testing.T) {
-	step := &docker.Step{}
-	mounts := []string{"/tmp:/app"}
+func TestConfigs_ValidateWithPlatform(t *testing.T) {
+	steps := []Step{
+		{Image: "busybox", Command: []string{"ls"}, Platform: "linux/arm/v7"},
+		{Image: "busybox", Command: []string{"ls"}, Platform: "arm64"},
+	}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: steps}}}
 
-	err := DecodeMount(mounts, step)
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err.Error())
+	expected := "task 'build', step 2: platform 'arm64' is invalid. Use os/arch with an optional variant, like linux/arm64 or linux/arm/v7"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
-	if (*step).ExtMounts == nil {
-		t.Fatalf("expected ExtMounts to be set, got nil")
+}
+
+func TestConfigs_ValidateWithStopSignal(t *testing.T) {
+	steps := []Step{
+		{Image: "busybox", Command: []string{"ls"}, StopSignal: "SIGQUIT", StopTimeout: 30 * time.Second},
+		{Image: "busybox", Command: []string{"ls"}, StopSignal: "TERM"},
+		{Image: "busybox", Command: []string{"ls"}, StopSignal: "SIGSTOPPED"},
+		{Image: "busybox", Command: []string{"ls"}, StopTimeout: -time.Second},
 	}
-	if len((*step).ExtMounts) != 1 {
-		t.Fatalf("expected ExtMounts to be of length 1, got %d", len((*step).ExtMounts))
+	configs := &Configs{Tasks: map[string]Task{"serve": {Steps: steps}}}
+
+	errs := configs.Validate()
+
+	expected := []string{
+		"task 'serve', step 3: stop signal 'SIGSTOPPED' is invalid. Use the name of a signal, like SIGTERM or SIGQUIT",
+		"task 'serve', step 4: stopTimeout must be 0 or greater",
 	}
-	if (*step).ExtMounts[0].Source != "/tmp" {
-		t.Fatalf("expected ExtMounts Source to be '/tmp', got %s", (*step).ExtMounts[0].Source)
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
 	}
-	if (*step).ExtMounts[0].Target != "/app" {
-		t.Fatalf("expected ExtMounts Source to be '/app', got %s", (*step).ExtMounts[0].Target)
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
 }
 
-func TestDecodeMountWithShorthandHomeDir(t *testing.T) {
-	step := &docker.Step{}
-	mounts := []string{"~/tmp:/app"}
+func TestConfigs_ValidateWithCaches(t *testing.T) {
+	caches := []string{"gomod:/go/pkg/mod", "go-build:/root/.cache/go-build", "/go/pkg/mod", "gomod:go/pkg/mod", "-gomod:/go"}
+	step := Step{Image: "golang", Command: []string{"go", "build"}, Caches: caches}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: []Step{step}}}}
 
-	err := DecodeMount(mounts, step)
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err.Error())
+	var expected []string
+	for _, cache := range caches[2:] {
+		expected = append(expected, "task 'build', step 1: cache '"+cache+"' is invalid. Use a name and an absolute path, like gomod:/go/pkg/mod")
 	}
-	if (*step).ExtMounts == nil {
-		t.Fatalf("expected ExtMounts to be set, got nil")
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
 	}
-	if len((*step).ExtMounts) != 1 {
-		t.Fatalf("expected ExtMounts to be of length 1, got %d", len((*step).ExtMounts))
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
-	if (*step).ExtMounts[0].Source != fmt.Sprintf("%s/tmp", util.HomeDir) {
-		t.Fatalf("expected ExtMounts Source to be '/tmp', got %s", (*step).ExtMounts[0].Source)
+}
+
+func TestParseCache(t *testing.T) {
+	name, m, err := ParseCache("gomod:/go/pkg/mod")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
 	}
-	if (*step).ExtMounts[0].Target != "/app" {
-		t.Fatalf("expected ExtMounts Source to be '/app', got %s", (*step).ExtMounts[0].Target)
+	expected := mount.Mount{Type: mount.TypeVolume, Source: "dunner-cache-gomod", Target: "/go/pkg/mod"}
+	if name != "gomod" || !reflect.DeepEqual(expected, m) {
+		t.Errorf("expected cache gomod with mount %+v, got: %s with %+v", expected, name, m)
 	}
 }
 
-func TestGetDunnerTaskFileWithCustomFileFromUser(t *testing.T) {
-	taskFile := ".test_dunner.yaml"
+func TestConfigs_ValidateWithCommandErrorMode(t *testing.T) {
+	steps := []Step{
+		{Image: "golang", Commands: []Command{{"go", "vet"}, {"go", "test"}}, CommandErrorMode: docker.CommandErrorContinue},
+		{Image: "golang", Commands: []Command{{"go", "vet"}, {"go", "test"}}, CommandErrorMode: "ignore"},
+	}
+	configs := &Configs{Tasks: map[string]Task{"check": {Steps: steps}}}
 
-	got, err := getDunnerTaskFile(taskFile)
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err)
+	expected := "task 'check', step 2: command error mode 'ignore' is invalid. It must be one of: abort, continue"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
-	if got != taskFile {
-		t.Fatalf("expected original taskfile from user %s, got %s", taskFile, got)
+}
+
+func TestParseGPUs(t *testing.T) {
+	for gpus, expected := range map[string]container.DeviceRequest{
+		"all":          {Count: -1, Capabilities: [][]string{{"gpu"}}},
+		"2":            {Count: 2, Capabilities: [][]string{{"gpu"}}},
+		"device=0,GPU": {DeviceIDs: []string{"0", "GPU"}, Capabilities: [][]string{{"gpu"}}},
+	} {
+		request, err := ParseGPUs(gpus)
+		if err != nil {
+			t.Errorf("expected no error for '%s', got: %s", gpus, err)
+		}
+		if !reflect.DeepEqual(expected, request) {
+			t.Errorf("expected '%s' to be %+v, got: %+v", gpus, expected, request)
+		}
+	}
+	for _, gpus := range []string{"0", "some", "device=", "device=0,"} {
+		if _, err := ParseGPUs(gpus); err == nil {
+			t.Errorf("expected error for gpus '%s', got none", gpus)
+		}
 	}
 }
 
-func TestGetDunnerTaskFileWithDefaultValue(t *testing.T) {
-	taskFile := internal.DefaultDunnerTaskFileName
+func TestConfigs_ValidateWithGPUs(t *testing.T) {
+	var configs Configs
+	if err := yaml.Unmarshal([]byte("tasks:\n  train:\n    steps:\n      - image: pytorch\n        gpus: 1\n      - image: pytorch\n        gpus: some\n"), &configs); err != nil {
+		t.Fatal(err)
+	}
 
-	got, err := getDunnerTaskFile(taskFile)
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err)
-	}
-	if !strings.HasSuffix(got, taskFile) {
-		t.Fatalf("expected taskfile to end with %s, got %s", taskFile, got)
+	expected := "task 'train', step 2: gpus 'some' is invalid. Use all, a number of GPUs, or device= followed by the IDs of the GPUs like device=0,1"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
 }
 
-func TestGetConfigsWhenNotPresentTillRoot(t *testing.T) {
-	taskFile := internal.DefaultDunnerTaskFileName
-	revert := setup(t)
-	defer revert()
+func TestConfigs_ValidateWithCommitAs(t *testing.T) {
+	steps := []Step{
+		{Image: "golang", Command: []string{"go", "build"}, CommitAs: "registry.internal:5000/builder:v1"},
+		{Image: "golang", Command: []string{"go", "build"}, CommitAs: "Builder"},
+		{Image: "golang", Command: []string{"go", "build"}, CommitAs: "builder@sha256:4a35e747960bd7f1fd9a8b2a2a4bcd0b86bce7ee2a3d3f9f0b4fd4d1e9ab2d4c"},
+	}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: steps}}}
 
-	got, err := GetConfigs(taskFile)
+	errs := configs.Validate()
 
-	if got != nil {
-		t.Errorf("expected Configs to be nil, got %s", got)
+	expected := []string{
+		"task 'build', step 2: commitAs image 'Builder' is invalid. Use an image name with an optional tag like myimage:tag",
+		"task 'build', step 3: commitAs image 'builder@sha256:4a35e747960bd7f1fd9a8b2a2a4bcd0b86bce7ee2a3d3f9f0b4fd4d1e9ab2d4c' is invalid. Use an image name with an optional tag like myimage:tag",
 	}
-	if err == nil {
-		t.Fatalf("expected error, got nil")
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
 	}
-	expectedErr := "failed to find Dunner task file"
-	if err.Error() != expectedErr {
-		t.Fatalf("expected error: %s, got: %s", expectedErr, err.Error())
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
 }
 
-func setup(t *testing.T) func() {
-	folder, err := ioutil.TempDir("", "")
-	if err != nil {
-		t.Errorf("Failed to create temp dir: %s", err.Error())
+func TestConfigs_ValidateInteractiveWithStdin(t *testing.T) {
+	steps := []Step{
+		{Image: "busybox", Command: []string{"sh"}, Interactive: true},
+		{Image: "busybox", Command: []string{"sh"}, Interactive: true, Stdin: "ls"},
 	}
+	configs := &Configs{Tasks: map[string]Task{"debug": {Steps: steps}}}
 
-	previous, err := os.Getwd()
-	if err != nil {
-		t.Errorf("Failed to get working directory: %s", err.Error())
+	errs := configs.Validate()
+
+	expected := "task 'debug', step 2: an interactive step cannot be given stdin, its input is the terminal"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
+}
 
-	if err = os.Chdir(folder); err != nil {
-		t.Errorf("Failed to change working directory: %s", err.Error())
+func TestConfigs_ValidateUlimits(t *testing.T) {
+	steps := []Step{
+		{Image: "busybox", Command: []string{"ls"}, Ulimits: map[string]string{"nofile": "65536", "nproc": "1024:2048"}},
+		{Image: "busybox", Command: []string{"ls"}, Ulimits: map[string]string{"files": "65536"}},
+		{Image: "busybox", Command: []string{"ls"}, Ulimits: map[string]string{"nofile": "2048:1024"}},
+		{Image: "busybox", Command: []string{"ls"}, Ulimits: map[string]string{"nofile": "many"}},
 	}
-	return func() {
-		if err = os.Chdir(previous); err != nil {
-			t.Errorf("Failed to revert change in working directory: %s", err.Error())
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: steps}}}
+
+	errs := configs.Validate()
+
+	message := "ulimits are invalid. Use names like nofile with a limit, or soft:hard limits like 1024:65536 with the soft limit not greater than the hard one"
+	expected := []string{"task 'build', step 2: " + message, "task 'build', step 3: " + message, "task 'build', step 4: " + message}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
 		}
 	}
 }
 
-func TestParseStepEnvToReplaceDirSuccess(t *testing.T) {
-	mainDir := "MY_ENVNAME"
-	os.Setenv(mainDir, "foobar")
-	subDir := "SUBDIR"
-	os.Setenv(subDir, "dunner")
-	defer os.Unsetenv(mainDir)
-	defer os.Unsetenv(subDir)
-	step := &Step{Image: "node", Dir: fmt.Sprintf("/tmp/`$%s`/`$%s`", mainDir, subDir)}
+func TestConfigs_ValidateSysctls(t *testing.T) {
+	steps := []Step{
+		{Image: "busybox", Command: []string{"ls"}, Sysctls: map[string]string{"net.ipv4.ip_forward": "1", "kernel.shmmax": "68719476736", "fs.mqueue.msg_max": "100"}},
+		{Image: "busybox", Command: []string{"ls"}, Sysctls: map[string]string{"vm.swappiness": "10"}},
+		{Image: "busybox", Command: []string{"ls"}, Sysctls: map[string]string{"net": "1"}},
+		{Image: "busybox", Command: []string{"ls"}, Sysctls: map[string]string{"net.ipv4.ip forward": "1"}},
+		{Image: "busybox", Command: []string{"ls"}, Sysctls: map[string]string{"net.core.somaxconn": " "}},
+	}
+	configs := &Configs{Tasks: map[string]Task{"build": {Steps: steps}}}
 
-	err := step.ParseStepEnv()
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err)
+	message := "sysctls are invalid. Use namespaced kernel parameters like net.ipv4.ip_forward or kernel.shmmax with a value"
+	expected := []string{"task 'build', step 2: " + message, "task 'build', step 3: " + message, "task 'build', step 4: " + message, "task 'build', step 5: " + message}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
 	}
-	expected := "/tmp/foobar/dunner"
-	if step.Dir != expected {
-		t.Errorf("expected step dir: %s, got: %s", expected, step.Dir)
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
 }
 
-func TestParseStepEnvToReplaceDirFailure(t *testing.T) {
-	env := "MY_UNSET_ENV"
-	sErr := os.Unsetenv(env)
-	if sErr != nil {
-		t.Fatalf("failed to setup test environment: %s", sErr)
-	}
-	dir := "/tmp/`$MY_UNSET_ENV`"
-	step := &Step{Image: "node", Dir: dir}
+func TestParseUlimitsWithInvalidName(t *testing.T) {
+	_, err := ParseUlimits(map[string]string{"files": "65536"})
 
-	err := step.ParseStepEnv()
+	expected := "config: invalid ulimit files '65536': invalid ulimit type: files"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
 
-	expectedErr := "could not find environment variable 'MY_UNSET_ENV'"
-	if err == nil || err.Error() != expectedErr {
-		t.Fatalf("expected error %s, got %s", expectedErr, err)
+func TestConfigs_ValidateWithBackoff(t *testing.T) {
+	steps := []Step{
+		{Image: "busybox", Command: []string{"ls"}, Retries: 3, RetryBackoff: &Backoff{Strategy: BackoffExponential, Jitter: 0.2}},
+		{Image: "busybox", Command: []string{"ls"}, Retries: 3, RetryBackoff: &Backoff{Strategy: "linear"}},
 	}
-	if step.Dir != dir {
-		t.Errorf("expected step dir: %s, got: %s", dir, step.Dir)
+	configs := &Configs{Tasks: map[string]Task{"deploy": {Steps: steps}}}
+
+	errs := configs.Validate()
+
+	expected := "task 'deploy', step 2: backoff strategy 'linear' is invalid. It must be one of: fixed, exponential"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
 }
 
-func TestParseStepEnvToReplaceMountSuccess(t *testing.T) {
-	srcDir := "MY_ENVNAME"
-	os.Setenv(srcDir, "foobar")
-	destDir := "SUBDIR"
-	os.Setenv(destDir, "dunner")
-	defer os.Unsetenv(srcDir)
-	defer os.Unsetenv(destDir)
-	step := &Step{Image: "node", Mounts: []string{fmt.Sprintf("/tmp/`$%s`:/tmp/`$%s`/foo:w", srcDir, destDir)}}
+func TestConfigs_ValidateCaptureAs(t *testing.T) {
+	steps := []Step{
+		{Image: "busybox", Command: []string{"git", "rev-parse", "HEAD"}, CaptureAs: "GIT_SHA"},
+		{Image: "busybox", Command: []string{"git", "rev-parse", "HEAD"}, CaptureAs: "GIT-SHA"},
+		{Image: "busybox", Command: []string{"sh"}, CaptureAs: "OUTPUT", Interactive: true},
+	}
+	configs := &Configs{Tasks: map[string]Task{"release": {Steps: steps}}}
 
-	err := step.ParseStepEnv()
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err)
+	expected := []string{
+		"task 'release', step 2: captureAs 'GIT-SHA' is invalid. Use the name of an environment variable like GIT_SHA, on a step that is not interactive",
+		"task 'release', step 3: captureAs 'OUTPUT' is invalid. Use the name of an environment variable like GIT_SHA, on a step that is not interactive",
 	}
-	expected := "/tmp/foobar:/tmp/dunner/foo:w"
-	if step.Mounts[0] != expected {
-		t.Errorf("expected step mount: %s, got: %s", expected, step.Mounts[0])
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], errs[i])
+		}
 	}
 }
 
-func TestParseStepEnvToReplaceMountFailure(t *testing.T) {
-	srcDir := "MY_ENVNAME"
-	os.Setenv(srcDir, "foobar")
-	defer os.Unsetenv(srcDir)
-	destDir := "SUBDIR"
-	os.Unsetenv(destDir)
-	mount := fmt.Sprintf("/tmp/`$%s`:/tmp/`$%s`/foo:w", srcDir, destDir)
-	step := &Step{Image: "node", Mounts: []string{mount}}
-
-	err := step.ParseStepEnv()
+func TestTaskMatrixCombinations(t *testing.T) {
+	task := Task{Matrix: map[string][]string{"OS": {"linux", "darwin"}, "GO_VERSION": {"1.12", "1.13"}}}
 
-	expectedErr := "could not find environment variable 'SUBDIR'"
-	if err == nil || err.Error() != expectedErr {
-		t.Fatalf("expected error %s, got %s", expectedErr, err)
+	expected := [][]string{
+		{"GO_VERSION=1.12", "OS=linux"},
+		{"GO_VERSION=1.12", "OS=darwin"},
+		{"GO_VERSION=1.13", "OS=linux"},
+		{"GO_VERSION=1.13", "OS=darwin"},
 	}
-	if step.Mounts[0] != mount {
-		t.Errorf("expected step mount: %s, got: %s", mount, step.Mounts[0])
+	if combinations := task.MatrixCombinations(); !reflect.DeepEqual(expected, combinations) {
+		t.Errorf("expected combinations: %v, got: %v", expected, combinations)
+	}
+	if combinations := (Task{}).MatrixCombinations(); combinations != nil {
+		t.Errorf("expected no combinations without a matrix, got: %v", combinations)
 	}
 }
 
-func TestParseStepEnvToReplaceUserFailure(t *testing.T) {
-	env := "UNSET_USER"
-	sErr := os.Unsetenv(env)
-	if sErr != nil {
-		t.Fatalf("failed to setup test environment: %s", sErr)
+func TestConfigs_MatrixTask(t *testing.T) {
+	step := getSampleStep()
+	step.Envs = []string{"TARGET=${IMAGE_TAG}-$OS"}
+	configs := &Configs{
+		Envs: []string{"REGISTRY=mirror.internal"},
+		Tasks: map[string]Task{"test": {
+			Matrix: map[string][]string{"GO_VERSION": {"1.13"}, "OS": {"linux"}},
+			Envs:   []string{"IMAGE_TAG=$REGISTRY/golang:$GO_VERSION", "OS=windows"},
+			Steps:  []Step{step},
+		}},
+	}
+	if err := ParseEnvs(configs); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
 	}
-	user := "`$UNSET_USER`"
-	step := &Step{Image: "node", User: user}
 
-	err := step.ParseStepEnv()
+	task, err := configs.MatrixTask("test", []string{"GO_VERSION=1.13", "OS=linux$1"})
 
-	expectedErr := "could not find environment variable 'UNSET_USER'"
-	if err == nil || err.Error() != expectedErr {
-		t.Fatalf("expected error %s, got %s", expectedErr, err)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
 	}
-	if step.User != user {
-		t.Errorf("expected step dir: %s, got: %s", user, step.User)
+	if expected := []string{"GO_VERSION=1.13", "OS=linux$1", "IMAGE_TAG=mirror.internal/golang:1.13", "OS=windows"}; !reflect.DeepEqual(expected, task.Envs) {
+		t.Errorf("expected task envs: %v, got: %v", expected, task.Envs)
+	}
+	if expected := []string{"TARGET=mirror.internal/golang:1.13-linux$1"}; !reflect.DeepEqual(expected, task.Steps[0].Envs) {
+		t.Errorf("expected step envs: %v, got: %v", expected, task.Steps[0].Envs)
+	}
+	if task.Matrix != nil {
+		t.Errorf("expected no matrix, got: %v", task.Matrix)
+	}
+	if expected := []string{"TARGET=${IMAGE_TAG}-$OS"}; !reflect.DeepEqual(expected, configs.Tasks["test"].Steps[0].Envs) {
+		t.Errorf("expected envs of the task with a matrix to be left as they are, got: %v", configs.Tasks["test"].Steps[0].Envs)
 	}
 }
 
-func TestParseStepEnvToReplaceUserSuccess(t *testing.T) {
-	step := &Step{Image: "node", User: "`$USER`"}
+func TestConfigs_ValidateMatrix(t *testing.T) {
+	steps := []Step{{Image: "golang", Command: []string{"go", "test"}}}
+	configs := &Configs{Tasks: map[string]Task{
+		"test": {Matrix: map[string][]string{"GO_VERSION": {"1.12", "1.13"}}, Steps: steps},
+		"lint": {Matrix: map[string][]string{"GO-VERSION": {"1.12"}}, Steps: steps},
+		"vet":  {Matrix: map[string][]string{"GO_VERSION": {}}, Steps: steps},
+	}}
 
-	err := step.ParseStepEnv()
+	errs := configs.Validate()
 
-	if err != nil {
-		t.Fatalf("expected no error, got %s", err)
+	expected := map[string]bool{
+		"task 'lint': 'GO-VERSION' is not a valid name of an environment variable. Use letters, digits and underscores, not starting with a digit": true,
+		"task 'vet': every variable of the matrix needs at least one value":                                                                        true,
 	}
-	if step.User != os.Getenv("USER") {
-		t.Errorf("expected step dir: %s, got: %s", os.Getenv("USER"), step.User)
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for _, err := range errs {
+		if !expected[err.Error()] {
+			t.Errorf("unexpected error: %s", err)
+		}
 	}
 }
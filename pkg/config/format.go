@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formats of the task files, YAML being the default one
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// taskFileFormat returns the format of the task file, the one of `--task-file-format` if given, or else the one of
+// its extension. A task file read from stdin has no name to tell its format by, so the format must be given then.
+func taskFileFormat(taskFile string) (string, error) {
+	if format := viper.GetString("Task-file-format"); format != "" {
+		switch format {
+		case FormatYAML, FormatJSON, FormatTOML:
+			return format, nil
+		}
+		return "", fmt.Errorf("config: invalid task file format '%s', must be one of: %s, %s, %s", format, FormatYAML, FormatJSON, FormatTOML)
+	}
+	if taskFile == "" {
+		return "", fmt.Errorf("config: the format of the task file read from stdin must be given with --task-file-format, one of: %s, %s, %s", FormatYAML, FormatJSON, FormatTOML)
+	}
+	return extensionFormat(taskFile), nil
+}
+
+// extensionFormat returns the format of the task file given by its extension, YAML for any other extension
+func extensionFormat(taskFile string) string {
+	switch strings.ToLower(filepath.Ext(taskFile)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatYAML
+}
+
+// toYAML converts the contents of a task file of the format to YAML, for all the task files to be parsed alike.
+// The order of the keys is kept, as the tasks are listed in the order they are defined.
+func toYAML(fileContents []byte, format string) ([]byte, error) {
+	var value interface{}
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(fileContents))
+		decoder.UseNumber()
+		var err error
+		if value, err = decodeJSON(decoder); err != nil {
+			return nil, fmt.Errorf("config: failed to parse JSON task file: %s", err.Error())
+		}
+	case FormatTOML:
+		tree, err := toml.LoadBytes(fileContents)
+		if err != nil {
+			return nil, fmt.Errorf("config: failed to parse TOML task file: %s", err.Error())
+		}
+		value = tomlValue(tree)
+	default:
+		return fileContents, nil
+	}
+	return yaml.Marshal(value)
+}
+
+// decodeJSON decodes the next JSON value, objects being decoded to ordered maps
+func decodeJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			values := []interface{}{}
+			for decoder.More() {
+				value, err := decodeJSON(decoder)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			}
+			_, err := decoder.Token()
+			return values, err
+		}
+		object := yaml.MapSlice{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, yaml.MapItem{Key: key, Value: value})
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Number:
+		if i, err := token.Int64(); err == nil {
+			return i, nil
+		}
+		return token.Float64()
+	}
+	return token, nil
+}
+
+// tomlValue returns the value of a TOML document, tables being returned as maps ordered as in the document
+func tomlValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case *toml.Tree:
+		keys := value.Keys()
+		sort.SliceStable(keys, func(i, j int) bool {
+			a, b := value.GetPositionPath([]string{keys[i]}), value.GetPositionPath([]string{keys[j]})
+			return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+		})
+		table := yaml.MapSlice{}
+		for _, key := range keys {
+			table = append(table, yaml.MapItem{Key: key, Value: tomlValue(value.GetPath([]string{key}))})
+		}
+		return table
+	case []*toml.Tree:
+		var tables []interface{}
+		for _, tree := range value {
+			tables = append(tables, tomlValue(tree))
+		}
+		return tables
+	case []interface{}:
+		var values []interface{}
+		for _, v := range value {
+			values = append(values, tomlValue(v))
+		}
+		return values
+	}
+	return value
+}
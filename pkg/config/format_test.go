@@ -0,0 +1,144 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/internal"
+	"github.com/spf13/viper"
+)
+
+const jsonTaskFile = `{
+	"envs": ["GLOBAL=1"],
+	"tasks": {
+		"test": {
+			"steps": [
+				{"image": "golang", "command": "go test ./...", "timeout": "30s", "retries": 2},
+				{"image": "busybox", "command": ["echo", "a\/b"]}
+			]
+		},
+		"build": {
+			"steps": [{"image": "golang", "commands": [["go", "build"]]}]
+		}
+	}
+}`
+
+const tomlTaskFile = `envs = ["GLOBAL=1"]
+
+[tasks.test]
+[[tasks.test.steps]]
+image = "golang"
+command = "go test ./..."
+timeout = "30s"
+retries = 2
+
+[[tasks.test.steps]]
+image = "busybox"
+command = ["echo", "a/b"]
+
+[tasks.build]
+steps = [{ image = "golang", commands = [["go", "build"]] }]
+`
+
+// expectTaskFile verifies that the configs are those of jsonTaskFile and tomlTaskFile, which define the same tasks
+func expectTaskFile(t *testing.T, configs *Configs) {
+	if expected := []string{"test", "build"}; !reflect.DeepEqual(configs.TaskNames(), expected) {
+		t.Errorf("expected tasks in the order of the task file: %v, got: %v", expected, configs.TaskNames())
+	}
+	if !reflect.DeepEqual(configs.Envs, []string{"GLOBAL=1"}) {
+		t.Errorf("expected envs: [GLOBAL=1], got: %v", configs.Envs)
+	}
+	steps := configs.Tasks["test"].Steps
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 steps of 'test' task, got: %d", len(steps))
+	}
+	if expected := (Command{"sh", "-c", "go test ./..."}); !reflect.DeepEqual(steps[0].Command, expected) {
+		t.Errorf("expected command run with the shell: %q, got: %q", expected, steps[0].Command)
+	}
+	if steps[0].Timeout != 30*time.Second || steps[0].Retries != 2 {
+		t.Errorf("expected timeout 30s and 2 retries, got: %s and %d", steps[0].Timeout, steps[0].Retries)
+	}
+	if expected := (Command{"echo", "a/b"}); !reflect.DeepEqual(steps[1].Command, expected) {
+		t.Errorf("expected command: %q, got: %q", expected, steps[1].Command)
+	}
+	if expected := []Command{{"go", "build"}}; !reflect.DeepEqual(configs.Tasks["build"].Steps[0].Commands, expected) {
+		t.Errorf("expected commands of 'build' task: %q, got: %q", expected, configs.Tasks["build"].Steps[0].Commands)
+	}
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Errorf("expected no validation errors, got: %s", errs)
+	}
+}
+
+func TestGetConfigsWithJSONTaskFile(t *testing.T) {
+	revert := setup(t)
+	defer revert()
+	if err := ioutil.WriteFile("dunner.json", []byte(jsonTaskFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(internal.DefaultDunnerTaskFileName)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expectTaskFile(t, configs)
+}
+
+func TestGetConfigsWithTOMLTaskFile(t *testing.T) {
+	revert := setup(t)
+	defer revert()
+	if err := ioutil.WriteFile("tasks.toml", []byte(tomlTaskFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs("tasks.toml")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expectTaskFile(t, configs)
+}
+
+func TestGetConfigsFromStdinWithTaskFileFormat(t *testing.T) {
+	defer func(original io.Reader) { stdin = original }(stdin)
+	defer viper.Set("Task-file-format", "")
+
+	for format, contents := range map[string]string{FormatJSON: jsonTaskFile, FormatTOML: tomlTaskFile} {
+		viper.Set("Task-file-format", format)
+		stdin = strings.NewReader(contents)
+
+		configs, err := GetConfigs(internal.StdinTaskFileName)
+
+		if err != nil {
+			t.Fatalf("expected no error reading %s from stdin, got: %s", format, err)
+		}
+		expectTaskFile(t, configs)
+	}
+
+	// Without the format, the task file read from stdin is not guessed to be YAML
+	viper.Set("Task-file-format", "")
+	stdin = strings.NewReader("tasks:\n  test:\n    steps:\n      - image: busybox")
+	_, err := GetConfigs(internal.StdinTaskFileName)
+	expected := "config: the format of the task file read from stdin must be given with --task-file-format, one of: yaml, json, toml"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestGetConfigsWithInvalidTaskFileFormat(t *testing.T) {
+	defer func(original io.Reader) { stdin = original }(stdin)
+	defer viper.Set("Task-file-format", "")
+	viper.Set("Task-file-format", "xml")
+	stdin = strings.NewReader("<tasks/>")
+
+	_, err := GetConfigs(internal.StdinTaskFileName)
+
+	expected := "config: invalid task file format 'xml', must be one of: yaml, json, toml"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s, got: %v", expected, err)
+	}
+}
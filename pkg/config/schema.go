@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// jsonSchema is the part of JSON Schema, draft 7, that describes the task file
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"` // false, or the schema of the values of a map
+	Required             []string               `json:"required,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	MinLength            int                    `json:"minLength,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Definitions          map[string]*jsonSchema `json:"definitions,omitempty"`
+}
+
+// durationPattern matches the durations of the task file, like `90s` or `1m30s`
+const durationPattern = `^(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`
+
+// schemaEnums are the values allowed by the validation tags of the fields with a fixed set of values
+var schemaEnums = map[string][]string{
+	"followon":         {FollowOnSuccess, FollowOnFailure, FollowOnAlways},
+	"pullpolicy":       {docker.PullAlways, docker.PullMissing, docker.PullNever},
+	"commanderrormode": {docker.CommandErrorAbort, docker.CommandErrorContinue},
+	"backoffstrategy":  {BackoffFixed, BackoffExponential},
+	"argtype":          {ArgString, ArgInt, ArgBool},
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	commandType  = reflect.TypeOf(Command{})
+)
+
+// Schema returns the JSON Schema of the task file, which editors can validate and complete task files with. It is
+// generated from the fields of `Configs`, `Task` and `Step` and of the types they contain, so that it follows
+// their definitions, along with the constraints of their validation tags that JSON Schema can express.
+func Schema() ([]byte, error) {
+	definitions := make(map[string]*jsonSchema)
+	schema := structSchema(reflect.TypeOf(Configs{}), definitions)
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.Title = "Dunner task file"
+	schema.Definitions = definitions
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// structSchema returns the schema of the object of the fields of the struct that have a YAML key
+func structSchema(t reflect.Type, definitions map[string]*jsonSchema) *jsonSchema {
+	schema := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.PkgPath != "" || key == "" || key == "-" {
+			continue
+		}
+		fieldSchema := typeSchema(field.Type, definitions)
+		if field.Type == reflect.TypeOf([]Command{}) {
+			// The commands of `commands` can also be given as objects with their directory
+			fieldSchema.Items = &jsonSchema{OneOf: append(fieldSchema.Items.OneOf, dirCommandSchema())}
+		}
+		if applyValidation(fieldSchema, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, key)
+		}
+		schema.Properties[key] = fieldSchema
+	}
+	return schema
+}
+
+// typeSchema returns the schema of the values of the type, the structs being referred to in the definitions
+func typeSchema(t reflect.Type, definitions map[string]*jsonSchema) *jsonSchema {
+	switch t {
+	case durationType:
+		return &jsonSchema{Type: "string", Pattern: durationPattern}
+	case commandType:
+		return &jsonSchema{OneOf: []*jsonSchema{{Type: "string"}, {Type: "array", Items: &jsonSchema{Type: "string"}}}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), definitions)
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: typeSchema(t.Elem(), definitions)}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), definitions)}
+	case reflect.Struct:
+		if _, exists := definitions[t.Name()]; !exists {
+			// The definition is reserved first, as a step can contain steps through the types it refers to
+			definitions[t.Name()] = nil
+			definitions[t.Name()] = structSchema(t, definitions)
+		}
+		return &jsonSchema{Ref: "#/definitions/" + t.Name()}
+	}
+	return &jsonSchema{}
+}
+
+// dirCommandSchema returns the schema of a command of `commands` given as an object with its directory
+func dirCommandSchema() *jsonSchema {
+	return &jsonSchema{
+		Type: "object",
+		Properties: map[string]*jsonSchema{
+			"cmd": typeSchema(commandType, nil),
+			"dir": {Type: "string"},
+		},
+		AdditionalProperties: false,
+		Required:             []string{"cmd"},
+	}
+}
+
+// applyValidation adds the constraints of the validation tag to the schema of the field, those after `dive` to
+// the schema of its items or values, and returns true if the field is required. The keys of maps and the items of
+// nested lists are not constrained.
+func applyValidation(schema *jsonSchema, tag string) bool {
+	var required, keys bool
+	target := schema
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		switch {
+		case name == "keys" || name == "endkeys":
+			keys = name == "keys"
+		case keys:
+		case name == "dive":
+			if target != schema {
+				return required
+			}
+			if values, ok := schema.AdditionalProperties.(*jsonSchema); ok {
+				target = values
+			} else if target = schema.Items; target == nil {
+				return required
+			}
+		case name == "required" && target == schema:
+			required = true
+		case (name == "required" || name == "min") && target.Type == "string":
+			target.MinLength = 1
+		case (name == "min" || name == "max") && (target.Type == "integer" || target.Type == "number"):
+			if value, err := strconv.ParseFloat(param, 64); err == nil && name == "min" {
+				target.Minimum = &value
+			} else if err == nil {
+				target.Maximum = &value
+			}
+		default:
+			if values, ok := schemaEnums[name]; ok {
+				target.Enum = values
+			}
+		}
+	}
+	return required
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	output, err := Schema()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(output, &schema); err != nil {
+		t.Fatalf("expected schema to be valid JSON, got: %s", err)
+	}
+
+	if tasks := schema.Properties["tasks"]; tasks == nil || tasks.Type != "object" {
+		t.Errorf("expected tasks to be an object, got: %+v", tasks)
+	} else if values, ok := tasks.AdditionalProperties.(map[string]interface{}); !ok || values["$ref"] != "#/definitions/Task" {
+		t.Errorf("expected tasks to refer to the task definition, got: %+v", tasks.AdditionalProperties)
+	}
+	if before := schema.Properties["before"]; before == nil || before.Items == nil || before.Items.Ref != "#/definitions/Step" {
+		t.Errorf("expected before hook to be a list of steps, got: %+v", before)
+	}
+
+	step := schema.Definitions["Step"]
+	if step == nil {
+		t.Fatal("expected step definition")
+	}
+	if step.AdditionalProperties != false {
+		t.Errorf("expected unknown fields of steps to be rejected, got: %v", step.AdditionalProperties)
+	}
+	stepType := reflect.TypeOf(Step{})
+	for i := 0; i < stepType.NumField(); i++ {
+		key := strings.Split(stepType.Field(i).Tag.Get("yaml"), ",")[0]
+		if key != "" && key != "-" && step.Properties[key] == nil {
+			t.Errorf("expected field '%s' of steps in the schema", key)
+		}
+	}
+	if on := step.Properties["on"]; on == nil || !reflect.DeepEqual(on.Enum, []string{FollowOnSuccess, FollowOnFailure, FollowOnAlways}) {
+		t.Errorf("expected values of `on` to be enumerated, got: %+v", on)
+	}
+	if timeout := step.Properties["timeout"]; timeout == nil || timeout.Type != "string" || timeout.Pattern != durationPattern {
+		t.Errorf("expected timeout to be a duration, got: %+v", timeout)
+	}
+	if commands := step.Properties["commands"]; commands == nil || commands.Items == nil || len(commands.Items.OneOf) != 3 {
+		t.Errorf("expected commands to be strings, lists or objects with a directory, got: %+v", commands)
+	}
+
+	if arg := schema.Definitions["TaskArg"]; arg == nil || !reflect.DeepEqual(arg.Required, []string{"name"}) {
+		t.Errorf("expected name of task arguments to be required, got: %+v", arg)
+	}
+}
@@ -1,49 +1,324 @@
 package config
 
+import "time"
+
 // Step defines a single step for a task
 type Step struct {
 	// Name given as string to identify the task
 	Name string `yaml:"name"`
 
-	// Image is the repo name on which Docker containers are built
-	Image string `yaml:"image" validate:"required_without=Follow"`
+	// Short description of what the step does, shown in listings, plans and verbose logs
+	Description string `yaml:"description"`
+
+	// Name of the template of the task file that the step is based on, the fields given in the step overriding
+	// those of the template
+	Use string `yaml:"use"`
+
+	// Image is the repo name on which Docker containers are built, which can be pinned by digest like
+	// `busybox@sha256:...` to verify that the pulled image is the expected one
+	Image string `yaml:"image" validate:"required_without_all=Follow Build,imagedigest"`
+
+	// Build is the path to the build context directory from which the image is built, used instead of Image
+	Build string `yaml:"build" validate:"omitempty,without_image,builddir"`
+
+	// Dockerfile is the path of the Dockerfile within the build context, `Dockerfile` by default
+	Dockerfile string `yaml:"dockerfile"`
+
+	// The build-time variables passed when building the image
+	BuildArgs map[string]string `yaml:"buildArgs"`
 
 	// Dir is the primary directory on which task is to be run
 	Dir string `yaml:"dir"`
 
 	// The command which runs on the container and exits
-	Command []string `yaml:"command" validate:"omitempty,dive,required"`
+	Command Command `yaml:"command" validate:"omitempty,dive,required"`
+
+	// The list of commands that are to be run in sequence. Each of them can also be given as an object with
+	// the command as `cmd` and the directory it is run on as `dir`
+	Commands []Command `yaml:"commands" validate:"omitempty,dive,omitempty,dive,required"`
+
+	// The directories that the commands given with a `dir` are run on, by index in Commands, overriding Dir
+	CommandDirs map[int]string `yaml:"-"`
 
-	// The list of commands that are to be run in sequence
-	Commands [][]string `yaml:"commands" validate:"omitempty,dive,omitempty,dive,required"`
+	// The shell that the commands given as plain strings are run with, like `sh -c`
+	Shell string `yaml:"shell"`
 
-	// The list of environment variables to be exported inside the container
+	// Entrypoint overrides the entrypoint of the image, to which command(s) are passed as arguments.
+	// An empty entrypoint clears the entrypoint of the image.
+	Entrypoint *string `yaml:"entrypoint"`
+
+	// The list of environment variables to be exported inside the container. Argument variables like `$1` and
+	// `${name}` are replaced with the arguments, as in the command(s).
 	Envs []string `yaml:"envs"`
 
-	// The directories to be mounted on the container as bind volumes
+	// Labels set on the container, overriding those of the task and the task file with the same key
+	Labels map[string]string `yaml:"labels"`
+
+	// Condition evaluated against the environment variables of the step, the step is skipped if it is false
+	When string `yaml:"when"`
+
+	// The directories to be mounted on the container as bind volumes. Argument variables like `$1` and `${name}`
+	// are replaced with the arguments, a source with them being checked only once they are replaced.
 	Mounts []string `yaml:"mounts" validate:"omitempty,dive,min=1,mountdir,parsedir"`
 
+	// The tmpfs mounts of the container, of the form `target:options` like `/scratch:size=64m`, for scratch space
+	// kept in memory and discarded with the container
+	Tmpfs []string `yaml:"tmpfs" validate:"omitempty,dive,tmpfs"`
+
+	// The caches of the container, of the form `name:path` like `gomod:/go/pkg/mod`, mounted from Docker volumes
+	// created if they do not exist and kept between runs, for build caches. They are removed with `dunner cache clean`.
+	Caches []string `yaml:"caches" validate:"omitempty,dive,cache"`
+
+	// Whether the root filesystem of the container is read-only. The commands can then only write to the mounts,
+	// so paths they write to like `/tmp` likely need a `tmpfs` mount.
+	ReadOnlyRootfs bool `yaml:"readOnlyRootfs"`
+
 	// The next task that must be executed if this does go successfully
 	Follow string `yaml:"follow" validate:"omitempty,follow_exist"`
 
+	// When the follow task is run, depending on the previous steps of the task, one of FollowOnSuccess,
+	// FollowOnFailure or FollowOnAlways. It is FollowOnSuccess by default.
+	On string `yaml:"on" validate:"omitempty,followon"`
+
 	// The list of arguments that are to be passed
 	Args []string `yaml:"args"`
 
-	// User that will run the command(s) inside the container, also support user:group
+	// Names of the steps of the task that must be done before this step is run, in asynchronous mode.
+	// Steps run in the order they are defined otherwise.
+	Needs []string `yaml:"needs"`
+
+	// Whether the step is a setup step, like one creating a network, in asynchronous mode. Setup steps run one
+	// after the other before the other steps, which start only once all of them succeeded.
+	Setup bool `yaml:"setup"`
+
+	// User that will run the command(s) inside the container, also support user:group. Both can be given either
+	// as a numeric id or as a name, which is resolved by Docker inside the image
 	User string `yaml:"user"`
+
+	// Network is the name of the Docker network that the container is attached to
+	Network string `yaml:"network"`
+
+	// Entries added to /etc/hosts of the container, of the form host:ip like `myhost:10.0.0.5`. The IP can be
+	// `host-gateway` for the IP of the host.
+	ExtraHosts []string `yaml:"extraHosts" validate:"omitempty,dive,extrahost"`
+
+	// IP addresses of the DNS servers of the container, and the domains searched by its DNS resolver. Each list
+	// replaces the one of the task and the task file.
+	DNS       []string `yaml:"dns" validate:"omitempty,dive,dns"`
+	DNSSearch []string `yaml:"dnsSearch"`
+
+	// Whether the Docker socket of the host is mounted into the container, for steps running docker commands
+	DockerSocket bool `yaml:"dockerSocket"`
+
+	// Whether the container runs in privileged mode, with all the capabilities of the host
+	Privileged bool `yaml:"privileged"`
+
+	// The maximum duration for which the command(s) can run, after which the container is killed
+	Timeout time.Duration `yaml:"timeout" validate:"min=0"`
+
+	// The signal sent to the container when the step is canceled, like on Ctrl+C, before it is killed, like
+	// `SIGTERM` or `SIGQUIT`. The signal canceling the run is sent by default.
+	StopSignal string `yaml:"stopSignal" validate:"omitempty,stopsignal"`
+
+	// How long the container has to exit once sent the stop signal, before it is killed, the `--stop-timeout` of
+	// the run by default
+	StopTimeout time.Duration `yaml:"stopTimeout" validate:"min=0"`
+
+	// Path of the file on the host to which the output of the command(s) is written, besides the terminal
+	OutputFile string `yaml:"outputFile"`
+
+	// Whether the error output of the command(s) is written to `outputFile` as well
+	OutputStderr bool `yaml:"outputStderr"`
+
+	// Name of the environment variable that the output of the command(s) is passed to the next steps of the task
+	// as, once the step succeeded. The whitespace around the output is trimmed, like its trailing newline, while
+	// the lines of a multi-line output are kept separated by newlines. The steps after a step following the task
+	// get it named after the task, like `${build.GIT_SHA}`, replaced in their commands, envs and mounts.
+	CaptureAs string `yaml:"captureAs" validate:"omitempty,captureas"`
+
+	// Input fed to the command(s), either given as it is or as `@file` to read it from the file, relative to
+	// the directory of the task file. `@@` at the start is a literal `@`.
+	Stdin string `yaml:"stdin" validate:"omitempty,stdinfile"`
+
+	// Whether the command(s) run with a pseudo-TTY attached to the terminal, like `docker exec -it`, for instance
+	// to debug in a shell of the container. Interactive steps cannot be run in asynchronous mode, nor given `stdin`.
+	Interactive bool `yaml:"interactive" validate:"omitempty,interactive"`
+
+	// The number of times the step is re-run if its command(s) exit with a non-zero exit code
+	Retries int `yaml:"retries" validate:"min=0"`
+
+	// The duration to wait for between two attempts of running the step
+	RetryDelay time.Duration `yaml:"retryDelay" validate:"min=0"`
+
+	// How the duration between two attempts grows from `retryDelay`, the duration being the same by default
+	RetryBackoff *Backoff `yaml:"retryBackoff"`
+
+	// Whether the task goes on if the command(s) of the step exit with a non-zero exit code, the task still
+	// failing once it is done
+	ContinueOnError bool `yaml:"continueOnError"`
+
+	// Whether the step is run even after a previous step of the task failed, like a step cleaning up
+	Always bool `yaml:"always"`
+
+	// Whether an init process runs as the first process of the container, forwarding signals to the commands and
+	// reaping their zombie processes. It overrides the `init` of the task file.
+	Init *bool `yaml:"init"`
+
+	// Whether the container of the step is kept running once the step is done, rather than removed, to debug it
+	// with `docker exec`
+	KeepContainer bool `yaml:"keepContainer"`
+
+	// The memory limit of the container, a number of bytes with an optional unit suffix like `512m` or `2g`
+	Memory string `yaml:"memory" validate:"omitempty,memory"`
+
+	// The number of CPUs the container can use, like `1.5`
+	CPUs float64 `yaml:"cpus" validate:"min=0"`
+
+	// The ulimits of the container by name, like `nofile: 65536`, either a limit or `soft:hard` limits like
+	// `1024:65536`. The names are those of `docker run --ulimit`.
+	Ulimits map[string]string `yaml:"ulimits" validate:"omitempty,ulimits"`
+
+	// The kernel parameters set in the container, like `net.core.somaxconn: "1024"`. Only those of the namespaces of
+	// the container can be set, like `net.*`, `fs.mqueue.*` and the IPC ones like `kernel.shmmax`.
+	Sysctls map[string]string `yaml:"sysctls" validate:"omitempty,sysctls"`
+
+	// The image that the container is committed to once the commands succeeded, like `myimage:tag`, for later
+	// steps to run on with `image`. It keeps the entrypoint and command of the image of the step, which is the
+	// image built from `build` if given, the committed image being tagged besides the built one.
+	CommitAs string `yaml:"commitAs" validate:"omitempty,commitas"`
+
+	// The GPUs the container can use, either `all`, a number of GPUs, or `device=` followed by the IDs of the GPUs
+	// like `device=0,1`. The host needs the NVIDIA Container Toolkit.
+	GPUs string `yaml:"gpus" validate:"omitempty,gpus"`
+
+	// Whether a failed command of `commands` stops the commands after it, either `abort` or `continue`, `abort` by
+	// default. With `continue`, the remaining commands are still run and the step fails if any of them failed.
+	CommandErrorMode string `yaml:"commandErrorMode" validate:"omitempty,commanderrormode"`
+
+	// Whether the commands of `commands` are run one after another in one shell, so that changes of the directory
+	// and variables like `cd` and `export` are kept between them. Every command is run on its own by default.
+	SharedShell bool `yaml:"sharedShell"`
+
+	// The platform of the image the container runs, like `linux/arm64`, for the images of several platforms. Images
+	// of another platform than the one of the host are emulated, which needs QEMU to be set up on the host.
+	Platform string `yaml:"platform" validate:"omitempty,platform"`
+
+	// When the image is pulled before running the step, one of `always`, `missing` or `never`, `missing` by default
+	PullPolicy string `yaml:"pullPolicy" validate:"omitempty,pullpolicy"`
+
+	// What to wait for to be ready once the step is done, before the next step is run
+	WaitFor *WaitFor `yaml:"waitFor"`
+
+	shellCommand  bool         // Whether the command is given as a plain string, to be run with the shell
+	shellCommands map[int]bool // Indices of the commands given as plain strings, to be run with the shell
+	scriptShell   []string     // The shell running the commands as one script, if `sharedShell` is set
+	fields        []string     // Keys of the fields given in the task file, until the template used is applied
+}
+
+// Conditions of running a follow task, depending on the previous steps of the task
+const (
+	FollowOnSuccess = "success" // The follow task is run as long as no previous step stopped the task
+	FollowOnFailure = "failure" // The follow task is run only if a previous step failed
+	FollowOnAlways  = "always"  // The follow task is run either way
+)
+
+// WaitFor describes a service, like one started by a step, which is polled until it is ready. Either the address
+// of the service or a command run on the host to check it is given.
+type WaitFor struct {
+	Address  string        `yaml:"address" validate:"waitfor"` // Address of the form host:port, ready once it accepts TCP connections
+	Command  Command       `yaml:"command"`                    // Command run on the host, ready once it exits with a zero exit code
+	Timeout  time.Duration `yaml:"timeout" validate:"min=0"`   // The maximum duration to wait for, 30s by default
+	Interval time.Duration `yaml:"interval" validate:"min=0"`  // The duration between two polls, 1s by default
+	Backoff  *Backoff      `yaml:"backoff"`                    // How the duration between two polls grows from the interval
+}
+
+// Backoff describes how the delay between two attempts of something grows, from a base delay given along with it
+type Backoff struct {
+	Strategy   string        `yaml:"strategy" validate:"omitempty,backoffstrategy"` // BackoffFixed or BackoffExponential, BackoffFixed by default
+	Jitter     float64       `yaml:"jitter" validate:"min=0,max=1"`                 // Fraction of the delay it is randomly changed by, like 0.2 for ±20%
+	MaxElapsed time.Duration `yaml:"maxElapsed" validate:"min=0"`                   // The duration after which no more attempts are made, no limit if zero
+}
+
+// Backoff strategies, telling how the delay between two attempts grows
+const (
+	BackoffFixed       = "fixed"       // The delay is the same between all attempts
+	BackoffExponential = "exponential" // The delay doubles after every attempt
+)
+
+// Command is a command to be run on the container, given either in exec form as a list of strings, or as a
+// plain string which is run with the shell of the step.
+type Command []string
+
+// RegistryAuth describes the credentials that images are pulled from a registry with, either a username and a
+// password or a token. Values can refer to environment variables, like `${REGISTRY_PASSWORD}`.
+type RegistryAuth struct {
+	Username string `yaml:"username" validate:"registryauth"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"` // Bearer token sent to the registry, instead of a username and a password
+}
+
+// Types of the arguments of a task
+const (
+	ArgString = "string" // Any value is accepted
+	ArgInt    = "int"    // The value must be an integer
+	ArgBool   = "bool"   // The value must be a boolean, like true, false, 1 or 0
+)
+
+// TaskArg describes an argument expected by a task, passed in order after the task name in the command line
+type TaskArg struct {
+	Name        string `yaml:"name" validate:"required"`          // Name of the argument, shown in the usage of the task
+	Type        string `yaml:"type" validate:"omitempty,argtype"` // One of string, int or bool, string by default
+	Required    bool   `yaml:"required"`                          // Whether the task cannot be run without the argument
+	Description string `yaml:"description"`                       // Short description of the argument, shown in the usage
 }
 
 // Task describes a single task composed of multiple steps to be run in a docker container
 type Task struct {
-	Envs   []string `yaml:"envs"`   // Environment variables common to all steps
-	Mounts []string `yaml:"mounts"` // Directory mounts common to all steps
-	Steps  []Step   `yaml:"steps"`
+	Description string              `yaml:"description"` // Short description of what the task does, shown when listing tasks
+	Args        []TaskArg           `yaml:"args"`        // Arguments expected by the task, any number of arguments is accepted if not given
+	Matrix      map[string][]string `yaml:"matrix"`      // Values of environment variables by name, the task being run once for every combination of them
+
+	Envs       []string          `yaml:"envs"`                                // Environment variables common to all steps
+	Labels     map[string]string `yaml:"labels"`                              // Container labels common to all steps
+	DNS        []string          `yaml:"dns" validate:"omitempty,dive,dns"`   // IP addresses of the DNS servers of the containers, unless the step has a `dns`
+	DNSSearch  []string          `yaml:"dnsSearch"`                           // DNS search domains of the containers, unless the step has a `dnsSearch`
+	InheritEnv []string          `yaml:"inheritEnv" validate:"dive,required"` // Names of the host environment variables passed to all steps, `NAME!` if it must be set
+	EnvFile    string            `yaml:"envFile"`                             // File of environment variables common to all steps, in dotenv format
+	Mounts     []string          `yaml:"mounts"`                              // Directory mounts common to all steps
+	WorkDir    string            `yaml:"workdir"`                             // Default directory on which steps are run, unless the step has a `dir`
+	Image      string            `yaml:"image"`                               // Default image of the steps, unless the step has an `image`, a `build` or a `follow`
+	Shell      string            `yaml:"shell"`                               // Shell of the commands given as plain strings, unless the step has a `shell`
+	Secrets    []string          `yaml:"secrets"`                             // Names of the environment variables whose values are redacted from the output
+	Inputs     []string          `yaml:"inputs" validate:"dive,glob"`         // Glob patterns of the files the task depends on, relative to the task file, skipping it while they do not change
+	Steps      []Step            `yaml:"steps"`
+
+	fileEnvs []string // Environment variables of the env file, in scope of the envs of the task, see readEnvFiles
 }
 
 // Configs describes the parsed information from the dunner file.
 // It is a map of task name as keys and the list of tasks associated with it.
 type Configs struct {
-	Envs   []string        `yaml:"envs"`   // Environment variables common to all tasks
-	Mounts []string        `yaml:"mounts"` // Directory mounts common to all tasks
-	Tasks  map[string]Task `yaml:"tasks" validate:"dive,keys,required,endkeys,required,min=1,required"`
+	Include    []string                `yaml:"include" validate:"dive,required"`           // Task files whose tasks and globals are merged, this file taking precedence
+	Envs       []string                `yaml:"envs"`                                       // Environment variables common to all tasks
+	InheritEnv []string                `yaml:"inheritEnv" validate:"dive,required"`        // Names of the host environment variables passed to all tasks, `NAME!` if it must be set
+	Labels     map[string]string       `yaml:"labels"`                                     // Container labels common to all tasks
+	DNS        []string                `yaml:"dns" validate:"omitempty,dive,dns"`          // IP addresses of the DNS servers of the containers, unless the task or the step has a `dns`
+	DNSSearch  []string                `yaml:"dnsSearch"`                                  // DNS search domains of the containers, unless the task or the step has a `dnsSearch`
+	EnvFile    string                  `yaml:"envFile"`                                    // File of environment variables common to all tasks, in dotenv format
+	Mounts     []string                `yaml:"mounts"`                                     // Directory mounts common to all tasks
+	Shell      string                  `yaml:"shell"`                                      // Shell of the commands given as plain strings, `sh -c` by default
+	PullPolicy string                  `yaml:"pullPolicy" validate:"omitempty,pullpolicy"` // When images are pulled, unless the step has a `pullPolicy`
+	Registry   string                  `yaml:"registry"`                                   // Registry or mirror that images given without a registry are pulled from
+	Init       bool                    `yaml:"init"`                                       // Whether the containers run an init process, unless the step has an `init`
+	Auth       map[string]RegistryAuth `yaml:"auth" validate:"dive"`                       // Credentials of the registries by host, like `docker.io` for Docker Hub
+	Secrets    []string                `yaml:"secrets"`                                    // Names of the environment variables whose values are redacted from the output
+	Before     []Step                  `yaml:"before"`                                     // Steps run before every task run from the command line
+	After      []Step                  `yaml:"after"`                                      // Steps run after every task run from the command line, even if it failed
+	Templates  map[string]Step         `yaml:"templates"`                                  // Steps by name that steps can be based on with `use`
+	Tasks      map[string]Task         `yaml:"tasks" validate:"dive,keys,required,endkeys,required,min=1,required"`
+
+	baseDir       string   // Directory of the task file, against which relative paths in it are resolved
+	taskOrder     []string // Names of the tasks in the order they are defined in the task file
+	unknownFields []error  // Fields of the task file unknown to dunner, reported on validation
+	fileEnvs      []string // Environment variables of the env file, in scope of the envs of the task file, see readEnvFiles
 }
@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// dockerHub is the host of the registry that images given without a registry are pulled from
+const dockerHub = "docker.io"
+
+// ImageRegistry returns the host of the registry the image is pulled from, `docker.io` if the image is given
+// without a registry.
+func ImageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if parts[0] == "index.docker.io" {
+			return dockerHub
+		}
+		return parts[0]
+	}
+	return dockerHub
+}
+
+// registryAuth returns the encoded credentials of the registry of the image, empty if the step has none for it
+func (step Step) registryAuth(image string) (string, error) {
+	auth, found := step.Auths[ImageRegistry(image)]
+	if !found {
+		return "", nil
+	}
+	encoded, err := json.Marshal(auth)
+	if err != nil {
+		return "", fmt.Errorf(`docker: failed to encode credentials of registry '%s': %s`, ImageRegistry(image), err.Error())
+	}
+	return base64.URLEncoding.EncodeToString(encoded), nil
+}
+
+// pullError returns the error of a failed pull of the image, telling apart failures to authenticate to the
+// registry from images that do not exist.
+func pullError(image string, hasAuth bool, err error) error {
+	registry := ImageRegistry(image)
+	switch {
+	case client.IsErrUnauthorized(err) && hasAuth:
+		return fmt.Errorf(`docker: failed to authenticate to registry '%s' to pull image %s, check its credentials: %s`, registry, image, err.Error())
+	case client.IsErrUnauthorized(err):
+		return fmt.Errorf(`docker: registry '%s' needs credentials to pull image %s, add them to the auth of the task file: %s`, registry, image, err.Error())
+	case client.IsErrNotFound(err):
+		return fmt.Errorf(`docker: image %s does not exist in registry '%s': %s`, image, registry, err.Error())
+	}
+	return fmt.Errorf(`docker: failed to pull image %s: %s`, image, err.Error())
+}
+
+// authConfigs returns the credentials of the registries of the step, to pull the base images of a build with
+func (step Step) authConfigs() map[string]types.AuthConfig {
+	if len(step.Auths) == 0 {
+		return nil
+	}
+	auths := make(map[string]types.AuthConfig, len(step.Auths))
+	for registry, auth := range step.Auths {
+		if registry == dockerHub {
+			// The daemon looks up the credentials of Docker Hub by its index address
+			registry = "https://index.docker.io/v1/"
+		}
+		auths[registry] = auth
+	}
+	return auths
+}
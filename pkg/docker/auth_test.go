@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+)
+
+func TestImageRegistry(t *testing.T) {
+	for image, expected := range map[string]string{
+		"busybox":                        "docker.io",
+		"user/repo:1.0":                  "docker.io",
+		"index.docker.io/library/golang": "docker.io",
+		"quay.io/user/repo":              "quay.io",
+		"localhost:5000/repo":            "localhost:5000",
+	} {
+		if got := ImageRegistry(image); got != expected {
+			t.Errorf("expected registry of '%s' to be %s, got: %s", image, expected, got)
+		}
+	}
+}
+
+func TestStepRegistryAuth(t *testing.T) {
+	auth := types.AuthConfig{Username: "user", Password: "pass", ServerAddress: "quay.io"}
+	step := Step{Auths: map[string]types.AuthConfig{"quay.io": auth}}
+
+	encoded, err := step.registryAuth("quay.io/user/repo")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	decoded, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("expected credentials to be base64 encoded, got: %s", err)
+	}
+	var got types.AuthConfig
+	if err := json.Unmarshal(decoded, &got); err != nil || !reflect.DeepEqual(got, auth) {
+		t.Errorf("expected credentials %v, got %v (%v)", auth, got, err)
+	}
+
+	if encoded, _ := step.registryAuth("busybox"); encoded != "" {
+		t.Errorf("expected no credentials for Docker Hub, got: %s", encoded)
+	}
+}
+
+func TestPullError(t *testing.T) {
+	unauthorized := errdefs.Unauthorized(errors.New("unauthorized: authentication required"))
+	notFound := errdefs.NotFound(errors.New("manifest unknown"))
+	tests := []struct {
+		err      error
+		hasAuth  bool
+		expected string
+	}{
+		{unauthorized, true, "docker: failed to authenticate to registry 'quay.io' to pull image quay.io/user/repo, check its credentials"},
+		{unauthorized, false, "docker: registry 'quay.io' needs credentials to pull image quay.io/user/repo, add them to the auth of the task file"},
+		{notFound, true, "docker: image quay.io/user/repo does not exist in registry 'quay.io'"},
+		{errors.New("timeout"), false, "docker: failed to pull image quay.io/user/repo"},
+	}
+
+	for _, test := range tests {
+		if err := pullError("quay.io/user/repo", test.hasAuth, test.err); !strings.HasPrefix(err.Error(), test.expected) {
+			t.Errorf("expected error starting with: %s, got: %s", test.expected, err)
+		}
+	}
+}
+
+func TestStepAuthConfigs(t *testing.T) {
+	hub := types.AuthConfig{Username: "user", Password: "pass"}
+	step := Step{Auths: map[string]types.AuthConfig{"docker.io": hub}}
+
+	expected := map[string]types.AuthConfig{"https://index.docker.io/v1/": hub}
+	if got := step.authConfigs(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected credentials %v, got %v", expected, got)
+	}
+}
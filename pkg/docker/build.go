@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/term"
+)
+
+// buildImage builds the image of the step from its build context and returns the ID of the built image. The image
+// is built once per run for the same build inputs, see `ImageCache`.
+func buildImage(ctx context.Context, cli *client.Client, step Step) (string, error) {
+	buildContext, digest, err := tarBuildContext(step.Build)
+	if err != nil {
+		return "", fmt.Errorf(`docker: failed to read build context %s: %s`, step.Build, err.Error())
+	}
+	key := buildKey(digest, step.Dockerfile, step.BuildArgs, step.Platform)
+	return step.Images.built(key, func() (string, error) { return runBuild(ctx, cli, step, buildContext) })
+}
+
+// runBuild builds the image of the step from the archive of its build context
+func runBuild(ctx context.Context, cli *client.Client, step Step, buildContext []byte) (string, error) {
+	log.Infof("Building image for '%s' task from '%s'", step.Task, step.Build)
+	buildArgs := make(map[string]*string)
+	for k := range step.BuildArgs {
+		v := step.BuildArgs[k]
+		buildArgs[k] = &v
+	}
+	resp, err := cli.ImageBuild(ctx, bytes.NewReader(buildContext), types.ImageBuildOptions{
+		Dockerfile:  step.Dockerfile,
+		BuildArgs:   buildArgs,
+		AuthConfigs: step.authConfigs(),
+		Platform:    step.Platform,
+		Remove:      true,
+	})
+	if err != nil {
+		return "", fmt.Errorf(`docker: failed to build image from %s: %s`, step.Build, err.Error())
+	}
+	defer resp.Body.Close()
+
+	var id string
+	var out io.Writer = ioutil.Discard
+	if step.settings().Verbose {
+		out = os.Stdout
+	}
+	termFd, isTerm := term.GetFdInfo(out)
+	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, out, termFd, isTerm, func(msg jsonmessage.JSONMessage) {
+		var result types.BuildResult
+		if err := json.Unmarshal(*msg.Aux, &result); err == nil && result.ID != "" {
+			id = result.ID
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf(`docker: failed to build image from %s: %s`, step.Build, err.Error())
+	}
+	if id == "" {
+		return "", fmt.Errorf(`docker: failed to find ID of image built from %s`, step.Build)
+	}
+
+	return id, nil
+}
+
+// tarBuildContext archives the given build context directory to be sent to the Docker daemon,
+// along with a digest of the archive that changes whenever any file in the context changes.
+func tarBuildContext(dir string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		// Modification times are left out so that the digest only depends on the contents
+		header.ModTime, header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}, time.Time{}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:]), nil
+}
+
+func buildKey(contextDigest string, dockerfile string, buildArgs map[string]string, platform string) string {
+	keys := make([]string, 0, len(buildArgs))
+	for k := range buildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", contextDigest, dockerfile, platform)
+	for _, k := range keys {
+		fmt.Fprintf(h, "\x00%s=%s", k, buildArgs[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createBuildContext(t *testing.T, dockerfile string) string {
+	dir, err := ioutil.TempDir("", "dunner-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestTarBuildContext(t *testing.T) {
+	dir := createBuildContext(t, "FROM busybox")
+	defer os.RemoveAll(dir)
+
+	archive, _, err := tarBuildContext(dir)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	expected := []string{"Dockerfile", "src", "src/main.go"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected archive entries: %v, got: %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected archive entries: %v, got: %v", expected, names)
+		}
+	}
+}
+
+func TestTarBuildContextDigestChangesWithContents(t *testing.T) {
+	dir := createBuildContext(t, "FROM busybox")
+	defer os.RemoveAll(dir)
+	_, digest, err := tarBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, unchanged, err := tarBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, changed, err := tarBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if digest != unchanged {
+		t.Errorf("expected digest of unchanged context to be %s, got %s", digest, unchanged)
+	}
+	if digest == changed {
+		t.Errorf("expected digest to change when the context is changed, got %s", changed)
+	}
+}
+
+func TestBuildKeyDependsOnBuildArgs(t *testing.T) {
+	key := buildKey("digest", "Dockerfile", map[string]string{"VERSION": "1", "OS": "linux"}, "")
+
+	if same := buildKey("digest", "Dockerfile", map[string]string{"OS": "linux", "VERSION": "1"}, ""); same != key {
+		t.Errorf("expected key %s for same build args, got %s", key, same)
+	}
+	if other := buildKey("digest", "Dockerfile", map[string]string{"VERSION": "2", "OS": "linux"}, ""); other == key {
+		t.Errorf("expected key to change with build args, got %s", other)
+	}
+}
+
+func TestBuildKeyDependsOnPlatform(t *testing.T) {
+	key := buildKey("digest", "Dockerfile", nil, "linux/amd64")
+
+	if other := buildKey("digest", "Dockerfile", nil, "linux/arm64"); other == key {
+		t.Errorf("expected key to change with the platform, got %s", other)
+	}
+}
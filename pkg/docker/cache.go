@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// CacheLabel is the label of the volumes of the caches of steps, its value being the name of the cache
+const CacheLabel = "dunner.cache"
+
+// cacheVolumePrefix is the prefix of the names of the volumes of the caches
+const cacheVolumePrefix = "dunner-cache-"
+
+// CacheVolume returns the name of the volume of the cache of the given name
+func CacheVolume(name string) string {
+	return cacheVolumePrefix + name
+}
+
+// CacheName returns the name of the cache of the volume, or false if the volume is not the one of a cache
+func CacheName(volume string) (string, bool) {
+	if !strings.HasPrefix(volume, cacheVolumePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(volume, cacheVolumePrefix), true
+}
+
+// createCaches creates the volumes of the caches of the step that do not exist yet, labeled for `dunner cache clean`
+// to find them. They are kept between runs, for the steps to reuse what they cached.
+func (step Step) createCaches(ctx context.Context, cli *client.Client) error {
+	for _, name := range step.Caches {
+		volume := CacheVolume(name)
+		_, err := cli.VolumeInspect(ctx, volume)
+		if err == nil {
+			continue
+		}
+		if !client.IsErrNotFound(err) {
+			return fmt.Errorf(`docker: failed to inspect volume %s of cache '%s': %s`, volume, name, err.Error())
+		}
+		log.Infof("Creating volume %s of cache '%s'", volume, name)
+		body := volumetypes.VolumeCreateBody{Name: volume, Labels: map[string]string{CacheLabel: name}}
+		if _, err := cli.VolumeCreate(ctx, body); err != nil {
+			return fmt.Errorf(`docker: failed to create volume %s of cache '%s': %s`, volume, name, err.Error())
+		}
+	}
+	return nil
+}
+
+// RemoveCaches removes the volumes of the caches of the given names, or of all the caches if none is given. It
+// returns the names of the removed caches, even if it failed to remove one, like a cache in use by a container.
+func RemoveCaches(names []string) ([]string, error) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, err
+	}
+	cli.NegotiateAPIVersion(ctx)
+	return removeCaches(ctx, cli, names)
+}
+
+func removeCaches(ctx context.Context, cli *client.Client, names []string) ([]string, error) {
+	list, err := cli.VolumeList(ctx, filters.NewArgs(filters.Arg("label", CacheLabel)))
+	if err != nil {
+		return nil, fmt.Errorf(`docker: failed to list volumes of caches: %s`, err.Error())
+	}
+	removing := make(map[string]bool, len(names))
+	for _, name := range names {
+		removing[name] = true
+	}
+	var removed []string
+	for _, volume := range list.Volumes {
+		name := volume.Labels[CacheLabel]
+		if len(names) > 0 && !removing[name] {
+			continue
+		}
+		if err := cli.VolumeRemove(ctx, volume.Name, false); err != nil {
+			return removed, fmt.Errorf(`docker: failed to remove volume %s of cache '%s': %s`, volume.Name, name, err.Error())
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// fakeVolumeDaemon returns a client of a fake Docker daemon with the volumes, which records the volumes created
+// and removed through it, along with the function stopping the daemon
+func fakeVolumeDaemon(t *testing.T, volumes ...*types.Volume) (*client.Client, *[]string, func()) {
+	var mu sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch {
+		case r.Method == http.MethodGet && name == "volumes":
+			json.NewEncoder(w).Encode(volumetypes.VolumeListOKBody{Volumes: volumes})
+		case r.Method == http.MethodGet:
+			for _, volume := range volumes {
+				if volume.Name == name {
+					json.NewEncoder(w).Encode(volume)
+					return
+				}
+			}
+			http.Error(w, `{"message": "no such volume"}`, http.StatusNotFound)
+		case r.Method == http.MethodPost && name == "create":
+			var body volumetypes.VolumeCreateBody
+			json.NewDecoder(r.Body).Decode(&body)
+			calls = append(calls, "create "+body.Name+" "+body.Labels[CacheLabel])
+			json.NewEncoder(w).Encode(types.Volume{Name: body.Name, Labels: body.Labels})
+		case r.Method == http.MethodDelete:
+			calls = append(calls, "remove "+name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+server.Listener.Addr().String()), client.WithVersion("1.39"))
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return cli, &calls, server.Close
+}
+
+func TestCacheName(t *testing.T) {
+	if name, isCache := CacheName(CacheVolume("gomod")); !isCache || name != "gomod" {
+		t.Errorf("expected name of the cache of its volume to be gomod, got: %s", name)
+	}
+	if _, isCache := CacheName("data"); isCache {
+		t.Errorf("expected volume data not to be the one of a cache")
+	}
+}
+
+func TestCreateCaches(t *testing.T) {
+	cli, calls, stop := fakeVolumeDaemon(t, &types.Volume{Name: CacheVolume("gomod"), Labels: map[string]string{CacheLabel: "gomod"}})
+	defer stop()
+	step := Step{Task: "build", Caches: []string{"gomod", "gobuild"}}
+
+	if err := step.createCaches(context.Background(), cli); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"create dunner-cache-gobuild gobuild"}
+	if !reflect.DeepEqual(expected, *calls) {
+		t.Errorf("expected only the missing cache to be created: %v, got: %v", expected, *calls)
+	}
+}
+
+func TestRemoveCaches(t *testing.T) {
+	volumes := []*types.Volume{
+		{Name: CacheVolume("gomod"), Labels: map[string]string{CacheLabel: "gomod"}},
+		{Name: CacheVolume("npm"), Labels: map[string]string{CacheLabel: "npm"}},
+	}
+	for _, test := range []struct {
+		names    []string
+		expected []string
+	}{
+		{nil, []string{"gomod", "npm"}},
+		{[]string{"npm", "pip"}, []string{"npm"}},
+	} {
+		cli, calls, stop := fakeVolumeDaemon(t, volumes...)
+
+		removed, err := removeCaches(context.Background(), cli, test.names)
+		stop()
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if !reflect.DeepEqual(test.expected, removed) {
+			t.Errorf("expected removed caches of %v: %v, got: %v", test.names, test.expected, removed)
+		}
+		if len(*calls) != len(test.expected) {
+			t.Errorf("expected %d volumes to be removed, got: %v", len(test.expected), *calls)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// runAndCommit runs the commands on the container, then commits the container to the image of `CommitAs` if they
+// all succeeded
+func (step Step) runAndCommit(ctx context.Context, cli *client.Client, containerID string, commands [][]string) error {
+	if err := step.runCommands(ctx, cli, containerID, commands); err != nil || step.CommitAs == "" {
+		return err
+	}
+	return step.commit(ctx, cli, containerID)
+}
+
+// commit commits the container to the image of `CommitAs`. The container is kept running with a command of its
+// own, so the entrypoint, command and environment of the committed image are those of the image of the step, for
+// the image to behave like it and not to keep the environment variables of the step.
+func (step Step) commit(ctx context.Context, cli *client.Client, containerID string) error {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, step.Image)
+	if err != nil {
+		return fmt.Errorf(`docker: failed to commit container to image %s: %s`, step.CommitAs, err.Error())
+	}
+	config := &container.Config{Env: []string{}}
+	if inspect.Config != nil {
+		config.Entrypoint, config.Cmd, config.WorkingDir = inspect.Config.Entrypoint, inspect.Config.Cmd, inspect.Config.WorkingDir
+		if len(inspect.Config.Env) > 0 {
+			config.Env = inspect.Config.Env
+		}
+	}
+	if _, err := cli.ContainerCommit(ctx, containerID, types.ContainerCommitOptions{Reference: step.CommitAs, Config: config}); err != nil {
+		return fmt.Errorf(`docker: failed to commit container to image %s: %s`, step.CommitAs, err.Error())
+	}
+	log.Infof("Committed container of '%s' task to image %s", step.Task, step.CommitAs)
+	return nil
+}
@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// SplitDigest splits an image reference pinned by digest, like `busybox@sha256:...`, into the repository with
+// its tag if any and the digest. The digest is empty if the image is not pinned.
+func SplitDigest(image string) (string, string) {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
+
+// repository returns the repository of the image reference, without its tag and digest
+func repository(image string) string {
+	name, _ := SplitDigest(image)
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[:i]
+	}
+	return name
+}
+
+// matchesDigest returns true if any of the repository digests of an image, of the form `repository@digest`, is
+// the one the image reference is pinned to.
+func matchesDigest(repoDigests []string, image string) bool {
+	_, digest := SplitDigest(image)
+	for _, repoDigest := range repoDigests {
+		if name, d := SplitDigest(repoDigest); d == digest && repository(name) == repository(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImageDigest returns true if an image with the digest the image reference is pinned to exists on the host
+func checkImageDigest(ctx context.Context, cli *client.Client, image string) (bool, error) {
+	hostImages, err := cli.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, imageSummary := range hostImages {
+		if matchesDigest(imageSummary.RepoDigests, image) {
+			log.Debugf("Image '%s' exists with the host", image)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// verifyDigest verifies that the image on the host has the digest the image reference is pinned to, if any.
+// The digest of a pulled image is checked so that a registry or mirror cannot serve a different image.
+func verifyDigest(ctx context.Context, cli *client.Client, image string) error {
+	_, digest := SplitDigest(image)
+	if digest == "" {
+		return nil
+	}
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return fmt.Errorf(`docker: failed to verify digest of image %s: %s`, image, err.Error())
+	}
+	if !matchesDigest(inspect.RepoDigests, image) {
+		return fmt.Errorf(`docker: image %s does not match its pinned digest %s, its digests are: %s`, repository(image), digest, strings.Join(inspect.RepoDigests, ", "))
+	}
+	return nil
+}
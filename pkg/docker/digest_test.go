@@ -0,0 +1,39 @@
+package docker
+
+import "testing"
+
+const testDigest = "sha256:4a35e747960bd7f1fd9a8b2a2a4bcd0b86bce7ee2a3d3f9f0b4fd4d1e9ab2d4c"
+
+func TestSplitDigest(t *testing.T) {
+	for image, expected := range map[string][2]string{
+		"busybox@" + testDigest:           {"busybox", testDigest},
+		"busybox:1.31@" + testDigest:      {"busybox:1.31", testDigest},
+		"localhost:5000/repo:1.0":         {"localhost:5000/repo:1.0", ""},
+		"quay.io/user/repo@" + testDigest: {"quay.io/user/repo", testDigest},
+	} {
+		if name, digest := SplitDigest(image); name != expected[0] || digest != expected[1] {
+			t.Errorf("expected %s to be split into %v, got [%s %s]", image, expected, name, digest)
+		}
+	}
+}
+
+func TestMatchesDigest(t *testing.T) {
+	otherDigest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	tests := []struct {
+		repoDigests []string
+		image       string
+		expected    bool
+	}{
+		{[]string{"busybox@" + testDigest}, "busybox@" + testDigest, true},
+		{[]string{"busybox@" + testDigest}, "busybox:1.31@" + testDigest, true},
+		{[]string{"busybox@" + otherDigest}, "busybox@" + testDigest, false},
+		{[]string{"alpine@" + testDigest}, "busybox@" + testDigest, false},
+		{nil, "busybox@" + testDigest, false},
+		{[]string{"localhost:5000/repo@" + testDigest}, "localhost:5000/repo:1.0@" + testDigest, true},
+	}
+	for _, test := range tests {
+		if got := matchesDigest(test.repoDigests, test.image); got != test.expected {
+			t.Errorf("expected digests %v to match %s: %v, got: %v", test.repoDigests, test.image, test.expected, got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package docker
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,10 +19,13 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/strslice"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/docker/pkg/term"
+	"github.com/docker/go-units"
 	"github.com/leopardslab/dunner/internal/logger"
 	"github.com/leopardslab/dunner/internal/util"
 	"github.com/spf13/viper"
@@ -29,21 +33,133 @@ import (
 
 var log = logger.Log
 
+// hostMountTarget is the directory of the container on which the working directory of the host is mounted,
+// which is also the default working directory of the container.
+const hostMountTarget = "/dunner"
+
+// Pull policies of the image of a step
+const (
+	PullAlways  = "always"  // The image is pulled before every run
+	PullMissing = "missing" // The image is pulled only if it is not present on the host
+	PullNever   = "never"   // The image is never pulled, it must be present on the host
+)
+
+// Command error modes, which tell whether a failed command of the `Commands` of a step stops the ones after it
+const (
+	CommandErrorAbort    = "abort"    // The commands after a failed command are not run
+	CommandErrorContinue = "continue" // The commands after a failed command are still run, the step failing in the end
+)
+
+// Keys of the built-in labels set on the container of every step
+const (
+	TaskLabel = "dunner.task" // The task of the step
+	StepLabel = "dunner.step" // The name of the step, if it has one
+)
+
 // Step describes the information required to run one task in docker container. It is very similar to the concept
 // of docker build of a 'Dockerfile' and then a sequence of commands to be executed in `docker run`.
 type Step struct {
-	Task      string            // The name of the task that the step corresponds to
-	Name      string            // Name given to this step for identification purpose
-	Image     string            // Image is the repo name on which Docker containers are built
-	Command   []string          // The command which runs on the container and exits
-	Commands  [][]string        // The list of commands that are to be run in sequence
-	Env       []string          // The list of environment variables to be exported inside the container
-	WorkDir   string            // The primary directory on which task is to be run
-	Volumes   map[string]string // Volumes that are to be attached to the container
-	ExtMounts []mount.Mount     // The directories to be mounted on the container as bind volumes
-	Follow    string            // The next task that must be executed if this does go successfully
-	Args      []string          // The list of arguments that are to be passed
-	User      string            // User that will run the command(s) inside the container, also support user:group
+	Task         string            // The name of the task that the step corresponds to
+	Name         string            // Name given to this step for identification purpose
+	Number       int               // Position of the step in its task, starting from 1
+	Image        string            // Image is the repo name on which Docker containers are built
+	PullPolicy   string            // When the image is pulled, one of PullAlways, PullMissing or PullNever, PullMissing if empty
+	Registry     string            // Registry that Image is pulled from if it is given without one, Docker Hub if empty
+	Command      []string          // The command which runs on the container and exits
+	Commands     [][]string        // The list of commands that are to be run in sequence
+	CommandDirs  map[int]string    // Directories that the Commands are run on by index, overriding WorkDir
+	Entrypoint   []string          // The entrypoint which the command(s) are passed to, nil keeps the one of the image
+	Env          []string          // The list of environment variables to be exported inside the container
+	Labels       map[string]string // Labels set on the container
+	WorkDir      string            // The primary directory on which task is to be run
+	Volumes      map[string]string // Volumes that are to be attached to the container
+	ExtMounts    []mount.Mount     // The directories to be mounted on the container as bind volumes
+	Caches       []string          // Names of the caches among ExtMounts, whose volumes are created if they do not exist
+	Follow       string            // The next task that must be executed if this does go successfully
+	Args         []string          // The list of arguments that are to be passed
+	Captured     []string          // Values captured by the tasks followed before, like `build.GIT_SHA=...`, passed as named arguments
+	DeclaredArgs []string          // Names of the arguments declared by the task, in order, which are named arguments too
+	User         string            // User that will run the command(s) inside the container, also support user:group
+	Network      string            // The Docker network that the container is attached to
+	ExtraHosts   []string          // Entries of /etc/hosts of the container, of the form host:ip
+	DNS          []string          // IP addresses of the DNS servers of the container, those of the daemon if empty
+	DNSSearch    []string          // Domains searched by the DNS resolver of the container
+	Platform     string            // The platform of the image, like `linux/arm64`, the one of the daemon if empty
+	GroupAdd     []string          // Additional groups that the user of the container is added to
+	Privileged   bool              // Whether the container runs in privileged mode
+	ReadOnly     bool              // Whether the root filesystem of the container is read-only
+	Init         bool              // Whether an init process runs in the container, forwarding signals and reaping zombies
+	Timeout      time.Duration     // The maximum duration for which the command(s) can run, zero means no limit
+	StopSignal   string            // The signal stopping the container once Cancel is closed, that of Shutdown if empty
+	StopTimeout  time.Duration     // How long the container has to exit once signaled, the grace period of Shutdown if zero
+	Build        string            // Path to the build context from which the image is built, instead of pulling `Image`
+	Dockerfile   string            // Path of the Dockerfile within the build context
+	BuildArgs    map[string]string // Build-time variables passed to the Dockerfile
+	Memory       int64             // The memory limit of the container in bytes, zero means no limit
+	Ulimits      []*units.Ulimit   // The ulimits of the container, those of the Docker daemon if nil
+	Sysctls      map[string]string // The kernel parameters set in the container
+	CPUs         float64           // The number of CPUs the container can use, zero means no limit
+	OutputPrefix string            // Prefix of every line of the command output, to tell apart concurrently running tasks
+	Stdout       io.Writer         // If set, the output of the command(s) is written to it instead of being printed
+	Stderr       io.Writer         // If set along with Stdout, the error output of the command(s) is written to it
+	Tee          io.Writer         // If set, the output of the command(s) is written to it as well
+	TeeStderr    bool              // Whether the error output of the command(s) is written to Tee as well
+	Secrets      []string          // Values that are redacted from the output of the command(s)
+	Stdin        string            // If set, it is fed to the standard input of each of the command(s)
+	Cancel       <-chan struct{}   // If set, the container is stopped once it is closed
+
+	Auths            map[string]types.AuthConfig // Credentials of the registries that images are pulled from, by host
+	CommandErrorMode string                      // Whether the Commands after a failed one are run, CommandErrorAbort if empty
+	SharedShell      []string                    // If set, the Commands are run as the lines of one script of this shell, sharing its state
+	GPUs             *container.DeviceRequest    // The GPUs the container can use, none if nil
+	CommitAs         string                      // If set, the container is committed to this image once the command(s) succeeded
+	Interactive      bool                        // Whether the command(s) run with a pseudo-TTY attached to the terminal
+	Capture          *bytes.Buffer               // If set, the output of the command(s) is written to it as well, secrets included
+	KeepContainer    bool                        // Whether the container is kept running once the step is done, rather than removed
+	Shutdown         *Shutdown                   // If set, its signal is forwarded to the container once Cancel is closed by it
+	Images           *ImageCache                 // If set, the images on the host in the run, which are not checked for or built again
+	Settings         *Settings                   // Settings of the run the step is part of, the global settings if nil
+
+	existingContainer bool // Whether the command(s) run in a container not created for the step, see Settings.ExecIn
+}
+
+// Settings are the settings of the run that a step is part of, which are the same for all of its steps.
+type Settings struct {
+	Async            bool   // Whether the step runs along with others, its output being printed once it is done
+	Verbose          bool   // Whether the progress of pulling and building images is printed
+	VerboseDocker    bool   // Whether the progress of pulling images is streamed to the error output, layer by layer
+	Quiet            bool   // Whether only the error output of the command(s) is printed
+	DryRun           bool   // Whether the step is not run at all
+	ForcePull        bool   // Whether the image is pulled whatever the pull policy of the step
+	WorkingDirectory string // The directory of the host mounted on the container
+	ExecIn           string // If set, the name or ID of the running container that the command(s) are run in
+
+	ContainerNameTemplate string // Template of the names of the containers, like `dunner-{task}-{step}-{run}`, random names if empty
+	RunID                 string // Short random ID of the run, in the names of its containers
+}
+
+// IsBuiltinLabel returns true if the label of the key is one of the built-in labels, not overridden by the user
+func (step Step) IsBuiltinLabel(key string) bool {
+	return key == TaskLabel && step.Labels[key] == step.Task || key == StepLabel && step.Labels[key] == step.Name
+}
+
+// settings returns the settings of the step, read from the global settings of the command line if it has none
+func (step Step) settings() Settings {
+	if step.Settings != nil {
+		return *step.Settings
+	}
+	return Settings{
+		Async:            viper.GetBool("Async"),
+		Verbose:          viper.GetBool("Verbose"),
+		VerboseDocker:    viper.GetBool("Verbose-docker"),
+		Quiet:            viper.GetBool("Quiet"),
+		DryRun:           viper.GetBool("Dry-run"),
+		ForcePull:        viper.GetBool("Force-pull"),
+		WorkingDirectory: viper.GetString("WorkingDirectory"),
+		ExecIn:           viper.GetString("Exec-in"),
+
+		ContainerNameTemplate: viper.GetString("Container-name-template"),
+	}
 }
 
 // Result stores the output of commands run using `docker exec`
@@ -52,120 +168,101 @@ type Result struct {
 	Error  string
 }
 
+// ExitError is returned when a command run inside the container exits with a non-zero exit code.
+type ExitError struct {
+	Code int // The exit code of the failed command
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("docker: command execution failed with exit code %d", e.Code)
+}
+
+// ErrCanceled is returned when the step is canceled by closing its Cancel channel.
+var ErrCanceled = errors.New("docker: step was canceled")
+
 // Exec method is used to execute the task described in the corresponding step. It returns an object of the
 // struct `Result` with the corresponding output and/or error.
 //
 // Note: A working internet connection is mandatory for the Docker container to contact Docker Hub to find the image and/or
 // corresponding updates.
 func (step Step) Exec() error {
-	var (
-		async     = viper.GetBool("Async")
-		dryRun    = viper.GetBool("Dry-run")
-		verbose   = viper.GetBool("Verbose")
-		forcePull = viper.GetBool("Force-pull")
-	)
+	if step.settings().DryRun {
+		return nil
+	}
 
 	var (
-		hostMountFilepath          = viper.GetString("WorkingDirectory")
-		containerDefaultWorkingDir = "/dunner"
-		hostMountTarget            = "/dunner"
-		defaultCommand             = []string{"tail", "-f", "/dev/null"}
+		hostMountFilepath = step.settings().WorkingDirectory
+		defaultCommand    = []string{"tail", "-f", "/dev/null"}
 	)
 
 	ctx := context.Background()
 	cli, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf(`docker: failed to connect to the Docker daemon: %s`, err.Error())
 	}
 	cli.NegotiateAPIVersion(ctx)
 
-	path, err := filepath.Abs(hostMountFilepath)
-	if err != nil {
-		log.Fatal(err)
+	if name := step.settings().ExecIn; name != "" {
+		return step.execInContainer(ctx, cli, name)
 	}
 
-	check, err := CheckImageExist(ctx, cli, step.Image, false)
+	networkingConfig, err := step.networkingConfig(ctx, cli)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if err = step.createCaches(ctx, cli); err != nil {
+		return err
 	}
-	if forcePull || !check {
-		loadingMsg := fmt.Sprintf("Pulling image: '%s'", step.Image)
-		var done chan bool
-		if !async {
-			done = make(chan bool)
-			go util.ShowLoadingMessage(
-				loadingMsg,
-				fmt.Sprintf("Pulled image: '%s'", step.Image),
-				&done,
-				nil,
-			)
-		} else {
-			log.Info(loadingMsg)
-		}
-
-		out, err := cli.ImagePull(ctx, step.Image, types.ImagePullOptions{})
-		if err != nil {
-			log.Debug(err)
-			log.Infoln("Failed to fetch docker image from Docker Hub, checking in the host...")
-			if check, _ = CheckImageExist(ctx, cli, step.Image, true); !check {
-				return fmt.Errorf(`docker: failed to pull image %s: %s`, step.Image, err.Error())
-			}
-		}
 
-		if out != nil {
-			termFd, isTerm := term.GetFdInfo(os.Stdout)
-			if verbose {
-				if err = jsonmessage.DisplayJSONMessagesStream(out, os.Stdout, termFd, isTerm, nil); err != nil {
-					log.Fatal(err)
-				}
-			} else {
-				if err = jsonmessage.DisplayJSONMessagesStream(out, ioutil.Discard, termFd, isTerm, nil); err != nil {
-					log.Fatal(err)
-				}
-			}
+	path, err := filepath.Abs(hostMountFilepath)
+	if err != nil {
+		return fmt.Errorf(`docker: failed to find working directory %s: %s`, hostMountFilepath, err.Error())
+	}
 
-			if err = out.Close(); err != nil {
-				log.Fatal(err)
-			}
+	if step.Build != "" {
+		if step.Image, err = buildImage(ctx, cli, step); err != nil {
+			return err
 		}
-
-		if !async {
-			done <- true
+	} else {
+		step.Image = QualifyImage(step.Image, step.Registry)
+		if err = step.pullImage(ctx, cli); err != nil {
+			return err
 		}
-		if err = out.Close(); err != nil {
-			log.Fatal(err)
+		if err = verifyDigest(ctx, cli, step.Image); err != nil {
+			return err
 		}
 	}
+	// The container is created from the image as pulled or built, as the API of the client has no platform on
+	// container creation, so the image is checked to be of the platform
+	if err = step.verifyPlatform(ctx, cli); err != nil {
+		return err
+	}
 
-	var containerWorkingDir = containerDefaultWorkingDir
-	if step.WorkDir != "" {
-		if step.WorkDir[0] == '/' {
-			containerWorkingDir = step.WorkDir
-		} else {
-			containerWorkingDir = filepath.Join(hostMountTarget, step.WorkDir)
-		}
+	if err = step.checkGPUSupport(cli); err != nil {
+		return err
 	}
 
-	resp, err := cli.ContainerCreate(
+	var containerWorkingDir = containerDir(step.WorkDir)
+
+	resp, err := step.createContainer(
 		ctx,
+		cli,
 		&container.Config{
 			Image:      step.Image,
+			Entrypoint: step.containerEntrypoint(),
 			Cmd:        defaultCommand,
 			Env:        step.Env,
+			Labels:     step.Labels,
 			WorkingDir: containerWorkingDir,
 			User:       step.User,
 		},
-		&container.HostConfig{
-			Mounts: append(step.ExtMounts, mount.Mount{
-				Type:   mount.TypeBind,
-				Source: path,
-				Target: hostMountTarget,
-			}),
-			AutoRemove: true,
-		},
-		nil, "")
+		step.hostConfig(path),
+		networkingConfig)
+	if err != nil && step.GPUs != nil && strings.Contains(err.Error(), "could not select device driver") {
+		return fmt.Errorf("docker: the Docker daemon has no GPU support to run the step on GPUs, install the NVIDIA Container Toolkit and restart the daemon: %s", err.Error())
+	}
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf(`docker: failed to create container of '%s' task: %s`, step.Task, err.Error())
 	}
 
 	if len(resp.Warnings) > 0 {
@@ -175,15 +272,20 @@ func (step Step) Exec() error {
 	}
 
 	if err = cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		log.Fatal(err)
+		return fmt.Errorf(`docker: failed to start container of '%s' task: %s`, step.Task, err.Error())
 	}
+	var killed bool
 	defer func() {
-		dur, err := time.ParseDuration("-1ns") // Negative duration means no force termination
-		if err != nil {
-			log.Fatal(err)
+		if step.KeepContainer {
+			log.Infof("Kept container %s of '%s' task, debug it with `docker exec -it %s sh` and remove it with `docker rm -f %s`", resp.ID[:12], step.Task, resp.ID[:12], resp.ID[:12])
+			return
 		}
-		if err = cli.ContainerStop(ctx, resp.ID, &dur); err != nil {
-			log.Fatal(err)
+		if killed {
+			return
+		}
+		dur := -time.Nanosecond // Negative duration means no force termination
+		if err := cli.ContainerStop(ctx, resp.ID, &dur); err != nil {
+			log.Errorf("docker: failed to stop container of '%s' task: %s", step.Task, err.Error())
 		}
 	}()
 
@@ -192,11 +294,161 @@ func (step Step) Exec() error {
 		commands = append(commands, step.Command)
 	}
 
-	for _, cmd := range commands {
-		if dryRun {
-			continue
+	if step.Timeout <= 0 && step.Cancel == nil {
+		return step.runAndCommit(ctx, cli, resp.ID, commands)
+	}
+
+	// The timer starts only after the container is running, so that time spent pulling the image is not counted
+	var timeout <-chan time.Time
+	if step.Timeout > 0 {
+		timeout = time.After(step.Timeout)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- step.runAndCommit(ctx, cli, resp.ID, commands)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-timeout:
+		killed = true
+		if err := cli.ContainerKill(ctx, resp.ID, "SIGKILL"); err != nil {
+			return fmt.Errorf(`docker: failed to kill container of timed out step: %s`, err.Error())
 		}
+		return fmt.Errorf(`dunner: step timed out after %s`, step.Timeout)
+	case <-step.Cancel:
+		killed = true
+		if err := step.stopContainer(ctx, cli, resp.ID, done); err != nil {
+			return err
+		}
+		return ErrCanceled
+	}
+}
+
+// QualifyImage returns the reference of the image in the registry, if the image is given without a registry, like
+// `busybox` or `user/repo`. Images of the official repositories of Docker Hub are under `library` in the registry.
+// Fully qualified references, and any reference when the registry is empty, are returned as they are.
+func QualifyImage(image string, registry string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	if registry == "" {
+		return image
+	}
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return registry + "/library/" + image
+	}
+	if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+		return image
+	}
+	return registry + "/" + image
+}
+
+// pullImage pulls the image of the step as per its pull policy, unless a previous step of the run already has
+// with the same image
+func (step Step) pullImage(ctx context.Context, cli *client.Client) error {
+	if !step.settings().ForcePull && step.PullPolicy != PullAlways && step.Images.has(step.Image, step.Platform) {
+		log.Debugf("docker: image '%s' is already on the host in this run", step.Image)
+		return nil
+	}
+	if err := step.fetchImage(ctx, cli); err != nil {
+		return err
+	}
+	step.Images.add(step.Image, step.Platform)
+	return nil
+}
+
+// fetchImage pulls the given image from the registry as per the pull policy. By default, the image is pulled
+// unless it already exists on the host machine. The `--force-pull` flag pulls it unless the policy is never.
+func (step Step) fetchImage(ctx context.Context, cli *client.Client) error {
+	var (
+		settings   = step.settings()
+		async      = settings.Async
+		forcePull  = settings.ForcePull
+		image      = step.Image
+		pullPolicy = step.PullPolicy
+		// The loading message is shown only when the output of the step is printed as it comes, and not along with
+		// the progress of the pull
+		showLoading = !async && !settings.Quiet && !settings.VerboseDocker
+	)
 
+	check, err := CheckImageExist(ctx, cli, image, false)
+	if err != nil {
+		return err
+	}
+	if check && step.Platform != "" && pullPolicy != PullNever {
+		// The image on the host may be of another platform, in which case the one of the platform is pulled
+		check = step.hasPlatform(ctx, cli)
+	}
+	if pullPolicy == PullNever {
+		if !check {
+			if check, _ = CheckImageExist(ctx, cli, image, true); !check {
+				return fmt.Errorf(`docker: image '%s' does not exist on the host and is not pulled as the pull policy is never`, image)
+			}
+		}
+		return nil
+	}
+	if forcePull || pullPolicy == PullAlways || !check {
+		loadingMsg := fmt.Sprintf("Pulling image: '%s'", image)
+		var done chan bool
+		if showLoading {
+			done = make(chan bool)
+			go util.ShowLoadingMessage(
+				loadingMsg,
+				fmt.Sprintf("Pulled image: '%s'", image),
+				&done,
+				nil,
+			)
+		} else {
+			log.Info(loadingMsg)
+		}
+
+		auth, err := step.registryAuth(image)
+		if err != nil {
+			return err
+		}
+		out, err := cli.ImagePull(ctx, image, types.ImagePullOptions{RegistryAuth: auth, Platform: step.Platform})
+		if err != nil {
+			log.Debug(err)
+			log.Infoln("Failed to fetch docker image from the registry, checking in the host...")
+			if check, _ = CheckImageExist(ctx, cli, image, true); !check {
+				return pullError(image, auth != "", err)
+			}
+		}
+
+		if out != nil {
+			if err = displayPullProgress(out, settings); err != nil {
+				if step.Platform != "" && isPlatformError(err) {
+					out.Close()
+					return fmt.Errorf(`docker: image %s is not available for platform '%s': %s`, image, step.Platform, err.Error())
+				}
+				out.Close()
+				return fmt.Errorf(`docker: failed to pull image %s: %s`, image, err.Error())
+			}
+
+			if err = out.Close(); err != nil {
+				return fmt.Errorf(`docker: failed to pull image %s: %s`, image, err.Error())
+			}
+		}
+
+		if showLoading {
+			done <- true
+		}
+	}
+	return nil
+}
+
+func (step Step) runCommands(ctx context.Context, cli *client.Client, containerID string, commands [][]string) error {
+	var async = step.settings().Async
+
+	if step.SharedShell != nil && len(step.Commands) > 0 {
+		// The commands are run as one, so that the directory and the variables of the shell are kept between them
+		script := sharedShellScript(step.Commands, step.CommandDirs, step.CommandErrorMode)
+		commands = [][]string{append(append([]string{}, step.SharedShell...), script)}
+		step.CommandDirs, step.CommandErrorMode = nil, CommandErrorAbort
+	}
+
+	var failed error // Error of the first failed command, if the remaining commands are run after it
+	for i, cmd := range commands {
 		if !async {
 			log.Infof(
 				"Running command '%s' of '%s' task on a container of '%s' image",
@@ -206,58 +458,181 @@ func (step Step) Exec() error {
 			)
 		}
 
-		r, err := runCmd(ctx, cli, resp.ID, cmd)
+		var dir string
+		if commandDir, ok := step.CommandDirs[i]; ok && len(step.Commands) > 0 {
+			dir = containerDir(commandDir)
+		}
+		r, err := step.runCmd(ctx, cli, containerID, append(append([]string{}, step.Entrypoint...), cmd...), dir)
 
 		if async {
-			if async {
-				log.Infof(
-					"Finished running command '%s' on '%s' docker",
-					strings.Join(cmd, " "),
-					step.Image,
-				)
-			}
-			if r != nil && r.Output != "" {
+			log.Infof(
+				"Finished running command '%s' on '%s' docker",
+				strings.Join(cmd, " "),
+				step.Image,
+			)
+			if r != nil && r.Output != "" && !step.settings().Quiet {
 				fmt.Printf(`OUT: %s`, r.Output)
 			}
 			if r != nil && r.Error != "" {
 				logger.ErrorOutput(`ERR: %s`, r.Error)
 			}
 		}
+		var exitErr *ExitError
+		if err != nil && step.CommandErrorMode == CommandErrorContinue && errors.As(err, &exitErr) {
+			log.Warnf("Command '%s' of '%s' task failed with exit code %d, running the remaining commands", strings.Join(cmd, " "), step.Task, exitErr.Code)
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return failed
+}
+
+// displayPullProgress reads the stream of the progress of an image pull to the end, writing the status of every
+// layer to the writer of `pullProgressWriter`.
+func displayPullProgress(stream io.Reader, settings Settings) error {
+	out := pullProgressWriter(settings)
+	termFd, isTerm := term.GetFdInfo(out)
+	return jsonmessage.DisplayJSONMessagesStream(stream, out, termFd, isTerm, nil)
+}
+
+// pullProgressWriter returns where the progress of pulling images is written: to the error output with
+// `--verbose-docker`, so that a slow pull can be told apart from a stuck one without mixing it with the output of
+// the commands, to the output in verbose mode, and nowhere otherwise.
+func pullProgressWriter(settings Settings) io.Writer {
+	switch {
+	case settings.VerboseDocker:
+		return os.Stderr
+	case settings.Verbose:
+		return os.Stdout
+	}
+	return ioutil.Discard
+}
+
+// hostConfig returns the host configuration of the container of the step, the directory of the given path being
+// mounted on it besides the mounts of the step
+func (step Step) hostConfig(path string) *container.HostConfig {
+	return &container.HostConfig{
+		Mounts: append(step.ExtMounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: path,
+			Target: hostMountTarget,
+		}),
+		AutoRemove:  !step.KeepContainer,
+		NetworkMode: container.NetworkMode(step.Network),
+		ExtraHosts:  step.ExtraHosts,
+		DNS:         step.DNS,
+		DNSSearch:   step.DNSSearch,
+		GroupAdd:    step.GroupAdd,
+		Privileged:  step.Privileged,
+		Init:        step.initProcess(),
+		Resources: container.Resources{
+			Memory:         step.Memory,
+			NanoCPUs:       int64(step.CPUs * 1e9),
+			DeviceRequests: step.deviceRequests(),
+			Ulimits:        step.Ulimits,
+		},
+		ReadonlyRootfs: step.ReadOnly,
+		Sysctls:        step.Sysctls,
+	}
+}
+
+// initProcess returns whether the container runs the init process of Docker, nil for the default of the daemon
+func (step Step) initProcess() *bool {
+	if !step.Init {
+		return nil
+	}
+	init := true
+	return &init
+}
+
+// networkingConfig returns the networking configuration attaching the container to the network of the step,
+// after checking that the network exists.
+func (step Step) networkingConfig(ctx context.Context, cli *client.Client) (*network.NetworkingConfig, error) {
+	if step.Network == "" {
+		return nil, nil
+	}
+	if _, err := cli.NetworkInspect(ctx, step.Network, types.NetworkInspectOptions{}); err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, fmt.Errorf("docker: network '%s' does not exist, it can be created with `docker network create %s`", step.Network, step.Network)
+		}
+		return nil, err
+	}
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{step.Network: {}},
+	}, nil
+}
+
+// containerEntrypoint returns the entrypoint of the container. If the step overrides the entrypoint of the image,
+// it is cleared for the container to be kept running, and the entrypoint of the step is run with every command.
+func (step Step) containerEntrypoint() strslice.StrSlice {
+	if step.Entrypoint == nil {
+		return nil
+	}
+	return strslice.StrSlice{""}
+}
+
+// containerDir returns the directory of the container for the given directory of a step, relative directories
+// being relative to the mounted working directory of the host.
+func containerDir(dir string) string {
+	if dir == "" {
+		return hostMountTarget
+	}
+	if dir[0] == '/' {
+		return dir
+	}
+	return filepath.Join(hostMountTarget, dir)
 }
 
-func runCmd(ctx context.Context, cli *client.Client, containerID string, command []string) (*Result, error) {
+// runCmd runs the command on the container, on the given directory or on the working directory of the container
+// if it is empty.
+func (step Step) runCmd(ctx context.Context, cli *client.Client, containerID string, command []string, dir string) (*Result, error) {
 	if len(command) == 0 {
 		return nil, fmt.Errorf(`config: Command cannot be empty`)
 	}
+	if step.Interactive {
+		return nil, step.runInteractiveCmd(ctx, cli, containerID, command, dir)
+	}
 
-	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
-		Cmd:          command,
-		AttachStdout: true,
-		AttachStderr: true,
-	})
+	execConfig := step.execConfig(command, dir)
+	execConfig.AttachStdin = step.Stdin != ""
+	exec, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer resp.Close()
+	if step.Stdin != "" {
+		go func() {
+			// The input is closed once written, so that the command reading it to the end can go on
+			if _, err := io.WriteString(resp.Conn, step.Stdin); err != nil {
+				log.Debugf("docker: failed to write stdin of '%s' task: %s", step.Task, err.Error())
+			}
+			if err := resp.CloseWrite(); err != nil {
+				log.Debugf("docker: failed to close stdin of '%s' task: %s", step.Task, err.Error())
+			}
+		}()
+	}
 
-	result := ExtractResult(resp.Reader, command)
+	result, err := step.copyOutput(resp.Reader)
+	if err != nil {
+		return nil, err
+	}
 
 	info, err := cli.ContainerExecInspect(ctx, exec.ID)
 	if err != nil {
-		log.Fatal(err)
+		return result, err
 	}
 	if info.ExitCode != 0 {
-		return result, fmt.Errorf("docker: command execution failed with exit code %d", info.ExitCode)
+		return result, &ExitError{Code: info.ExitCode}
 	}
 
 	return result, nil
@@ -265,28 +640,109 @@ func runCmd(ctx context.Context, cli *client.Client, containerID string, command
 
 // ExtractResult can parse output and/or error corresponding to the command passed as an argument,
 // from an io.Reader and convert to an object of strings.
-func ExtractResult(reader io.Reader, command []string) *Result {
+func ExtractResult(reader io.Reader, command []string) (*Result, error) {
 	if viper.GetBool("Async") {
 		var out, errOut bytes.Buffer
 		if _, err := stdcopy.StdCopy(&out, &errOut, reader); err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		var result = Result{
 			Output: out.String(),
 			Error:  errOut.String(),
 		}
-		return &result
+		return &result, nil
 	}
 
 	if _, err := stdcopy.StdCopy(os.Stdout, logger.NewErrWriter(), reader); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return nil
+	return nil, nil
+}
+
+func (step Step) stderr() io.Writer {
+	if step.Stderr == nil {
+		return logger.NewErrWriter()
+	}
+	return step.Stderr
+}
+
+// copyOutput copies the output and error of a command from the multiplexed reader to the writers of the step,
+// to the terminal with the output prefix of the step if any, or into the returned result in asynchronous mode.
+// In quiet mode, only the error output is printed to the terminal.
+// Both are also written to the Tee writer of the step if it is set, and the secrets of the step are redacted
+// from all of them. The output is written as it is to the Capture buffer of the step, if it is set.
+func (step Step) copyOutput(reader io.Reader) (*Result, error) {
+	var result *Result
+	var stdout, stderr io.Writer
+	var out, errOut bytes.Buffer
+	var bufferedWriters []bufferedWriter
+	switch {
+	case step.Stdout != nil:
+		stdout, stderr = step.Stdout, step.stderr()
+	case step.settings().Async:
+		result = &Result{}
+		stdout, stderr = &out, &errOut
+	case step.settings().Quiet:
+		stdout, stderr = ioutil.Discard, logger.NewErrWriter()
+		if step.OutputPrefix != "" {
+			bufferedWriters = []bufferedWriter{logger.NewPrefixWriter(stderr, step.OutputPrefix)}
+			stderr = bufferedWriters[0]
+		}
+	case step.OutputPrefix != "":
+		bufferedWriters = []bufferedWriter{
+			logger.NewPrefixWriter(os.Stdout, step.OutputPrefix),
+			logger.NewPrefixWriter(logger.NewErrWriter(), step.OutputPrefix),
+		}
+		stdout, stderr = bufferedWriters[0], bufferedWriters[1]
+	default:
+		stdout, stderr = os.Stdout, logger.NewErrWriter()
+	}
+	if step.Tee != nil {
+		stdout = io.MultiWriter(stdout, step.Tee)
+		if step.TeeStderr {
+			stderr = io.MultiWriter(stderr, step.Tee)
+		}
+	}
+	if len(step.Secrets) > 0 {
+		// Redacting writers come first, so that what they hold back is flushed to the writers above
+		redactWriters := []bufferedWriter{
+			logger.NewRedactWriter(stdout, step.Secrets),
+			logger.NewRedactWriter(stderr, step.Secrets),
+		}
+		stdout, stderr = redactWriters[0], redactWriters[1]
+		bufferedWriters = append(redactWriters, bufferedWriters...)
+	}
+	if step.Capture != nil {
+		stdout = io.MultiWriter(stdout, step.Capture)
+	}
+
+	_, err := stdcopy.StdCopy(stdout, stderr, reader)
+	for _, w := range bufferedWriters {
+		if flushErr := w.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result != nil {
+		result.Output, result.Error = out.String(), errOut.String()
+	}
+	return result, nil
+}
+
+// bufferedWriter is an io.Writer holding back part of the output until it is flushed
+type bufferedWriter interface {
+	io.Writer
+	Flush() error
 }
 
 // CheckImageExist checks for the image whether it is present on the host machine or not.
 func CheckImageExist(ctx context.Context, cli *client.Client, image string, notag bool) (bool, error) {
 	log.Debugf("docker: checking existence of the image '%s'", image)
+	if _, digest := SplitDigest(image); digest != "" {
+		return checkImageDigest(ctx, cli, image)
+	}
 	var splitImage = strings.Split(image, ":")
 	if len(splitImage) <= 2 {
 		hostImages, err := cli.ImageList(ctx, types.ImageListOptions{})
@@ -297,12 +753,12 @@ func CheckImageExist(ctx context.Context, cli *client.Client, image string, nota
 			for _, rt := range imageSummary.RepoTags {
 				if len(splitImage) < 2 && notag {
 					if strings.Split(rt, ":")[0] == image {
-						log.Infof("Image '%s' exists with the host", image)
+						log.Debugf("Image '%s' exists with the host", image)
 						return true, nil
 					}
 				}
 				if rt == image {
-					log.Infof("Image '%s' exists with the host", image)
+					log.Debugf("Image '%s' exists with the host", image)
 					return true, nil
 				}
 			}
@@ -1,12 +1,21 @@
 package docker
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"context"
 
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/leopardslab/dunner/internal/settings"
 	"github.com/spf13/viper"
 )
@@ -92,6 +101,24 @@ func TestStep_execWithErr(t *testing.T) {
 	}
 }
 
+func TestStepExecWithTimeout(t *testing.T) {
+	settings.Init()
+	step := &Step{
+		Task:    "test",
+		Name:    "node",
+		Image:   "node:10.15.0",
+		Command: []string{"sleep", "10"},
+		Timeout: time.Second,
+	}
+
+	err := step.Exec()
+
+	expectedErr := "dunner: step timed out after 1s"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %s", expectedErr, err)
+	}
+}
+
 func TestStepExecSuccess(t *testing.T) {
 	var testNodeVersion = "10.15.0"
 
@@ -102,6 +129,28 @@ func TestStepExecSuccess(t *testing.T) {
 	}
 }
 
+func TestStepExecContinuesAfterFailedCommand(t *testing.T) {
+	settings.Init()
+	var out bytes.Buffer
+	step := &Step{
+		Task:             "test",
+		Image:            "busybox:1.31",
+		Commands:         [][]string{{"sh", "-c", "exit 3"}, {"echo", "done"}},
+		CommandErrorMode: CommandErrorContinue,
+		Stdout:           &out,
+	}
+
+	err := step.Exec()
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("expected error of the failed command, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "done") {
+		t.Errorf("expected the command after the failed one to run, got output: %q", out.String())
+	}
+}
+
 func ExampleStep_execDryRun() {
 	dryRun := viper.GetBool("Dry-run")
 	viper.Set("Dry-run", true)
@@ -157,3 +206,195 @@ func checkImage(img string, notag bool) (bool, error) {
 	cli.NegotiateAPIVersion(ctx)
 	return CheckImageExist(ctx, cli, img, notag)
 }
+
+func TestContainerEntrypoint(t *testing.T) {
+	if entrypoint := (Step{}).containerEntrypoint(); entrypoint != nil {
+		t.Errorf("expected entrypoint of the image to be kept, got: %#v", entrypoint)
+	}
+	if entrypoint := (Step{Entrypoint: []string{"sh", "-c"}}).containerEntrypoint(); len(entrypoint) != 1 || entrypoint[0] != "" {
+		t.Errorf("expected entrypoint of the container to be cleared, got: %#v", entrypoint)
+	}
+}
+
+func TestHostConfigWithSysctls(t *testing.T) {
+	sysctls := map[string]string{"net.core.somaxconn": "1024", "kernel.shmmax": "68719476736"}
+
+	hostConfig := (Step{Sysctls: sysctls, ReadOnly: true}).hostConfig("/src")
+
+	if !reflect.DeepEqual(hostConfig.Sysctls, sysctls) {
+		t.Errorf("expected sysctls of the container: %v, got: %v", sysctls, hostConfig.Sysctls)
+	}
+	if !hostConfig.ReadonlyRootfs || len(hostConfig.Mounts) != 1 || hostConfig.Mounts[0].Source != "/src" {
+		t.Errorf("expected read-only container with the directory mounted, got: %+v", hostConfig)
+	}
+	if hostConfig := (Step{}).hostConfig("/src"); hostConfig.Sysctls != nil {
+		t.Errorf("expected no sysctls of the container, got: %v", hostConfig.Sysctls)
+	}
+}
+
+func TestHostConfigWithDNS(t *testing.T) {
+	step := Step{DNS: []string{"10.0.0.2", "10.0.0.3"}, DNSSearch: []string{"corp.internal"}}
+
+	hostConfig := step.hostConfig("/src")
+
+	if !reflect.DeepEqual(hostConfig.DNS, step.DNS) || !reflect.DeepEqual(hostConfig.DNSSearch, step.DNSSearch) {
+		t.Errorf("expected DNS servers: %v and search domains: %v of the container, got: %v and %v", step.DNS, step.DNSSearch, hostConfig.DNS, hostConfig.DNSSearch)
+	}
+	if hostConfig := (Step{}).hostConfig("/src"); hostConfig.DNS != nil || hostConfig.DNSSearch != nil {
+		t.Errorf("expected DNS of the daemon, got: %v and %v", hostConfig.DNS, hostConfig.DNSSearch)
+	}
+}
+
+func TestStepExecWithMissingNetwork(t *testing.T) {
+	var testNetwork = "dunner_not_existing_network"
+	step := &Step{
+		Task:    "test",
+		Name:    "busybox",
+		Image:   "busybox",
+		Command: []string{"ls"},
+		Network: testNetwork,
+	}
+
+	err := step.Exec()
+
+	expected := fmt.Sprintf("docker: network '%s' does not exist, it can be created with `docker network create %s`", testNetwork, testNetwork)
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func multiplexedOutput(stdout, stderr string) *bytes.Buffer {
+	var stream bytes.Buffer
+	stdcopy.NewStdWriter(&stream, stdcopy.Stdout).Write([]byte(stdout))
+	stdcopy.NewStdWriter(&stream, stdcopy.Stderr).Write([]byte(stderr))
+	return &stream
+}
+
+func TestCopyOutputWritesToTee(t *testing.T) {
+	var stdout, stderr, tee bytes.Buffer
+	step := Step{Stdout: &stdout, Stderr: &stderr, Tee: &tee}
+
+	if _, err := step.copyOutput(multiplexedOutput("out\n", "err\n")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("expected output to be streamed, got: %q and %q", stdout.String(), stderr.String())
+	}
+	if tee.String() != "out\n" {
+		t.Errorf("expected only output to be written to tee, got: %q", tee.String())
+	}
+}
+
+func TestCopyOutputWritesErrorsToTee(t *testing.T) {
+	var stdout, stderr, tee bytes.Buffer
+	step := Step{Stdout: &stdout, Stderr: &stderr, Tee: &tee, TeeStderr: true}
+
+	if _, err := step.copyOutput(multiplexedOutput("out\n", "err\n")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if tee.String() != "out\nerr\n" {
+		t.Errorf("expected output and errors to be written to tee, got: %q", tee.String())
+	}
+}
+
+func TestCopyOutputRedactsSecrets(t *testing.T) {
+	var stdout, stderr, tee bytes.Buffer
+	step := Step{Stdout: &stdout, Stderr: &stderr, Tee: &tee, TeeStderr: true, Secrets: []string{"s3cr3t"}}
+
+	if _, err := step.copyOutput(multiplexedOutput("token: s3cr3t\n", "bad token s3cr3t")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if stdout.String() != "token: ****\n" || stderr.String() != "bad token ****" {
+		t.Errorf("expected secret to be redacted from output, got: %q and %q", stdout.String(), stderr.String())
+	}
+	if tee.String() != "token: ****\nbad token ****" {
+		t.Errorf("expected secret to be redacted from tee, got: %q", tee.String())
+	}
+}
+
+func TestContainerDir(t *testing.T) {
+	for dir, expected := range map[string]string{"": "/dunner", "web": "/dunner/web", "/src": "/src"} {
+		if got := containerDir(dir); got != expected {
+			t.Errorf("expected directory of '%s' to be %s, got: %s", dir, expected, got)
+		}
+	}
+}
+
+func TestQualifyImage(t *testing.T) {
+	registry := "myregistry.internal/"
+	for image, expected := range map[string]string{
+		"busybox":                       "myregistry.internal/library/busybox",
+		"busybox:1.31":                  "myregistry.internal/library/busybox:1.31",
+		"user/repo":                     "myregistry.internal/user/repo",
+		"quay.io/user/repo":             "quay.io/user/repo",
+		"localhost/repo":                "localhost/repo",
+		"localhost:5000/repo:latest":    "localhost:5000/repo:latest",
+		"docker.io/library/busybox:1.3": "docker.io/library/busybox:1.3",
+	} {
+		if got := QualifyImage(image, registry); got != expected {
+			t.Errorf("expected image '%s' to be qualified as %s, got: %s", image, expected, got)
+		}
+	}
+	if got := QualifyImage("busybox", ""); got != "busybox" {
+		t.Errorf("expected image to be unchanged without a registry, got: %s", got)
+	}
+}
+
+func TestCopyOutputInQuietMode(t *testing.T) {
+	defer viper.Set("Quiet", false)
+	viper.Set("Quiet", true)
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	var tee bytes.Buffer
+	step := Step{Tee: &tee}
+
+	_, err = step.copyOutput(multiplexedOutput("out\n", ""))
+	w.Close()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	printed, _ := ioutil.ReadAll(r)
+	if len(printed) != 0 {
+		t.Errorf("expected no output to be printed, got: %q", printed)
+	}
+	if tee.String() != "out\n" {
+		t.Errorf("expected output to be still written to tee, got: %q", tee.String())
+	}
+}
+
+func TestPullProgressWriter(t *testing.T) {
+	for _, test := range []struct {
+		settings Settings
+		expected io.Writer
+	}{
+		{Settings{}, ioutil.Discard},
+		{Settings{Verbose: true}, os.Stdout},
+		{Settings{VerboseDocker: true}, os.Stderr},
+		{Settings{Verbose: true, VerboseDocker: true}, os.Stderr},
+	} {
+		if out := pullProgressWriter(test.settings); out != test.expected {
+			t.Errorf("expected progress of pulls to be written to %v with %+v, got: %v", test.expected, test.settings, out)
+		}
+	}
+}
+
+func TestStepExecWithInvalidDockerHost(t *testing.T) {
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", "not-a-host")
+	step := Step{Image: "busybox", Command: []string{"ls"}, Settings: &Settings{}}
+
+	err := step.Exec()
+
+	if err == nil || !strings.HasPrefix(err.Error(), "docker: failed to connect to the Docker daemon: ") {
+		t.Errorf("expected error connecting to the Docker daemon, got: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// execInContainer runs the command(s) of the step in the running container of the given name or ID with
+// `docker exec`, instead of creating a container of the image of the step. The fields of the step configuring the
+// container it would run on, like its image and mounts, are ignored with a warning.
+func (step Step) execInContainer(ctx context.Context, cli *client.Client, name string) error {
+	info, err := cli.ContainerInspect(ctx, name)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return fmt.Errorf("docker: container '%s' to run the commands of '%s' task in does not exist", name, step.Task)
+		}
+		return err
+	}
+	if info.State == nil || !info.State.Running {
+		return fmt.Errorf("docker: container '%s' to run the commands of '%s' task in is not running", name, step.Task)
+	}
+	if ignored := step.ignoredFields(); len(ignored) > 0 {
+		log.Warnf("Ignoring %s of '%s' task, as its commands run in the existing container '%s'", strings.Join(ignored, ", "), step.Task, name)
+	}
+
+	step.existingContainer, step.Image = true, name
+	commands := step.Commands
+	if len(commands) == 0 {
+		commands = append(commands, step.Command)
+	}
+	return step.runCommands(ctx, cli, info.ID, commands)
+}
+
+// ignoredFields returns the fields of the step that configure the container created for it, which have no effect
+// on an existing container
+func (step Step) ignoredFields() []string {
+	var ignored []string
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"image", step.Image != "" && step.Build == ""},
+		{"build", step.Build != ""},
+		{"platform", step.Platform != ""},
+		{"mounts", len(step.ExtMounts) > 0 || len(step.Volumes) > 0},
+		{"labels", step.hasUserLabels()},
+		{"network", step.Network != ""},
+		{"extraHosts", len(step.ExtraHosts) > 0},
+		{"dns", len(step.DNS) > 0},
+		{"dnsSearch", len(step.DNSSearch) > 0},
+		{"privileged", step.Privileged},
+		{"readOnlyRootfs", step.ReadOnly},
+		{"init", step.Init},
+		{"memory", step.Memory > 0},
+		{"cpus", step.CPUs > 0},
+		{"sysctls", len(step.Sysctls) > 0},
+		{"gpus", step.GPUs != nil},
+		{"timeout", step.Timeout > 0},
+		{"stopSignal", step.StopSignal != ""},
+		{"stopTimeout", step.StopTimeout > 0},
+		{"commitAs", step.CommitAs != ""},
+	} {
+		if field.set {
+			ignored = append(ignored, field.name)
+		}
+	}
+	return ignored
+}
+
+// execConfig returns the configuration of `docker exec` running the command on the container of the step. The
+// environment variables, user and absolute directory of the step are given to the command when it runs in an
+// existing container, as the container was not created with them.
+func (step Step) execConfig(command []string, dir string) types.ExecConfig {
+	config := types.ExecConfig{
+		Cmd:          command,
+		WorkingDir:   dir,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	if step.existingContainer {
+		config.Env, config.User = step.Env, step.User
+		if dir == "" && path.IsAbs(step.WorkDir) {
+			config.WorkingDir = step.WorkDir
+		}
+	}
+	return config
+}
+
+// hasUserLabels returns true if the step has labels other than the built-in ones, which dunner sets on every step
+func (step Step) hasUserLabels() bool {
+	for key := range step.Labels {
+		if !step.IsBuiltinLabel(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestIgnoredFields(t *testing.T) {
+	step := Step{
+		Image:     "busybox",
+		ExtMounts: []mount.Mount{{Type: mount.TypeBind, Source: "/tmp", Target: "/tmp"}},
+		Timeout:   time.Minute,
+		Env:       []string{"FOO=bar"},
+	}
+
+	expected := []string{"image", "mounts", "timeout"}
+	if ignored := step.ignoredFields(); !reflect.DeepEqual(expected, ignored) {
+		t.Errorf("expected ignored fields: %v, got: %v", expected, ignored)
+	}
+	if ignored := (Step{Build: "."}).ignoredFields(); !reflect.DeepEqual([]string{"build"}, ignored) {
+		t.Errorf("expected only build to be ignored, got: %v", ignored)
+	}
+}
+
+func TestIgnoredFieldsWithBuiltinLabels(t *testing.T) {
+	step := Step{Task: "build", Name: "compile", Labels: map[string]string{TaskLabel: "build", StepLabel: "compile"}}
+
+	if ignored := step.ignoredFields(); len(ignored) != 0 {
+		t.Errorf("expected the built-in labels not to be ignored, got: %v", ignored)
+	}
+	step.Labels["team"] = "infra"
+	if ignored := step.ignoredFields(); !reflect.DeepEqual([]string{"labels"}, ignored) {
+		t.Errorf("expected the labels of the user to be ignored, got: %v", ignored)
+	}
+}
+
+func TestExecConfigInExistingContainer(t *testing.T) {
+	step := Step{Env: []string{"FOO=bar"}, User: "1000", WorkDir: "/app"}
+
+	if config := step.execConfig([]string{"ls"}, ""); config.Env != nil || config.User != "" || config.WorkingDir != "" {
+		t.Errorf("expected the container of the step to have the environment, user and directory, got: %+v", config)
+	}
+
+	step.existingContainer = true
+	config := step.execConfig([]string{"ls"}, "")
+	if !reflect.DeepEqual(step.Env, config.Env) || config.User != "1000" || config.WorkingDir != "/app" {
+		t.Errorf("expected environment, user and directory of the step, got: %+v", config)
+	}
+	if config := step.execConfig([]string{"ls"}, "/src"); config.WorkingDir != "/src" {
+		t.Errorf("expected directory of the command, got: %s", config.WorkingDir)
+	}
+	step.WorkDir = "src"
+	if config := step.execConfig([]string{"ls"}, ""); config.WorkingDir != "" {
+		t.Errorf("expected relative directory of the mounted host directory to be ignored, got: %s", config.WorkingDir)
+	}
+}
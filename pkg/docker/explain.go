@@ -0,0 +1,210 @@
+package docker
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// builtImageVariable is the shell variable of the image built from the build context of a step, in the command
+// lines of the step
+const builtImageVariable = "image"
+
+// CommandLines returns the command lines of the Docker CLI equivalent to running the step, to be run by a POSIX
+// shell. Every command of the step is run by its own `docker run`, the image being built first if the step has a
+// build context. As the commands run in the container by `docker exec`, which ignores the entrypoint of the image,
+// the entrypoint of every `docker run` is the first argument of its command.
+func (step Step) CommandLines() ([]string, error) {
+	path, err := filepath.Abs(step.settings().WorkingDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	image := ShellQuote(QualifyImage(step.Image, step.Registry))
+	if step.Build != "" {
+		lines = append(lines, builtImageVariable+"=$("+ShellQuote(step.buildArgs()...)+")")
+		image = `"$` + builtImageVariable + `"`
+	}
+
+	commands, dirs := step.Commands, step.CommandDirs
+	if len(commands) == 0 {
+		commands = [][]string{step.Command}
+	} else if step.SharedShell != nil {
+		script := sharedShellScript(step.Commands, step.CommandDirs, step.CommandErrorMode)
+		commands, dirs = [][]string{append(append([]string{}, step.SharedShell...), script)}, nil
+	}
+	for i, cmd := range commands {
+		dir := step.WorkDir
+		if commandDir, ok := dirs[i]; ok && len(step.Commands) > 0 {
+			dir = commandDir
+		}
+		cmd = append(append([]string{}, step.Entrypoint...), cmd...)
+		args := append(step.runArgs(path, dir), "--entrypoint")
+		if len(cmd) == 0 {
+			args = append(args, "")
+		} else {
+			args = append(args, cmd[0])
+		}
+		line := ShellQuote(args...) + " " + image
+		if len(cmd) > 1 {
+			line += " " + ShellQuote(cmd[1:]...)
+		}
+		if step.Stdin != "" {
+			line = ShellQuote("printf", "%s", step.Stdin) + " | " + line
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// buildArgs returns the arguments of `docker build` building the image of the step, printing only its ID
+func (step Step) buildArgs() []string {
+	args := []string{"docker", "build", "-q"}
+	if step.Dockerfile != "" {
+		args = append(args, "-f", filepath.Join(step.Build, step.Dockerfile))
+	}
+	for _, name := range sortedKeys(step.BuildArgs) {
+		args = append(args, "--build-arg", name+"="+step.BuildArgs[name])
+	}
+	if step.Platform != "" {
+		args = append(args, "--platform", step.Platform)
+	}
+	return append(args, step.Build)
+}
+
+// runArgs returns the arguments of `docker run` creating the container of the step, up to its entrypoint, with
+// the directory of the given path mounted on it and the given working directory
+func (step Step) runArgs(path string, dir string) []string {
+	args := []string{"docker", "run"}
+	if !step.KeepContainer {
+		args = append(args, "--rm")
+	}
+	switch {
+	case step.Interactive:
+		args = append(args, "-it")
+	case step.Stdin != "":
+		args = append(args, "-i")
+	}
+	if step.Platform != "" && step.Build == "" {
+		args = append(args, "--platform", step.Platform)
+	}
+	args = append(args, "-v", path+":"+hostMountTarget)
+	for _, m := range step.ExtMounts {
+		args = append(args, mountArgs(m)...)
+	}
+	args = append(args, "-w", containerDir(dir))
+	if step.User != "" {
+		args = append(args, "-u", step.User)
+	}
+	for _, env := range step.Env {
+		args = append(args, "-e", env)
+	}
+	for _, key := range sortedKeys(step.Labels) {
+		args = append(args, "--label", key+"="+step.Labels[key])
+	}
+	if step.Network != "" {
+		args = append(args, "--network", step.Network)
+	}
+	for _, host := range step.ExtraHosts {
+		args = append(args, "--add-host", host)
+	}
+	for _, server := range step.DNS {
+		args = append(args, "--dns", server)
+	}
+	for _, domain := range step.DNSSearch {
+		args = append(args, "--dns-search", domain)
+	}
+	for _, group := range step.GroupAdd {
+		args = append(args, "--group-add", group)
+	}
+	if step.Privileged {
+		args = append(args, "--privileged")
+	}
+	if step.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	if step.Init {
+		args = append(args, "--init")
+	}
+	if step.Memory != 0 {
+		args = append(args, "--memory", strconv.FormatInt(step.Memory, 10))
+	}
+	if step.CPUs != 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(step.CPUs, 'g', -1, 64))
+	}
+	for _, ulimit := range step.Ulimits {
+		args = append(args, "--ulimit", ulimit.String())
+	}
+	for _, name := range sortedKeys(step.Sysctls) {
+		args = append(args, "--sysctl", name+"="+step.Sysctls[name])
+	}
+	if step.GPUs != nil {
+		args = append(args, "--gpus", gpusArg(step.GPUs.Count, step.GPUs.DeviceIDs))
+	}
+	if step.StopSignal != "" {
+		args = append(args, "--stop-signal", step.StopSignal)
+	}
+	if step.StopTimeout > 0 {
+		args = append(args, "--stop-timeout", strconv.Itoa(int(math.Ceil(step.StopTimeout.Seconds()))))
+	}
+	return args
+}
+
+// mountArgs returns the arguments of `docker run` mounting the mount on the container
+func mountArgs(m mount.Mount) []string {
+	if m.Type == mount.TypeTmpfs {
+		var options []string
+		if m.TmpfsOptions != nil && m.TmpfsOptions.SizeBytes != 0 {
+			options = append(options, "size="+strconv.FormatInt(m.TmpfsOptions.SizeBytes, 10))
+		}
+		if m.TmpfsOptions != nil && m.TmpfsOptions.Mode != 0 {
+			options = append(options, fmt.Sprintf("mode=%o", m.TmpfsOptions.Mode))
+		}
+		if len(options) == 0 {
+			return []string{"--tmpfs", m.Target}
+		}
+		return []string{"--tmpfs", m.Target + ":" + strings.Join(options, ",")}
+	}
+	var options []string
+	if m.ReadOnly {
+		options = append(options, "ro")
+	}
+	if m.Consistency != "" {
+		options = append(options, string(m.Consistency))
+	}
+	if m.BindOptions != nil && m.BindOptions.Propagation != "" {
+		options = append(options, string(m.BindOptions.Propagation))
+	}
+	volume := m.Source + ":" + m.Target
+	if len(options) > 0 {
+		volume += ":" + strings.Join(options, ",")
+	}
+	return []string{"-v", volume}
+}
+
+// gpusArg returns the value of `--gpus` giving the container the number of GPUs, or the GPUs of the IDs
+func gpusArg(count int, ids []string) string {
+	switch {
+	case count < 0:
+		return "all"
+	case len(ids) > 0:
+		return `"device=` + strings.Join(ids, ",") + `"`
+	}
+	return strconv.Itoa(count)
+}
+
+// sortedKeys returns the keys of the map in ascending order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
+)
+
+func TestCommandLines(t *testing.T) {
+	step := Step{
+		Task:        "test",
+		Image:       "golang:1.13",
+		Command:     []string{"go", "test", "./..."},
+		Env:         []string{"GOFLAGS=-mod=vendor", "MESSAGE=hello world"},
+		Labels:      map[string]string{"team": "build", "lang": "go"},
+		WorkDir:     "src",
+		User:        "1000:1000",
+		Network:     "ci",
+		ExtraHosts:  []string{"db:10.0.0.5"},
+		DNS:         []string{"10.0.0.2"},
+		DNSSearch:   []string{"corp.internal"},
+		ReadOnly:    true,
+		Init:        true,
+		Memory:      512 * 1024 * 1024,
+		CPUs:        1.5,
+		Ulimits:     []*units.Ulimit{{Name: "nofile", Soft: 1024, Hard: 65536}},
+		Sysctls:     map[string]string{"net.core.somaxconn": "1024"},
+		GPUs:        &container.DeviceRequest{DeviceIDs: []string{"0", "1"}},
+		StopSignal:  "SIGINT",
+		StopTimeout: 1500 * time.Millisecond,
+		ExtMounts: []mount.Mount{
+			{Type: mount.TypeBind, Source: "/home/go/pkg", Target: "/go/pkg", ReadOnly: true},
+			{Type: mount.TypeVolume, Source: "gocache", Target: "/root/.cache"},
+			{Type: mount.TypeTmpfs, Target: "/tmp", TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 1024, Mode: 01777}},
+		},
+		Settings: &Settings{WorkingDirectory: "/work"},
+	}
+
+	lines, err := step.CommandLines()
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{"docker run --rm -v /work:/dunner -v /home/go/pkg:/go/pkg:ro -v gocache:/root/.cache --tmpfs /tmp:size=1024,mode=1777 " +
+		"-w /dunner/src -u 1000:1000 -e GOFLAGS=-mod=vendor -e 'MESSAGE=hello world' --label lang=go --label team=build --network ci " +
+		"--add-host db:10.0.0.5 --dns 10.0.0.2 --dns-search corp.internal --read-only --init --memory 536870912 --cpus 1.5 --ulimit nofile=1024:65536 --sysctl net.core.somaxconn=1024 " +
+		`--gpus '"device=0,1"' --stop-signal SIGINT --stop-timeout 2 --entrypoint go golang:1.13 test ./...`}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected command lines:\n%s\ngot:\n%s", expected, lines)
+	}
+}
+
+func TestCommandLinesWithCommands(t *testing.T) {
+	step := Step{
+		Image:         "busybox",
+		Registry:      "mirror.internal",
+		Commands:      [][]string{{"ls"}, {"cat", "go.mod"}},
+		CommandDirs:   map[int]string{1: "/src"},
+		Entrypoint:    []string{"sh", "-c"},
+		Stdin:         "it's input",
+		KeepContainer: true,
+		Settings:      &Settings{WorkingDirectory: "/work"},
+	}
+
+	lines, err := step.CommandLines()
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{
+		`printf %s 'it'\''s input' | docker run -i -v /work:/dunner -w /dunner --entrypoint sh mirror.internal/library/busybox -c ls`,
+		`printf %s 'it'\''s input' | docker run -i -v /work:/dunner -w /src --entrypoint sh mirror.internal/library/busybox -c cat go.mod`,
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected command lines:\n%s\ngot:\n%s", expected, lines)
+	}
+}
+
+func TestCommandLinesWithBuild(t *testing.T) {
+	step := Step{
+		Build:       "./docker",
+		Dockerfile:  "Dockerfile.ci",
+		BuildArgs:   map[string]string{"VERSION": "1.13"},
+		Commands:    [][]string{{"make"}, {"make", "test"}},
+		SharedShell: []string{"bash", "-c"},
+		Settings:    &Settings{WorkingDirectory: "/work"},
+	}
+
+	lines, err := step.CommandLines()
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{
+		`image=$(docker build -q -f docker/Dockerfile.ci --build-arg VERSION=1.13 ./docker)`,
+		`docker run --rm -v /work:/dunner -w /dunner --entrypoint bash "$image" -c 'set -e` + "\n" + `make` + "\n" + `make test'`,
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected command lines:\n%s\ngot:\n%s", expected, lines)
+	}
+}
@@ -0,0 +1,29 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+)
+
+// gpuAPIVersion is the first version of the Docker API with the device requests giving containers GPUs
+const gpuAPIVersion = "1.40"
+
+// deviceRequests returns the requests of the devices of the container, for the GPUs of the step
+func (step Step) deviceRequests() []container.DeviceRequest {
+	if step.GPUs == nil {
+		return nil
+	}
+	return []container.DeviceRequest{*step.GPUs}
+}
+
+// checkGPUSupport verifies that the Docker daemon can give GPUs to the container, if the step needs any. Older
+// daemons ignore the device requests, which would run the step without the GPUs.
+func (step Step) checkGPUSupport(cli *client.Client) error {
+	if step.GPUs == nil || !versions.LessThan(cli.ClientVersion(), gpuAPIVersion) {
+		return nil
+	}
+	return fmt.Errorf("docker: the step needs GPUs, which need version %s of the Docker API while the Docker daemon supports %s, upgrade Docker to 19.03 or later", gpuAPIVersion, cli.ClientVersion())
+}
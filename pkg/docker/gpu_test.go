@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+func TestCheckGPUSupport(t *testing.T) {
+	gpus := &container.DeviceRequest{Count: -1, Capabilities: [][]string{{"gpu"}}}
+	for version, expected := range map[string]string{
+		"1.39": "docker: the step needs GPUs, which need version 1.40 of the Docker API while the Docker daemon supports 1.39, upgrade Docker to 19.03 or later",
+		"1.40": "",
+	} {
+		cli, err := client.NewClientWithOpts(client.WithVersion(version))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Step{GPUs: gpus}.checkGPUSupport(cli)
+
+		if expected == "" && err != nil || expected != "" && (err == nil || err.Error() != expected) {
+			t.Errorf("expected error: %q for API version %s, got: %v", expected, version, err)
+		}
+		if err := (Step{}).checkGPUSupport(cli); err != nil {
+			t.Errorf("expected no error for a step without GPUs, got: %s", err)
+		}
+	}
+}
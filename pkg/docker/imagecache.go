@@ -0,0 +1,78 @@
+package docker
+
+import "sync"
+
+// ImageCache records the images that are on the host during a run, so that the steps running on an image already
+// pulled or found by a previous step of the run do not check for it or pull it again. Steps with the pull policy
+// always, or run with `--force-pull`, still pull their image every time. The images built by the steps are
+// recorded too, so that steps sharing an unchanged build context build the image only once per run.
+type ImageCache struct {
+	mu     sync.Mutex
+	images map[string]bool
+	builds map[string]*imageBuild // Images built in the run, by the key of their build inputs
+}
+
+// imageBuild is the image built from the same build inputs by the steps of a run, which build it one at a time
+type imageBuild struct {
+	mu sync.Mutex
+	id string // ID of the built image, empty until a build succeeds
+}
+
+// NewImageCache returns an empty cache of images, for one run
+func NewImageCache() *ImageCache {
+	return &ImageCache{images: make(map[string]bool), builds: make(map[string]*imageBuild)}
+}
+
+// has returns whether the image of the platform is on the host, as recorded by a previous step. A nil cache has
+// no images.
+func (c *ImageCache) has(image string, platform string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.images[imageCacheKey(image, platform)]
+}
+
+// add records that the image of the platform is on the host
+func (c *ImageCache) add(image string, platform string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.images[imageCacheKey(image, platform)] = true
+}
+
+func imageCacheKey(image string, platform string) string {
+	return image + " " + platform
+}
+
+// built returns the ID of the image built from the build inputs of the key in the run, building it with build if
+// no step did yet. Images of different keys are built concurrently, while the steps building the same image wait
+// for the first one, a failed build being tried again by the next step. A nil cache builds every time.
+func (c *ImageCache) built(key string, build func() (string, error)) (string, error) {
+	if c == nil {
+		return build()
+	}
+	c.mu.Lock()
+	b, found := c.builds[key]
+	if !found {
+		b = &imageBuild{}
+		c.builds[key] = b
+	}
+	c.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.id != "" {
+		log.Debugf("docker: reusing image '%s' built in this run", b.id)
+		return b.id, nil
+	}
+	id, err := build()
+	if err != nil {
+		return "", err
+	}
+	b.id = id
+	return id, nil
+}
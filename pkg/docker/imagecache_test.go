@@ -0,0 +1,138 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+// fakeDaemon returns a client of a fake Docker daemon with the image on its host, along with the number of API
+// calls made to it and the function stopping the daemon
+func fakeDaemon(tb testing.TB, image string) (*client.Client, *int32, func()) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/json"):
+			fmt.Fprintf(w, `[{"Id": "sha256:0123", "RepoTags": [%q]}]`, image)
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			fmt.Fprint(w, `{"status": "Downloaded newer image"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+server.Listener.Addr().String()), client.WithVersion("1.39"))
+	if err != nil {
+		server.Close()
+		tb.Fatal(err)
+	}
+	return cli, &calls, server.Close
+}
+
+// pullImageOfSteps pulls the image of every step as they would when run one after the other
+func pullImageOfSteps(tb testing.TB, cli *client.Client, steps int, step Step) {
+	for i := 0; i < steps; i++ {
+		if err := step.pullImage(context.Background(), cli); err != nil {
+			tb.Fatalf("expected no error, got: %s", err)
+		}
+	}
+}
+
+func TestPullImageWithImageCache(t *testing.T) {
+	defer func(out io.Writer) { log.Out = out }(log.Out)
+	log.Out = ioutil.Discard
+	settings := &Settings{Quiet: true}
+	for _, test := range []struct {
+		step     Step
+		expected int32
+	}{
+		{Step{Image: "busybox:latest", Settings: settings}, 10},
+		{Step{Image: "busybox:latest", Settings: settings, Images: NewImageCache()}, 1},
+		{Step{Image: "busybox:latest", Settings: settings, Images: NewImageCache(), PullPolicy: PullAlways}, 20},
+	} {
+		cli, calls, stop := fakeDaemon(t, "busybox:latest")
+
+		pullImageOfSteps(t, cli, 10, test.step)
+		stop()
+
+		if *calls != test.expected {
+			t.Errorf("expected %d calls to the Docker API with pull policy '%s', got: %d", test.expected, test.step.PullPolicy, *calls)
+		}
+	}
+}
+
+func TestImageCacheBuildsOncePerKey(t *testing.T) {
+	cache := NewImageCache()
+	var builds int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	build := func(id string) func() (string, error) {
+		return func() (string, error) {
+			atomic.AddInt32(&builds, 1)
+			if id == "a" {
+				// The build of "a" runs until the one of "b" has started, so they must run concurrently
+				close(started)
+				<-release
+			}
+			return id, nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cache.built("a", build("a"))
+	}()
+	<-started
+	if id, err := cache.built("b", build("b")); err != nil || id != "b" {
+		t.Errorf("expected image 'b' built while 'a' is building, got: %s, %v", id, err)
+	}
+	close(release)
+	wg.Wait()
+
+	if id, err := cache.built("a", build("a")); err != nil || id != "a" {
+		t.Errorf("expected image 'a' reused, got: %s, %v", id, err)
+	}
+	if builds != 2 {
+		t.Errorf("expected 2 builds, got: %d", builds)
+	}
+	if _, err := cache.built("c", func() (string, error) { return "", fmt.Errorf("failed") }); err == nil {
+		t.Error("expected error of the failed build")
+	}
+	if id, _ := cache.built("c", build("c")); id != "c" {
+		t.Errorf("expected failed build to be tried again, got: %s", id)
+	}
+	if id, _ := (*ImageCache)(nil).built("a", build("d")); id != "d" {
+		t.Errorf("expected nil cache to build every time, got: %s", id)
+	}
+}
+
+func BenchmarkPullImageOfTenSteps(b *testing.B) {
+	defer func(out io.Writer) { log.Out = out }(log.Out)
+	log.Out = ioutil.Discard
+	for name, cached := range map[string]bool{"without cache": false, "with cache": true} {
+		b.Run(name, func(b *testing.B) {
+			cli, calls, stop := fakeDaemon(b, "busybox:latest")
+			defer stop()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				step := Step{Image: "busybox:latest", Settings: &Settings{Quiet: true}}
+				if cached {
+					step.Images = NewImageCache()
+				}
+				pullImageOfSteps(b, cli, 10, step)
+			}
+			b.ReportMetric(float64(atomic.LoadInt32(calls))/float64(b.N), "calls/op")
+		})
+	}
+}
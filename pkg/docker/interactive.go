@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/term"
+)
+
+// runInteractiveCmd runs the command on the container with a pseudo-TTY, attached to the standard input and output
+// of dunner, to use the container interactively like with `docker exec -it`. The terminal is put in raw mode
+// while the command runs, so that the keys are sent to the container as they are typed.
+func (step Step) runInteractiveCmd(ctx context.Context, cli *client.Client, containerID string, command []string, dir string) error {
+	execConfig := step.execConfig(command, dir)
+	execConfig.Tty, execConfig.AttachStdin = true, true
+	exec, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	fd, isTerminal := term.GetFdInfo(os.Stdin)
+	if isTerminal {
+		state, err := term.SetRawTerminal(fd)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := term.RestoreTerminal(fd, state); err != nil {
+				log.Debugf("docker: failed to restore terminal after '%s' task: %s", step.Task, err.Error())
+			}
+		}()
+		if size, err := term.GetWinsize(fd); err == nil {
+			resizeOptions := types.ResizeOptions{Height: uint(size.Height), Width: uint(size.Width)}
+			if err := cli.ContainerExecResize(ctx, exec.ID, resizeOptions); err != nil {
+				log.Debugf("docker: failed to resize terminal of '%s' task: %s", step.Task, err.Error())
+			}
+		}
+	}
+
+	go func() {
+		if _, err := io.Copy(resp.Conn, os.Stdin); err != nil {
+			log.Debugf("docker: failed to write stdin of '%s' task: %s", step.Task, err.Error())
+		}
+	}()
+	// With a TTY, the output and the error output are not multiplexed
+	if _, err := io.Copy(os.Stdout, resp.Reader); err != nil {
+		return err
+	}
+
+	info, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return err
+	}
+	if info.ExitCode != 0 {
+		return &ExitError{Code: info.ExitCode}
+	}
+	return nil
+}
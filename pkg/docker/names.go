@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// Placeholders of the container name template, replaced by the task, the step and the run of the container
+const (
+	taskPlaceholder = "{task}"
+	stepPlaceholder = "{step}"
+	runPlaceholder  = "{run}"
+)
+
+// maxNameAttempts is the number of names tried for a container whose name is already in use, the name of the
+// template being followed by a number from 2 after the first attempt
+const maxNameAttempts = 100
+
+var placeholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+var invalidNameCharsRegex = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// ValidateContainerNameTemplate verifies that the placeholders of the container name template are known ones
+func ValidateContainerNameTemplate(template string) error {
+	for _, placeholder := range placeholderRegex.FindAllString(template, -1) {
+		switch placeholder {
+		case taskPlaceholder, stepPlaceholder, runPlaceholder:
+		default:
+			return fmt.Errorf("docker: container name template '%s' has unknown placeholder '%s', use %s, %s and %s", template, placeholder, taskPlaceholder, stepPlaceholder, runPlaceholder)
+		}
+	}
+	return nil
+}
+
+// NewRunID returns a short random ID of a run, which tells apart the containers of concurrent runs
+func NewRunID() string {
+	id := make([]byte, 3)
+	if _, err := rand.Read(id); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// containerName returns the name of the container of the step, from the container name template of its settings,
+// or an empty name for Docker to generate a random one without a template. The step is named by its number if it
+// has no name, and the characters not allowed in container names are replaced by `-`.
+func (step Step) containerName() string {
+	settings := step.settings()
+	if settings.ContainerNameTemplate == "" {
+		return ""
+	}
+	stepName := step.Name
+	if stepName == "" {
+		stepName = strconv.Itoa(step.Number)
+	}
+	runID := settings.RunID
+	if runID == "" {
+		runID = NewRunID()
+	}
+	name := strings.NewReplacer(taskPlaceholder, step.Task, stepPlaceholder, stepName, runPlaceholder, runID).Replace(settings.ContainerNameTemplate)
+	return sanitizeContainerName(name)
+}
+
+// sanitizeContainerName replaces the characters not allowed in container names by `-`, and prefixes the name
+// with `dunner-` unless it starts with a letter or a digit and has at least two characters, as Docker requires
+func sanitizeContainerName(name string) string {
+	name = invalidNameCharsRegex.ReplaceAllString(name, "-")
+	if len(name) < 2 || strings.ContainsAny(name[:1], "_.-") {
+		name = "dunner-" + strings.TrimLeft(name, "_.-")
+	}
+	return name
+}
+
+// createContainer creates the container of the step with its name, a number being added to the name while it is
+// in use by another container, like a container of the same step in another run of the task
+func (step Step) createContainer(ctx context.Context, cli *client.Client, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig) (container.ContainerCreateCreatedBody, error) {
+	name := step.containerName()
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, name)
+	for attempt := 2; name != "" && errdefs.IsConflict(err) && attempt <= maxNameAttempts; attempt++ {
+		resp, err = cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, name+"-"+strconv.Itoa(attempt))
+	}
+	return resp, err
+}
@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestContainerName(t *testing.T) {
+	settings := &Settings{ContainerNameTemplate: "dunner-{task}-{step}-{run}", RunID: "a1b2c3"}
+	for _, test := range []struct {
+		step     Step
+		expected string
+	}{
+		{Step{Task: "build", Name: "compile", Number: 2}, "dunner-build-compile-a1b2c3"},
+		{Step{Task: "build", Number: 3}, "dunner-build-3-a1b2c3"},
+		{Step{Task: "test:unit", Name: "go test ./..."}, "dunner-test-unit-go-test-.-...-a1b2c3"},
+	} {
+		test.step.Settings = settings
+		if name := test.step.containerName(); name != test.expected {
+			t.Errorf("expected container name: %s, got: %s", test.expected, name)
+		}
+	}
+
+	if name := (Step{Task: "build", Settings: &Settings{}}).containerName(); name != "" {
+		t.Errorf("expected no container name without a template, got: %s", name)
+	}
+	step := Step{Task: "build", Settings: &Settings{ContainerNameTemplate: "{task}-{run}"}}
+	if name := step.containerName(); !regexp.MustCompile(`^build-[0-9a-f]{6}$`).MatchString(name) {
+		t.Errorf("expected container name with a generated run ID, got: %s", name)
+	}
+}
+
+func TestSanitizeContainerName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"ci_build.1":  "ci_build.1",
+		"-build":      "dunner-build",
+		"my build/go": "my-build-go",
+		"x":           "dunner-x",
+		"__":          "dunner-",
+	} {
+		if actual := sanitizeContainerName(name); actual != expected {
+			t.Errorf("expected container name %q sanitized to %q, got: %q", name, expected, actual)
+		}
+	}
+}
+
+func TestValidateContainerNameTemplate(t *testing.T) {
+	if err := ValidateContainerNameTemplate("ci-{task}-{step}-{run}"); err != nil {
+		t.Errorf("expected no error, got: %s", err)
+	}
+	expected := "docker: container name template 'ci-{task}-{id}' has unknown placeholder '{id}', use {task}, {step} and {run}"
+	if err := ValidateContainerNameTemplate("ci-{task}-{id}"); err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	id, other := NewRunID(), NewRunID()
+	if len(id) != 6 || id == other {
+		t.Errorf("expected distinct run IDs of 6 characters, got: %s and %s", id, other)
+	}
+}
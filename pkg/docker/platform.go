@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// verifyPlatform checks that the image of the step is of its platform, if it has one
+func (step Step) verifyPlatform(ctx context.Context, cli *client.Client) error {
+	if step.Platform == "" {
+		return nil
+	}
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, step.Image)
+	if err != nil {
+		return fmt.Errorf(`docker: failed to verify platform of image %s: %s`, step.Image, err.Error())
+	}
+	if !matchesPlatform(step.Platform, inspect) {
+		return fmt.Errorf(`docker: image %s is not available for platform '%s', it is of platform '%s/%s'`, step.Image, step.Platform, inspect.Os, inspect.Architecture)
+	}
+	return nil
+}
+
+// hasPlatform returns whether the image of the step on the host is of its platform
+func (step Step) hasPlatform(ctx context.Context, cli *client.Client) bool {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, step.Image)
+	return err == nil && matchesPlatform(step.Platform, inspect)
+}
+
+// matchesPlatform returns whether the image is of the platform of the form os/arch, with an optional variant that
+// is not checked, as it is not part of the inspection of images
+func matchesPlatform(platform string, inspect types.ImageInspect) bool {
+	parts := strings.SplitN(platform, "/", 3)
+	return len(parts) >= 2 && parts[0] == inspect.Os && parts[1] == inspect.Architecture
+}
+
+// isPlatformError returns whether the error of a pull is of an image that has no manifest of the platform
+func isPlatformError(err error) bool {
+	return strings.Contains(err.Error(), "no matching manifest")
+}
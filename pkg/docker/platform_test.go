@@ -0,0 +1,32 @@
+package docker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestMatchesPlatform(t *testing.T) {
+	inspect := types.ImageInspect{Os: "linux", Architecture: "arm"}
+	for platform, expected := range map[string]bool{
+		"linux/arm":    true,
+		"linux/arm/v7": true,
+		"linux/arm64":  false,
+		"windows/arm":  false,
+		"linux":        false,
+	} {
+		if actual := matchesPlatform(platform, inspect); actual != expected {
+			t.Errorf("expected %s to match: %t, got: %t", platform, expected, actual)
+		}
+	}
+}
+
+func TestIsPlatformError(t *testing.T) {
+	if !isPlatformError(errors.New("no matching manifest for linux/s390x in the manifest list entries")) {
+		t.Errorf("expected error of missing manifest to be a platform error")
+	}
+	if isPlatformError(errors.New("manifest unknown")) {
+		t.Errorf("expected error of unknown manifest not to be a platform error")
+	}
+}
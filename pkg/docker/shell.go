@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"regexp"
+	"strings"
+)
+
+var unquotedArgRegex = regexp.MustCompile(`^[A-Za-z0-9_/.=:,@%+-]+$`)
+
+// ShellQuote returns the arguments joined into one command line of a POSIX shell, arguments with characters
+// special to the shell being quoted.
+func ShellQuote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if unquotedArgRegex.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// sharedShellScript returns the script running the commands one after another in one shell, every command being
+// a line of the script. A command with a directory changes to it, for the commands after it as well. In the
+// CommandErrorContinue mode, the commands after a failed one are still run, the script exiting with the exit code
+// of the last failed command.
+func sharedShellScript(commands [][]string, dirs map[int]string, errorMode string) string {
+	var lines []string
+	for i, cmd := range commands {
+		if dir, ok := dirs[i]; ok {
+			lines = append(lines, "cd "+ShellQuote(containerDir(dir)))
+		}
+		lines = append(lines, strings.Join(cmd, " "))
+	}
+	if errorMode != CommandErrorContinue {
+		return "set -e\n" + strings.Join(lines, "\n")
+	}
+	script := []string{"dunner_status=0"}
+	for _, line := range lines {
+		script = append(script, "{ "+line+"\n} || dunner_status=$?")
+	}
+	return strings.Join(append(script, "exit $dunner_status"), "\n")
+}
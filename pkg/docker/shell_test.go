@@ -0,0 +1,38 @@
+package docker
+
+import "testing"
+
+func TestShellQuote(t *testing.T) {
+	for expected, args := range map[string][]string{
+		"ls -l /tmp":             {"ls", "-l", "/tmp"},
+		"echo 'hi && ls'":        {"echo", "hi && ls"},
+		`echo 'it'\''s' '${1}'`:  {"echo", "it's", "${1}"},
+		"go test ./... -run=Foo": {"go", "test", "./...", "-run=Foo"},
+	} {
+		if got := ShellQuote(args...); got != expected {
+			t.Errorf("expected %q to be quoted as %s, got: %s", args, expected, got)
+		}
+	}
+}
+
+func TestSharedShellScript(t *testing.T) {
+	commands := [][]string{{"cd src"}, {"export GOFLAGS=-mod=vendor"}, {"go test ./..."}}
+
+	got := sharedShellScript(commands, map[int]string{2: "/app"}, "")
+
+	expected := "set -e\ncd src\nexport GOFLAGS=-mod=vendor\ncd /app\ngo test ./..."
+	if got != expected {
+		t.Errorf("expected script:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestSharedShellScriptInContinueMode(t *testing.T) {
+	commands := [][]string{{"go vet ./..."}, {"go test ./..."}}
+
+	got := sharedShellScript(commands, nil, CommandErrorContinue)
+
+	expected := "dunner_status=0\n{ go vet ./...\n} || dunner_status=$?\n{ go test ./...\n} || dunner_status=$?\nexit $dunner_status"
+	if got != expected {
+		t.Errorf("expected script:\n%s\ngot:\n%s", expected, got)
+	}
+}
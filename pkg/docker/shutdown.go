@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// Shutdown is the graceful shutdown of the steps of a run interrupted by a signal, like SIGINT on Ctrl+C. Once it
+// is started, the signal is forwarded to the containers of the running steps, which are killed if they are still
+// running after the grace period.
+type Shutdown struct {
+	GracePeriod time.Duration // How long the containers have to exit once signaled, before they are killed
+
+	mu     sync.Mutex
+	signal string
+	done   chan struct{}
+}
+
+// NewShutdown returns a shutdown giving the containers the grace period to exit
+func NewShutdown(gracePeriod time.Duration) *Shutdown {
+	return &Shutdown{GracePeriod: gracePeriod, done: make(chan struct{})}
+}
+
+// Start starts the shutdown with the signal forwarded to the containers, like `SIGINT` or `SIGTERM`, closing the
+// channel of Done. A shutdown already started keeps its signal.
+func (s *Shutdown) Start(signal string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.signal == "" {
+		s.signal = signal
+		close(s.done)
+	}
+}
+
+// Done returns the channel closed once the shutdown is started
+func (s *Shutdown) Done() <-chan struct{} {
+	return s.done
+}
+
+// Signal returns the signal forwarded to the containers, empty if the shutdown is not started
+func (s *Shutdown) Signal() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signal
+}
+
+// stopContainer stops the container of the canceled step. If the step has a stop signal, or is canceled by a
+// shutdown, the signal is sent to it, and it is killed once the commands are done or the stop timeout is over.
+// Otherwise, it is killed at once.
+func (step Step) stopContainer(ctx context.Context, cli *client.Client, containerID string, done <-chan error) error {
+	if signal := step.stopSignal(); signal != "" {
+		if err := cli.ContainerKill(ctx, containerID, signal); err != nil {
+			log.Debugf("docker: failed to send %s to container of '%s' task: %s", signal, step.Task, err.Error())
+		} else {
+			step.signalCommands(ctx, cli, containerID, signal)
+			stopTimeout := step.stopTimeout()
+			log.Infof("Sent %s to container of '%s' task, killing it in %s unless it exits", signal, step.Task, stopTimeout)
+			select {
+			case <-done:
+				// The container may still be running, if only its commands exited on the signal
+				if err := cli.ContainerKill(ctx, containerID, "SIGKILL"); err != nil {
+					log.Debugf("docker: failed to kill container of '%s' task: %s", step.Task, err.Error())
+				}
+				return nil
+			case <-time.After(stopTimeout):
+			}
+		}
+	}
+	if err := cli.ContainerKill(ctx, containerID, "SIGKILL"); err != nil {
+		return fmt.Errorf(`docker: failed to kill container of canceled step: %s`, err.Error())
+	}
+	return nil
+}
+
+// stopSignal returns the signal sent to the container of the canceled step: its stop signal if given, or else the
+// signal of the shutdown canceling it. It is empty if the container is to be killed at once.
+func (step Step) stopSignal() string {
+	if step.StopSignal != "" {
+		return step.StopSignal
+	}
+	if step.Shutdown != nil {
+		return step.Shutdown.Signal()
+	}
+	return ""
+}
+
+// stopTimeout returns how long the container of the canceled step has to exit once signaled: its stop timeout if
+// given, or else the grace period of the shutdown, defaultStopTimeout without one.
+func (step Step) stopTimeout() time.Duration {
+	if step.StopTimeout > 0 {
+		return step.StopTimeout
+	}
+	if step.Shutdown != nil {
+		return step.Shutdown.GracePeriod
+	}
+	return defaultStopTimeout
+}
+
+// defaultStopTimeout is how long the container of a canceled step with a stop signal has to exit, if neither the
+// step nor a shutdown gives a stop timeout
+const defaultStopTimeout = 10 * time.Second
+
+// signalCommands sends the signal to the running commands of the container, as the signal sent to the container
+// only reaches its own process. It is sent from within the container with `kill`, if the image has a shell.
+func (step Step) signalCommands(ctx context.Context, cli *client.Client, containerID string, signal string) {
+	command := []string{"sh", "-c", "kill -s " + strings.TrimPrefix(signal, "SIG") + " -1"}
+	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{Cmd: command, User: "0"})
+	if err == nil {
+		err = cli.ContainerExecStart(ctx, exec.ID, types.ExecStartCheck{Detach: true})
+	}
+	if err != nil {
+		log.Debugf("docker: failed to forward %s to commands of '%s' task: %s", signal, step.Task, err.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopSignal(t *testing.T) {
+	shutdown := NewShutdown(5 * time.Second)
+	for _, test := range []struct {
+		step     Step
+		expected string
+	}{
+		{Step{}, ""},
+		{Step{StopSignal: "SIGQUIT"}, "SIGQUIT"},
+		{Step{Shutdown: shutdown}, ""},
+		{Step{Shutdown: shutdown, StopSignal: "SIGQUIT"}, "SIGQUIT"},
+	} {
+		if signal := test.step.stopSignal(); signal != test.expected {
+			t.Errorf("expected stop signal of step with %q and shutdown %t: %q, got: %q", test.step.StopSignal, test.step.Shutdown != nil, test.expected, signal)
+		}
+	}
+
+	shutdown.Start("SIGINT")
+	if signal := (Step{Shutdown: shutdown}).stopSignal(); signal != "SIGINT" {
+		t.Errorf("expected stop signal of shutdown: SIGINT, got: %q", signal)
+	}
+	if signal := (Step{Shutdown: shutdown, StopSignal: "SIGQUIT"}).stopSignal(); signal != "SIGQUIT" {
+		t.Errorf("expected stop signal of step overriding shutdown: SIGQUIT, got: %q", signal)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	shutdown := NewShutdown(5 * time.Second)
+	for _, test := range []struct {
+		step     Step
+		expected time.Duration
+	}{
+		{Step{}, defaultStopTimeout},
+		{Step{StopTimeout: time.Minute}, time.Minute},
+		{Step{Shutdown: shutdown}, 5 * time.Second},
+		{Step{Shutdown: shutdown, StopTimeout: time.Minute}, time.Minute},
+	} {
+		if timeout := test.step.stopTimeout(); timeout != test.expected {
+			t.Errorf("expected stop timeout of step with %s and shutdown %t: %s, got: %s", test.step.StopTimeout, test.step.Shutdown != nil, test.expected, timeout)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package dunner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// validateArgs verifies the arguments passed to a task against the arguments it declares, if any. The error
+// returned for missing, extra or mistyped arguments has the usage of the task.
+func validateArgs(taskName string, task config.Task, args []string) error {
+	if len(task.Args) == 0 {
+		return nil
+	}
+	var err error
+	if len(args) > len(task.Args) {
+		err = fmt.Errorf("dunner: task '%s' takes at most %d arguments, got %d", taskName, len(task.Args), len(args))
+	}
+	for i, arg := range task.Args {
+		if err != nil {
+			break
+		}
+		if i >= len(args) {
+			if arg.Required {
+				err = fmt.Errorf("dunner: task '%s' needs the argument '%s'", taskName, arg.Name)
+			}
+			break
+		}
+		if !validArgValue(arg.Type, args[i]) {
+			err = fmt.Errorf("dunner: argument '%s' of task '%s' must be of type %s, got '%s'", arg.Name, taskName, arg.Type, args[i])
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s\n\n%s", err.Error(), taskUsage(taskName, task))
+	}
+	return nil
+}
+
+// declaredArgNames returns the names of the arguments declared by the task, in order
+func declaredArgNames(task config.Task) []string {
+	var names []string
+	for _, arg := range task.Args {
+		names = append(names, arg.Name)
+	}
+	return names
+}
+
+// validArgValue returns true if the value passed for an argument is of the type of the argument
+func validArgValue(argType string, value string) bool {
+	var err error
+	switch argType {
+	case config.ArgInt:
+		_, err = strconv.Atoi(value)
+	case config.ArgBool:
+		_, err = strconv.ParseBool(value)
+	}
+	return err == nil
+}
+
+// taskUsage returns the usage of a task, listing the arguments it declares. Optional arguments are shown in
+// square brackets.
+func taskUsage(taskName string, task config.Task) string {
+	var usage strings.Builder
+	usage.WriteString("Usage: dunner do " + taskName)
+	for _, arg := range task.Args {
+		if arg.Required {
+			fmt.Fprintf(&usage, " <%s>", arg.Name)
+		} else {
+			fmt.Fprintf(&usage, " [%s]", arg.Name)
+		}
+	}
+	usage.WriteString("\n\nArguments:\n")
+	w := tabwriter.NewWriter(&usage, 0, 0, 2, ' ', 0)
+	for _, arg := range task.Args {
+		argType := arg.Type
+		if argType == "" {
+			argType = config.ArgString
+		}
+		if arg.Required {
+			argType += ", required"
+		}
+		fmt.Fprintf(w, "  %s\t(%s)\t%s\n", arg.Name, argType, arg.Description)
+	}
+	w.Flush()
+	return strings.TrimRight(usage.String(), "\n")
+}
@@ -0,0 +1,80 @@
+package dunner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+var deployTask = config.Task{Args: []config.TaskArg{
+	{Name: "env", Required: true, Description: "Environment to deploy to"},
+	{Name: "replicas", Type: config.ArgInt, Description: "Number of replicas"},
+}}
+
+func TestValidateArgs(t *testing.T) {
+	for _, args := range [][]string{{"staging"}, {"staging", "3"}} {
+		if err := validateArgs("deploy", deployTask, args); err != nil {
+			t.Errorf("expected no error for %v, got: %s", args, err)
+		}
+	}
+}
+
+func TestValidateArgsWithoutSpec(t *testing.T) {
+	if err := validateArgs("test", config.Task{}, []string{"a", "b", "c"}); err != nil {
+		t.Errorf("expected no error, got: %s", err)
+	}
+}
+
+func TestValidateArgsWithInvalidArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "dunner: task 'deploy' needs the argument 'env'"},
+		{[]string{"staging", "many"}, "dunner: argument 'replicas' of task 'deploy' must be of type int, got 'many'"},
+		{[]string{"staging", "3", "extra"}, "dunner: task 'deploy' takes at most 2 arguments, got 3"},
+	}
+	usage := `Usage: dunner do deploy <env> [replicas]
+
+Arguments:
+  env       (string, required)  Environment to deploy to
+  replicas  (int)               Number of replicas`
+
+	for _, test := range tests {
+		err := validateArgs("deploy", deployTask, test.args)
+		if err == nil {
+			t.Errorf("expected error for %v, got none", test.args)
+			continue
+		}
+		lines := strings.SplitN(err.Error(), "\n\n", 2)
+		if lines[0] != test.expected {
+			t.Errorf("expected error: %s, got: %s", test.expected, lines[0])
+		}
+		if len(lines) != 2 || lines[1] != usage {
+			t.Errorf("expected usage:\n%s\ngot:\n%s", usage, err)
+		}
+	}
+}
+
+func TestDoTasksValidatesArgsBeforeRunning(t *testing.T) {
+	var ran bool
+	defer stubExecStep(func(docker.Step) error {
+		ran = true
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	task := deployTask
+	task.Steps = []config.Step{step}
+	configs := config.Configs{Tasks: map[string]config.Task{"deploy": task}}
+
+	err := new(Runner).doTasks(&configs, "deploy", []string{})
+
+	if err == nil || !strings.HasPrefix(err.Error(), "dunner: task 'deploy' needs the argument 'env'") {
+		t.Errorf("expected missing argument error, got: %v", err)
+	}
+	if ran {
+		t.Error("expected no step to run")
+	}
+}
@@ -0,0 +1,60 @@
+package dunner
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// backoff gives the successive delays between attempts of something, like the retries of a step or the polls of
+// its `waitFor`, growing from a base delay as per the strategy of its configuration.
+type backoff struct {
+	delay      time.Duration // Delay before the next attempt, before any jitter
+	strategy   string
+	jitter     float64
+	maxElapsed time.Duration
+	start      time.Time
+	rand       *rand.Rand
+	now        func() time.Time
+}
+
+// newBackoff returns the backoff growing from the base delay as per the configuration, which can be nil for a
+// fixed delay. The jitter is drawn from the source of random numbers.
+func newBackoff(delay time.Duration, c *config.Backoff, source rand.Source) *backoff {
+	b := &backoff{delay: delay, strategy: config.BackoffFixed, rand: rand.New(source), now: time.Now}
+	if c != nil {
+		if c.Strategy != "" {
+			b.strategy = c.Strategy
+		}
+		b.jitter, b.maxElapsed = c.Jitter, c.MaxElapsed
+	}
+	b.start = b.now()
+	return b
+}
+
+// newTimeBackoff returns the backoff of `newBackoff`, with a jitter seeded from the current time
+func newTimeBackoff(delay time.Duration, c *config.Backoff) *backoff {
+	return newBackoff(delay, c, rand.NewSource(time.Now().UnixNano()))
+}
+
+// next returns the delay before the next attempt. It returns false if the next attempt would be made after the
+// maximum elapsed duration since the backoff started, after which no more attempts are to be made.
+func (b *backoff) next() (time.Duration, bool) {
+	delay := b.delay
+	if b.jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 - b.jitter + 2*b.jitter*b.rand.Float64()))
+	}
+	if b.maxElapsed > 0 && b.now().Sub(b.start)+delay > b.maxElapsed {
+		return 0, false
+	}
+	if b.strategy == config.BackoffExponential && b.delay < maxBackoffDelay {
+		if b.delay *= 2; b.delay > maxBackoffDelay {
+			b.delay = maxBackoffDelay
+		}
+	}
+	return delay, true
+}
+
+// maxBackoffDelay is the delay after which an exponential backoff stops growing
+const maxBackoffDelay = time.Hour
@@ -0,0 +1,91 @@
+package dunner
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func backoffDelays(b *backoff, n int) []time.Duration {
+	var delays []time.Duration
+	for i := 0; i < n; i++ {
+		delay, ok := b.next()
+		if !ok {
+			break
+		}
+		delays = append(delays, delay)
+	}
+	return delays
+}
+
+func TestBackoffFixed(t *testing.T) {
+	b := newBackoff(time.Second, nil, rand.NewSource(1))
+
+	got := backoffDelays(b, 3)
+
+	if expected := []time.Duration{time.Second, time.Second, time.Second}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected delays: %v, got: %v", expected, got)
+	}
+}
+
+func TestBackoffExponential(t *testing.T) {
+	b := newBackoff(time.Second, &config.Backoff{Strategy: config.BackoffExponential}, rand.NewSource(1))
+
+	got := backoffDelays(b, 4)
+
+	if expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected delays: %v, got: %v", expected, got)
+	}
+}
+
+func TestBackoffExponentialStopsGrowing(t *testing.T) {
+	b := newBackoff(40*time.Minute, &config.Backoff{Strategy: config.BackoffExponential}, rand.NewSource(1))
+
+	got := backoffDelays(b, 3)
+
+	if expected := []time.Duration{40 * time.Minute, time.Hour, time.Hour}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected delays: %v, got: %v", expected, got)
+	}
+}
+
+func TestBackoffWithJitter(t *testing.T) {
+	c := &config.Backoff{Strategy: config.BackoffExponential, Jitter: 0.5}
+
+	got := backoffDelays(newBackoff(time.Second, c, rand.NewSource(42)), 3)
+
+	expected := []time.Duration{873028361, 1132000993, 4416375406}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected delays: %v, got: %v", expected, got)
+	}
+	if again := backoffDelays(newBackoff(time.Second, c, rand.NewSource(42)), 3); !reflect.DeepEqual(got, again) {
+		t.Errorf("expected the same delays with the same seed, got: %v and %v", got, again)
+	}
+	for i, delay := range got {
+		if base := time.Second << uint(i); delay < base/2 || delay > base*3/2 {
+			t.Errorf("expected delay %d to be within 50%% of %s, got: %s", i+1, base, delay)
+		}
+	}
+}
+
+func TestBackoffWithMaxElapsed(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBackoff(time.Second, &config.Backoff{Strategy: config.BackoffExponential, MaxElapsed: 10 * time.Second}, rand.NewSource(1))
+	b.start, b.now = now, func() time.Time { return now }
+
+	var got []time.Duration
+	for {
+		delay, ok := b.next()
+		if !ok {
+			break
+		}
+		got = append(got, delay)
+		now = now.Add(delay)
+	}
+
+	if expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected delays: %v, got: %v", expected, got)
+	}
+}
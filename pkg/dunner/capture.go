@@ -0,0 +1,47 @@
+package dunner
+
+import "github.com/leopardslab/dunner/pkg/config"
+
+// namespaceCaptured returns the values captured by a followed task named after the task, for the steps after the
+// step following it: `GIT_SHA` captured by a step of `build` task is `build.GIT_SHA`, and `version.GIT_SHA` captured
+// by a task that `build` follows in turn is `build.version.GIT_SHA`. The steps refer to them like named arguments,
+// as `${build.GIT_SHA}` in their commands, environment variables and mounts. Of the values of the same name, the
+// one captured last is kept, that of the later step of the followed task, of the later follow step or of the later
+// combination of a matrix, while a named argument of the same name passed with `--arg` overrides them. Values are
+// only captured in sequential mode, like `captureAs`.
+func namespaceCaptured(taskName string, captured []string) []string {
+	namespaced := make([]string, len(captured))
+	for i, value := range captured {
+		namespaced[i] = taskName + "." + value
+	}
+	return namespaced
+}
+
+// plannedCaptured returns the values that the followed task would capture, named after the task, for the plan of
+// the steps after the step following it. As the steps are not run, every value is the variable referring to it,
+// which is printed as it is.
+func plannedCaptured(configs *config.Configs, taskName string) []string {
+	var names []string
+	var collect func(taskName string, prefix string, visited map[string]bool)
+	collect = func(taskName string, prefix string, visited map[string]bool) {
+		if visited[taskName] {
+			return
+		}
+		visited[taskName] = true
+		defer delete(visited, taskName)
+		for _, step := range configs.Tasks[taskName].Steps {
+			if step.Follow != "" {
+				collect(step.Follow, prefix+step.Follow+".", visited)
+			} else if step.CaptureAs != "" {
+				names = append([]string{prefix + step.CaptureAs}, names...)
+			}
+		}
+	}
+	collect(taskName, taskName+".", make(map[string]bool))
+
+	captured := make([]string, len(names))
+	for i, name := range names {
+		captured[i] = name + "=${" + name + "}"
+	}
+	return captured
+}
@@ -0,0 +1,138 @@
+package dunner
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestExecTaskPassesValuesCapturedByFollowedTasks(t *testing.T) {
+	commands := map[string][]string{}
+	envs := map[string][]string{}
+	defer stubExecStep(func(s docker.Step) error {
+		commands[s.Name], envs[s.Name] = s.Command, s.Env
+		switch s.Name {
+		case "sha":
+			s.Capture.WriteString("abc123\n")
+		case "image":
+			s.Capture.WriteString("app:" + s.Command[1])
+		}
+		return nil
+	})()
+	tasks := map[string]config.Task{
+		"version": {Steps: []config.Step{
+			{Name: "sha", Image: busyBoxImage, Command: []string{"git", "rev-parse", "HEAD"}, CaptureAs: "GIT_SHA"},
+		}},
+		"build": {Steps: []config.Step{
+			{Follow: "version"},
+			{Name: "image", Image: busyBoxImage, Command: []string{"echo", "${version.GIT_SHA}"}, CaptureAs: "IMAGE"},
+		}},
+		"release": {Steps: []config.Step{
+			{Follow: "build"},
+			{Name: "push", Image: busyBoxImage, Command: []string{"push", "${build.IMAGE}", "${build.version.GIT_SHA}"}, Envs: []string{"SHA=${build.version.GIT_SHA}"}},
+		}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := new(Runner).ExecTask(&configs, "release", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := []string{"echo", "abc123"}; !reflect.DeepEqual(commands["image"], expected) {
+		t.Errorf("expected value captured by the followed task in the command: %q, got: %q", expected, commands["image"])
+	}
+	if expected := []string{"push", "app:abc123", "abc123"}; !reflect.DeepEqual(commands["push"], expected) {
+		t.Errorf("expected values captured by the followed tasks in the command: %q, got: %q", expected, commands["push"])
+	}
+	if got := envMap(envs["push"]); got["SHA"] != "abc123" {
+		t.Errorf("expected value captured by the followed tasks in the environment variables, got: %v", envs["push"])
+	}
+}
+
+func TestExecTaskPassesLatestCapturedValues(t *testing.T) {
+	var pushed []string
+	defer stubExecStep(func(s docker.Step) error {
+		switch s.Name {
+		case "tag":
+			s.Capture.WriteString(s.Command[1])
+		case "push":
+			pushed = s.Command
+		}
+		return nil
+	})()
+	tasks := map[string]config.Task{
+		"tag": {Steps: []config.Step{{Name: "tag", Image: busyBoxImage, Command: []string{"echo", "$1"}, CaptureAs: "TAG"}}},
+		"release": {Steps: []config.Step{
+			{Follow: "tag", Args: []string{"v1"}},
+			{Follow: "tag", Args: []string{"v2"}},
+			{Name: "push", Image: busyBoxImage, Command: []string{"push", "${tag.TAG}", "${tag.MISSING:-none}"}},
+		}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := new(Runner).ExecTask(&configs, "release", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"push", "v2", "none"}; !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("expected value of the last follow step: %q, got: %q", expected, pushed)
+	}
+
+	// A named argument of the same name overrides the captured value
+	if err := (&Runner{Args: []string{"tag.TAG=pinned"}}).ExecTask(&configs, "release", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"push", "pinned", "none"}; !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("expected named argument overriding the captured value: %q, got: %q", expected, pushed)
+	}
+}
+
+func TestExecTaskWithMissingCapturedValue(t *testing.T) {
+	defer stubExecStep(func(docker.Step) error { return nil })()
+	tasks := map[string]config.Task{
+		"build": {Steps: []config.Step{{Image: busyBoxImage, Command: []string{"make"}}}},
+		"release": {Steps: []config.Step{
+			{Follow: "build"},
+			{Name: "push", Image: busyBoxImage, Command: []string{"push", "${build.IMAGE}"}},
+		}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	err := new(Runner).ExecTask(&configs, "release", nil, nil)
+
+	expected := "dunner: captured value 'build.IMAGE' is not set, it is set by a step following 'build' task before"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestPrintPlanWithCapturedValues(t *testing.T) {
+	tasks := map[string]config.Task{
+		"version": {Steps: []config.Step{{Image: busyBoxImage, Command: []string{"git", "describe"}, CaptureAs: "VERSION"}}},
+		"build": {Steps: []config.Step{
+			{Follow: "version"},
+			{Image: busyBoxImage, Command: []string{"make"}, CaptureAs: "IMAGE"},
+		}},
+		"release": {Steps: []config.Step{
+			{Follow: "build"},
+			{Name: "push", Image: busyBoxImage, Command: []string{"push", "${build.IMAGE}:${build.version.VERSION}"}},
+		}},
+	}
+	configs := &config.Configs{Tasks: tasks}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "release", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := "    command:    push ${build.IMAGE}:${build.version.VERSION}\n"; !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+
+	tasks["release"].Steps[1].Command = []string{"push", "${build.TAG}"}
+	if err := PrintPlan(&out, configs, "release", nil); err == nil {
+		t.Error("expected error printing the plan of a step with a value not captured by the followed task")
+	}
+}
@@ -0,0 +1,98 @@
+package dunner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// evalCondition evaluates the `when` expression of a step against the given environment variables of the
+// form `KEY=VALUE`. The supported expressions are
+//
+//	$VAR                  true if VAR is set to a non-empty value
+//	!$VAR                 true if VAR is unset or empty
+//	$VAR == "value"       true if value of VAR equals the given value
+//	$VAR != "value"       true if value of VAR does not equal the given value
+//
+// Operands of a comparison can be variables (`$VAR` or `${VAR}`), quoted strings or bare words.
+func evalCondition(expr string, envs []string) (bool, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	env := make(map[string]string)
+	for _, e := range envs {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		} else {
+			env[kv[0]] = ""
+		}
+	}
+
+	invalidErr := fmt.Errorf("dunner: invalid condition '%s'", expr)
+	switch {
+	case len(tokens) == 1 && tokens[0].isOperand():
+		return tokens[0].value(env) != "", nil
+	case len(tokens) == 2 && tokens[0].text == "!" && tokens[1].isOperand():
+		return tokens[1].value(env) == "", nil
+	case len(tokens) == 3 && tokens[0].isOperand() && tokens[2].isOperand():
+		switch tokens[1].text {
+		case "==":
+			return tokens[0].value(env) == tokens[2].value(env), nil
+		case "!=":
+			return tokens[0].value(env) != tokens[2].value(env), nil
+		}
+	}
+	return false, invalidErr
+}
+
+type conditionToken struct {
+	text   string
+	quoted bool
+}
+
+func (t conditionToken) isOperand() bool {
+	return t.quoted || (t.text != "!" && t.text != "==" && t.text != "!=")
+}
+
+func (t conditionToken) value(env map[string]string) string {
+	if t.quoted || !strings.HasPrefix(t.text, "$") {
+		return t.text
+	}
+	name := strings.TrimPrefix(t.text, "$")
+	if strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}") {
+		name = name[1 : len(name)-1]
+	}
+	return env[name]
+}
+
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("dunner: unterminated string in condition '%s'", expr)
+			}
+			tokens = append(tokens, conditionToken{text: expr[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, conditionToken{text: expr[i : i+2]})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, conditionToken{text: "!"})
+			i++
+		default:
+			end := strings.IndexAny(expr[i:], " \t=!\"'")
+			if end < 0 {
+				end = len(expr) - i
+			}
+			tokens = append(tokens, conditionToken{text: expr[i : i+end]})
+			i += end
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,47 @@
+package dunner
+
+import (
+	"testing"
+)
+
+var conditionTests = []struct {
+	expr string
+	want bool
+	err  string
+}{
+	{`$BRANCH == "main"`, true, ""},
+	{`$BRANCH == 'dev'`, false, ""},
+	{`${BRANCH}==main`, true, ""},
+	{`$BRANCH != "main"`, false, ""},
+	{`"main" == $BRANCH`, true, ""},
+	{`$DEPLOY`, true, ""},
+	{`$EMPTY`, false, ""},
+	{`$UNSET`, false, ""},
+	{`!$UNSET`, true, ""},
+	{`! $DEPLOY`, false, ""},
+	{`$UNSET == ""`, true, ""},
+	{`$BRANCH ==`, false, "dunner: invalid condition '$BRANCH =='"},
+	{`$BRANCH main`, false, "dunner: invalid condition '$BRANCH main'"},
+	{`$BRANCH == "main`, false, `dunner: unterminated string in condition '$BRANCH == "main'`},
+}
+
+func TestEvalCondition(t *testing.T) {
+	envs := []string{"BRANCH=main", "DEPLOY=true", "EMPTY="}
+	for _, tt := range conditionTests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalCondition(tt.expr, envs)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error: %s, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,135 +4,846 @@ Package dunner consists of the main executing functions for the Dunner applicati
 package dunner
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	os_user "os/user"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/leopardslab/dunner/internal/logger"
 	"github.com/leopardslab/dunner/pkg/config"
 	"github.com/leopardslab/dunner/pkg/docker"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var log = logger.Log
 
-// Do method is invoked for command-line use
-func Do(_ *cobra.Command, args []string) {
-	logger.InitColorOutput()
+// execStep runs the given step in a docker container, it is a variable so that it can be stubbed in tests
+var execStep = docker.Step.Exec
 
-	var async = viper.GetBool("Async")
+// Do method is invoked for command-line use
+func Do(cmd *cobra.Command, args []string) {
+	NewRunner().Do(cmd, args)
+}
 
-	if verbose := viper.GetBool("Verbose"); async && verbose {
+// Do runs the task given in the command line with the settings of the runner
+func (r *Runner) Do(_ *cobra.Command, args []string) {
+	logger.InitColorOutput()
+	if r.Async && r.Verbose {
 		log.Warn("Silencing verbose in asynchronous mode")
-		viper.Set("Verbose", false)
+		r.Verbose = false
+	}
+	if r.Quiet {
+		r.Verbose = false
+	}
+	if err := logger.InitLogLevel(r.LogLevel, r.Verbose, r.Quiet); err != nil {
+		log.Fatal(err)
 	}
 
-	var dunnerFile = viper.GetString("DunnerTaskFile")
+	// Logs are written to stderr, so that with json the standard output is only the stream of step results
+	switch output := r.Output; output {
+	case textOutput, jsonOutput:
+	default:
+		log.Fatalf("dunner: invalid output format '%s', must be one of: %s, %s", output, textOutput, jsonOutput)
+	}
 
-	configs, err := config.GetConfigs(dunnerFile)
+	configs, err := config.GetConfigs(r.TaskFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 	errs := configs.Validate()
 	if len(errs) != 0 {
-		fmt.Println("Validation failed with following errors:")
+		log.Error("Validation failed with following errors:")
 		for _, err := range errs {
-			logger.ErrorOutput(err.Error())
+			log.Error(err)
 		}
 		os.Exit(1)
 	}
 
-	if err = ExecTask(configs, args[0], args[1:], nil); err != nil {
-		log.Fatal(err)
+	tasks := []taskArgs{{name: args[0], args: args[1:]}}
+	if r.Tasks {
+		if tasks, err = splitTasks(args); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(r.Watch) > 0 {
+		if err = r.watchTasks(configs, tasks, r.Watch); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	stopHandlingSignals := r.handleSignals()
+	err = r.withTimeout(func() error { return r.runTasks(configs, tasks) })
+	stopHandlingSignals()
+	if err != nil {
+		log.Error(err)
+		os.Exit(ExitCode(err))
+	}
+}
+
+// doTasks runs all the tasks matching the given task name with the arguments, see `runTasks`
+func (r *Runner) doTasks(configs *config.Configs, taskName string, args []string) error {
+	return r.runTasks(configs, []taskArgs{{name: taskName, args: args}})
+}
+
+// runTasks runs all the tasks matching the given task names, each with its arguments, or prints their plan on
+// dry-run, or their docker run command lines with explain. The tasks are run one after the other, or all at once
+// in asynchronous mode if they are given with --tasks.
+func (r *Runner) runTasks(configs *config.Configs, tasks []taskArgs) error {
+	if r.MaxParallel < 0 {
+		return fmt.Errorf("dunner: max-parallel cannot be negative")
+	}
+	if _, err := r.getCLIEnvs(); err != nil {
+		return err
+	}
+	var runs []taskArgs
+	for _, task := range tasks {
+		taskNames, err := matchTasks(configs, task.name)
+		if err != nil {
+			return err
+		}
+		for _, taskName := range taskNames {
+			runs = append(runs, taskArgs{name: taskName, args: task.args})
+		}
+	}
+	if err := docker.ValidateContainerNameTemplate(r.NameTemplate); err != nil {
+		return err
+	}
+	r.images, r.runID = docker.NewImageCache(), docker.NewRunID()
+	defer func() { r.images, r.runID = nil, "" }()
+	if !r.NoSummary && !r.DryRun && !r.Explain && !r.Quiet {
+		r.summary = newRunSummary()
+		defer func() {
+			if len(r.summary.steps) > 0 {
+				if err := r.summary.write(resultWriter, r.Output, r.Async); err != nil {
+					log.Error(err)
+				}
+			}
+			r.summary = nil
+		}()
+	}
+	for _, run := range runs {
+		if err := validateArgs(run.name, configs.Tasks[run.name], run.args); err != nil {
+			return err
+		}
+	}
+	// Tasks run all at once are all done before their errors are reported
+	var errs []error
+	if r.Tasks && r.Async && !r.DryRun && !r.Explain {
+		errs = r.execTasksAtOnce(configs, runs)
+	}
+	// Without fail-fast, every task is run and the failed ones are reported once all are done
+	failFast := r.FailFast || len(runs) == 1
+	failed := taskErrors{total: len(runs)}
+	var passed []string
+	for i, run := range runs {
+		var err error
+		switch {
+		case errs != nil:
+			err = errs[i]
+		case r.DryRun:
+			err = r.PrintPlan(os.Stdout, configs, run.name, run.args)
+		case r.Explain:
+			err = r.PrintCommandLines(os.Stdout, configs, run.name, run.args)
+		default:
+			err = r.ExecTask(configs, run.name, run.args, nil)
+		}
+		switch {
+		case err != nil && failFast:
+			return err
+		case err != nil:
+			log.Error(err)
+			failed.tasks = append(failed.tasks, run.name)
+			failed.errs = append(failed.errs, err)
+		default:
+			passed = append(passed, run.name)
+		}
+	}
+	if failFast {
+		return nil
 	}
+	if len(passed) > 0 {
+		log.Infof("Passed tasks: %s", strings.Join(passed, ", "))
+	}
+	if len(failed.tasks) > 0 {
+		return &failed
+	}
+	return nil
 }
 
-// ExecTask processes the parsed tasks from the dunner task file
+// matchTasks returns the names of the tasks matching the task name given in command line, which can be a
+// glob pattern like `test:*`. Matching tasks are returned in the order they are defined in the task file.
+func matchTasks(configs *config.Configs, pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	var taskNames []string
+	for _, taskName := range configs.TaskNames() {
+		matched, err := path.Match(pattern, taskName)
+		if err != nil {
+			return nil, fmt.Errorf("dunner: invalid task name pattern '%s': %s", pattern, err.Error())
+		}
+		if matched {
+			taskNames = append(taskNames, taskName)
+		}
+	}
+	if len(taskNames) == 0 {
+		return nil, fmt.Errorf("dunner: no task matches '%s', available tasks are: %s", pattern, strings.Join(configs.TaskNames(), ", "))
+	}
+	return taskNames, nil
+}
+
+// ExitCode returns the exit code of the failed container command that caused the error returned by `ExecTask`,
+// so that it can be used as exit status of the caller. It returns 1 for any other error, and 0 if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *docker.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return 1
+}
+
+// ExecTask processes the parsed tasks from the dunner task file, with the global settings of the command line
 func ExecTask(configs *config.Configs, taskName string, args []string, parentStep *config.Step) error {
-	var async = viper.GetBool("Async")
-	var wg sync.WaitGroup
+	return NewRunner().ExecTask(configs, taskName, args, parentStep)
+}
 
+// ExecTask processes the parsed tasks from the dunner task file. The `before` and `after` hooks of the task file
+// are run around a task invoked from the command line, unless disabled with --no-hooks. A task with a `matrix`
+// is run once for every combination of its values, the hooks being run once around all of them. A task with
+// `inputs` is skipped if they did not change since it last succeeded, unless run with --force.
+func (r *Runner) ExecTask(configs *config.Configs, taskName string, args []string, parentStep *config.Step) error {
+	_, err := r.runTask(configs, taskName, args, parentStep)
+	return err
+}
+
+// runTask runs the task like ExecTask, and returns the values captured by its steps, for the steps after the step
+// following it, if any. See namespaceCaptured for how they are named.
+func (r *Runner) runTask(configs *config.Configs, taskName string, args []string, parentStep *config.Step) ([]string, error) {
 	if _, exists := configs.Tasks[taskName]; !exists {
-		return fmt.Errorf("dunner: task '%s' does not exist", taskName)
+		return nil, fmt.Errorf("dunner: task '%s' does not exist", taskName)
+	}
+	digest, unchanged, err := r.checkInputs(configs, taskName, args)
+	if err != nil {
+		return nil, err
+	}
+	if unchanged {
+		log.Infof("Skipping '%s' task: its inputs did not change since it last succeeded, run it anyway with --force", taskName)
+		return nil, nil
+	}
+	captured, err := r.execTask(configs, taskName, args, parentStep)
+	if err != nil || digest == "" {
+		return captured, err
+	}
+	return captured, saveInputs(configs, taskName, digest)
+}
+
+func (r *Runner) execTask(configs *config.Configs, taskName string, args []string, parentStep *config.Step) ([]string, error) {
+	if parentStep != nil || r.NoHooks {
+		return r.execTaskSteps(configs, taskName, args, parentStep)
+	}
+	if err := r.runHooks(configs, beforeHook, configs.Before, taskName, args); err != nil {
+		return nil, err
+	}
+	captured, err := r.execTaskSteps(configs, taskName, args, parentStep)
+	if hookErr := r.runHooks(configs, afterHook, configs.After, taskName, args); hookErr != nil {
+		if err == nil {
+			return captured, hookErr
+		}
+		log.Error(hookErr)
+	}
+	return captured, err
+}
+
+// runHooks runs the steps of a hook one after the other for the task, stopping at the first that fails
+func (r *Runner) runHooks(configs *config.Configs, hook string, steps []config.Step, taskName string, args []string) error {
+	for i := range steps {
+		stepDefinition := steps[i]
+		step, run, err := r.resolveStep(configs, taskName, i+1, &stepDefinition, nil, args, nil)
+		if err == nil && run {
+			_, err = r.processStep(configs, step, args, &stepDefinition)
+		} else if err == nil {
+			log.Infof("Skipping step %d of %s hook: condition '%s' is not met", i+1, hook, stepDefinition.When)
+		}
+		if err != nil && !isContinued(err) {
+			return &hookError{hook: hook, task: taskName, err: err}
+		}
+	}
+	return nil
+}
+
+// execSteps runs the steps of the task, and returns the values captured by them and by the tasks they follow
+func (r *Runner) execSteps(configs *config.Configs, taskName string, args []string, parentStep *config.Step) ([]string, error) {
+	var async = r.Async
+
+	steps := configs.Tasks[taskName].Steps
+	if parentStep == nil {
+		var err error
+		if steps, err = r.filterSteps(taskName, steps); err != nil {
+			return nil, err
+		}
 	}
-	for _, stepDefinition := range configs.Tasks[taskName].Steps {
-		err := stepDefinition.ParseStepEnv()
+	var follows, asyncSteps []pendingStep
+	var failures []error   // Errors of the failed steps, the task goes on after those with `continueOnError`
+	var stopped bool       // Whether a step failed, after which only the steps with `always` are run
+	var generated []string // Environment variables written by the steps to DUNNER_ENV, for the steps after them
+	var captured []string  // Values captured by the steps and by the tasks they follow, the latest first
+	var followed []string  // Values captured by the tasks followed, for the steps after them
+	runFollows := func() {
+		followCaptured, err := r.runFollowSteps(configs, follows, args, parentStep)
 		if err != nil {
-			return err
+			failures = append(failures, err)
+			stopped = !isContinued(err)
 		}
-		if async {
-			wg.Add(1)
-		}
-		step := docker.Step{
-			Task:     taskName,
-			Name:     stepDefinition.Name,
-			Image:    stepDefinition.Image,
-			Command:  stepDefinition.Command,
-			Commands: stepDefinition.Commands,
-			Env:      stepDefinition.Envs,
-			WorkDir:  stepDefinition.Dir,
-			Follow:   stepDefinition.Follow,
-			Args:     stepDefinition.Args,
-			User:     getDunnerUser(stepDefinition),
-		}
-
-		if err := PassGlobals(&step, configs, &stepDefinition, parentStep); err != nil {
-			log.Fatal(err)
+		captured, followed = append(followCaptured, captured...), append(followCaptured, followed...)
+		follows = nil
+	}
+	for i, stepDefinition := range steps {
+		// Consecutive follow steps do not depend on each other, they are collected to be run together before the
+		// next step that is not a follow step, which can use the values they captured, or the next conditional one,
+		// which depends on their outcome.
+		if !async && (stepDefinition.Follow == "" || isConditionalFollow(stepDefinition)) {
+			runFollows()
+		}
+		if stopped && !runsAfterFailure(stepDefinition) {
+			continue
+		}
+		if !async && stepDefinition.On == config.FollowOnFailure && len(failures) == 0 {
+			log.Infof("Skipping step %d of '%s' task: it follows '%s' on failure, and no step failed", i+1, taskName, stepDefinition.Follow)
+			continue
+		}
+		step, run, err := r.resolveStep(configs, taskName, i+1, &stepDefinition, parentStep, args, followed)
+		if err != nil {
+			return captured, err
+		}
+		if !run {
+			log.Infof("Skipping step %d of '%s' task: condition '%s' is not met", i+1, taskName, stepDefinition.When)
+			continue
 		}
 
 		if async {
-			go Process(configs, &step, &wg, args, &stepDefinition)
-		} else {
-			Process(configs, &step, &wg, args, &stepDefinition)
+			asyncSteps = append(asyncSteps, pendingStep{step: step, definition: stepDefinition})
+			continue
+		}
+		if stopped {
+			if err := r.applyStepEnvs(step, &stepDefinition, generated); err != nil {
+				return captured, err
+			}
+			r.runAlwaysStep(configs, step, args, &stepDefinition)
+			continue
+		}
+		if step.Follow != "" {
+			follows = append(follows, pendingStep{step: step, definition: stepDefinition})
+			continue
+		}
+		if err := r.processStepWithEnv(configs, step, args, &stepDefinition, &generated); err != nil {
+			failures = append(failures, err)
+			stopped = !isContinued(err)
+		} else if value, found := lookupEnv(generated, stepDefinition.CaptureAs); found && stepDefinition.CaptureAs != "" {
+			captured = append([]string{stepDefinition.CaptureAs + "=" + value}, captured...)
+		}
+	}
+	if async {
+		return nil, r.runAsyncSteps(configs, asyncSteps, args)
+	}
+	runFollows()
+	return captured, joinErrors(failures)
+}
+
+// isConditionalFollow returns true if the step follows a task depending on the outcome of the previous steps
+func isConditionalFollow(step config.Step) bool {
+	return step.Follow != "" && (step.On == config.FollowOnFailure || step.On == config.FollowOnAlways)
+}
+
+// runsAfterFailure returns true if the step is run even after a previous step of the task failed
+func runsAfterFailure(step config.Step) bool {
+	return step.Always || isConditionalFollow(step)
+}
+
+// runAlwaysStep runs a step with `always` after a previous step of the task failed. Its failure is only logged,
+// so that the error of the task is the one of the step that failed first.
+func (r *Runner) runAlwaysStep(configs *config.Configs, step *docker.Step, args []string, stepDefinition *config.Step) {
+	if _, err := r.processStep(configs, step, args, stepDefinition); err != nil {
+		log.Errorf("Running %s after a failure, it failed as well: %s", describeStep(step), err.Error())
+	}
+}
+
+// pendingStep is a resolved step waiting to be run, along with its definition.
+type pendingStep struct {
+	step       *docker.Step
+	definition config.Step
+}
+
+// runAsyncSteps runs the steps all at once in asynchronous mode, except that a step waits for the steps it `needs`
+// to be done. Every step runs independently of its siblings, a failing step does not stop the others but the steps
+// that need it are not run, unless it has `continueOnError` or they have `always`. A follow step with `on: failure` is
+// run only if a step it needs failed. The setup steps are run first, one after the other, as if all the other steps
+// needed them. It returns the errors of all the failed steps, after all the steps are done.
+func (r *Runner) runAsyncSteps(configs *config.Configs, steps []pendingStep, args []string) error {
+	type stepState struct {
+		done   chan struct{}
+		failed bool // Written before done is closed
+	}
+	// Steps are needed by name, only the first step of a name can be needed
+	states := make(map[string]*stepState)
+	ownStates := make([]*stepState, len(steps))
+	for i, s := range steps {
+		if _, exists := states[s.definition.Name]; s.definition.Name != "" && !exists {
+			ownStates[i] = &stepState{done: make(chan struct{})}
+			states[s.definition.Name] = ownStates[i]
+		}
+	}
+
+	errs := make(chan error, len(steps))
+	var setupFailed bool
+	for i, s := range steps {
+		if !s.definition.Setup {
+			continue
+		}
+		var failed bool
+		switch {
+		case setupFailed && !runsAfterFailure(s.definition):
+			log.Warnf("Skipping %s: a setup step failed", describeStep(s.step))
+			failed = true
+		case s.definition.On == config.FollowOnFailure && !setupFailed:
+			log.Infof("Skipping %s: it follows '%s' on failure, and no setup step failed", describeStep(s.step), s.step.Follow)
+		default:
+			if _, err := r.processStep(configs, s.step, args, &s.definition); err != nil {
+				failed = !isContinued(err)
+				errs <- err
+			}
+		}
+		setupFailed = setupFailed || failed
+		if ownStates[i] != nil {
+			ownStates[i].failed = failed
+			close(ownStates[i].done)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, s := range steps {
+		if s.definition.Setup {
+			continue
 		}
+		wg.Add(1)
+		go func(s pendingStep, state *stepState) {
+			defer wg.Done()
+			if state != nil {
+				defer close(state.done)
+			}
+			if setupFailed && !runsAfterFailure(s.definition) {
+				log.Warnf("Skipping %s: a setup step failed", describeStep(s.step))
+				if state != nil {
+					state.failed = true
+				}
+				return
+			}
+			// Needed steps which are skipped, or filtered out, are not waited for
+			neededFailed := setupFailed
+			for _, need := range s.definition.Needs {
+				if needed, exists := states[need]; exists && needed != state {
+					<-needed.done
+					if needed.failed && !runsAfterFailure(s.definition) {
+						log.Warnf("Skipping %s: needed step '%s' failed", describeStep(s.step), need)
+						if state != nil {
+							state.failed = true
+						}
+						return
+					}
+					neededFailed = neededFailed || needed.failed
+				}
+			}
+			if s.definition.On == config.FollowOnFailure && !neededFailed {
+				log.Infof("Skipping %s: it follows '%s' on failure, and no needed step failed", describeStep(s.step), s.step.Follow)
+				return
+			}
+			if _, err := r.processStep(configs, s.step, args, &s.definition); err != nil {
+				if state != nil {
+					state.failed = !isContinued(err)
+				}
+				errs <- err
+			}
+		}(s, ownStates[i])
 	}
 
 	wg.Wait()
+	close(errs)
+	return collectErrors(errs)
+}
+
+// runFollowSteps runs the tasks followed by the given steps of the task of parentStep in parallel, see
+// runInParallel, along with the tasks they depend on, see scheduleFollows. It returns the errors of all the failed
+// tasks, after all the started tasks are done. No more tasks are started once one fails, unless its step has
+// `continueOnError`. The values captured by the tasks are returned as well, named after the tasks, those of the
+// last follow step first.
+func (r *Runner) runFollowSteps(configs *config.Configs, follows []pendingStep, args []string, parentStep *config.Step) ([]string, error) {
+	defer r.scheduleFollows(configs, follows, parentStep)()
+	errs := make(chan error, len(follows))
+	captures := make([][]string, len(follows))
+	r.runInParallel(len(follows), func(i int) bool {
+		var err error
+		if captures[i], err = r.processStep(configs, follows[i].step, args, &follows[i].definition); err != nil {
+			errs <- err
+			return isContinued(err)
+		}
+		return true
+	})
+	close(errs)
+	var captured []string
+	for i, follow := range follows {
+		captured = append(namespaceCaptured(follow.step.Follow, captures[i]), captured...)
+	}
+	return captured, collectErrors(errs)
+}
+
+// collectErrors returns the errors received from the closed channel, joined into a single error
+func collectErrors(errs <-chan error) error {
+	var failures []error
+	for err := range errs {
+		failures = append(failures, err)
+	}
+	return joinErrors(failures)
+}
+
+// taskSlots counts the follow tasks running in their own goroutine, to limit the number of tasks running
+// at a time to the `--max-parallel` flag. The calling task always holds one of the slots.
+type taskSlots struct {
+	mu      sync.Mutex
+	running int
+}
+
+func (s *taskSlots) tryAcquire(maxParallel int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxParallel > 0 && s.running >= maxParallel-1 {
+		return false
+	}
+	s.running++
+	return true
+}
+
+func (s *taskSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+}
+
+// resolveStep builds the docker step of the given step definition, passing the environment variables and
+// mounts from the upper scopes with the arguments substituted in them, along with the values captured by the
+// tasks followed before the step. It returns false if the step is to be skipped as its `when` condition is not met.
+func (r *Runner) resolveStep(configs *config.Configs, taskName string, stepNumber int, stepDefinition *config.Step, parentStep *config.Step, args []string, captured []string) (*docker.Step, bool, error) {
+	if stepDefinition.Dir == "" {
+		stepDefinition.Dir = configs.Tasks[taskName].WorkDir
+	}
+	if err := stepDefinition.ParseStepEnv(); err != nil {
+		return nil, false, err
+	}
+	step := docker.Step{
+		Task:        taskName,
+		Name:        stepDefinition.Name,
+		Number:      stepNumber,
+		Image:       stepDefinition.Image,
+		PullPolicy:  stepDefinition.PullPolicy,
+		Command:     copyCommand(stepDefinition.Command),
+		Commands:    copyCommands(stepDefinition.Commands),
+		CommandDirs: stepDefinition.CommandDirs,
+		Env:         stepDefinition.Envs,
+		WorkDir:     stepDefinition.Dir,
+		Follow:      stepDefinition.Follow,
+		Args:        stepDefinition.Args,
+		User:        getDunnerUser(*stepDefinition),
+		Timeout:     stepDefinition.Timeout,
+		StopSignal:  stepDefinition.StopSignal,
+		StopTimeout: stepDefinition.StopTimeout,
+		Build:       stepDefinition.Build,
+		Dockerfile:  stepDefinition.Dockerfile,
+		BuildArgs:   stepDefinition.BuildArgs,
+		CPUs:        stepDefinition.CPUs,
+		Network:     stepDefinition.Network,
+		ExtraHosts:  stepDefinition.ExtraHosts,
+		Platform:    stepDefinition.Platform,
+		Captured:    captured,
+		Cancel:      r.cancel,
+		Shutdown:    r.shutdown,
+		Images:      r.images,
+	}
+	if step.PullPolicy == "" {
+		step.PullPolicy = configs.PullPolicy
+	}
+	dnsScopes, dnsSearchScopes := [][]string{stepDefinition.DNS}, [][]string{stepDefinition.DNSSearch}
+	if parentStep != nil {
+		dnsScopes, dnsSearchScopes = append(dnsScopes, parentStep.DNS), append(dnsSearchScopes, parentStep.DNSSearch)
+	}
+	task := configs.Tasks[taskName]
+	step.DeclaredArgs = declaredArgNames(task)
+	step.DNS = firstNonEmptyList(append(dnsScopes, task.DNS, configs.DNS)...)
+	step.DNSSearch = firstNonEmptyList(append(dnsSearchScopes, task.DNSSearch, configs.DNSSearch)...)
+	step.CommandErrorMode = stepDefinition.CommandErrorMode
+	step.SharedShell = stepDefinition.ScriptShell()
+	step.CommitAs = stepDefinition.CommitAs
+	step.KeepContainer = stepDefinition.KeepContainer || r.KeepContainers
+	step.ReadOnly = stepDefinition.ReadOnlyRootfs
+	if step.Init = configs.Init || r.Init; stepDefinition.Init != nil {
+		step.Init = *stepDefinition.Init
+	}
+	if step.Interactive = stepDefinition.Interactive; step.Interactive && r.Async {
+		return nil, false, fmt.Errorf("dunner: %s is interactive, it cannot be run in asynchronous mode", describeStep(&step))
+	}
+	step.Settings = r.dockerSettings()
+	if step.Registry = r.Registry; step.Registry == "" {
+		step.Registry = configs.Registry
+	}
+	if stepDefinition.Entrypoint != nil {
+		step.Entrypoint = strings.Fields(*stepDefinition.Entrypoint)
+		if step.Entrypoint == nil {
+			step.Entrypoint = []string{}
+		}
+	}
+	if stepDefinition.GPUs != "" {
+		gpus, err := config.ParseGPUs(stepDefinition.GPUs)
+		if err != nil {
+			return nil, false, err
+		}
+		step.GPUs = &gpus
+	}
+	if len(stepDefinition.Ulimits) > 0 {
+		ulimits, err := config.ParseUlimits(stepDefinition.Ulimits)
+		if err != nil {
+			return nil, false, err
+		}
+		step.Ulimits = ulimits
+	}
+	step.Sysctls = stepDefinition.Sysctls
+	if stepDefinition.Memory != "" {
+		memory, err := config.ParseMemory(stepDefinition.Memory)
+		if err != nil {
+			return nil, false, err
+		}
+		step.Memory = memory
+	}
+	step.OutputPrefix = r.outputPrefix(taskName, stepNumber)
+
+	substitute, err := r.argsSubstituter(args, step.DeclaredArgs, builtinEnvs(taskName, stepNumber, stepDefinition.Name), captured)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := r.passGlobals(&step, configs, stepDefinition, parentStep, substitute); err != nil {
+		return nil, false, err
+	}
+	for _, tmpfs := range stepDefinition.Tmpfs {
+		m, err := config.ParseTmpfs(tmpfs)
+		if err != nil {
+			return nil, false, err
+		}
+		step.ExtMounts = append(step.ExtMounts, m)
+	}
+	for _, cache := range stepDefinition.Caches {
+		name, m, err := config.ParseCache(cache)
+		if err != nil {
+			return nil, false, err
+		}
+		step.ExtMounts = append(step.ExtMounts, m)
+		step.Caches = append(step.Caches, name)
+	}
+	for _, env := range builtinEnvs(taskName, stepNumber, stepDefinition.Name) {
+		if _, found := lookupEnv(step.Env, strings.SplitN(env, "=", 2)[0]); !found {
+			step.Env = append(step.Env, env)
+		}
+	}
+	step.Secrets = secretValues(configs, taskName, step.Env)
+	auths, authSecrets, err := registryAuths(configs)
+	if err != nil {
+		return nil, false, err
+	}
+	step.Auths = auths
+	step.Secrets = append(step.Secrets, authSecrets...)
+	if step.Stdin, err = readStdin(stepDefinition.Stdin, configs.BaseDir()); err != nil {
+		return nil, false, err
+	}
+	if stepDefinition.Privileged {
+		if r.NoPrivileged {
+			return nil, false, fmt.Errorf("dunner: %s runs a privileged container, which is disabled with --no-privileged", describeStep(&step))
+		}
+		step.Privileged = true
+	}
+	if stepDefinition.DockerSocket {
+		if err := r.mountDockerSocket(&step); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if stepDefinition.When != "" {
+		run, err := evalCondition(stepDefinition.When, step.Env)
+		if err != nil || !run {
+			return &step, false, err
+		}
+	}
+	return &step, true, nil
+}
+
+// outputPrefix returns the prefix of the output lines of the step, `[task/step] ` with `--prefix`, or `[task] ` if
+// tasks run in parallel. It is colored with `--color`.
+func (r *Runner) outputPrefix(taskName string, stepNumber int) string {
+	var prefix string
+	switch {
+	case r.Prefix:
+		prefix = fmt.Sprintf("[%s/%d]", taskName, stepNumber)
+	case r.MaxParallel != 1:
+		prefix = fmt.Sprintf("[%s]", taskName)
+	default:
+		return ""
+	}
+	if r.Color {
+		prefix = logger.ColorPrefix(prefix)
+	}
+	return prefix + " "
+}
+
+// copyCommand returns a copy of the command, so that passing arguments to a step does not change its definition,
+// which can be shared by steps running concurrently.
+func copyCommand(command []string) []string {
+	if command == nil {
+		return nil
+	}
+	return append([]string{}, command...)
+}
+
+// firstNonEmptyList returns the first of the lists that is not empty, like the one of the most specific scope
+func firstNonEmptyList(lists ...[]string) []string {
+	for _, list := range lists {
+		if len(list) > 0 {
+			return list
+		}
+	}
 	return nil
 }
 
-// Process executes a single step of the task.
-func Process(configs *config.Configs, s *docker.Step, wg *sync.WaitGroup, args []string, dunnerStep *config.Step) {
-	var async = viper.GetBool("Async")
-	if async {
-		defer wg.Done()
+func copyCommands(commands []config.Command) [][]string {
+	if commands == nil {
+		return nil
+	}
+	copied := make([][]string, len(commands))
+	for i, command := range commands {
+		copied[i] = copyCommand(command)
 	}
+	return copied
+}
+
+// Process executes a single step of the task, with the global settings of the command line.
+func Process(configs *config.Configs, s *docker.Step, args []string, dunnerStep *config.Step) error {
+	return NewRunner().Process(configs, s, args, dunnerStep)
+}
+
+// Process executes a single step of the task.
+func (r *Runner) Process(configs *config.Configs, s *docker.Step, args []string, dunnerStep *config.Step) error {
+	_, err := r.process(configs, s, args, dunnerStep)
+	return err
+}
 
+// process executes the step like Process, and returns the values captured by the task it follows, if any
+func (r *Runner) process(configs *config.Configs, s *docker.Step, args []string, dunnerStep *config.Step) ([]string, error) {
+	if dunnerStep.Description != "" {
+		log.Debugf("Running %s: %s", describeStep(s), dunnerStep.Description)
+	}
 	if s.Follow != "" {
-		if async {
-			wg.Add(1)
-			go func(wg *sync.WaitGroup) {
-				ExecTask(configs, s.Follow, s.Args, dunnerStep)
-				wg.Done()
-			}(wg)
-		} else {
-			ExecTask(configs, s.Follow, s.Args, dunnerStep)
-		}
-		return
+		return r.followTask(configs, s, dunnerStep)
 	}
 
-	if err := PassArgs(s, &args); err != nil {
-		log.Fatal(err)
+	if err := r.PassArgs(s, &args); err != nil {
+		return nil, err
 	}
 
-	if s.Image == "" {
-		log.Fatalf(`dunner: image repository name cannot be empty`)
+	if s.Image == "" && s.Build == "" {
+		return nil, fmt.Errorf(`dunner: image repository name cannot be empty`)
 	}
 
-	err := (*s).Exec()
-	if err != nil {
-		log.Fatal(err)
+	select {
+	case <-s.Cancel:
+		return nil, docker.ErrCanceled
+	default:
+	}
+
+	if dunnerStep.OutputFile != "" {
+		file, err := os.Create(dunnerStep.OutputFile)
+		if err != nil {
+			return nil, fmt.Errorf("dunner: failed to create output file of %s: %s", describeStep(s), err.Error())
+		}
+		defer file.Close()
+		s.Tee, s.TeeStderr = file, dunnerStep.OutputStderr
 	}
+
+	if r.Output == jsonOutput || r.run != nil {
+		return nil, r.execWithJSONResult(s, dunnerStep)
+	}
+	return nil, r.execWithRetries(s, dunnerStep)
+}
+
+// execWithRetries runs the step, re-running it as many times as `retries` of the step definition if it fails
+// with a non-zero exit code. Any other failure is returned immediately without retrying.
+func (r *Runner) execWithRetries(s *docker.Step, dunnerStep *config.Step) error {
+	attempts := dunnerStep.Retries + 1
+	delays := newTimeBackoff(dunnerStep.RetryDelay, dunnerStep.RetryBackoff)
+	var err error
+	var attempt int
+	for attempt = 1; attempt <= attempts; attempt++ {
+		if s.Capture != nil {
+			// Only the output of the last attempt is captured
+			s.Capture.Reset()
+		}
+		if err = execStep(*s); err == nil {
+			return nil
+		}
+		var exitErr *docker.ExitError
+		if !errors.As(err, &exitErr) {
+			return err
+		}
+		if attempt == attempts {
+			break
+		}
+		delay, ok := delays.next()
+		if !ok {
+			log.Warnf("Step of '%s' task failed, not retrying as its retries would take longer than %s", s.Task, dunnerStep.RetryBackoff.MaxElapsed)
+			break
+		}
+		log.Debugf("Step of '%s' task failed, retrying in %s (attempt %d of %d)", s.Task, delay, attempt+1, attempts)
+		time.Sleep(delay)
+	}
+	if attempt > 1 {
+		return fmt.Errorf("dunner: step failed after %d attempts: %w", attempt, err)
+	}
+	return err
 }
 
 // PassArgs replaces argument variables,of the form '`$d`', where d is a number, with dth argument.
+// Variables of the form '`${name}`' are replaced with the named argument passed as `--arg name=value` in the
+// command line, or with the positional argument of an argument of that name declared by the task. Other variables,
+// like '`${HOME}`', are left for the shell of the container, and '`$${name}`' can be used for a literal '`${name}`'.
+// Both can have a default value used when the argument is not passed, like '`${1:-default}`' or
+// '`${name:-default}`'. The built-in environment variables describing the step, like '`${DUNNER_TASK}`', can be
+// used as named arguments too, as can the values captured by the tasks followed before the step, like
+// '`${build.GIT_SHA}`', see `namespaceCaptured`.
 func PassArgs(s *docker.Step, args *[]string) error {
-	var gErr error
+	return NewRunner().PassArgs(s, args)
+}
+
+// PassArgs replaces the argument variables of the commands of the step with the arguments, and the named arguments
+// of the runner. Those of its environment variables and mounts are replaced once the step is resolved.
+func (r *Runner) PassArgs(s *docker.Step, args *[]string) error {
+	substitute, err := r.argsSubstituter(*args, s.DeclaredArgs, s.Env, s.Captured)
+	if err != nil {
+		return err
+	}
 	var commands [][]string
 	if s.Command != nil {
 		commands = [][]string{s.Command}
@@ -141,29 +852,187 @@ func PassArgs(s *docker.Step, args *[]string) error {
 	}
 	for i, cmd := range commands {
 		for j, subStr := range cmd {
-			regex := regexp.MustCompile(`\$[1-9][0-9]*`)
-			subStr = regex.ReplaceAllStringFunc(subStr, func(str string) string {
-				j, err := strconv.Atoi(strings.Trim(str, "$"))
-				if err != nil {
-					log.Fatal(err)
-				}
-				if j > len(*args) {
-					gErr = fmt.Errorf(`dunner: insufficient number of arguments passed`)
-					return ""
-				}
-				return (*args)[j-1]
-			})
-			if gErr != nil {
-				return gErr
+			parsed, err := substitute(subStr)
+			if err != nil {
+				return err
 			}
 			if s.Command != nil {
-				s.Command[j] = subStr
+				s.Command[j] = parsed
 			} else {
-				s.Commands[i][j] = subStr
+				s.Commands[i][j] = parsed
 			}
 		}
 	}
-	return gErr
+	return nil
+}
+
+// argsSubstituter returns the function replacing the argument variables with the arguments, and the named arguments
+// of the runner. The arguments declared by the task are named arguments too, their values being the positional
+// arguments, as are the built-in environment variables found in env, like DUNNER_TASK, and the captured values of
+// the tasks followed before, unless named arguments of the same name are passed.
+func (r *Runner) argsSubstituter(args []string, declared []string, env []string, captured []string) (func(string) (string, error), error) {
+	namedArgs, err := r.getNamedArgs()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range declared {
+		if _, passed := namedArgs[name]; !passed && i < len(args) {
+			namedArgs[name] = args[i]
+		}
+	}
+	for _, name := range builtinEnvNames {
+		if value, found := lookupEnv(env, name); found {
+			if _, passed := namedArgs[name]; !passed {
+				namedArgs[name] = value
+			}
+		}
+	}
+	// The first of the captured values of the same name is the latest one, which is kept
+	for _, value := range captured {
+		if pair := strings.SplitN(value, "=", 2); len(pair) == 2 {
+			if _, passed := namedArgs[pair[0]]; !passed {
+				namedArgs[pair[0]] = pair[1]
+			}
+		}
+	}
+	declaredArgs := make(map[string]bool, len(declared))
+	for _, name := range declared {
+		declaredArgs[name] = true
+	}
+	return func(str string) (string, error) { return substituteArgs(str, args, namedArgs, declaredArgs) }, nil
+}
+
+// substituteAll returns a copy of the values with the arguments replaced by substitute, if not nil
+func substituteAll(values []string, substitute func(string) (string, error)) ([]string, error) {
+	substituted := make([]string, 0, len(values))
+	for _, value := range values {
+		if substitute != nil {
+			var err error
+			if value, err = substitute(value); err != nil {
+				return nil, err
+			}
+		}
+		substituted = append(substituted, value)
+	}
+	return substituted, nil
+}
+
+var argRegex = regexp.MustCompile(`\$\$\{[^}]*\}|\$\{([1-9][0-9]*|[A-Za-z_][A-Za-z0-9_]*|[^$:{}\s]+\.[A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}|\$([1-9][0-9]*)`)
+
+// substituteArgs replaces the positional and named argument variables in str. A variable with a default value,
+// like '`${1:-default}`', is replaced with its default value when the argument is not passed. The variables that
+// are neither named arguments, declared arguments nor captured values are left as they are.
+func substituteArgs(str string, args []string, namedArgs map[string]string, declared map[string]bool) (string, error) {
+	var gErr error
+	substituted := argRegex.ReplaceAllStringFunc(str, func(match string) string {
+		if strings.HasPrefix(match, "$${") {
+			return match[1:]
+		}
+		groups := argRegex.FindStringSubmatch(match)
+		name, defaultValue := groups[1]+groups[3], groups[2]
+		if j, err := strconv.Atoi(name); err == nil {
+			if j <= len(args) {
+				return args[j-1]
+			}
+			if defaultValue != "" {
+				return strings.TrimPrefix(defaultValue, ":-")
+			}
+			if gErr == nil {
+				gErr = fmt.Errorf(`dunner: insufficient number of arguments passed`)
+			}
+			return ""
+		}
+		if value, ok := namedArgs[name]; ok {
+			return value
+		}
+		if !declared[name] && !strings.Contains(name, ".") {
+			return match
+		}
+		if defaultValue != "" {
+			return strings.TrimPrefix(defaultValue, ":-")
+		}
+		if gErr == nil && strings.Contains(name, ".") {
+			gErr = fmt.Errorf(`dunner: captured value '%s' is not set, it is set by a step following '%s' task before`, name, strings.SplitN(name, ".", 2)[0])
+		} else if gErr == nil {
+			gErr = fmt.Errorf(`dunner: named argument '%s' is not passed, pass it with --arg %s=<value>`, name, name)
+		}
+		return ""
+	})
+	return substituted, gErr
+}
+
+// getNamedArgs returns the named arguments passed as `--arg name=value` in the command line
+func (r *Runner) getNamedArgs() (map[string]string, error) {
+	namedArgs := make(map[string]string)
+	for _, arg := range r.Args {
+		pair := strings.SplitN(arg, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, fmt.Errorf(`dunner: invalid argument '%s', named arguments must be of the form name=value`, arg)
+		}
+		namedArgs[pair[0]] = pair[1]
+	}
+	return namedArgs, nil
+}
+
+// readStdin returns the input fed to the command(s) of a step, read from the file if it is given as `@file`
+func readStdin(stdin string, baseDir string) (string, error) {
+	file, isFile := config.StdinFile(stdin, baseDir)
+	if !isFile {
+		if strings.HasPrefix(stdin, "@@") {
+			return stdin[1:], nil
+		}
+		return stdin, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("dunner: failed to read stdin file %s: %s", file, err.Error())
+	}
+	return string(content), nil
+}
+
+// builtinEnvNames are the names of the built-in environment variables that every step sees
+var builtinEnvNames = config.BuiltinEnvNames
+
+// builtinEnvs returns the built-in environment variables describing the step, the number of the step being
+// its position in the task starting from 1. They are overridden by any environment variable of the same name.
+func builtinEnvs(taskName string, stepNumber int, stepName string) []string {
+	values := []string{taskName, stepName, strconv.Itoa(stepNumber)}
+	envs := make([]string, len(builtinEnvNames))
+	for i, name := range builtinEnvNames {
+		envs[i] = name + "=" + values[i]
+	}
+	return envs
+}
+
+// inheritedEnvs returns the host environment variables of the given names, of the form KEY=VALUE. Variables
+// that are not set on the host are skipped, unless their name ends with `!` to mark them as required.
+func inheritedEnvs(names []string, scope string) ([]string, error) {
+	var envs []string
+	for _, name := range names {
+		required := strings.HasSuffix(name, "!")
+		name = strings.TrimSuffix(name, "!")
+		value, found := os.LookupEnv(name)
+		if !found {
+			if required {
+				return nil, fmt.Errorf("dunner: host environment variable '%s' inherited by %s is not set", name, scope)
+			}
+			continue
+		}
+		envs = append(envs, name+"="+value)
+	}
+	return envs, nil
+}
+
+// getCLIEnvs returns the environment variables passed as `--env KEY=VALUE` in the command line
+func (r *Runner) getCLIEnvs() ([]string, error) {
+	var envs []string
+	for _, env := range r.Env {
+		if pair := strings.SplitN(env, "=", 2); len(pair) != 2 || pair[0] == "" {
+			return nil, fmt.Errorf(`dunner: invalid environment variable '%s', it must be of the form KEY=VALUE`, env)
+		}
+		envs = append(envs, env)
+	}
+	return envs, nil
 }
 
 // getDunnerUser returns the user value from step, if empty returns first found value in order:
@@ -190,7 +1059,8 @@ func getDunnerUser(step config.Step) string {
 //
 // In the case of environment variables, if a different value of variable is given
 // in a lower scope as compared to an upper scope, the value from the upper scope
-// is overridden by the lower scope variable definition.
+// is overridden by the lower scope variable definition. The host variables named in
+// `inheritEnv` come right after the variables given in `envs` of the same scope.
 // While in the case of directory mounts, similar comparision is done when two mounts
 // from different scopes have
 // the same destination (target) path.
@@ -198,21 +1068,64 @@ func getDunnerUser(step config.Step) string {
 // Since both of these parings are independent of each other, they are carried out
 // concurrently on two different goroutines to increase the execution speed.
 func PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *config.Step, parentStep *config.Step) error {
+	return NewRunner().PassGlobals(step, configs, stepDefinition, parentStep)
+}
+
+// PassGlobals passes the environment variables and directory mounts of the upper scopes to the step, along with
+// the environment variables of the runner.
+func (r *Runner) PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *config.Step, parentStep *config.Step) error {
+	return r.passGlobals(step, configs, stepDefinition, parentStep, nil)
+}
+
+// passGlobals is PassGlobals with the arguments substituted by substitute, when not nil, in the environment
+// variables and mounts of the task file before they are merged. Those passed with `--env` or inherited from the
+// host are passed as they are.
+func (r *Runner) passGlobals(step *docker.Step, configs *config.Configs, stepDefinition *config.Step, parentStep *config.Step, substitute func(string) (string, error)) error {
+	cliEnvs, err := r.getCLIEnvs()
+	if err != nil {
+		return err
+	}
+	taskInherited, err := inheritedEnvs((*configs).Tasks[step.Task].InheritEnv, fmt.Sprintf("task '%s'", step.Task))
+	if err != nil {
+		return err
+	}
+	globalInherited, err := inheritedEnvs((*configs).InheritEnv, "the task file")
+	if err != nil {
+		return err
+	}
+
+	var taskEnvs, taskMounts []string
+	if parentStep != nil {
+		taskEnvs, taskMounts = append(taskEnvs, parentStep.Envs...), append(taskMounts, parentStep.Mounts...)
+	}
+	taskEnvs = append(taskEnvs, (*configs).Tasks[step.Task].Envs...)
+	taskMounts = append(taskMounts, (*configs).Tasks[step.Task].Mounts...)
+	values := [][]string{step.Env, taskEnvs, (*configs).Envs, (*stepDefinition).Mounts, taskMounts, (*configs).Mounts}
+	for i := range values {
+		if values[i], err = substituteAll(values[i], substitute); err != nil {
+			return err
+		}
+	}
+	stepEnvs, taskEnvs, globalEnvs := values[0], append(values[1], taskInherited...), append(values[2], globalInherited...)
+	stepMounts, taskMounts, globalMounts := values[3], values[4], values[5]
+
 	var wg sync.WaitGroup
 	wg.Add(2)
+	mountErr := make(chan error, 1)
 
 	// Parsing environment variable. Environment variable are overridden if
-	// same key is present in the lower scopes.
+	// same key is present in the lower scopes, while those passed with `--env`
+	// override all of them.
 	go func() {
 		envKeys := make(map[string]struct{})
-		for _, env := range (*step).Env {
-			envKeys[strings.Split(env, "=")[0]] = struct{}{}
-		}
-		var taskEnvs []string
-		if parentStep != nil {
-			taskEnvs = append(taskEnvs, parentStep.Envs...)
+		step.Env = nil
+		for _, env := range append(cliEnvs, stepEnvs...) {
+			k := strings.Split(env, "=")[0]
+			if _, present := envKeys[k]; !present {
+				step.Env = append(step.Env, env)
+				envKeys[k] = struct{}{}
+			}
 		}
-		taskEnvs = append(taskEnvs, (*configs).Tasks[step.Task].Envs...)
 		for _, env := range taskEnvs {
 			k := strings.Split(env, "=")[0]
 			if _, present := envKeys[k]; !present {
@@ -220,7 +1133,7 @@ func PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *con
 				envKeys[k] = struct{}{}
 			}
 		}
-		for _, env := range (*configs).Envs {
+		for _, env := range globalEnvs {
 			k := strings.Split(env, "=")[0]
 			if _, present := envKeys[k]; !present {
 				step.Env = append(step.Env, env)
@@ -233,15 +1146,10 @@ func PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *con
 	// present in the lower scopes.
 	go func() {
 		targets := make(map[string]struct{})
-		allMounts := (*stepDefinition).Mounts
-		for _, mount := range (*stepDefinition).Mounts {
+		allMounts := stepMounts
+		for _, mount := range stepMounts {
 			targets[strings.Split(mount, ":")[1]] = struct{}{}
 		}
-		var taskMounts []string
-		if parentStep != nil {
-			taskMounts = append(taskMounts, parentStep.Mounts...)
-		}
-		taskMounts = append(taskMounts, (*configs).Tasks[step.Task].Mounts...)
 		for _, mount := range taskMounts {
 			k := strings.Split(mount, ":")[1]
 			if _, present := targets[k]; !present {
@@ -249,18 +1157,33 @@ func PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *con
 				targets[k] = struct{}{}
 			}
 		}
-		for _, mount := range (*configs).Mounts {
+		for _, mount := range globalMounts {
 			k := strings.Split(mount, ":")[1]
 			if _, present := targets[k]; !present {
 				allMounts = append(allMounts, mount)
 			}
 		}
-		if err := config.DecodeMount(allMounts, step); err != nil {
-			log.Fatal(err)
-		}
+		mountErr <- config.DecodeMount(allMounts, configs.BaseDir(), step)
 		wg.Done()
 	}()
-
 	wg.Wait()
+	if err := <-mountErr; err != nil {
+		return err
+	}
+
+	// Labels are overridden if same key is present in the lower scopes, the built-in ones being overridden by all
+	step.Labels = map[string]string{docker.TaskLabel: step.Task}
+	if step.Name != "" {
+		step.Labels[docker.StepLabel] = step.Name
+	}
+	scopes := []map[string]string{configs.Labels, configs.Tasks[step.Task].Labels}
+	if parentStep != nil {
+		scopes = append(scopes, parentStep.Labels)
+	}
+	for _, labels := range append(scopes, stepDefinition.Labels) {
+		for key, value := range labels {
+			step.Labels[key] = value
+		}
+	}
 	return nil
 }
@@ -1,23 +1,37 @@
 package dunner
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	os_user "os/user"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
 	"github.com/leopardslab/dunner/pkg/config"
 	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 var busyBoxImage = "busybox:1.31"
 
 func TestDo(t *testing.T) {
+	testDo(t, &Runner{Output: textOutput})
+}
+
+func TestDo_VerboseAsync(t *testing.T) {
+	testDo(t, &Runner{Output: textOutput, Async: true, Verbose: true})
+}
 
+func testDo(t *testing.T, r *Runner) {
 	var content = []byte(`
 envs:
   - GLB=VARBL
@@ -33,23 +47,11 @@ tasks:
         envs:
           - MYVAR=MYVAL`)
 
-	if err := doContent(&content); err != nil {
+	if err := doContent(r, &content); err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestDo_VerboseAsync(t *testing.T) {
-	async := viper.GetBool("Async")
-	viper.Set("Async", true)
-	verbose := viper.GetBool("Verbose")
-	viper.Set("Verbose", true)
-
-	defer viper.Set("Async", async)
-	defer viper.Set("Verbose", verbose)
-
-	TestDo(t)
-}
-
 func TestDo_WithFollow(t *testing.T) {
 
 	var content = []byte(`
@@ -73,12 +75,12 @@ tasks:
       - image: busybox
         command: ["pwd"]`)
 
-	if err := doContent(&content); err != nil {
+	if err := doContent(&Runner{Output: textOutput}, &content); err != nil {
 		t.Fatal(err)
 	}
 }
 
-func doContent(content *[]byte) error {
+func doContent(r *Runner, content *[]byte) error {
 	var tmpFilename = ".testdunner.yaml"
 
 	tmpFile, err := ioutil.TempFile("", tmpFilename)
@@ -96,19 +98,24 @@ func doContent(content *[]byte) error {
 		return err
 	}
 
-	defaultTaskFile := viper.GetString("DunnerTaskFile")
-	viper.Set("DunnerTaskFile", tmpFile.Name())
-	defer viper.Set("DunnerTaskFile", defaultTaskFile)
-
-	Do(nil, []string{"test", "/"})
+	r.TaskFile = tmpFile.Name()
+	r.Do(nil, []string{"test", "/"})
 	return nil
 }
 
 func TestExecTask(t *testing.T) {
+	testExecTask(t, new(Runner))
+}
+
+func TestExecTaskAsync(t *testing.T) {
+	testExecTask(t, &Runner{Async: true})
+}
+
+func testExecTask(t *testing.T, r *Runner) {
 	var step = config.Step{
 		Name:     "",
 		Image:    busyBoxImage,
-		Commands: [][]string{{"ls", "/"}, {"ls", "$1"}},
+		Commands: []config.Command{{"ls", "/"}, {"ls", "$1"}},
 		Envs:     []string{"MYVAR=MYVAL"},
 	}
 	var tasks = make(map[string]config.Task)
@@ -117,7 +124,7 @@ func TestExecTask(t *testing.T) {
 		Tasks: tasks,
 	}
 
-	if err := ExecTask(&configs, "test", []string{"/dunner"}, nil); err != nil {
+	if err := r.ExecTask(&configs, "test", []string{"/dunner"}, nil); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -125,14 +132,14 @@ func TestExecTask(t *testing.T) {
 func ExampleExecTask_taskWithFollowStep() {
 	var buildStep = config.Step{
 		Image:    busyBoxImage,
-		Commands: [][]string{{"echo", "build"}},
+		Commands: []config.Command{{"echo", "build"}},
 	}
 	var step = config.Step{
 		Follow: "build",
 	}
 	var testStep = config.Step{
 		Image:    busyBoxImage,
-		Commands: [][]string{{"echo", "test"}},
+		Commands: []config.Command{{"echo", "test"}},
 	}
 	var tasks = make(map[string]config.Task)
 	tasks["test"] = config.Task{Steps: []config.Step{step, testStep}}
@@ -165,12 +172,160 @@ func TestExecTaskWithParseError(t *testing.T) {
 	}
 }
 
-func TestExecTaskAsync(t *testing.T) {
-	async := viper.GetBool("Async")
-	viper.Set("Async", true)
-	defer viper.Set("Async", async)
+func TestExecTaskWithParseErrorInTaskWorkDir(t *testing.T) {
+	step := config.Step{Image: "busybox"}
+	tasks := make(map[string]config.Task)
+	tasks["test"] = config.Task{WorkDir: "`$INVALID_USER_NONEXISTING`", Steps: []config.Step{step}}
+	configs := config.Configs{Tasks: tasks}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	expectedErr := "could not find environment variable 'INVALID_USER_NONEXISTING'"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got %s", expectedErr, err)
+	}
+}
+
+func TestExecTaskWithTaskWorkDir(t *testing.T) {
+	dirs := make(map[string]string)
+	defer stubExecStep(func(s docker.Step) error {
+		dirs[s.Name] = s.WorkDir
+		return nil
+	})()
+	tasks := map[string]config.Task{
+		"test": {WorkDir: "/src", Steps: []config.Step{
+			{Name: "default", Image: busyBoxImage, Command: []string{"ls"}},
+			{Name: "override", Image: busyBoxImage, Command: []string{"ls"}, Dir: "/tmp"},
+			{Follow: "build"},
+		}},
+		"build": {WorkDir: "/build", Steps: []config.Step{{Name: "follow", Image: busyBoxImage, Command: []string{"ls"}}}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := map[string]string{"default": "/src", "override": "/tmp", "follow": "/build"}
+	if !reflect.DeepEqual(expected, dirs) {
+		t.Errorf("expected step dirs: %v, got: %v", expected, dirs)
+	}
+}
+
+func TestExecTaskAsyncRunsStepsAfterTheirNeeds(t *testing.T) {
+	r := &Runner{Async: true}
+	var mu sync.Mutex
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		if s.Name == "build" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, s.Name)
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "test", Image: busyBoxImage, Command: []string{"ls"}, Needs: []string{"build"}},
+		{Name: "build", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	if err := r.ExecTask(&configs, "ci", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"build", "test"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskAsyncRunsSetupStepsFirst(t *testing.T) {
+	r := &Runner{Async: true}
+	var mu sync.Mutex
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		if s.Name == "network" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, s.Name)
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "test", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "network", Image: busyBoxImage, Command: []string{"ls"}, Setup: true},
+		{Name: "lint", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "volume", Image: busyBoxImage, Command: []string{"ls"}, Setup: true},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	if err := r.ExecTask(&configs, "ci", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(ran) != 4 || !reflect.DeepEqual([]string{"network", "volume"}, ran[:2]) {
+		t.Errorf("expected setup steps to run one after the other before the others, got: %v", ran)
+	}
+}
+
+func TestExecTaskAsyncSkipsStepsAfterFailedSetupStep(t *testing.T) {
+	r := &Runner{Async: true}
+	var mu sync.Mutex
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, s.Name)
+		if s.Name == "network" {
+			return &docker.ExitError{Code: 3}
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "network", Image: busyBoxImage, Command: []string{"ls"}, Setup: true},
+		{Name: "volume", Image: busyBoxImage, Command: []string{"ls"}, Setup: true},
+		{Name: "test", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "teardown", Image: busyBoxImage, Command: []string{"ls"}, Always: true},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
 
-	TestExecTask(t)
+	err := r.ExecTask(&configs, "ci", []string{}, nil)
+
+	if ExitCode(err) != 3 {
+		t.Fatalf("expected error of the failed setup step, got: %v", err)
+	}
+	if expected := []string{"network", "teardown"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskAsyncSkipsStepsNeedingFailedStep(t *testing.T) {
+	r := &Runner{Async: true}
+	var mu sync.Mutex
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, s.Name)
+		if s.Name == "build" {
+			return &docker.ExitError{Code: 2}
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "build", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "test", Image: busyBoxImage, Command: []string{"ls"}, Needs: []string{"build"}},
+		{Name: "deploy", Image: busyBoxImage, Command: []string{"ls"}, Needs: []string{"test"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	err := r.ExecTask(&configs, "ci", []string{}, nil)
+
+	if ExitCode(err) != 2 {
+		t.Fatalf("expected error of failed step, got: %v", err)
+	}
+	if expected := []string{"build"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
 }
 
 func TestGetDunnerUserFromStep(t *testing.T) {
@@ -184,6 +339,22 @@ func TestGetDunnerUserFromStep(t *testing.T) {
 	}
 }
 
+func TestResolveStepPassesUserVerbatim(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	for _, user := range []string{"20", "node", "node:staff", "1000:1000"} {
+		stepDefinition := config.Step{Image: busyBoxImage, User: user}
+
+		step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if step.User != user {
+			t.Errorf("got: %s, want: %s", step.User, user)
+		}
+	}
+}
+
 func TestGetDunnerUserFromUserEnv(t *testing.T) {
 	user, _ := os_user.Current()
 	want := user.Uid
@@ -309,3 +480,1593 @@ func TestPassGlobalsToOverrideTaskLevelValuesFromFollowTask(t *testing.T) {
 		t.Errorf("expected: %v, got: %v", expectedMounts, dockerStep.ExtMounts)
 	}
 }
+
+func stubExecStep(fn func(docker.Step) error) func() {
+	original := execStep
+	execStep = fn
+	return func() { execStep = original }
+}
+
+func TestExecTaskRetriesFailedStep(t *testing.T) {
+	var attempts int
+	defer stubExecStep(func(docker.Step) error {
+		attempts++
+		return &docker.ExitError{Code: 3}
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"false"}, Retries: 2}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	if attempts != 3 {
+		t.Errorf("expected step to be run 3 times, got %d", attempts)
+	}
+	expectedErr := "dunner: step failed after 3 attempts: docker: command execution failed with exit code 3"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %s", expectedErr, err)
+	}
+}
+
+func TestExecTaskRetriesUntilStepSucceeds(t *testing.T) {
+	var attempts int
+	defer stubExecStep(func(docker.Step) error {
+		attempts++
+		if attempts < 2 {
+			return &docker.ExitError{Code: 1}
+		}
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}, Retries: 3}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	if err := ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected step to be run 2 times, got %d", attempts)
+	}
+}
+
+func TestExecTaskDoesNotRetryArgumentErrors(t *testing.T) {
+	var attempts int
+	defer stubExecStep(func(docker.Step) error {
+		attempts++
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls", "$1"}, Retries: 3}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	expectedErr := "dunner: insufficient number of arguments passed"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %s", expectedErr, err)
+	}
+	if attempts != 0 {
+		t.Errorf("expected step not to be run, got %d runs", attempts)
+	}
+}
+
+func TestExecTaskWritesOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner_output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputFile := dir + "/output.log"
+	if err := ioutil.WriteFile(outputFile, []byte("stale output"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer stubExecStep(func(s docker.Step) error {
+		if s.TeeStderr {
+			t.Errorf("expected errors not to be written to output file")
+		}
+		_, err := io.WriteString(s.Tee, "fresh output")
+		return err
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}, OutputFile: outputFile}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	if err := ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "fresh output" {
+		t.Errorf("expected output file to be truncated and written, got: %q", string(content))
+	}
+}
+
+func TestExecTaskWithUncreatableOutputFile(t *testing.T) {
+	defer stubExecStep(func(docker.Step) error {
+		t.Errorf("expected step not to be run")
+		return nil
+	})()
+	step := config.Step{Name: "ls", Image: busyBoxImage, Command: []string{"ls"}, OutputFile: "/dunner/not/existing/output.log"}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	expected := "dunner: failed to create output file of task 'test', step 'ls'"
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestExecTaskSkipsStepWhenConditionIsFalse(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "build", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "deploy", Image: busyBoxImage, Command: []string{"ls"}, When: `$BRANCH == "main"`},
+		{Name: "notify", Image: busyBoxImage, Command: []string{"ls"}, When: `$BRANCH == "dev"`},
+	}
+	tasks := map[string]config.Task{"test": {Steps: steps, Envs: []string{"BRANCH=main"}}}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{"build", "deploy"}
+	if !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps %v to run, got %v", expected, ran)
+	}
+}
+
+func TestPassGlobalsPreservesNamedVolumes(t *testing.T) {
+	dockerStep := &docker.Step{Task: "build"}
+	step := config.Step{Image: busyBoxImage, Mounts: []string{"/foo:/tmp:w"}}
+	tasks := map[string]config.Task{"build": {Steps: []config.Step{step}, Mounts: []string{"gocache:/root/.cache:w"}}}
+	configs := &config.Configs{Tasks: tasks, Mounts: []string{"gocache:/ignored", "modcache:/go/pkg/mod"}}
+
+	PassGlobals(dockerStep, configs, &step, nil)
+
+	expectedMounts := []mount.Mount{
+		{Type: mount.TypeBind, Source: "/foo", Target: "/tmp", ReadOnly: false},
+		{Type: mount.TypeVolume, Source: "gocache", Target: "/root/.cache", ReadOnly: false},
+		{Type: mount.TypeVolume, Source: "gocache", Target: "/ignored", ReadOnly: true},
+		{Type: mount.TypeVolume, Source: "modcache", Target: "/go/pkg/mod", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(expectedMounts, dockerStep.ExtMounts) {
+		t.Errorf("expected: %v, got: %v", expectedMounts, dockerStep.ExtMounts)
+	}
+}
+
+func TestPassGlobalsWithCLIEnvs(t *testing.T) {
+	r := &Runner{Env: []string{"REGION=eu", "STAGE=prod"}}
+	dockerStep := &docker.Step{Task: "deploy", Env: []string{"STAGE=dev", "APP=dunner"}}
+	step := config.Step{Image: busyBoxImage}
+	tasks := map[string]config.Task{"deploy": {Steps: []config.Step{step}, Envs: []string{"REGION=us"}}}
+	configs := &config.Configs{Tasks: tasks}
+
+	if err := r.PassGlobals(dockerStep, configs, &step, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"REGION=eu", "STAGE=prod", "APP=dunner"}
+	if !reflect.DeepEqual(expected, dockerStep.Env) {
+		t.Errorf("expected envs: %v, got: %v", expected, dockerStep.Env)
+	}
+}
+
+func TestDoTasksWithInvalidCLIEnv(t *testing.T) {
+	r := &Runner{Env: []string{"STAGE"}}
+	defer stubExecStep(func(docker.Step) error {
+		t.Errorf("expected step not to be run")
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	err := r.doTasks(configs, "test", []string{})
+
+	expectedErr := "dunner: invalid environment variable 'STAGE', it must be of the form KEY=VALUE"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestDoTasksPassesContainerNameTemplate(t *testing.T) {
+	r := &Runner{NameTemplate: "ci-{task}-{step}-{run}"}
+	var settings []docker.Settings
+	defer stubExecStep(func(s docker.Step) error {
+		settings = append(settings, *s.Settings)
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step, step}}}}
+
+	if err := r.doTasks(configs, "test", []string{}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(settings) != 2 || settings[0].ContainerNameTemplate != r.NameTemplate || len(settings[0].RunID) != 6 || settings[0].RunID != settings[1].RunID {
+		t.Errorf("expected container name template and run ID shared by the steps, got: %+v", settings)
+	}
+
+	r.NameTemplate = "ci-{task}-{id}"
+	if err := r.doTasks(configs, "test", []string{}); err == nil {
+		t.Error("expected error of container name template with an unknown placeholder")
+	}
+}
+
+func TestExitCodeOfFailedStep(t *testing.T) {
+	defer stubExecStep(func(docker.Step) error {
+		return &docker.ExitError{Code: 42}
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"false"}, Retries: 1}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	if code := ExitCode(err); code != 42 {
+		t.Errorf("expected exit code 42, got %d", code)
+	}
+	expectedErr := "dunner: step failed after 2 attempts: docker: command execution failed with exit code 42"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error: %s, got: %s", expectedErr, err)
+	}
+}
+
+func TestExitCodeOfOtherErrors(t *testing.T) {
+	if code := ExitCode(nil); code != 0 {
+		t.Errorf("expected exit code 0 for no error, got %d", code)
+	}
+	if code := ExitCode(fmt.Errorf("dunner: task 'foo' does not exist")); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+}
+
+func TestMatchTasksWithGlob(t *testing.T) {
+	var content = []byte(`
+tasks:
+  test:unit:
+    steps:
+      - image: busybox
+  build:
+    steps:
+      - image: busybox
+  test:integration:
+    steps:
+      - image: busybox`)
+	tmpFile := createDunnerTaskFile(t, content, ".testdunner.yaml")
+	defer os.Remove(tmpFile.Name())
+	defer viper.Reset()
+	configs, err := config.GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := matchTasks(configs, "test:*")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{"test:unit", "test:integration"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected tasks: %v, got: %v", expected, got)
+	}
+}
+
+func TestMatchTasksWithoutGlob(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {}}}
+
+	got, err := matchTasks(configs, "build")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual([]string{"build"}, got) {
+		t.Errorf("expected tasks: [build], got: %v", got)
+	}
+}
+
+func TestMatchTasksWithNoMatch(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {}, "lint": {}}}
+
+	_, err := matchTasks(configs, "test:*")
+
+	expectedErr := "dunner: no task matches 'test:*', available tasks are: build, lint"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func followTasksConcurrency(t *testing.T, maxParallel int) int {
+	r := &Runner{MaxParallel: maxParallel}
+	var mu sync.Mutex
+	var running, maxRunning int
+	defer stubExecStep(func(docker.Step) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	tasks := map[string]config.Task{
+		"all":   {Steps: []config.Step{{Follow: "lint"}, {Follow: "test"}, {Follow: "build"}}},
+		"lint":  {Steps: []config.Step{step}},
+		"test":  {Steps: []config.Step{step}},
+		"build": {Steps: []config.Step{step}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := r.ExecTask(&configs, "all", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	return maxRunning
+}
+
+func TestExecTaskRunsFollowTasksInParallel(t *testing.T) {
+	if got := followTasksConcurrency(t, 2); got != 2 {
+		t.Errorf("expected 2 follow tasks to run at a time, got %d", got)
+	}
+	if got := followTasksConcurrency(t, 0); got != 3 {
+		t.Errorf("expected 3 follow tasks to run at a time, got %d", got)
+	}
+}
+
+func TestExecTaskRunsFollowTasksSeriallyByDefault(t *testing.T) {
+	if got := followTasksConcurrency(t, 1); got != 1 {
+		t.Errorf("expected 1 follow task to run at a time, got %d", got)
+	}
+}
+
+func TestExecTaskWaitsForFollowTasksBeforeNextStep(t *testing.T) {
+	r := &Runner{MaxParallel: 0}
+	var mu sync.Mutex
+	var order []string
+	defer stubExecStep(func(s docker.Step) error {
+		if s.Task != "all" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		mu.Lock()
+		order = append(order, s.Task)
+		mu.Unlock()
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	tasks := map[string]config.Task{
+		"all":  {Steps: []config.Step{{Follow: "lint"}, {Follow: "test"}, step}},
+		"lint": {Steps: []config.Step{step}},
+		"test": {Steps: []config.Step{step}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := r.ExecTask(&configs, "all", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(order) != 3 || order[2] != "all" {
+		t.Errorf("expected step of 'all' task to run after its follow tasks, got order: %v", order)
+	}
+}
+
+func TestExecTaskRunsFollowTaskOfDiamondOnce(t *testing.T) {
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	tasks := map[string]config.Task{
+		"all":   {Steps: []config.Step{{Follow: "lint"}, {Follow: "test"}, step}},
+		"lint":  {Steps: []config.Step{{Follow: "deps"}, step}},
+		"test":  {Steps: []config.Step{{Follow: "deps"}, step}},
+		"deps":  {Steps: []config.Step{step}},
+		"other": {Steps: []config.Step{step}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	for _, maxParallel := range []int{0, 1, 2} {
+		var mu sync.Mutex
+		var order []string
+		restore := stubExecStep(func(s docker.Step) error {
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			order = append(order, s.Task)
+			mu.Unlock()
+			return nil
+		})
+
+		err := (&Runner{MaxParallel: maxParallel}).ExecTask(&configs, "all", []string{}, nil)
+		restore()
+
+		if err != nil {
+			t.Fatalf("expected no error with --max-parallel=%d, got: %s", maxParallel, err)
+		}
+		if len(order) != 4 || order[0] != "deps" || order[3] != "all" {
+			t.Errorf("expected 'deps' task run once before 'lint' and 'test', and 'all' last with --max-parallel=%d, got order: %v", maxParallel, order)
+		}
+	}
+}
+
+func TestExecTaskRunsFollowTaskOfDependencyAndLaterStep(t *testing.T) {
+	var runs []string
+	defer stubExecStep(func(s docker.Step) error {
+		runs = append(runs, s.Task)
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	tasks := map[string]config.Task{
+		"all":   {Steps: []config.Step{{Follow: "build"}, {Follow: "clean"}}},
+		"build": {Steps: []config.Step{{Follow: "clean"}, step, {Follow: "clean"}}},
+		"clean": {Steps: []config.Step{step}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := (&Runner{MaxParallel: 1}).ExecTask(&configs, "all", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"clean", "build", "clean", "clean"}; !reflect.DeepEqual(expected, runs) {
+		t.Errorf("expected 'clean' task run for every step following it: %q, got: %q", expected, runs)
+	}
+}
+
+func TestExecTaskRunsFollowTaskForEveryStep(t *testing.T) {
+	var runs []string
+	defer stubExecStep(func(s docker.Step) error {
+		runs = append(runs, strings.Join(s.Command, " "))
+		return nil
+	})()
+	tasks := map[string]config.Task{
+		"all": {Steps: []config.Step{
+			{Follow: "echo", Args: []string{"a"}},
+			{Follow: "echo", Args: []string{"b"}},
+			{Follow: "echo", Args: []string{"a"}},
+			{Follow: "echo", Args: []string{"a"}, Envs: []string{"FOO=bar"}},
+		}},
+		"echo": {Steps: []config.Step{{Image: busyBoxImage, Command: []string{"echo", "$1"}}}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := (&Runner{MaxParallel: 1}).ExecTask(&configs, "all", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"echo a", "echo b", "echo a", "echo a"}; !reflect.DeepEqual(expected, runs) {
+		t.Errorf("expected 'echo' task run for every step following it: %q, got: %q", expected, runs)
+	}
+}
+
+func TestResolveStepPrefixesOutputInParallelMode(t *testing.T) {
+	r := &Runner{MaxParallel: 4}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage}
+
+	step, _, err := r.resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if step.OutputPrefix != "[test] " {
+		t.Errorf("expected output prefix: '[test] ', got: '%s'", step.OutputPrefix)
+	}
+}
+
+func TestResolveStepPrefixesOutputWithPrefix(t *testing.T) {
+	r := &Runner{MaxParallel: 4, Prefix: true}
+	configs := config.Configs{Tasks: map[string]config.Task{"build": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage}
+
+	step, _, err := r.resolveStep(&configs, "build", 2, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if step.OutputPrefix != "[build/2] " {
+		t.Errorf("expected output prefix: '[build/2] ', got: '%s'", step.OutputPrefix)
+	}
+}
+
+func TestExecTaskRunsOnlySelectedSteps(t *testing.T) {
+	r := &Runner{Only: []string{"unit"}}
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Task+"/"+s.Name)
+		return nil
+	})()
+	tasks := map[string]config.Task{
+		"test": {Steps: []config.Step{
+			{Name: "lint", Image: busyBoxImage, Command: []string{"ls"}},
+			{Name: "unit", Image: busyBoxImage, Command: []string{"ls"}},
+			{Name: "deps", Follow: "build"},
+		}},
+		"build": {Steps: []config.Step{{Name: "compile", Image: busyBoxImage, Command: []string{"ls"}}}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := r.ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"test/unit"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestResolveStepWithResourceLimits(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage, Memory: "512m", CPUs: 1.5}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if step.Memory != 512<<20 || step.CPUs != 1.5 {
+		t.Errorf("expected memory of 512m and 1.5 cpus, got memory: %d, cpus: %g", step.Memory, step.CPUs)
+	}
+}
+
+func TestResolveStepWithUlimits(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage, Ulimits: map[string]string{"nofile": "1024:65536", "nproc": "512"}}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []*units.Ulimit{{Name: "nofile", Soft: 1024, Hard: 65536}, {Name: "nproc", Soft: 512, Hard: 512}}
+	if !reflect.DeepEqual(expected, step.Ulimits) {
+		t.Errorf("expected ulimits: %v, got: %v", expected, step.Ulimits)
+	}
+}
+
+func TestResolveStepWithSysctls(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	sysctls := map[string]string{"net.core.somaxconn": "1024"}
+	stepDefinition := config.Step{Image: busyBoxImage, Sysctls: sysctls}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual(sysctls, step.Sysctls) {
+		t.Errorf("expected sysctls: %v, got: %v", sysctls, step.Sysctls)
+	}
+}
+
+func TestResolveStepWithExtraHosts(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage, ExtraHosts: []string{"myhost:10.0.0.5"}}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual([]string{"myhost:10.0.0.5"}, step.ExtraHosts) {
+		t.Errorf("expected extra hosts: [myhost:10.0.0.5], got: %v", step.ExtraHosts)
+	}
+}
+
+func TestResolveStepWithDNS(t *testing.T) {
+	task := config.Task{DNS: []string{"10.0.0.3"}}
+	configs := config.Configs{DNS: []string{"10.0.0.2"}, DNSSearch: []string{"corp.internal"}, Tasks: map[string]config.Task{"test": task}}
+	tests := []struct {
+		step              []string
+		parent            *config.Step
+		expected          []string
+		expectedSearching []string
+	}{
+		{nil, nil, []string{"10.0.0.3"}, []string{"corp.internal"}},
+		{nil, &config.Step{DNS: []string{"10.0.0.4"}, DNSSearch: []string{"ci.internal"}}, []string{"10.0.0.4"}, []string{"ci.internal"}},
+		{[]string{"10.0.0.5", "10.0.0.6"}, &config.Step{DNS: []string{"10.0.0.4"}}, []string{"10.0.0.5", "10.0.0.6"}, []string{"corp.internal"}},
+	}
+	for _, test := range tests {
+		stepDefinition := config.Step{Image: busyBoxImage, DNS: test.step}
+
+		step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, test.parent, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if !reflect.DeepEqual(step.DNS, test.expected) || !reflect.DeepEqual(step.DNSSearch, test.expectedSearching) {
+			t.Errorf("expected DNS servers: %v and search domains: %v, got: %v and %v", test.expected, test.expectedSearching, step.DNS, step.DNSSearch)
+		}
+	}
+}
+
+func TestResolveStepWithPullPolicy(t *testing.T) {
+	configs := config.Configs{PullPolicy: docker.PullNever, Tasks: map[string]config.Task{"test": {}}}
+	for stepPolicy, expected := range map[string]string{"": docker.PullNever, docker.PullAlways: docker.PullAlways} {
+		stepDefinition := config.Step{Image: busyBoxImage, PullPolicy: stepPolicy}
+
+		step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if step.PullPolicy != expected {
+			t.Errorf("expected pull policy: %s, got: %s", expected, step.PullPolicy)
+		}
+	}
+}
+
+func TestResolveStepWithEntrypoint(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	for entrypoint, expected := range map[string][]string{"sh -c": {"sh", "-c"}, "": {}} {
+		entrypoint := entrypoint
+		stepDefinition := config.Step{Image: busyBoxImage, Entrypoint: &entrypoint, Command: []string{"echo $1"}}
+
+		step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if !reflect.DeepEqual(expected, step.Entrypoint) {
+			t.Errorf("expected entrypoint: %#v, got: %#v", expected, step.Entrypoint)
+		}
+	}
+}
+
+func TestResolveStepWithoutEntrypoint(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if step.Entrypoint != nil {
+		t.Errorf("expected entrypoint of the image to be kept, got: %#v", step.Entrypoint)
+	}
+}
+
+func TestPassArgsDoesNotChangeEntrypoint(t *testing.T) {
+	step := &docker.Step{Entrypoint: []string{"sh", "$1"}, Command: []string{"echo", "$1"}}
+
+	if err := PassArgs(step, &[]string{"hi"}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual([]string{"sh", "$1"}, step.Entrypoint) || !reflect.DeepEqual([]string{"echo", "hi"}, step.Command) {
+		t.Errorf("expected arguments passed only to command, got entrypoint: %v, command: %v", step.Entrypoint, step.Command)
+	}
+}
+
+func TestExecTaskLogsStepDescriptionAtDebugLevel(t *testing.T) {
+	r := &Runner{Verbose: true}
+	var buf bytes.Buffer
+	defer func(out io.Writer) { log.Out = out }(log.Out)
+	log.Out = &buf
+	defer func(level logrus.Level) { log.Level = level }(log.Level)
+	log.Level = logrus.DebugLevel
+	defer stubExecStep(func(docker.Step) error { return nil })()
+	step := config.Step{Name: "unit", Description: "Runs the unit tests", Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	if err := r.ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := "Running task 'test', step 'unit': Runs the unit tests"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected logs to contain: %s, got: %s", expected, buf.String())
+	}
+
+	buf.Reset()
+	log.Level = logrus.InfoLevel
+	if err := r.ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if strings.Contains(buf.String(), expected) {
+		t.Errorf("expected logs not to contain the description at info level, got: %s", buf.String())
+	}
+}
+
+func TestResolveStepWithPrivileged(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Image: "docker:dind", Privileged: true}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !step.Privileged {
+		t.Error("expected step to run a privileged container")
+	}
+}
+
+func TestResolveStepWithPrivilegedDisabled(t *testing.T) {
+	r := &Runner{NoPrivileged: true}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Name: "dind", Image: "docker:dind", Privileged: true}
+
+	_, _, err := r.resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	expectedErr := "dunner: task 'test', step 'dind' runs a privileged container, which is disabled with --no-privileged"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestResolveStepWithKeepContainer(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	for _, test := range []struct {
+		runner   *Runner
+		step     config.Step
+		expected bool
+	}{
+		{new(Runner), config.Step{Image: busyBoxImage}, false},
+		{new(Runner), config.Step{Image: busyBoxImage, KeepContainer: true}, true},
+		{&Runner{KeepContainers: true}, config.Step{Image: busyBoxImage}, true},
+	} {
+		step, _, err := test.runner.resolveStep(&configs, "test", 1, &test.step, nil, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if step.KeepContainer != test.expected {
+			t.Errorf("expected container kept to be %t with --keep-containers=%t, got: %t", test.expected, test.runner.KeepContainers, step.KeepContainer)
+		}
+	}
+}
+
+func TestResolveStepWithInit(t *testing.T) {
+	enabled, disabled := true, false
+	for _, test := range []struct {
+		runner   *Runner
+		configs  config.Configs
+		init     *bool
+		expected bool
+	}{
+		{new(Runner), config.Configs{}, nil, false},
+		{new(Runner), config.Configs{}, &enabled, true},
+		{new(Runner), config.Configs{Init: true}, nil, true},
+		{&Runner{Init: true}, config.Configs{}, nil, true},
+		{&Runner{Init: true}, config.Configs{Init: true}, &disabled, false},
+	} {
+		test.configs.Tasks = map[string]config.Task{"test": {}}
+		stepDefinition := config.Step{Image: busyBoxImage, Init: test.init}
+
+		step, _, err := test.runner.resolveStep(&test.configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if step.Init != test.expected {
+			t.Errorf("expected init to be %t with --init=%t and init of the task file %t, got: %t", test.expected, test.runner.Init, test.configs.Init, step.Init)
+		}
+	}
+}
+
+func TestResolveStepWithArgsInEnvsAndMounts(t *testing.T) {
+	r := &Runner{Args: []string{"tag=v1"}, Env: []string{"RAW=$1"}}
+	configs := config.Configs{
+		Envs:  []string{"TASK=${DUNNER_TASK}"},
+		Tasks: map[string]config.Task{"build": {Envs: []string{"VERSION=${tag}"}}},
+	}
+	stepDefinition := config.Step{Image: busyBoxImage, Envs: []string{"OUT=$1", "HOME_DIR=$${HOME}"}, Mounts: []string{"$1:/${tag}:w"}}
+
+	step, _, err := r.resolveStep(&configs, "build", 1, &stepDefinition, nil, []string{"/tmp/out"}, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, expected := range []string{"RAW=$1", "OUT=/tmp/out", "HOME_DIR=${HOME}", "VERSION=v1", "TASK=build"} {
+		var found bool
+		for _, env := range step.Env {
+			found = found || env == expected
+		}
+		if !found {
+			t.Errorf("expected environment variables to contain %s, got: %v", expected, step.Env)
+		}
+	}
+	expectedMount := mount.Mount{Type: mount.TypeBind, Source: "/tmp/out", Target: "/v1"}
+	if len(step.ExtMounts) != 1 || !reflect.DeepEqual(step.ExtMounts[0], expectedMount) {
+		t.Errorf("expected mounts: %v, got: %v", []mount.Mount{expectedMount}, step.ExtMounts)
+	}
+}
+
+func TestResolveStepWithArgsInEnvsOfLoadedTaskFile(t *testing.T) {
+	defer viper.Reset()
+	contents := `envs: ["TASK=${DUNNER_TASK}"]
+tasks:
+  build:
+    args: [{name: target}]
+    envs: ["VERSION=${tag}", "IMAGE=app:$VERSION"]
+    steps:
+      - image: busybox
+        envs: ["OUT=${target}", "HOME_DIR=$${HOME}"]
+`
+	tmpFile := createDunnerTaskFile(t, []byte(contents), ".dunner.yaml")
+	defer os.Remove(tmpFile.Name())
+	configs, err := config.GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("expected no error loading the task file, got: %s", err)
+	}
+	stepDefinition := configs.Tasks["build"].Steps[0]
+
+	// The named arguments are those of the runner, as for a library caller, not those of the command line
+	step, _, err := (&Runner{Args: []string{"tag=v1"}}).resolveStep(configs, "build", 1, &stepDefinition, nil, []string{"linux"}, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, expected := range []string{"TASK=build", "VERSION=v1", "IMAGE=app:v1", "OUT=linux", "HOME_DIR=${HOME}"} {
+		if !contains(step.Env, expected) {
+			t.Errorf("expected environment variables to contain %s, got: %v", expected, step.Env)
+		}
+	}
+}
+
+func TestResolveStepWithInvalidMountOfArgs(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"build": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage, Mounts: []string{"/tmp:/out:$1"}}
+
+	_, _, err := new(Runner).resolveStep(&configs, "build", 1, &stepDefinition, nil, []string{"bogus"}, nil)
+
+	expected := "config: invalid mount '/tmp:/out:bogus': unknown option 'bogus'"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestResolveStepWithMissingArgsInEnvsAndMounts(t *testing.T) {
+	for _, stepDefinition := range []config.Step{
+		{Image: busyBoxImage, Envs: []string{"OUT=$1"}},
+		{Image: busyBoxImage, Mounts: []string{"$1:/out"}},
+	} {
+		configs := config.Configs{Tasks: map[string]config.Task{"build": {}}}
+
+		_, _, err := new(Runner).resolveStep(&configs, "build", 1, &stepDefinition, nil, nil, nil)
+
+		expected := "dunner: insufficient number of arguments passed"
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error: %s, got: %v", expected, err)
+		}
+	}
+}
+
+func TestPassArgsWithNamedArgs(t *testing.T) {
+	r := &Runner{Args: []string{"env=staging", "region=eu"}}
+	step := docker.Step{Commands: [][]string{{"deploy", "--env=${env}", "$1"}, {"echo", "${region}", "$${HOME}"}}}
+
+	if err := r.PassArgs(&step, &[]string{"app"}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := [][]string{{"deploy", "--env=staging", "app"}, {"echo", "eu", "${HOME}"}}
+	if !reflect.DeepEqual(expected, step.Commands) {
+		t.Errorf("expected commands: %v, got: %v", expected, step.Commands)
+	}
+}
+
+func TestPassArgsWithMissingNamedArg(t *testing.T) {
+	defer viper.Reset()
+	step := docker.Step{Command: []string{"deploy", "${env}"}, DeclaredArgs: []string{"env"}}
+
+	err := PassArgs(&step, &[]string{})
+
+	expectedErr := "dunner: named argument 'env' is not passed, pass it with --arg env=<value>"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestPassArgsWithInvalidNamedArg(t *testing.T) {
+	r := &Runner{Args: []string{"staging"}}
+	step := docker.Step{Command: []string{"deploy"}}
+
+	err := r.PassArgs(&step, &[]string{})
+
+	expectedErr := "dunner: invalid argument 'staging', named arguments must be of the form name=value"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestPassArgsWithDefaultValues(t *testing.T) {
+	r := &Runner{Args: []string{"env=staging"}}
+	step := docker.Step{Command: []string{"deploy", "${1:-/default/path}", "${2:-latest}", "${env:-dev}", "${region:-eu}"}, DeclaredArgs: []string{"src", "region"}}
+
+	if err := r.PassArgs(&step, &[]string{"/src"}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"deploy", "/src", "latest", "staging", "eu"}
+	if !reflect.DeepEqual(expected, step.Command) {
+		t.Errorf("expected command: %v, got: %v", expected, step.Command)
+	}
+}
+
+func TestPassArgsWithDeclaredArgs(t *testing.T) {
+	step := docker.Step{Command: []string{"deploy", "${env}", "${region:-eu}"}, DeclaredArgs: []string{"env", "region"}}
+
+	if err := PassArgs(&step, &[]string{"staging"}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"deploy", "staging", "eu"}
+	if !reflect.DeepEqual(expected, step.Command) {
+		t.Errorf("expected command: %v, got: %v", expected, step.Command)
+	}
+}
+
+func TestPrintPlanLeavesShellVariables(t *testing.T) {
+	defer viper.Reset()
+	file, err := ioutil.TempFile("", ".dunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	contents := `tasks:
+  test:
+    steps:
+      - image: busybox
+        envs: ["FOO=bar"]
+        command: ["sh", "-c", "echo ${FOO} ${HOME} ${PATH:-/bin} $${FOO}"]
+`
+	if _, err := file.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	configs, err := config.GetConfigs(file.Name())
+	if err != nil {
+		t.Fatalf("expected no error loading the task file, got: %s", err)
+	}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "test", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := "sh -c echo ${FOO} ${HOME} ${PATH:-/bin} ${FOO}\n"; !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPassArgsWithoutDefaultValue(t *testing.T) {
+	step := docker.Step{Commands: [][]string{{"ls", "${1:-/}"}, {"ls", "${2}"}}}
+
+	err := PassArgs(&step, &[]string{})
+
+	expectedErr := "dunner: insufficient number of arguments passed"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExecTaskContinuesOnError(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		switch s.Name {
+		case "test":
+			return &docker.ExitError{Code: 3}
+		case "lint":
+			return &docker.ExitError{Code: 4}
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "test", Image: busyBoxImage, Command: []string{"false"}, ContinueOnError: true},
+		{Name: "lint", Image: busyBoxImage, Command: []string{"false"}, ContinueOnError: true},
+		{Name: "cleanup", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	err := ExecTask(&configs, "ci", []string{}, nil)
+
+	if expected := []string{"test", "lint", "cleanup"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+	expectedErr := "docker: command execution failed with exit code 3; docker: command execution failed with exit code 4"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+	if ExitCode(err) != 3 {
+		t.Errorf("expected exit code of the first failed step, got: %d", ExitCode(err))
+	}
+}
+
+func TestExecTaskStopsOnErrorWithoutContinueOnError(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		return &docker.ExitError{Code: 1}
+	})()
+	steps := []config.Step{
+		{Name: "test", Image: busyBoxImage, Command: []string{"false"}, ContinueOnError: true},
+		{Name: "build", Image: busyBoxImage, Command: []string{"false"}},
+		{Name: "deploy", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	err := ExecTask(&configs, "ci", []string{}, nil)
+
+	if expected := []string{"test", "build"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+	if errs, ok := err.(stepErrors); !ok || len(errs) != 2 {
+		t.Fatalf("expected errors of both failed steps, got: %v", err)
+	}
+}
+
+func TestExecTaskContinuesAfterFollowTaskWithContinueOnError(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Task)
+		if s.Task == "lint" {
+			return &docker.ExitError{Code: 2}
+		}
+		return nil
+	})()
+	tasks := map[string]config.Task{
+		"ci":   {Steps: []config.Step{{Follow: "lint", ContinueOnError: true}, {Image: busyBoxImage, Command: []string{"ls"}}}},
+		"lint": {Steps: []config.Step{{Image: busyBoxImage, Command: []string{"false"}}}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	err := ExecTask(&configs, "ci", []string{}, nil)
+
+	if expected := []string{"lint", "ci"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected tasks run: %v, got: %v", expected, ran)
+	}
+	if ExitCode(err) != 2 {
+		t.Errorf("expected task to fail with exit code of the follow task, got: %v", err)
+	}
+}
+
+func TestExecTaskRunsAlwaysStepsAfterFailure(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		switch s.Name {
+		case "test":
+			return &docker.ExitError{Code: 3}
+		case "teardown":
+			return &docker.ExitError{Code: 5}
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "start", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "test", Image: busyBoxImage, Command: []string{"false"}},
+		{Name: "report", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "teardown", Image: busyBoxImage, Command: []string{"ls"}, Always: true},
+		{Name: "logs", Image: busyBoxImage, Command: []string{"ls"}, Always: true},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	err := ExecTask(&configs, "ci", []string{}, nil)
+
+	if expected := []string{"start", "test", "teardown", "logs"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+	expectedErr := "docker: command execution failed with exit code 3"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error of the first failed step: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExecTaskAsyncRunsAlwaysStepsNeedingFailedStep(t *testing.T) {
+	r := &Runner{Async: true}
+	var mu sync.Mutex
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, s.Name)
+		if s.Name == "test" {
+			return &docker.ExitError{Code: 1}
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "test", Image: busyBoxImage, Command: []string{"false"}},
+		{Name: "teardown", Image: busyBoxImage, Command: []string{"ls"}, Needs: []string{"test"}, Always: true},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	err := r.ExecTask(&configs, "ci", []string{}, nil)
+
+	if ExitCode(err) != 1 {
+		t.Fatalf("expected error of the failed step, got: %v", err)
+	}
+	if expected := []string{"test", "teardown"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskPassesBuiltinEnvs(t *testing.T) {
+	var mu sync.Mutex
+	var envs [][]string
+	var commands []string
+	defer stubExecStep(func(s docker.Step) error {
+		mu.Lock()
+		defer mu.Unlock()
+		envs = append(envs, s.Env)
+		commands = append(commands, strings.Join(s.Command, " "))
+		return nil
+	})()
+	tasks := map[string]config.Task{
+		"all": {Steps: []config.Step{
+			{Name: "build", Image: busyBoxImage, Command: []string{"echo", "${DUNNER_TASK}"}},
+			{Follow: "test"},
+		}},
+		"test": {Steps: []config.Step{
+			{Name: "unit", Image: busyBoxImage, Command: []string{"echo", "${DUNNER_STEP}"}},
+		}},
+	}
+	configs := config.Configs{Tasks: tasks}
+
+	if err := ExecTask(&configs, "all", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := [][]string{
+		{"DUNNER_TASK=all", "DUNNER_STEP=build", "DUNNER_STEP_INDEX=1", "DUNNER_ENV=/.dunner_env"},
+		{"DUNNER_TASK=test", "DUNNER_STEP=unit", "DUNNER_STEP_INDEX=1", "DUNNER_ENV=/.dunner_env"},
+	}
+	if len(envs) != len(expected) {
+		t.Fatalf("expected %d steps to run, got %d", len(expected), len(envs))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(envs[i], expected[i]) {
+			t.Errorf("expected environment variables %v, got %v", expected[i], envs[i])
+		}
+	}
+	if expected := []string{"echo all", "echo unit"}; !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected commands %v, got %v", expected, commands)
+	}
+}
+
+func TestResolveStepWithOverriddenBuiltinEnv(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Name: "build", Image: busyBoxImage, Envs: []string{"DUNNER_STEP=custom"}}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 2, &stepDefinition, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{"DUNNER_STEP=custom", "DUNNER_TASK=test", "DUNNER_STEP_INDEX=2"}
+	if !reflect.DeepEqual(step.Env, expected) {
+		t.Errorf("expected environment variables %v, got %v", expected, step.Env)
+	}
+}
+
+func TestPassGlobalsMergesLabels(t *testing.T) {
+	dockerStep := &docker.Step{Task: "build", Name: "compile"}
+	step := config.Step{Image: busyBoxImage, Labels: map[string]string{"team": "step", "dunner.step": "custom"}}
+	followStep := config.Step{Follow: "build", Labels: map[string]string{"stage": "follow"}}
+	tasks := map[string]config.Task{
+		"build": {Steps: []config.Step{step}, Labels: map[string]string{"team": "task", "stage": "task", "owner": "task"}},
+	}
+	configs := &config.Configs{Tasks: tasks, Labels: map[string]string{"owner": "global", "project": "dunner"}}
+
+	if err := PassGlobals(dockerStep, configs, &step, &followStep); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := map[string]string{
+		"dunner.task": "build",
+		"dunner.step": "custom",
+		"team":        "step",
+		"stage":       "follow",
+		"owner":       "task",
+		"project":     "dunner",
+	}
+	if !reflect.DeepEqual(dockerStep.Labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, dockerStep.Labels)
+	}
+}
+
+func TestPassGlobalsSetsBuiltinLabels(t *testing.T) {
+	dockerStep := &docker.Step{Task: "build"}
+	step := config.Step{Image: busyBoxImage}
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {Steps: []config.Step{step}}}}
+
+	if err := PassGlobals(dockerStep, configs, &step, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := map[string]string{"dunner.task": "build"}
+	if !reflect.DeepEqual(dockerStep.Labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, dockerStep.Labels)
+	}
+}
+
+func TestResolveStepWithRegistry(t *testing.T) {
+	configs := config.Configs{Registry: "mirror.internal", Tasks: map[string]config.Task{"test": {}}}
+	for flag, expected := range map[string]string{"": "mirror.internal", "flag.internal": "flag.internal"} {
+		r := &Runner{Registry: flag}
+		stepDefinition := config.Step{Image: busyBoxImage}
+
+		step, _, err := r.resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if step.Registry != expected {
+			t.Errorf("expected registry: %s, got: %s", expected, step.Registry)
+		}
+	}
+}
+
+func TestResolveStepWithStdin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(dir+"/input.sql", []byte("SELECT 1;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	taskFile := dir + "/.dunner.yaml"
+	if err := ioutil.WriteFile(taskFile, []byte("tasks:\n  db:\n    steps:\n      - image: busybox\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := config.GetConfigs(taskFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for stdin, expected := range map[string]string{"@input.sql": "SELECT 1;\n", "@@input": "@input", "plain": "plain"} {
+		stepDefinition := config.Step{Image: busyBoxImage, Stdin: stdin}
+
+		step, _, err := new(Runner).resolveStep(configs, "db", 1, &stepDefinition, nil, nil, nil)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if step.Stdin != expected {
+			t.Errorf("expected stdin of '%s' to be %q, got: %q", stdin, expected, step.Stdin)
+		}
+	}
+}
+
+func TestResolveStepWithMissingStdinFile(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"db": {}}}
+	stepDefinition := config.Step{Image: busyBoxImage, Stdin: "@/nonexistent/input.sql"}
+
+	_, _, err := new(Runner).resolveStep(&configs, "db", 1, &stepDefinition, nil, nil, nil)
+
+	expected := "dunner: failed to read stdin file /nonexistent/input.sql"
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("expected error starting with: %s, got: %v", expected, err)
+	}
+}
+
+func conditionalFollowConfigs() config.Configs {
+	step := func(name string) config.Step {
+		return config.Step{Name: name, Image: busyBoxImage, Command: []string{"ls"}}
+	}
+	return config.Configs{Tasks: map[string]config.Task{
+		"ci": {Steps: []config.Step{
+			step("build"),
+			{Follow: "notify", On: config.FollowOnFailure},
+			{Follow: "deploy"},
+			{Follow: "report", On: config.FollowOnAlways},
+		}},
+		"notify": {Steps: []config.Step{step("notify")}},
+		"deploy": {Steps: []config.Step{step("deploy")}},
+		"report": {Steps: []config.Step{step("report")}},
+	}}
+}
+
+func TestExecTaskRunsFollowTasksOnSuccess(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		return nil
+	})()
+	configs := conditionalFollowConfigs()
+
+	if err := ExecTask(&configs, "ci", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"build", "deploy", "report"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskRunsFollowTasksOnFailure(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		if s.Name == "build" {
+			return &docker.ExitError{Code: 2}
+		}
+		return nil
+	})()
+	configs := conditionalFollowConfigs()
+
+	err := ExecTask(&configs, "ci", []string{}, nil)
+
+	if expected := []string{"build", "notify", "report"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+	expectedErr := "docker: command execution failed with exit code 2"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error of the failed step: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExecTaskRunsConditionalFollowAfterPreviousFollowTasks(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Task)
+		if s.Task == "deploy" {
+			return &docker.ExitError{Code: 1}
+		}
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{
+		"ci":     {Steps: []config.Step{{Follow: "deploy"}, {Follow: "notify", On: config.FollowOnFailure}}},
+		"deploy": {Steps: []config.Step{step}},
+		"notify": {Steps: []config.Step{step}},
+	}}
+
+	ExecTask(&configs, "ci", []string{}, nil)
+
+	if expected := []string{"deploy", "notify"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected tasks run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskAsyncRunsFollowTasksOnFailureOfNeededSteps(t *testing.T) {
+	r := &Runner{Async: true}
+	var mu sync.Mutex
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, s.Task)
+		if s.Task == "ci" {
+			return &docker.ExitError{Code: 1}
+		}
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	steps := []config.Step{
+		{Name: "test", Image: busyBoxImage, Command: []string{"false"}},
+		{Name: "lint", Image: busyBoxImage, Command: []string{"false"}, Needs: []string{"test"}, Always: true},
+		{Follow: "notify", On: config.FollowOnFailure, Needs: []string{"lint"}},
+		{Follow: "deploy", On: config.FollowOnFailure},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{
+		"ci":     {Steps: steps},
+		"notify": {Steps: []config.Step{step}},
+		"deploy": {Steps: []config.Step{step}},
+	}}
+
+	r.ExecTask(&configs, "ci", []string{}, nil)
+
+	if expected := []string{"ci", "ci", "notify"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected tasks run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskRunsHooksAroundTask(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name+":"+s.Task)
+		return nil
+	})()
+	configs := config.Configs{
+		Before: []config.Step{{Name: "notify", Image: busyBoxImage, Command: []string{"ls"}}},
+		After:  []config.Step{{Name: "report", Image: busyBoxImage, Command: []string{"ls"}}},
+		Tasks: map[string]config.Task{
+			"test":  {Steps: []config.Step{{Name: "run", Image: busyBoxImage, Command: []string{"ls"}}, {Follow: "build"}}},
+			"build": {Steps: []config.Step{{Name: "build", Image: busyBoxImage, Command: []string{"ls"}}}},
+		},
+	}
+
+	if err := ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"notify:test", "run:test", "build:build", "report:test"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskDoesNotRunTaskAfterFailedBeforeHook(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		if s.Name == "notify" {
+			return &docker.ExitError{Code: 2}
+		}
+		return nil
+	})()
+	configs := config.Configs{
+		Before: []config.Step{{Name: "notify", Image: busyBoxImage, Command: []string{"ls"}}},
+		After:  []config.Step{{Name: "report", Image: busyBoxImage, Command: []string{"ls"}}},
+		Tasks:  map[string]config.Task{"test": {Steps: []config.Step{{Name: "run", Image: busyBoxImage, Command: []string{"ls"}}}}},
+	}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	expectedErr := "dunner: before hook of 'test' task failed: docker: command execution failed with exit code 2"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+	if ExitCode(err) != 2 {
+		t.Errorf("expected exit code 2, got: %d", ExitCode(err))
+	}
+	if expected := []string{"notify"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskRunsAfterHookAfterFailedTask(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		if s.Name == "run" {
+			return &docker.ExitError{Code: 3}
+		}
+		return nil
+	})()
+	configs := config.Configs{
+		After: []config.Step{{Name: "report", Image: busyBoxImage, Command: []string{"ls"}}},
+		Tasks: map[string]config.Task{"test": {Steps: []config.Step{{Name: "run", Image: busyBoxImage, Command: []string{"ls"}}}}},
+	}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	if ExitCode(err) != 3 {
+		t.Fatalf("expected error of failed step, got: %v", err)
+	}
+	if expected := []string{"run", "report"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestExecTaskReportsFailedAfterHook(t *testing.T) {
+	defer stubExecStep(func(s docker.Step) error {
+		if s.Name == "report" {
+			return &docker.ExitError{Code: 4}
+		}
+		return nil
+	})()
+	configs := config.Configs{
+		After: []config.Step{{Name: "report", Image: busyBoxImage, Command: []string{"ls"}}},
+		Tasks: map[string]config.Task{"test": {Steps: []config.Step{{Name: "run", Image: busyBoxImage, Command: []string{"ls"}}}}},
+	}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	expectedErr := "dunner: after hook of 'test' task failed: docker: command execution failed with exit code 4"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExecTaskWithNoHooks(t *testing.T) {
+	r := &Runner{NoHooks: true}
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		return nil
+	})()
+	configs := config.Configs{
+		Before: []config.Step{{Name: "notify", Image: busyBoxImage, Command: []string{"ls"}}},
+		After:  []config.Step{{Name: "report", Image: busyBoxImage, Command: []string{"ls"}}},
+		Tasks:  map[string]config.Task{"test": {Steps: []config.Step{{Name: "run", Image: busyBoxImage, Command: []string{"ls"}}}}},
+	}
+
+	if err := r.ExecTask(&configs, "test", []string{}, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"run"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected steps run: %v, got: %v", expected, ran)
+	}
+}
+
+func TestDoTasksStopsAtFirstFailedTaskWithFailFast(t *testing.T) {
+	r := &Runner{FailFast: true, NoSummary: true}
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Task)
+		return &docker.ExitError{Code: 2}
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{
+		"test:unit": {Steps: []config.Step{step}},
+		"test:e2e":  {Steps: []config.Step{step}},
+	}}
+
+	err := r.doTasks(&configs, "test:*", []string{})
+
+	if ExitCode(err) != 2 {
+		t.Fatalf("expected error of failed step, got: %v", err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("expected one task to run, got: %v", ran)
+	}
+}
+
+func TestDoTasksRunsAllTasksWithoutFailFast(t *testing.T) {
+	r := &Runner{FailFast: false, NoSummary: true}
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Task)
+		if s.Task != "test:lint" {
+			return &docker.ExitError{Code: 3}
+		}
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{
+		"test:unit": {Steps: []config.Step{step}},
+		"test:lint": {Steps: []config.Step{step}},
+		"test:e2e":  {Steps: []config.Step{step}},
+	}}
+
+	err := r.doTasks(&configs, "test:*", []string{})
+
+	if len(ran) != 3 {
+		t.Errorf("expected all tasks to run, got: %v", ran)
+	}
+	expectedErr := "dunner: 2 of 3 tasks failed: test:e2e, test:unit"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+	if ExitCode(err) != 3 {
+		t.Errorf("expected exit code 3, got: %d", ExitCode(err))
+	}
+}
+
+func TestPassGlobalsWithInheritedEnvs(t *testing.T) {
+	for name, value := range map[string]string{"DUNNER_TEST_CI": "true", "DUNNER_TEST_HOME": "/home/dunner", "DUNNER_TEST_REGION": "us"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	dockerStep := &docker.Step{Task: "deploy", Env: []string{"APP=dunner"}}
+	step := config.Step{Image: busyBoxImage}
+	tasks := map[string]config.Task{"deploy": {
+		Steps:      []config.Step{step},
+		Envs:       []string{"DUNNER_TEST_CI=false"},
+		InheritEnv: []string{"DUNNER_TEST_CI", "DUNNER_TEST_REGION", "DUNNER_TEST_MISSING"},
+	}}
+	configs := &config.Configs{Tasks: tasks, Envs: []string{"DUNNER_TEST_REGION=eu"}, InheritEnv: []string{"DUNNER_TEST_HOME"}}
+
+	if err := PassGlobals(dockerStep, configs, &step, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"APP=dunner", "DUNNER_TEST_CI=false", "DUNNER_TEST_REGION=us", "DUNNER_TEST_HOME=/home/dunner"}
+	if !reflect.DeepEqual(expected, dockerStep.Env) {
+		t.Errorf("expected envs: %v, got: %v", expected, dockerStep.Env)
+	}
+}
+
+func TestPassGlobalsWithMissingRequiredInheritedEnv(t *testing.T) {
+	os.Unsetenv("DUNNER_TEST_MISSING")
+	step := config.Step{Image: busyBoxImage}
+	tasks := map[string]config.Task{"deploy": {Steps: []config.Step{step}, InheritEnv: []string{"DUNNER_TEST_MISSING!"}}}
+	configs := &config.Configs{Tasks: tasks}
+
+	err := PassGlobals(&docker.Step{Task: "deploy"}, configs, &step, nil)
+
+	expectedErr := "dunner: host environment variable 'DUNNER_TEST_MISSING' inherited by task 'deploy' is not set"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestResolveStepInteractiveInAsyncMode(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"debug": {}}}
+	stepDefinition := config.Step{Name: "shell", Image: busyBoxImage, Command: []string{"sh"}, Interactive: true}
+
+	step, _, err := new(Runner).resolveStep(&configs, "debug", 1, &stepDefinition, nil, nil, nil)
+	if err != nil || !step.Interactive {
+		t.Fatalf("expected interactive step, got: %v, error: %v", step, err)
+	}
+
+	_, _, err = (&Runner{Async: true}).resolveStep(&configs, "debug", 1, &stepDefinition, nil, nil, nil)
+
+	expectedErr := "dunner: task 'debug', step 'shell' is interactive, it cannot be run in asynchronous mode"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
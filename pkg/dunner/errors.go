@@ -0,0 +1,162 @@
+package dunner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// continuedError is the error of a step with `continueOnError` which failed with a non-zero exit code,
+// after which the task goes on.
+type continuedError struct {
+	err error
+}
+
+func (e *continuedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *continuedError) Unwrap() error {
+	return e.err
+}
+
+// Hooks of the task file, run around every task invoked from the command line
+const (
+	beforeHook = "before"
+	afterHook  = "after"
+)
+
+// hookError is the error of a step of a `before` or `after` hook, told apart from the errors of the task itself.
+type hookError struct {
+	hook string
+	task string
+	err  error
+}
+
+func (e *hookError) Error() string {
+	return fmt.Sprintf("dunner: %s hook of '%s' task failed: %s", e.hook, e.task, e.err.Error())
+}
+
+func (e *hookError) Unwrap() error {
+	return e.err
+}
+
+// runTimeoutError is the error of a run stopped by `--timeout`, told apart from the timeouts of steps.
+type runTimeoutError struct {
+	timeout time.Duration
+	err     error // Error of the steps stopped by the timeout
+}
+
+func (e *runTimeoutError) Error() string {
+	return fmt.Sprintf("dunner: run timed out after %s, the running steps were stopped", e.timeout)
+}
+
+func (e *runTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// taskErrors is the error of a run of many tasks with --fail-fast=false, of which some failed.
+type taskErrors struct {
+	tasks []string // Names of the failed tasks
+	errs  []error  // Errors of the failed tasks
+	total int      // Number of tasks run
+}
+
+func (e *taskErrors) Error() string {
+	return fmt.Sprintf("dunner: %d of %d tasks failed: %s", len(e.tasks), e.total, strings.Join(e.tasks, ", "))
+}
+
+// As finds the first of the errors of the tasks that matches target, so that the exit code is of the first failure
+func (e *taskErrors) As(target interface{}) bool {
+	return stepErrors(e.errs).As(target)
+}
+
+// Is reports whether any of the errors of the tasks matches target
+func (e *taskErrors) Is(target error) bool {
+	return stepErrors(e.errs).Is(target)
+}
+
+// matrixErrors is the error of a task with a matrix, of which some combinations failed.
+type matrixErrors struct {
+	task         string
+	combinations []string // The failed combinations, like `GO_VERSION=1.12 OS=linux`
+	errs         []error  // Errors of the failed combinations
+	total        int      // Number of combinations run
+}
+
+func (e *matrixErrors) Error() string {
+	failures := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		failures[i] = fmt.Sprintf("[%s] %s", e.combinations[i], err.Error())
+	}
+	return fmt.Sprintf("dunner: %d of %d combinations of '%s' task failed: %s", len(e.errs), e.total, e.task, strings.Join(failures, "; "))
+}
+
+// As finds the first of the errors of the combinations that matches target, so that the exit code is of the first
+// failure
+func (e *matrixErrors) As(target interface{}) bool {
+	return stepErrors(e.errs).As(target)
+}
+
+// Is reports whether any of the errors of the combinations matches target
+func (e *matrixErrors) Is(target error) bool {
+	return stepErrors(e.errs).Is(target)
+}
+
+// stepErrors is the error of a task of which more than one step failed.
+type stepErrors []error
+
+func (e stepErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// As finds the first of the errors that matches target, so that `errors.As` can inspect the errors of the steps
+func (e stepErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is reports whether any of the errors matches target, so that `errors.Is` can inspect the errors of the steps
+func (e stepErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors returns the errors as a single error, nil if there are none
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return stepErrors(errs)
+}
+
+// isContinued returns true if err only consists of errors of steps with `continueOnError`, so that the task
+// goes on after them.
+func isContinued(err error) bool {
+	if errs, ok := err.(stepErrors); ok {
+		for _, err := range errs {
+			if !isContinued(err) {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := err.(*continuedError)
+	return ok
+}
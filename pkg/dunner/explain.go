@@ -0,0 +1,57 @@
+package dunner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// PrintCommandLines prints to w the `docker run` command lines equivalent to the steps of the task that would run,
+// as a shell script to be copied and pasted. The steps are numbered like in `PrintPlan`, in comments, and the
+// secrets of the steps are redacted.
+func (r *Runner) PrintCommandLines(w io.Writer, configs *config.Configs, taskName string, args []string) error {
+	return r.printPlan(&commentWriter{w: w}, configs, taskName, args, func(_ io.Writer, number string, step *docker.Step, stepDefinition *config.Step, args []string) error {
+		if err := r.PassArgs(step, &args); err != nil {
+			return err
+		}
+		lines, err := step.CommandLines()
+		if err != nil {
+			return err
+		}
+		w, _, flush := planStepWriter(w, step)
+		defer flush()
+		fmt.Fprintf(w, "# %s. %s\n", number, describePlanStep(step, stepDefinition))
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+		return nil
+	})
+}
+
+// commentWriter writes every line written to it as a comment of a shell script, like the follow steps and the
+// skipped steps of an explained task
+type commentWriter struct {
+	w       io.Writer
+	midLine bool
+}
+
+func (c *commentWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !c.midLine {
+			if _, err := io.WriteString(c.w, "# "); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := c.w.Write(line); err != nil {
+			return 0, err
+		}
+		c.midLine = line[len(line)-1] != '\n'
+	}
+	return len(p), nil
+}
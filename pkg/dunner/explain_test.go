@@ -0,0 +1,57 @@
+package dunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func TestPrintCommandLines(t *testing.T) {
+	tasks := map[string]config.Task{
+		"test": {
+			Secrets: []string{"TOKEN"},
+			Steps: []config.Step{
+				{Name: "list", Image: busyBoxImage, Command: []string{"ls", "$1"}, Envs: []string{"TOKEN=s3cr3t"}},
+				{Follow: "build"},
+				{Name: "deploy", Image: busyBoxImage, Command: []string{"ls"}, When: "$DEPLOY"},
+			},
+		},
+		"build": {Steps: []config.Step{{Image: busyBoxImage, Dir: "pkg", Command: []string{"go", "build"}}}},
+	}
+	configs := &config.Configs{Tasks: tasks}
+	r := &Runner{WorkingDirectory: "/work"}
+	var out bytes.Buffer
+
+	if err := r.PrintCommandLines(&out, configs, "test", []string{"/tmp"}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 lines, got:\n%s", out.String())
+	}
+	expected := []string{
+		"# 1. task 'test', step 'list'",
+		"# 2. task 'test': follow task 'build'",
+		"# 2.1. task 'build'",
+		"# 3. task 'test', step 'deploy': skipped, condition '$DEPLOY' is not met",
+	}
+	for i, line := range []string{lines[0], lines[2], lines[3], lines[5]} {
+		if line != expected[i] {
+			t.Errorf("expected line: %q, got: %q", expected[i], line)
+		}
+	}
+	for _, part := range []string{"docker run --rm -v /work:/dunner -w /dunner ", " -e TOKEN=****", " --entrypoint ls busybox:1.31 /tmp"} {
+		if !strings.Contains(lines[1], part) {
+			t.Errorf("expected command line of 'list' step to contain %q, got: %s", part, lines[1])
+		}
+	}
+	if !strings.Contains(lines[4], " -w /dunner/pkg ") || !strings.HasSuffix(lines[4], " --entrypoint go busybox:1.31 build") {
+		t.Errorf("expected command line of 'build' task, got: %s", lines[4])
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("expected secret to be redacted, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,52 @@
+package dunner
+
+import (
+	"fmt"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// filterSteps returns the steps of the task selected by the `--only` and `--skip` flags, matching on the step
+// names. It returns an error if `--only` names a step that does not exist in the task.
+func (r *Runner) filterSteps(taskName string, steps []config.Step) ([]config.Step, error) {
+	only, skip := r.Only, r.Skip
+	if len(only) == 0 && len(skip) == 0 {
+		return steps, nil
+	}
+
+	for _, name := range only {
+		if !hasStep(steps, name) {
+			return nil, fmt.Errorf("dunner: step '%s' does not exist in '%s' task", name, taskName)
+		}
+	}
+
+	var selected []config.Step
+	for _, step := range steps {
+		if (len(only) > 0 && !contains(only, step.Name)) || contains(skip, step.Name) {
+			if step.Follow != "" {
+				log.Warnf("Filtered out step of '%s' task follows '%s' task, which will not be run", taskName, step.Follow)
+			}
+			continue
+		}
+		selected = append(selected, step)
+	}
+	return selected, nil
+}
+
+func hasStep(steps []config.Step, name string) bool {
+	for _, step := range steps {
+		if step.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package dunner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+var filterTestSteps = []config.Step{
+	{Name: "setup", Image: busyBoxImage},
+	{Name: "lint", Image: busyBoxImage},
+	{Follow: "build"},
+	{Name: "test", Image: busyBoxImage},
+}
+
+func stepNames(steps []config.Step) []string {
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestFilterStepsWithoutFlags(t *testing.T) {
+
+	steps, err := new(Runner).filterSteps("test", filterTestSteps)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual(filterTestSteps, steps) {
+		t.Errorf("expected all steps, got: %v", stepNames(steps))
+	}
+}
+
+func TestFilterStepsWithOnly(t *testing.T) {
+	r := &Runner{Only: []string{"test", "setup"}}
+
+	steps, err := r.filterSteps("test", filterTestSteps)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"setup", "test"}; !reflect.DeepEqual(expected, stepNames(steps)) {
+		t.Errorf("expected steps: %v, got: %v", expected, stepNames(steps))
+	}
+}
+
+func TestFilterStepsWithSkip(t *testing.T) {
+	r := &Runner{Skip: []string{"lint"}}
+
+	steps, err := r.filterSteps("test", filterTestSteps)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"setup", "", "test"}; !reflect.DeepEqual(expected, stepNames(steps)) {
+		t.Errorf("expected steps: %v, got: %v", expected, stepNames(steps))
+	}
+}
+
+func TestFilterStepsWithUnknownOnlyStep(t *testing.T) {
+	r := &Runner{Only: []string{"deploy"}}
+
+	_, err := r.filterSteps("test", filterTestSteps)
+
+	expectedErr := "dunner: step 'deploy' does not exist in 'test' task"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
@@ -0,0 +1,177 @@
+package dunner
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// followNode is a task of the graph of the tasks followed by a batch of follow steps, see scheduleFollows. Its edges
+// go to the tasks it follows before its first step, see followDeps, which are run before it.
+type followNode struct {
+	step       *docker.Step
+	definition *config.Step
+	deps       []*followNode
+	depsTaken  bool // Whether the leading follow steps of the task were given the nodes of deps, see takeDeps
+
+	once     sync.Once
+	captured []string // The values captured by the task
+	err      error    // The error of the task, given to every step following it
+}
+
+// followNodes are the nodes of the follow graphs being run, by the definition of the step following their task
+type followNodes struct {
+	mu    sync.Mutex
+	nodes map[*config.Step]*followNode
+}
+
+func (f *followNodes) get(stepDefinition *config.Step) *followNode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.nodes[stepDefinition]
+}
+
+func (f *followNodes) add(stepDefinition *config.Step, n *followNode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.nodes == nil {
+		f.nodes = make(map[*config.Step]*followNode)
+	}
+	f.nodes[stepDefinition] = n
+}
+
+func (f *followNodes) remove(stepDefinitions []*config.Step) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, stepDefinition := range stepDefinitions {
+		delete(f.nodes, stepDefinition)
+	}
+}
+
+// takeDeps returns the nodes that the task of the node of the parent step depends on, the first time it is called
+// for the task, as they are followed by its leading follow steps only
+func (f *followNodes) takeDeps(parentStep *config.Step) []*followNode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, exists := f.nodes[parentStep]
+	if !exists || n.depsTaken {
+		return nil
+	}
+	n.depsTaken = true
+	return n.deps
+}
+
+// scheduleFollows builds the graph of the tasks followed by a batch of follow steps, and returns a function
+// removing it once the batch is done. Every step of the batch is the root of its own node, and the tasks it
+// depends on are nodes shared in the graph, so that a task that several tasks of the batch depend on, like the
+// bottom of a diamond, is run once for all of them. The leading follow steps of a task of the graph are given the
+// nodes of the tasks it depends on, which are already run.
+func (r *Runner) scheduleFollows(configs *config.Configs, follows []pendingStep, parentStep *config.Step) func() {
+	deps := r.followNodes.takeDeps(parentStep)
+	shared := make(map[string]*followNode)
+	var added []*config.Step
+	var add func(stepDefinition *config.Step, n *followNode)
+	add = func(stepDefinition *config.Step, n *followNode) {
+		r.followNodes.add(stepDefinition, n)
+		added = append(added, stepDefinition)
+		for _, dep := range n.deps {
+			if r.followNodes.get(dep.definition) == nil {
+				add(dep.definition, dep)
+			}
+		}
+	}
+	for i := range follows {
+		if i < len(deps) {
+			r.followNodes.add(&follows[i].definition, deps[i])
+			added = append(added, &follows[i].definition)
+			continue
+		}
+		add(&follows[i].definition, r.newFollowNode(configs, follows[i].step, &follows[i].definition, shared))
+	}
+	return func() { r.followNodes.remove(added) }
+}
+
+// newFollowNode returns the node of the task followed by the step, along with the nodes of the tasks it depends
+// on. These are shared by the tasks of the graph that follow them alike, by their key in shared.
+func (r *Runner) newFollowNode(configs *config.Configs, step *docker.Step, stepDefinition *config.Step, shared map[string]*followNode) *followNode {
+	n := &followNode{step: step, definition: stepDefinition}
+	for _, dep := range r.followDeps(configs, step, stepDefinition) {
+		key := fmt.Sprintf("%s\x00%q\x00%q\x00%q\x00%v\x00%q\x00%q", dep.step.Follow, dep.step.Args, dep.definition.Envs,
+			dep.definition.Mounts, dep.definition.Labels, dep.definition.DNS, dep.definition.DNSSearch)
+		depNode, exists := shared[key]
+		if !exists {
+			definition := dep.definition
+			depNode = r.newFollowNode(configs, dep.step, &definition, shared)
+			shared[key] = depNode
+		}
+		n.deps = append(n.deps, depNode)
+	}
+	return n
+}
+
+// followTask runs the task followed by the step, and returns the values it captured. The task of a node of a
+// follow graph is run once the tasks it depends on are done, the independent ones in parallel, and a node already
+// run or being run is not run again, its outcome is returned once it is done.
+func (r *Runner) followTask(configs *config.Configs, step *docker.Step, stepDefinition *config.Step) ([]string, error) {
+	n := r.followNodes.get(stepDefinition)
+	if n == nil {
+		return r.runTask(configs, step.Follow, step.Args, stepDefinition)
+	}
+	n.once.Do(func() {
+		r.runInParallel(len(n.deps), func(i int) bool {
+			_, err := r.followTask(configs, n.deps[i].step, n.deps[i].definition)
+			return err == nil
+		})
+		n.captured, n.err = r.runTask(configs, n.step.Follow, n.step.Args, n.definition)
+	})
+	return n.captured, n.err
+}
+
+// followDeps returns the steps that the task followed by the step depends on: its leading steps following other
+// tasks unconditionally, which are run together before its first other step. Their outcome is left to the task,
+// which gets it when it reaches them. A task run in asynchronous mode, with a matrix, or with inputs that may let
+// it be skipped has none, the tasks it follows being run as it reaches them.
+func (r *Runner) followDeps(configs *config.Configs, step *docker.Step, stepDefinition *config.Step) []pendingStep {
+	task := configs.Tasks[step.Follow]
+	if r.Async || len(task.Matrix) > 0 || len(task.Inputs) > 0 && !r.Force {
+		return nil
+	}
+	var deps []pendingStep
+	for i, depDefinition := range task.Steps {
+		if depDefinition.Follow == "" || isConditionalFollow(depDefinition) || depDefinition.When != "" {
+			break
+		}
+		// A step failing to resolve is left for the task to report
+		dep, _, err := r.resolveStep(configs, step.Follow, i+1, &depDefinition, stepDefinition, step.Args, nil)
+		if err != nil {
+			break
+		}
+		deps = append(deps, pendingStep{step: dep, definition: depDefinition})
+	}
+	return deps
+}
+
+// runInParallel calls run for every index up to n in parallel, as many at a time as the `--max-parallel` flag
+// allows, and waits for all the calls to return. A call for which no slot is free is made in the calling goroutine,
+// so that nested calls never wait for a slot held by their parent. No more calls are made once such a call returns
+// false.
+func (r *Runner) runInParallel(n int, run func(i int) bool) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if !r.followSlots.tryAcquire(r.MaxParallel) {
+			if !run(i) {
+				break
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer r.followSlots.release()
+			run(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,136 @@
+package dunner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/leopardslab/dunner/internal/util"
+	"github.com/leopardslab/dunner/pkg/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// inputsCacheDir is the directory of the digests of the inputs of the tasks, as of their last successful run
+var inputsCacheDir = filepath.Join(util.HomeDir, ".dunner", "inputs")
+
+// checkInputs returns the digest of the inputs of the task, to be saved with `saveInputs` once the task succeeded,
+// and whether the task is to be skipped as its inputs did not change since it last succeeded. The digest is empty
+// for a task without inputs, which is always run, as is every task with `--force`.
+func (r *Runner) checkInputs(configs *config.Configs, taskName string, args []string) (string, bool, error) {
+	task := configs.Tasks[taskName]
+	if len(task.Inputs) == 0 {
+		return "", false, nil
+	}
+	digest, err := r.inputsDigest(configs, taskName, args)
+	if err != nil {
+		return "", false, err
+	}
+	if r.Force {
+		return digest, false, nil
+	}
+	saved, err := ioutil.ReadFile(inputsCacheFile(configs, taskName))
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("dunner: failed to read digest of the inputs of '%s' task: %s", taskName, err.Error())
+	}
+	return digest, string(saved) == digest, nil
+}
+
+// saveInputs saves the digest of the inputs of the task once it succeeded, for the next runs to be skipped as long
+// as the inputs do not change
+func saveInputs(configs *config.Configs, taskName string, digest string) error {
+	file := inputsCacheFile(configs, taskName)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("dunner: failed to save digest of the inputs of '%s' task: %s", taskName, err.Error())
+	}
+	if err := ioutil.WriteFile(file, []byte(digest), 0644); err != nil {
+		return fmt.Errorf("dunner: failed to save digest of the inputs of '%s' task: %s", taskName, err.Error())
+	}
+	return nil
+}
+
+// inputsCacheFile returns the file of the digest of the inputs of the task, which is kept apart from those of the
+// tasks of the same name in other task files
+func inputsCacheFile(configs *config.Configs, taskName string) string {
+	sum := sha256.Sum256([]byte(configs.BaseDir() + "\x00" + taskName))
+	return filepath.Join(inputsCacheDir, hex.EncodeToString(sum[:]))
+}
+
+// inputsDigest returns the digest of the contents of the files matching the inputs of the task, along with the
+// definition of the task and the arguments it is run with, so that changing any of them runs the task again.
+func (r *Runner) inputsDigest(configs *config.Configs, taskName string, args []string) (string, error) {
+	task := configs.Tasks[taskName]
+	files, err := inputFiles(task.Inputs, configs.BaseDir())
+	if err != nil {
+		return "", fmt.Errorf("dunner: failed to read inputs of '%s' task: %s", taskName, err.Error())
+	}
+	definition, err := yaml.Marshal(task)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%q\x00%q\x00%q\x00", definition, args, r.Args, r.Env)
+	for _, file := range files {
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(file.name))
+		f, err := os.Open(file.path)
+		if err != nil {
+			return "", fmt.Errorf("dunner: failed to read inputs of '%s' task: %s", taskName, err.Error())
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("dunner: failed to read inputs of '%s' task: %s", taskName, err.Error())
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inputFile is a file matching the inputs of a task, named relatively to the directory of the task file
+type inputFile struct {
+	name string
+	path string
+}
+
+// inputFiles returns the regular files matching the glob patterns, relative to the directory, sorted by name. The
+// files of the matching directories are all included.
+func inputFiles(patterns []string, baseDir string) ([]inputFile, error) {
+	if baseDir == "" {
+		baseDir = "."
+	}
+	seen := make(map[string]bool)
+	var files []inputFile
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() || seen[path] {
+					return err
+				}
+				seen[path] = true
+				name, err := filepath.Rel(baseDir, path)
+				if err != nil {
+					name = path
+				}
+				files = append(files, inputFile{name: name, path: path})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
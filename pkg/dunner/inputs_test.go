@@ -0,0 +1,136 @@
+package dunner
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// tempInputs creates a directory with the given files and contents, and keeps the digests of the inputs of the
+// tasks in a directory of its own. It returns the directory and the function to call to remove them.
+func tempInputs(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "dunner-inputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	original := inputsCacheDir
+	inputsCacheDir = filepath.Join(dir, ".cache")
+	return dir, func() {
+		inputsCacheDir = original
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExecTaskSkipsTaskWithUnchangedInputs(t *testing.T) {
+	dir, remove := tempInputs(t, map[string]string{"src/main.go": "package main"})
+	defer remove()
+	var runs int
+	var fail bool
+	defer stubExecStep(func(docker.Step) error {
+		runs++
+		if fail {
+			return &docker.ExitError{Code: 1}
+		}
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"go", "build"}}
+	task := config.Task{Inputs: []string{filepath.Join(dir, "src")}, Steps: []config.Step{step}}
+	configs := config.Configs{Tasks: map[string]config.Task{"build": task}}
+	r := &Runner{}
+
+	for i, test := range []struct {
+		change   func()
+		expected int
+	}{
+		{func() {}, 1},
+		{func() {}, 1},
+		{func() { ioutil.WriteFile(filepath.Join(dir, "src/main.go"), []byte("package app"), 0644) }, 2},
+		{func() { ioutil.WriteFile(filepath.Join(dir, "src/util.go"), []byte("package app"), 0644) }, 3},
+		{func() { r.Force = true }, 4},
+		{func() { r.Force = false }, 4},
+	} {
+		test.change()
+		if err := r.ExecTask(&configs, "build", nil, nil); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if runs != test.expected {
+			t.Errorf("expected %d runs after run %d, got: %d", test.expected, i+1, runs)
+		}
+	}
+
+	// A failed run does not save the digest of the inputs, the task is run again
+	ioutil.WriteFile(filepath.Join(dir, "src/main.go"), []byte("package broken"), 0644)
+	fail = true
+	if err := r.ExecTask(&configs, "build", nil, nil); err == nil {
+		t.Fatal("expected task to fail")
+	}
+	fail = false
+	if err := r.ExecTask(&configs, "build", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if runs != 6 {
+		t.Errorf("expected failed task to be run again, got %d runs", runs)
+	}
+}
+
+func TestExecTaskRunsTaskWithInputsWithOtherArgs(t *testing.T) {
+	dir, remove := tempInputs(t, map[string]string{"input.txt": "hello"})
+	defer remove()
+	var runs int
+	defer stubExecStep(func(docker.Step) error {
+		runs++
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"echo", "$1"}}
+	task := config.Task{Inputs: []string{filepath.Join(dir, "*.txt")}, Steps: []config.Step{step}}
+	configs := config.Configs{Tasks: map[string]config.Task{"echo": task}}
+
+	for _, args := range [][]string{{"a"}, {"a"}, {"b"}} {
+		if err := new(Runner).ExecTask(&configs, "echo", args, nil); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("expected task to be run again only with other arguments, got %d runs", runs)
+	}
+}
+
+func TestInputFiles(t *testing.T) {
+	dir, remove := tempInputs(t, map[string]string{"go.mod": "", "src/b.go": "", "src/a.go": "", "src/a_test.go": "", "README.md": ""})
+	defer remove()
+
+	files, err := inputFiles([]string{"src", "*.mod", "src/a*.go", "missing/*"}, dir)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.ToSlash(file.name))
+	}
+	expected := []string{"go.mod", "src/a.go", "src/a_test.go", "src/b.go"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected input files: %v, got: %v", expected, names)
+	}
+}
+
+func TestInputFilesWithInvalidPattern(t *testing.T) {
+	if _, err := inputFiles([]string{"src/[a"}, "."); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Errorf("expected error: %s, got: %v", filepath.ErrBadPattern, err)
+	}
+}
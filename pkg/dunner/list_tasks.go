@@ -2,29 +2,77 @@ package dunner
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/leopardslab/dunner/internal/logger"
 	"github.com/leopardslab/dunner/pkg/config"
-	"github.com/spf13/viper"
 )
 
-// ListTasks lists all the available dunner tasks, if there are errors, it returns `error`
+// ListTasks lists all the available dunner tasks along with their description, in the order they are defined.
+// In verbose mode, the steps of every task are listed as well. With `--list-steps`, the resolved steps of the
+// task are listed instead, see `Runner.PrintSteps`. If there are errors, including validation errors
+// of the task file, it returns `error`
 func ListTasks() error {
-	var dunnerFile = viper.GetString("DunnerTaskFile")
+	return NewRunner().ListTasks()
+}
 
-	configs, err := config.GetConfigs(dunnerFile)
+// ListTasks lists the tasks of the task file of the runner along with their description, like `ListTasks`.
+func (r *Runner) ListTasks() error {
+	configs, err := config.GetConfigs(r.TaskFile)
 	if err != nil {
 		return err
 	}
+	if errs := configs.Validate(); len(errs) != 0 {
+		var messages []string
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		return fmt.Errorf("validation failed with following errors: %s", strings.Join(messages, "; "))
+	}
+	if r.ListSteps != "" {
+		return r.PrintSteps(os.Stdout, configs, r.ListSteps)
+	}
 
 	if len(configs.Tasks) == 0 {
 		fmt.Println("No dunner tasks found")
 	} else {
 		fmt.Println("Available Dunner tasks:")
-		for taskName := range configs.Tasks {
-			logger.Bullet(taskName)
+		for _, taskName := range configs.TaskNames() {
+			task := configs.Tasks[taskName]
+			if task.Description == "" {
+				logger.Bullet(taskName)
+			} else {
+				logger.Bullet("%s: %s", taskName, task.Description)
+			}
+			if r.Verbose {
+				for i, step := range task.Steps {
+					fmt.Printf("    %d. %s\n", i+1, summarizeStep(step))
+				}
+			}
 		}
 		fmt.Println("Run `dunner do <task_name>` to run a dunner task.")
 	}
 	return nil
 }
+
+// summarizeStep returns the name of the step along with the image it runs on, or the task it follows, and its
+// description if any
+func summarizeStep(step config.Step) string {
+	var summary string
+	switch {
+	case step.Follow != "":
+		summary = fmt.Sprintf("follow task '%s'", step.Follow)
+	case step.Build != "":
+		summary = fmt.Sprintf("image built from %s", step.Build)
+	default:
+		summary = fmt.Sprintf("image %s", step.Image)
+	}
+	if step.Name != "" {
+		summary = fmt.Sprintf("%s: %s", step.Name, summary)
+	}
+	if step.Description != "" {
+		summary = fmt.Sprintf("%s (%s)", summary, step.Description)
+	}
+	return summary
+}
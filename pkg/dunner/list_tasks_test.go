@@ -9,10 +9,9 @@ import (
 )
 
 func Test_ListTasksWhenConfigFileNotFound(t *testing.T) {
-	viper.Set("DunnerTaskFile", "fileThatDoesnotExit.yaml")
-	defer viper.Reset()
+	r := &Runner{TaskFile: "fileThatDoesnotExit.yaml"}
 
-	err := ListTasks()
+	err := r.ListTasks()
 
 	expected := "open fileThatDoesnotExit.yaml: no such file or directory"
 	if err == nil {
@@ -79,22 +78,82 @@ tasks:
 		panic(err)
 	}
 
-	viper.Set("DunnerTaskFile", tmpFile.Name())
-	defer viper.Reset()
+	r := &Runner{TaskFile: tmpFile.Name()}
 	defer os.Remove(tmpFile.Name())
 
-	err = ListTasks()
+	err = r.ListTasks()
 
 	if err != nil {
 		panic(err)
 	}
 
-	// Unordered output: Available Dunner tasks:
+	// Output: Available Dunner tasks:
 	// • setup
 	// • build
 	// Run `dunner do <task_name>` to run a dunner task.
 }
 
+func ExampleListTasks_verboseWithDescriptionAndSteps() {
+	var content = []byte(`
+tasks:
+  build:
+    description: Builds the project
+    steps:
+      - name: compile
+        description: Compiles the binaries
+        image: golang
+        command: ["go", "build"]
+      - follow: lint
+  lint:
+    steps:
+      - image: golang
+        command: ["go", "vet"]`)
+
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		panic(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		panic(err)
+	}
+	r := &Runner{TaskFile: tmpFile.Name(), Verbose: true}
+
+	if err := r.ListTasks(); err != nil {
+		panic(err)
+	}
+
+	// Output: Available Dunner tasks:
+	// • build: Builds the project
+	//     1. compile: image golang (Compiles the binaries)
+	//     2. follow task 'lint'
+	// • lint
+	//     1. image golang
+	// Run `dunner do <task_name>` to run a dunner task.
+}
+
+func Test_ListTasksWithInvalidTaskFile(t *testing.T) {
+	var content = []byte(`
+tasks:
+  build:
+    steps:
+      - command: ["ls"]`)
+
+	tmpFile := createDunnerTaskFile(t, content, ".testdunner.yaml")
+	defer os.Remove(tmpFile.Name())
+	defer viper.Reset()
+
+	err := ListTasks()
+
+	expected := "validation failed with following errors: task 'build', step 1: image is required, unless the task has a `follow` or `build` field"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("got: %v, want: %s", err, expected)
+	}
+}
+
 func Test_ListTasksSuccessNoTasks(t *testing.T) {
 	var tmpFilename = ".testdunner.yaml"
 	var content = []byte("")
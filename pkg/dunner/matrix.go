@@ -0,0 +1,61 @@
+package dunner
+
+import (
+	"strings"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// execTaskSteps runs the steps of the task, once for every combination of the values of its matrix if it has one.
+// The combinations run in parallel, sharing the slots of the follow tasks, see runInParallel. Every combination
+// is run even if others failed, the failed ones being reported together. Of the values captured by the
+// combinations, those of the last combination come first.
+func (r *Runner) execTaskSteps(configs *config.Configs, taskName string, args []string, parentStep *config.Step) ([]string, error) {
+	combinations := configs.Tasks[taskName].MatrixCombinations()
+	if len(combinations) == 0 {
+		return r.execSteps(configs, taskName, args, parentStep)
+	}
+
+	errs := make([]error, len(combinations))
+	captures := make([][]string, len(combinations))
+	r.runInParallel(len(combinations), func(i int) bool {
+		log.Infof("Running '%s' task with %s", taskName, strings.Join(combinations[i], " "))
+		matrixConfigs, err := matrixConfigs(configs, taskName, combinations[i])
+		if err != nil {
+			errs[i] = err
+			return true
+		}
+		captures[i], errs[i] = r.execSteps(matrixConfigs, taskName, args, parentStep)
+		return true
+	})
+
+	var captured []string
+	failed := &matrixErrors{task: taskName, total: len(combinations)}
+	for i, err := range errs {
+		captured = append(captures[i], captured...)
+		if err != nil {
+			failed.combinations = append(failed.combinations, strings.Join(combinations[i], " "))
+			failed.errs = append(failed.errs, err)
+		}
+	}
+	if len(failed.errs) == 0 {
+		return captured, nil
+	}
+	return captured, failed
+}
+
+// matrixConfigs returns a copy of the configs in which the task is run with one combination of its matrix, see
+// `config.MatrixTask`
+func matrixConfigs(configs *config.Configs, taskName string, combination []string) (*config.Configs, error) {
+	task, err := configs.MatrixTask(taskName, combination)
+	if err != nil {
+		return nil, err
+	}
+	copied := *configs
+	copied.Tasks = make(map[string]config.Task, len(configs.Tasks))
+	for name, task := range configs.Tasks {
+		copied.Tasks[name] = task
+	}
+	copied.Tasks[taskName] = task
+	return &copied, nil
+}
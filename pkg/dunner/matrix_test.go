@@ -0,0 +1,93 @@
+package dunner
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/viper"
+)
+
+func TestExecTaskWithMatrix(t *testing.T) {
+	var mu sync.Mutex
+	var runs []string
+	defer stubExecStep(func(s docker.Step) error {
+		env := envMap(s.Env)
+		mu.Lock()
+		runs = append(runs, env["GO_VERSION"]+"/"+env["OS"])
+		mu.Unlock()
+		if env["GO_VERSION"] == "1.12" && env["OS"] == "darwin" {
+			return &docker.ExitError{Code: 2}
+		}
+		return nil
+	})()
+	task := config.Task{
+		Matrix: map[string][]string{"GO_VERSION": {"1.12", "1.13"}, "OS": {"linux", "darwin"}},
+		Envs:   []string{"OS=windows"},
+		Steps:  []config.Step{{Name: "test", Image: busyBoxImage, Command: []string{"go", "test"}}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": task}}
+
+	for _, maxParallel := range []int{1, 0} {
+		runs = nil
+		err := (&Runner{MaxParallel: maxParallel}).ExecTask(&configs, "test", nil, nil)
+
+		expectedRuns := []string{"1.12/darwin", "1.12/linux", "1.13/darwin", "1.13/linux"}
+		sort.Strings(runs)
+		if !reflect.DeepEqual(expectedRuns, runs) {
+			t.Errorf("expected a run of every combination with --max-parallel=%d, got: %v", maxParallel, runs)
+		}
+		expectedErr := "dunner: 1 of 4 combinations of 'test' task failed: [GO_VERSION=1.12 OS=darwin] docker: command execution failed with exit code 2"
+		if err == nil || err.Error() != expectedErr {
+			t.Errorf("expected error: %s, got: %v", expectedErr, err)
+		}
+		var exitErr *docker.ExitError
+		if !errors.As(err, &exitErr) || ExitCode(err) != 2 {
+			t.Errorf("expected exit code of the failed combination, got: %d", ExitCode(err))
+		}
+	}
+	if configs.Tasks["test"].Envs[0] != "OS=windows" {
+		t.Errorf("expected the task of the configs to be left as it is, got: %v", configs.Tasks["test"].Envs)
+	}
+}
+
+func TestExecTaskWithMatrixInEnvsOfLoadedTaskFile(t *testing.T) {
+	defer viper.Reset()
+	var mu sync.Mutex
+	var tags []string
+	defer stubExecStep(func(s docker.Step) error {
+		mu.Lock()
+		tags = append(tags, envMap(s.Env)["TAG"])
+		mu.Unlock()
+		return nil
+	})()
+	contents := `tasks:
+  test:
+    matrix:
+      GO_VERSION: ["1.12", "1.13"]
+    envs: ["IMAGE_TAG=golang:$GO_VERSION"]
+    steps:
+      - image: busybox
+        envs: ["TAG=${IMAGE_TAG}-alpine"]
+`
+	tmpFile := createDunnerTaskFile(t, []byte(contents), ".dunner.yaml")
+	defer os.Remove(tmpFile.Name())
+	configs, err := config.GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("expected no error loading the task file, got: %s", err)
+	}
+
+	if err := new(Runner).ExecTask(configs, "test", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	sort.Strings(tags)
+	if expected := []string{"golang:1.12-alpine", "golang:1.13-alpine"}; !reflect.DeepEqual(expected, tags) {
+		t.Errorf("expected envs of every combination: %v, got: %v", expected, tags)
+	}
+}
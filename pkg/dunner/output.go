@@ -0,0 +1,80 @@
+package dunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// Output formats of the `--output` flag
+const (
+	textOutput = "text"
+	jsonOutput = "json"
+)
+
+// resultWriter is where the step results are written to with `--output json`
+var resultWriter io.Writer = os.Stdout
+var resultMutex sync.Mutex
+
+// stepResult is the machine-readable result of running a step, written as one JSON object per step
+type stepResult struct {
+	Task     string  `json:"task"`
+	Step     string  `json:"step"`
+	Image    string  `json:"image"`
+	ExitCode int     `json:"exitCode"`
+	Duration float64 `json:"duration"` // In seconds
+	Stdout   string  `json:"stdout"`
+	Stderr   string  `json:"stderr"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// execWithJSONResult runs the step capturing the output of its command(s), and writes the result of the step
+// as a JSON object to resultWriter, or records it to the run started with `Run` if any. The error of the step,
+// if any, is returned as well.
+func (r *Runner) execWithJSONResult(s *docker.Step, dunnerStep *config.Step) error {
+	var stdout, stderr bytes.Buffer
+	s.Stdout = &stdout
+	s.Stderr = &stderr
+
+	start := time.Now()
+	err := r.execWithRetries(s, dunnerStep)
+	elapsed := time.Since(start)
+	if run := r.run; run != nil {
+		run.record(StepResult{
+			Task:     s.Task,
+			Step:     s.Name,
+			Image:    s.Image,
+			ExitCode: ExitCode(err),
+			Duration: elapsed,
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+			Err:      err,
+		})
+		return err
+	}
+	result := stepResult{
+		Task:     s.Task,
+		Step:     s.Name,
+		Image:    s.Image,
+		ExitCode: ExitCode(err),
+		Duration: elapsed.Seconds(),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	resultMutex.Lock()
+	defer resultMutex.Unlock()
+	if encodeErr := json.NewEncoder(resultWriter).Encode(result); encodeErr != nil && err == nil {
+		return encodeErr
+	}
+	return err
+}
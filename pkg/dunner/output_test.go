@@ -0,0 +1,57 @@
+package dunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestExecTaskWithJSONOutput(t *testing.T) {
+	r := &Runner{Output: jsonOutput}
+	var buf bytes.Buffer
+	defer func(original io.Writer) { resultWriter = original }(resultWriter)
+	resultWriter = &buf
+	defer stubExecStep(func(s docker.Step) error {
+		if _, err := s.Stdout.Write([]byte("hello\n")); err != nil {
+			return err
+		}
+		if s.Name == "fail" {
+			s.Stderr.Write([]byte("oops\n"))
+			return &docker.ExitError{Code: 2}
+		}
+		return nil
+	})()
+	tasks := map[string]config.Task{"test": {Steps: []config.Step{
+		{Name: "greet", Image: busyBoxImage, Command: []string{"echo", "hello"}},
+		{Name: "fail", Image: busyBoxImage, Command: []string{"false"}},
+	}}}
+	configs := config.Configs{Tasks: tasks}
+
+	err := r.ExecTask(&configs, "test", []string{}, nil)
+
+	if ExitCode(err) != 2 {
+		t.Fatalf("expected exit code 2, got error: %v", err)
+	}
+	decoder := json.NewDecoder(&buf)
+	var results []stepResult
+	for decoder.More() {
+		var result stepResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 step results, got: %v", results)
+	}
+	if r := results[0]; r.Task != "test" || r.Step != "greet" || r.Image != busyBoxImage || r.ExitCode != 0 || r.Stdout != "hello\n" || r.Error != "" {
+		t.Errorf("unexpected result of 'greet' step: %+v", r)
+	}
+	if r := results[1]; r.Step != "fail" || r.ExitCode != 2 || r.Stderr != "oops\n" || r.Error == "" {
+		t.Errorf("unexpected result of 'fail' step: %+v", r)
+	}
+}
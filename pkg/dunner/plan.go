@@ -0,0 +1,401 @@
+package dunner
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
+	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// PrintPlan prints the execution plan of the task to w, without running any containers. Steps are numbered
+// in the order they would run, with the steps of follow tasks expanded and numbered under the follow step.
+// The steps of the hooks are numbered after the name of the hook.
+func PrintPlan(w io.Writer, configs *config.Configs, taskName string, args []string) error {
+	return NewRunner().PrintPlan(w, configs, taskName, args)
+}
+
+// PrintPlan prints the execution plan of the task to w with the settings of the runner.
+func (r *Runner) PrintPlan(w io.Writer, configs *config.Configs, taskName string, args []string) error {
+	return r.printPlan(w, configs, taskName, args, r.printPlanStep)
+}
+
+// printPlan prints the steps of the task that would run to w with printStep, along with those of the hooks unless
+// they are not run
+func (r *Runner) printPlan(w io.Writer, configs *config.Configs, taskName string, args []string, printStep stepPrinter) error {
+	if _, exists := configs.Tasks[taskName]; !exists {
+		return fmt.Errorf("dunner: task '%s' does not exist", taskName)
+	}
+	if r.NoHooks {
+		return r.printTaskPlan(w, configs, taskName, args, nil, "", printStep)
+	}
+	if err := r.printStepsPlan(w, configs, taskName, configs.Before, args, nil, beforeHook+".", printStep); err != nil {
+		return err
+	}
+	if err := r.printTaskPlan(w, configs, taskName, args, nil, "", printStep); err != nil {
+		return err
+	}
+	return r.printStepsPlan(w, configs, taskName, configs.After, args, nil, afterHook+".", printStep)
+}
+
+// PrintSteps prints the steps of the task that would run to w, with the steps of follow tasks expanded, like
+// `PrintPlan`. Only the effective image, commands, user, environment variables and mounts of the steps are
+// printed, the arguments in the commands being left as they are. The hooks are not printed.
+func (r *Runner) PrintSteps(w io.Writer, configs *config.Configs, taskName string) error {
+	if _, exists := configs.Tasks[taskName]; !exists {
+		return fmt.Errorf("dunner: task '%s' does not exist", taskName)
+	}
+	return r.printTaskPlan(w, configs, taskName, nil, nil, "", printStepSummary)
+}
+
+// stepPrinter prints a resolved step of a plan, numbered number, run with the arguments of its task
+type stepPrinter func(w io.Writer, number string, step *docker.Step, stepDefinition *config.Step, args []string) error
+
+func (r *Runner) printTaskPlan(w io.Writer, configs *config.Configs, taskName string, args []string, parentStep *config.Step, prefix string, printStep stepPrinter) error {
+	if _, exists := configs.Tasks[taskName]; !exists {
+		return fmt.Errorf("dunner: task '%s' does not exist", taskName)
+	}
+	printSteps := func(configs *config.Configs) error {
+		steps := configs.Tasks[taskName].Steps
+		if parentStep == nil {
+			var err error
+			if steps, err = r.filterSteps(taskName, steps); err != nil {
+				return err
+			}
+		}
+		return r.printStepsPlan(w, configs, taskName, steps, args, parentStep, prefix, printStep)
+	}
+	combinations := configs.Tasks[taskName].MatrixCombinations()
+	if len(combinations) == 0 {
+		return printSteps(configs)
+	}
+	// The steps are printed for every combination of the matrix, as the values can change what they run
+	for _, combination := range combinations {
+		fmt.Fprintf(w, "%s'%s' task with %s:\n", prefix, taskName, strings.Join(combination, " "))
+		matrixConfigs, err := matrixConfigs(configs, taskName, combination)
+		if err != nil {
+			return err
+		}
+		if err := printSteps(matrixConfigs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) printStepsPlan(w io.Writer, configs *config.Configs, taskName string, steps []config.Step, args []string, parentStep *config.Step, prefix string, printStep stepPrinter) error {
+	var followed []string // Values that the tasks followed would capture, for the steps after them
+	for i, stepDefinition := range steps {
+		number := fmt.Sprintf("%s%d", prefix, i+1)
+		step, run, err := r.resolveStep(configs, taskName, i+1, &stepDefinition, parentStep, args, followed)
+		if err != nil {
+			return err
+		}
+		if !run {
+			fmt.Fprintf(w, "%s. %s: skipped, condition '%s' is not met\n", number, describePlanStep(step, &stepDefinition), stepDefinition.When)
+			continue
+		}
+		if step.Follow != "" {
+			var condition string
+			if isConditionalFollow(stepDefinition) {
+				condition = " on " + stepDefinition.On
+			}
+			fmt.Fprintf(w, "%s. %s: follow task '%s'%s\n", number, describePlanStep(step, &stepDefinition), step.Follow, condition)
+			if err := r.printTaskPlan(w, configs, step.Follow, step.Args, &stepDefinition, number+".", printStep); err != nil {
+				return err
+			}
+			followed = append(plannedCaptured(configs, step.Follow), followed...)
+			continue
+		}
+		if err := printStep(w, number, step, &stepDefinition, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printPlanStep prints all the settings of the step, with the arguments substituted in its commands
+func (r *Runner) printPlanStep(w io.Writer, number string, step *docker.Step, stepDefinition *config.Step, args []string) error {
+	if err := r.PassArgs(step, &args); err != nil {
+		return err
+	}
+	printStepPlan(w, number, step, stepDefinition)
+	return nil
+}
+
+// printStepSummary prints the image, commands, user, environment variables and mounts of the step
+func printStepSummary(w io.Writer, number string, step *docker.Step, stepDefinition *config.Step, _ []string) error {
+	w, field, flush := planStepWriter(w, step)
+	defer flush()
+	fmt.Fprintf(w, "%s. %s\n", number, describePlanStep(step, stepDefinition))
+
+	if step.Build != "" {
+		field("build", "%s", step.Build)
+	} else {
+		field("image", "%s", docker.QualifyImage(step.Image, step.Registry))
+	}
+	printCommands(field, step)
+	if step.User != "" {
+		field("user", "%s", step.User)
+	}
+	printEnvs(field, step)
+	printMounts(field, step)
+	return nil
+}
+
+// planField prints a field of a step of a plan, named name, with its value formatted as by `fmt.Sprintf`
+type planField func(name string, format string, a ...interface{})
+
+// planStepWriter returns the writer of the plan of the step, redacting its secrets, along with a function to
+// print a field of the step to it and one to flush it once the step is printed.
+func planStepWriter(w io.Writer, step *docker.Step) (io.Writer, planField, func()) {
+	flush := func() {}
+	if len(step.Secrets) > 0 {
+		redactWriter := logger.NewRedactWriter(w, step.Secrets)
+		flush = func() { redactWriter.Flush() }
+		w = redactWriter
+	}
+	field := func(name string, format string, a ...interface{}) {
+		fmt.Fprintf(w, "    %-11s %s\n", name+":", fmt.Sprintf(format, a...))
+	}
+	return w, field, flush
+}
+
+func printStepPlan(w io.Writer, number string, step *docker.Step, stepDefinition *config.Step) {
+	w, field, flush := planStepWriter(w, step)
+	defer flush()
+	fmt.Fprintf(w, "%s. %s\n", number, describePlanStep(step, stepDefinition))
+
+	if step.Build != "" {
+		dockerfile := step.Dockerfile
+		if dockerfile == "" {
+			dockerfile = "Dockerfile"
+		}
+		field("build", "%s (%s)", step.Build, dockerfile)
+	} else {
+		field("image", "%s", docker.QualifyImage(step.Image, step.Registry))
+		if step.PullPolicy != "" {
+			field("pull", "%s", step.PullPolicy)
+		}
+	}
+	if step.Platform != "" {
+		field("platform", "%s", step.Platform)
+	}
+	if step.Entrypoint != nil {
+		entrypoint := strings.Join(step.Entrypoint, " ")
+		if entrypoint == "" {
+			entrypoint = "(none)"
+		}
+		field("entrypoint", "%s", entrypoint)
+	}
+	printCommands(field, step)
+	if step.CommandErrorMode != "" && len(step.Commands) > 0 {
+		field("on error", "%s", step.CommandErrorMode)
+	}
+	if step.SharedShell != nil && len(step.Commands) > 0 {
+		field("shell", "%s (shared by the commands)", strings.Join(step.SharedShell, " "))
+	}
+	if step.WorkDir != "" {
+		field("dir", "%s", step.WorkDir)
+	}
+	if step.User != "" {
+		field("user", "%s", step.User)
+	}
+	printEnvs(field, step)
+	var labelKeys []string
+	for key := range step.Labels {
+		// Built-in labels are set on every container, they are only shown when overridden
+		if step.IsBuiltinLabel(key) {
+			continue
+		}
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		field("label", "%s=%s", key, step.Labels[key])
+	}
+	if _, isFile := config.StdinFile(stepDefinition.Stdin, ""); isFile {
+		field("stdin", "%s", stepDefinition.Stdin)
+	} else if step.Stdin != "" {
+		field("stdin", "%q", step.Stdin)
+	}
+	if stepDefinition.OutputFile != "" {
+		if stepDefinition.OutputStderr {
+			field("output", "%s (with errors)", stepDefinition.OutputFile)
+		} else {
+			field("output", "%s", stepDefinition.OutputFile)
+		}
+	}
+	if stepDefinition.CaptureAs != "" {
+		field("capture as", "%s", stepDefinition.CaptureAs)
+	}
+	if step.Privileged {
+		field("privileged", "yes")
+	}
+	if step.ReadOnly {
+		field("rootfs", "read-only")
+	}
+	if step.Interactive {
+		field("interactive", "yes")
+	}
+	if step.Network != "" {
+		field("network", "%s", step.Network)
+	}
+	for _, host := range step.ExtraHosts {
+		field("extra host", "%s", host)
+	}
+	for _, server := range step.DNS {
+		field("dns", "%s", server)
+	}
+	for _, domain := range step.DNSSearch {
+		field("dns search", "%s", domain)
+	}
+	if step.Memory != 0 {
+		field("memory", "%s", units.BytesSize(float64(step.Memory)))
+	}
+	if step.CPUs != 0 {
+		field("cpus", "%g", step.CPUs)
+	}
+	for _, ulimit := range step.Ulimits {
+		field("ulimit", "%s", ulimit)
+	}
+	var sysctlNames []string
+	for name := range step.Sysctls {
+		sysctlNames = append(sysctlNames, name)
+	}
+	sort.Strings(sysctlNames)
+	for _, name := range sysctlNames {
+		field("sysctl", "%s=%s", name, step.Sysctls[name])
+	}
+	if step.Init {
+		field("init", "yes")
+	}
+	if step.StopSignal != "" || step.StopTimeout > 0 {
+		printStop(field, step)
+	}
+	if step.KeepContainer {
+		field("keep container", "yes")
+	}
+	if step.CommitAs != "" {
+		field("commit as", "%s", step.CommitAs)
+	}
+	if step.GPUs != nil {
+		field("gpus", "%s", describeGPUs(step.GPUs))
+	}
+	if stepDefinition.WaitFor != nil {
+		field("wait for", "%s", describeWaitFor(stepDefinition.WaitFor))
+	}
+	printMounts(field, step)
+}
+
+func printCommands(field planField, step *docker.Step) {
+	commands := step.Commands
+	if len(commands) == 0 {
+		commands = [][]string{step.Command}
+	}
+	for i, cmd := range commands {
+		if dir, ok := step.CommandDirs[i]; ok && len(step.Commands) > 0 {
+			field("command", "%s (in %s)", strings.Join(cmd, " "), dir)
+		} else {
+			field("command", "%s", strings.Join(cmd, " "))
+		}
+	}
+}
+
+func printEnvs(field planField, step *docker.Step) {
+	for _, env := range step.Env {
+		// Built-in environment variables are seen by every step, they are not shown
+		if name := strings.SplitN(env, "=", 2)[0]; !contains(builtinEnvNames, name) {
+			field("env", "%s", env)
+		}
+	}
+}
+
+func printMounts(field planField, step *docker.Step) {
+	for _, m := range step.ExtMounts {
+		mode := "read-write"
+		if m.ReadOnly {
+			mode = "read-only"
+		}
+		if m.Consistency != "" {
+			mode += ", " + string(m.Consistency)
+		}
+		if m.BindOptions != nil && m.BindOptions.Propagation != "" {
+			mode += ", " + string(m.BindOptions.Propagation)
+		}
+		switch m.Type {
+		case mount.TypeTmpfs:
+			field("mount", "tmpfs -> %s%s", m.Target, describeTmpfs(m.TmpfsOptions))
+		case mount.TypeVolume:
+			if name, isCache := docker.CacheName(m.Source); isCache {
+				field("mount", "cache %s -> %s (%s)", name, m.Target, mode)
+			} else {
+				field("mount", "volume %s -> %s (%s)", m.Source, m.Target, mode)
+			}
+		default:
+			field("mount", "%s -> %s (%s)", m.Source, m.Target, mode)
+		}
+	}
+}
+
+// describeGPUs returns the GPUs of a device request, either all of them, a number of them or their IDs
+func describeGPUs(gpus *container.DeviceRequest) string {
+	switch {
+	case gpus.Count < 0:
+		return "all"
+	case len(gpus.DeviceIDs) > 0:
+		return "devices " + strings.Join(gpus.DeviceIDs, ", ")
+	}
+	return strconv.Itoa(gpus.Count)
+}
+
+// describeTmpfs returns the size and mode of a tmpfs mount given in its options, if any
+func describeTmpfs(options *mount.TmpfsOptions) string {
+	var details []string
+	if options != nil && options.SizeBytes != 0 {
+		details = append(details, "size "+units.BytesSize(float64(options.SizeBytes)))
+	}
+	if options != nil && options.Mode != 0 {
+		details = append(details, fmt.Sprintf("mode %o", options.Mode))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+// describePlanStep returns the task and name of the step along with its description, if any
+func describePlanStep(step *docker.Step, stepDefinition *config.Step) string {
+	if stepDefinition.Description == "" {
+		return describeStep(step)
+	}
+	return fmt.Sprintf("%s (%s)", describeStep(step), stepDefinition.Description)
+}
+
+// describeStep returns the task and name of the step to identify it in the output
+func describeStep(step *docker.Step) string {
+	if step.Name == "" {
+		return fmt.Sprintf("task '%s'", step.Task)
+	}
+	return fmt.Sprintf("task '%s', step '%s'", step.Task, step.Name)
+}
+
+// printStop prints how the container of the step is stopped once it is canceled, the parts not given by the step
+// being those of the run
+func printStop(field planField, step *docker.Step) {
+	signal, timeout := step.StopSignal, "the stop timeout"
+	if signal == "" {
+		signal = "the signal canceling the run"
+	}
+	if step.StopTimeout > 0 {
+		timeout = step.StopTimeout.String()
+	}
+	field("stop", "%s, killed after %s", signal, timeout)
+}
@@ -0,0 +1,340 @@
+package dunner
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func ExamplePrintPlan() {
+	shellEntrypoint := "sh -c"
+	tasks := map[string]config.Task{
+		"test": {
+			Envs: []string{"GLB=VARBL2"},
+			Steps: []config.Step{
+				{Name: "list", Image: busyBoxImage, User: "20", Commands: []config.Command{{"ls", "$1"}, {"pwd"}}, Envs: []string{"MYVAR=MYVAL"}},
+				{Follow: "build", Args: []string{"/tmp"}, Mounts: []string{"/tmp:/tmp:w"}},
+				{Name: "deploy", Description: "Deploys the build", Image: busyBoxImage, User: "20", Command: []string{"ls"}, When: "$DEPLOY"},
+				{Name: "shell", Image: busyBoxImage, User: "20", Entrypoint: &shellEntrypoint, Command: []string{"echo hi"}, Privileged: true},
+			},
+		},
+		"build": {
+			Steps: []config.Step{
+				{Description: "Lists the packages", Image: busyBoxImage, User: "root", Dir: "pkg", Command: []string{"ls", "$1"}, Mounts: []string{"gocache:/root/.cache"}},
+			},
+		},
+	}
+	configs := &config.Configs{Tasks: tasks}
+
+	if err := PrintPlan(os.Stdout, configs, "test", []string{"/"}); err != nil {
+		panic(err)
+	}
+	// Output:
+	// 1. task 'test', step 'list'
+	//     image:      busybox:1.31
+	//     command:    ls /
+	//     command:    pwd
+	//     user:       20
+	//     env:        MYVAR=MYVAL
+	//     env:        GLB=VARBL2
+	// 2. task 'test': follow task 'build'
+	// 2.1. task 'build' (Lists the packages)
+	//     image:      busybox:1.31
+	//     command:    ls /tmp
+	//     dir:        pkg
+	//     user:       root
+	//     mount:      volume gocache -> /root/.cache (read-only)
+	//     mount:      /tmp -> /tmp (read-write)
+	// 3. task 'test', step 'deploy' (Deploys the build): skipped, condition '$DEPLOY' is not met
+	// 4. task 'test', step 'shell'
+	//     image:      busybox:1.31
+	//     entrypoint: sh -c
+	//     command:    echo hi
+	//     user:       20
+	//     env:        GLB=VARBL2
+	//     privileged: yes
+}
+
+func TestPrintPlanWithInvalidFollowTask(t *testing.T) {
+	tasks := map[string]config.Task{"test": {Steps: []config.Step{{Follow: "missing"}}}}
+	configs := &config.Configs{Tasks: tasks}
+	var out bytes.Buffer
+
+	err := PrintPlan(&out, configs, "test", nil)
+
+	expectedErr := "dunner: task 'missing' does not exist"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestPrintPlanRedactsSecrets(t *testing.T) {
+	step := config.Step{Image: busyBoxImage, User: "20", Command: []string{"login", "$1"}, Envs: []string{"TOKEN=s3cr3t"}}
+	tasks := map[string]config.Task{"deploy": {Secrets: []string{"TOKEN"}, Steps: []config.Step{step}}}
+	configs := &config.Configs{Tasks: tasks}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "deploy", []string{"s3cr3t"}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Fatalf("expected secret to be redacted from plan, got:\n%s", out.String())
+	}
+	for _, expected := range []string{"command:    login ****", "env:        TOKEN=****"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestPrintPlanWithLabels(t *testing.T) {
+	step := config.Step{Name: "compile", Image: busyBoxImage, User: "20", Command: []string{"ls"}, Labels: map[string]string{"team": "core"}}
+	tasks := map[string]config.Task{"build": {Steps: []config.Step{step}}}
+	configs := &config.Configs{Tasks: tasks, Labels: map[string]string{"dunner.task": "ci"}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "build", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    label:      dunner.task=ci\n    label:      team=core\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+	if strings.Contains(out.String(), "dunner.step") {
+		t.Errorf("expected built-in step label not to be shown, got:\n%s", out.String())
+	}
+}
+
+func TestPrintPlanWithHooks(t *testing.T) {
+	hook := func(name string) []config.Step {
+		return []config.Step{{Name: name, Image: busyBoxImage, User: "20", Command: []string{"ls"}}}
+	}
+	tasks := map[string]config.Task{"build": {Steps: hook("compile")}}
+	configs := &config.Configs{Tasks: tasks, Before: hook("notify"), After: hook("report")}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "build", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	var numbers []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, ". task") {
+			numbers = append(numbers, line)
+		}
+	}
+	expected := []string{"before.1. task 'build', step 'notify'", "1. task 'build', step 'compile'", "after.1. task 'build', step 'report'"}
+	if strings.Join(numbers, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected steps: %v, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithTmpfs(t *testing.T) {
+	step := config.Step{Name: "compile", Image: busyBoxImage, User: "20", Command: []string{"ls"}, Tmpfs: []string{"/scratch:size=64m,mode=1777", "/cache"}}
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "build", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    mount:      tmpfs -> /scratch (size 64MiB, mode 1777)\n    mount:      tmpfs -> /cache\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithReadOnlyRootfs(t *testing.T) {
+	step := config.Step{Name: "compile", Image: busyBoxImage, User: "20", Command: []string{"ls"}, ReadOnlyRootfs: true, KeepContainer: true, Tmpfs: []string{"/tmp"}}
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "build", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	for _, expected := range []string{"    rootfs:     read-only\n", "    mount:      tmpfs -> /tmp\n", "    keep container: yes\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestPrintPlanWithSysctls(t *testing.T) {
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}, Sysctls: map[string]string{"net.ipv4.ip_forward": "1", "kernel.shmmax": "1024"}}
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "build", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := "    sysctl:     kernel.shmmax=1024\n    sysctl:     net.ipv4.ip_forward=1\n"; !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithStopSignal(t *testing.T) {
+	steps := []config.Step{
+		{Name: "serve", Image: busyBoxImage, User: "20", Command: []string{"httpd"}, StopSignal: "SIGQUIT", StopTimeout: 30 * time.Second},
+		{Name: "worker", Image: busyBoxImage, User: "20", Command: []string{"worker"}, StopTimeout: time.Minute},
+	}
+	configs := &config.Configs{Tasks: map[string]config.Task{"serve": {Steps: steps}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "serve", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	for _, expected := range []string{
+		"    stop:       SIGQUIT, killed after 30s\n",
+		"    stop:       the signal canceling the run, killed after 1m0s\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestPrintPlanWithCaches(t *testing.T) {
+	step := config.Step{Name: "compile", Image: busyBoxImage, User: "20", Command: []string{"go", "build"}, Caches: []string{"gomod:/go/pkg/mod"}}
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "build", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    mount:      cache gomod -> /go/pkg/mod (read-write)\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithCommandErrorMode(t *testing.T) {
+	step := config.Step{Name: "check", Image: busyBoxImage, User: "20", Commands: []config.Command{{"go", "vet"}, {"go", "test"}}, CommandErrorMode: "continue"}
+	configs := &config.Configs{Tasks: map[string]config.Task{"lint": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "lint", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    command:    go test\n    on error:   continue\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithSharedShell(t *testing.T) {
+	step := config.Step{Name: "check", Image: busyBoxImage, User: "20", Commands: []config.Command{{"cd src"}, {"go test"}}, SharedShell: true}
+	configs := &config.Configs{Tasks: map[string]config.Task{"lint": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "lint", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    command:    go test\n    shell:      sh -c (shared by the commands)\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithGPUs(t *testing.T) {
+	step := config.Step{Name: "train", Image: busyBoxImage, User: "20", Command: []string{"python", "train.py"}, GPUs: "device=0,1"}
+	configs := &config.Configs{Tasks: map[string]config.Task{"ml": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "ml", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    gpus:       devices 0, 1\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithCommitAs(t *testing.T) {
+	step := config.Step{Name: "deps", Image: busyBoxImage, User: "20", Command: []string{"go", "mod", "download"}, CommitAs: "builder:deps"}
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "build", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    commit as:  builder:deps\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestPrintPlanWithPlatform(t *testing.T) {
+	step := config.Step{Name: "test", Image: busyBoxImage, User: "20", Command: []string{"uname", "-m"}, Platform: "linux/arm64"}
+	configs := &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+	var out bytes.Buffer
+
+	if err := PrintPlan(&out, configs, "test", nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := "    platform:   linux/arm64\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected plan to contain %q, got:\n%s", expected, out.String())
+	}
+}
+
+func ExampleRunner_PrintSteps() {
+	tasks := map[string]config.Task{
+		"test": {
+			Envs: []string{"GLB=VARBL2"},
+			Steps: []config.Step{
+				{Name: "list", Image: busyBoxImage, User: "20", Command: []string{"ls", "$1"}, Privileged: true},
+				{Follow: "build", Args: []string{"/tmp"}, Mounts: []string{"/tmp:/tmp:w"}},
+			},
+		},
+		"build": {
+			Steps: []config.Step{
+				{Description: "Lists the packages", Image: busyBoxImage, User: "root", Dir: "pkg", Command: []string{"ls", "$1"}, Envs: []string{"MYVAR=MYVAL"}},
+			},
+		},
+	}
+	configs := &config.Configs{Before: []config.Step{{Image: busyBoxImage, Command: []string{"date"}}}, Tasks: tasks}
+
+	if err := new(Runner).PrintSteps(os.Stdout, configs, "test"); err != nil {
+		panic(err)
+	}
+	// Output:
+	// 1. task 'test', step 'list'
+	//     image:      busybox:1.31
+	//     command:    ls $1
+	//     user:       20
+	//     env:        GLB=VARBL2
+	// 2. task 'test': follow task 'build'
+	// 2.1. task 'build' (Lists the packages)
+	//     image:      busybox:1.31
+	//     command:    ls $1
+	//     user:       root
+	//     env:        MYVAR=MYVAL
+	//     mount:      /tmp -> /tmp (read-write)
+}
+
+func TestPrintStepsWithMissingTask(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{}}
+	var out bytes.Buffer
+
+	err := new(Runner).PrintSteps(&out, configs, "missing")
+
+	expectedErr := "dunner: task 'missing' does not exist"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
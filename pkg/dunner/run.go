@@ -0,0 +1,86 @@
+package dunner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// RunOptions are the settings of a run started with `Run`, given explicitly in place of the command line flags.
+type RunOptions struct {
+	Async       bool     // Whether the steps of the task are run all at once
+	Verbose     bool     // Whether the progress of pulling and building images is printed
+	MaxParallel int      // The maximum number of follow tasks run in parallel, 1 if zero
+	Env         []string // Environment variables of the form KEY=VALUE passed to every step, overriding the task file
+	Registry    string   // Registry or mirror that images given without a registry are pulled from
+	ForcePull   bool     // Whether the images are pulled before every step, whatever their pull policy
+	NoHooks     bool     // Whether the `before` and `after` hooks of the task file are not run
+}
+
+// RunResult is the result of a run started with `Run`, with the results of its steps in the order they finished
+type RunResult struct {
+	Steps    []StepResult
+	Duration time.Duration
+
+	mu sync.Mutex
+}
+
+// StepResult is the result of a step run by `Run`, along with the output of its command(s)
+type StepResult struct {
+	Task     string
+	Step     string
+	Image    string
+	ExitCode int
+	Duration time.Duration
+	Stdout   string
+	Stderr   string
+	Err      error // The error of the step, nil if it succeeded
+}
+
+// Run runs the task of the parsed task file with the arguments, as `dunner do` would with the settings of opts,
+// capturing the output of the steps rather than printing it. The results of the steps that ran are returned
+// along with the error of the task, if any. The global settings of the command line are not used.
+func Run(configs *config.Configs, task string, args []string, opts RunOptions) (*RunResult, error) {
+	if _, exists := configs.Tasks[task]; !exists {
+		return nil, fmt.Errorf("dunner: task '%s' does not exist", task)
+	}
+	if opts.MaxParallel < 0 {
+		return nil, errors.New("dunner: max-parallel cannot be negative")
+	}
+	if opts.MaxParallel == 0 {
+		opts.MaxParallel = 1
+	}
+	if err := validateArgs(task, configs.Tasks[task], args); err != nil {
+		return nil, err
+	}
+
+	r := &Runner{
+		Async:       opts.Async,
+		Verbose:     opts.Verbose && !opts.Async,
+		MaxParallel: opts.MaxParallel,
+		Env:         opts.Env,
+		Registry:    opts.Registry,
+		ForcePull:   opts.ForcePull,
+		NoHooks:     opts.NoHooks,
+		Output:      textOutput,
+		run:         &RunResult{},
+		images:      docker.NewImageCache(),
+	}
+	if _, err := r.getCLIEnvs(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	err := r.ExecTask(configs, task, args, nil)
+	r.run.Duration = time.Since(start)
+	return r.run, err
+}
+
+func (r *RunResult) record(step StepResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Steps = append(r.Steps, step)
+}
@@ -0,0 +1,59 @@
+package dunner
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/viper"
+)
+
+func TestRunCapturesStepResults(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("Env", []string{"INVALID"})
+	defer stubExecStep(func(s docker.Step) error {
+		fmt.Fprintf(s.Stdout, "%s %v", s.Name, s.Env[0])
+		if s.Name == "test" {
+			fmt.Fprint(s.Stderr, "1 test failed")
+			return &docker.ExitError{Code: 1}
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "build", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "test", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := &config.Configs{Tasks: map[string]config.Task{"ci": {Steps: steps}}}
+
+	result, err := Run(configs, "ci", nil, RunOptions{Env: []string{"STAGE=dev"}})
+
+	if ExitCode(err) != 1 {
+		t.Fatalf("expected error of the failed step, got: %v", err)
+	}
+	if len(result.Steps) != 2 {
+		t.Fatalf("expected results of 2 steps, got: %v", result.Steps)
+	}
+	build, test := result.Steps[0], result.Steps[1]
+	if build.Step != "build" || build.Stdout != "build STAGE=dev" || build.Err != nil {
+		t.Errorf("unexpected result of the build step: %+v", build)
+	}
+	if test.Step != "test" || test.ExitCode != 1 || test.Stderr != "1 test failed" || test.Err == nil {
+		t.Errorf("unexpected result of the test step: %+v", test)
+	}
+	if expected := []string{"INVALID"}; !reflect.DeepEqual(expected, viper.GetStringSlice("Env")) {
+		t.Errorf("expected settings of the command line to be left untouched, got: %v", viper.GetStringSlice("Env"))
+	}
+}
+
+func TestRunWithMissingTask(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{}}
+
+	_, err := Run(configs, "ci", nil, RunOptions{})
+
+	expectedErr := "dunner: task 'ci' does not exist"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
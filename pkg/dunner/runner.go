@@ -0,0 +1,115 @@
+package dunner
+
+import (
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/viper"
+)
+
+// Runner runs the tasks of a task file with its own settings, in place of the global settings of the command
+// line, so that runs with different settings can coexist in one process. Its fields are the settings of the
+// flags of `dunner do` of the same name.
+type Runner struct {
+	TaskFile         string        // Path of the task file
+	WorkingDirectory string        // Directory of the host mounted on the containers
+	Async            bool          // Whether the steps of a task are run all at once
+	Verbose          bool          // Whether the progress of images is printed, and messages are logged at debug level
+	VerboseDocker    bool          // Whether the progress of pulling images is streamed to stderr
+	Quiet            bool          // Whether only the errors are printed
+	LogLevel         string        // Level of the messages logged, one of logger.LogLevels, per Verbose if empty
+	DryRun           bool          // Whether the plan of the tasks is printed instead of running them
+	Explain          bool          // Whether the docker run command lines of the steps are printed instead of running them
+	Tasks            bool          // Whether the arguments are the names of many tasks to run, each followed by its own arguments
+	ForcePull        bool          // Whether the images are pulled before every step, whatever their pull policy
+	Registry         string        // Registry or mirror that images given without a registry are pulled from
+	MaxParallel      int           // The maximum number of follow tasks run in parallel, unlimited if zero
+	Output           string        // Format of the output, `text` or `json`
+	Env              []string      // Environment variables of the form KEY=VALUE passed to every step
+	Args             []string      // Named arguments of the form NAME=VALUE passed to every step
+	Only             []string      // Names of the only steps run of the tasks
+	Skip             []string      // Names of the steps not run
+	Watch            []string      // Glob patterns of the files re-running the tasks when they change
+	FailFast         bool          // Whether a run of many tasks stops at the first that fails
+	NoSummary        bool          // Whether the summary of how long the steps took is not printed
+	NoHooks          bool          // Whether the `before` and `after` hooks of the task file are not run
+	NoPrivileged     bool          // Whether steps running privileged containers fail
+	NoDockerSocket   bool          // Whether steps needing the Docker socket fail
+	ListSteps        string        // Task whose resolved steps are listed by `ListTasks` in place of the tasks
+	ExecIn           string        // Name or ID of the running container that the commands are run in, instead of new ones
+	Init             bool          // Whether the containers of the steps run an init process, unless the step disables it
+	KeepContainers   bool          // Whether the containers of the steps are kept running once done, rather than removed
+	NameTemplate     string        // Template of the names of the containers, like `dunner-{task}-{step}-{run}`, random names if empty
+	Prefix           bool          // Whether every output line of the steps is prefixed by their task and step number
+	Color            bool          // Whether the output prefixes of the steps are colored
+	StopTimeout      time.Duration // How long the containers have to exit once the run is interrupted, before they are killed
+	Timeout          time.Duration // The maximum duration of the run, after which the running steps are stopped, zero means no limit
+	Force            bool          // Whether the tasks with `inputs` are run even if their inputs did not change
+
+	cancel   <-chan struct{}    // Closing it cancels the steps of the run in progress, in watch mode or on a shutdown
+	shutdown *docker.Shutdown   // The graceful shutdown of the run on SIGINT or SIGTERM, if the signals are handled
+	summary  *runSummary        // The summary of the run in progress, nil if no summary is recorded
+	images   *docker.ImageCache // The images on the host in the run in progress, checked for or pulled once per run
+	run      *RunResult         // The result of the run started with `Run` in progress, if any
+	runID    string             // The short random ID of the run in progress, in the names of its containers
+
+	followSlots taskSlots   // The slots of the follow tasks running in parallel
+	followNodes followNodes // The nodes of the follow graphs being run, see scheduleFollows
+}
+
+// NewRunner returns a runner with the global settings of the command line
+func NewRunner() *Runner {
+	return &Runner{
+		TaskFile:         viper.GetString("DunnerTaskFile"),
+		WorkingDirectory: viper.GetString("WorkingDirectory"),
+		Async:            viper.GetBool("Async"),
+		Verbose:          viper.GetBool("Verbose"),
+		LogLevel:         viper.GetString("Log-level"),
+		VerboseDocker:    viper.GetBool("Verbose-docker"),
+		Quiet:            viper.GetBool("Quiet"),
+		DryRun:           viper.GetBool("Dry-run"),
+		Explain:          viper.GetBool("Explain"),
+		Tasks:            viper.GetBool("Tasks"),
+		ForcePull:        viper.GetBool("Force-pull"),
+		Registry:         viper.GetString("Registry"),
+		MaxParallel:      viper.GetInt("Max-parallel"),
+		Output:           viper.GetString("Output"),
+		Env:              viper.GetStringSlice("Env"),
+		Args:             viper.GetStringSlice("Arg"),
+		Only:             viper.GetStringSlice("Only"),
+		Skip:             viper.GetStringSlice("Skip"),
+		Watch:            viper.GetStringSlice("Watch"),
+		FailFast:         viper.GetBool("Fail-fast"),
+		NoSummary:        viper.GetBool("No-summary"),
+		NoHooks:          viper.GetBool("No-hooks"),
+		NoPrivileged:     viper.GetBool("No-privileged"),
+		NoDockerSocket:   viper.GetBool("No-docker-socket"),
+		ListSteps:        viper.GetString("List-steps"),
+		ExecIn:           viper.GetString("Exec-in"),
+		Init:             viper.GetBool("Init"),
+		KeepContainers:   viper.GetBool("Keep-containers"),
+		NameTemplate:     viper.GetString("Container-name-template"),
+		Prefix:           viper.GetBool("Prefix"),
+		Color:            viper.GetBool("Color"),
+		StopTimeout:      viper.GetDuration("Stop-timeout"),
+		Timeout:          viper.GetDuration("Timeout"),
+		Force:            viper.GetBool("Force-run"),
+	}
+}
+
+// dockerSettings returns the settings of the docker layer for the steps run by the runner
+func (r *Runner) dockerSettings() *docker.Settings {
+	return &docker.Settings{
+		Async:            r.Async,
+		Verbose:          r.Verbose,
+		VerboseDocker:    r.VerboseDocker,
+		Quiet:            r.Quiet,
+		DryRun:           r.DryRun,
+		ForcePull:        r.ForcePull,
+		WorkingDirectory: r.WorkingDirectory,
+		ExecIn:           r.ExecIn,
+
+		ContainerNameTemplate: r.NameTemplate,
+		RunID:                 r.runID,
+	}
+}
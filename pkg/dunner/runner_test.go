@@ -0,0 +1,28 @@
+package dunner
+
+import (
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func TestRunnersWithDifferentSettings(t *testing.T) {
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	staging := &Runner{Async: true, Registry: "staging.internal"}
+	production := &Runner{DryRun: true, Registry: "production.internal"}
+
+	for runner, expected := range map[*Runner]string{staging: "staging.internal", production: "production.internal"} {
+		stepDefinition := config.Step{Image: busyBoxImage}
+		step, _, err := runner.resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if step.Registry != expected {
+			t.Errorf("expected registry: %s, got: %s", expected, step.Registry)
+		}
+		if step.Settings.Async != runner.Async || step.Settings.DryRun != runner.DryRun {
+			t.Errorf("expected settings of the runner, got: %+v", step.Settings)
+		}
+	}
+}
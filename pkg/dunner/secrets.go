@@ -0,0 +1,62 @@
+package dunner
+
+import (
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// secretValues returns the values of the secrets of the task and the global level, which are the names of
+// environment variables. Values are looked up in the environment variables of the step first, then in the
+// host environment.
+func secretValues(configs *config.Configs, taskName string, envs []string) []string {
+	var values []string
+	for _, name := range append(append([]string{}, configs.Tasks[taskName].Secrets...), configs.Secrets...) {
+		if value, found := lookupEnv(envs, name); found && value != "" {
+			values = append(values, value)
+		} else if value := os.Getenv(name); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// registryAuths returns the credentials of the registries of the task file by host, along with the passwords
+// and tokens among them, which are redacted from the output like secrets.
+func registryAuths(configs *config.Configs) (map[string]types.AuthConfig, []string, error) {
+	if len(configs.Auth) == 0 {
+		return nil, nil, nil
+	}
+	auths := make(map[string]types.AuthConfig, len(configs.Auth))
+	var secrets []string
+	for registry, auth := range configs.Auth {
+		auth, err := auth.ParseEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		auths[registry] = types.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			RegistryToken: auth.Token,
+			ServerAddress: registry,
+		}
+		for _, secret := range []string{auth.Password, auth.Token} {
+			if secret != "" {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	return auths, secrets, nil
+}
+
+// lookupEnv returns the value of the first environment variable of the given name in the `KEY=VALUE` list
+func lookupEnv(envs []string, name string) (string, bool) {
+	for _, env := range envs {
+		if pair := strings.SplitN(env, "=", 2); len(pair) == 2 && pair[0] == name {
+			return pair[1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,67 @@
+package dunner
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func TestSecretValues(t *testing.T) {
+	os.Setenv("DUNNER_HOST_SECRET", "host-value")
+	defer os.Unsetenv("DUNNER_HOST_SECRET")
+	tasks := map[string]config.Task{"deploy": {Secrets: []string{"TOKEN", "MISSING"}}}
+	configs := &config.Configs{Tasks: tasks, Secrets: []string{"DUNNER_HOST_SECRET"}}
+
+	values := secretValues(configs, "deploy", []string{"APP=dunner", "TOKEN=s3cr3t"})
+
+	expected := []string{"s3cr3t", "host-value"}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected secret values: %v, got: %v", expected, values)
+	}
+}
+
+func TestResolveStepWithSecrets(t *testing.T) {
+	tasks := map[string]config.Task{"deploy": {Secrets: []string{"TOKEN"}, Envs: []string{"TOKEN=s3cr3t"}}}
+	configs := &config.Configs{Tasks: tasks}
+	stepDefinition := config.Step{Image: busyBoxImage}
+
+	step, _, err := new(Runner).resolveStep(configs, "deploy", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"s3cr3t"}; !reflect.DeepEqual(expected, step.Secrets) {
+		t.Errorf("expected secrets: %v, got: %v", expected, step.Secrets)
+	}
+}
+
+func TestRegistryAuths(t *testing.T) {
+	os.Setenv("DUNNER_REGISTRY_TOKEN", "t0ken")
+	defer os.Unsetenv("DUNNER_REGISTRY_TOKEN")
+	auth := map[string]config.RegistryAuth{
+		"docker.io": {Username: "user", Password: "pass"},
+		"quay.io":   {Token: "$DUNNER_REGISTRY_TOKEN"},
+	}
+	configs := &config.Configs{Auth: auth}
+
+	auths, secrets, err := registryAuths(configs)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := map[string]types.AuthConfig{
+		"docker.io": {Username: "user", Password: "pass", ServerAddress: "docker.io"},
+		"quay.io":   {RegistryToken: "t0ken", ServerAddress: "quay.io"},
+	}
+	if !reflect.DeepEqual(auths, expected) {
+		t.Errorf("expected credentials %v, got %v", expected, auths)
+	}
+	sort.Strings(secrets)
+	if expected := []string{"pass", "t0ken"}; !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("expected secrets %v, got %v", expected, secrets)
+	}
+}
@@ -0,0 +1,75 @@
+package dunner
+
+import (
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// signalNames are the names of the signals shutting down a run, as sent to the containers
+var signalNames = map[os.Signal]string{os.Interrupt: "SIGINT", syscall.SIGTERM: "SIGTERM"}
+
+// handleSignals shuts the run down gracefully on SIGINT or SIGTERM: the signal is forwarded to the containers of
+// all the running steps, which are killed if they do not exit within the stop timeout, and the steps after them
+// are canceled. Another signal exits at once. It returns the function to call once the run is done, to stop
+// handling the signals.
+func (r *Runner) handleSignals() func() {
+	shutdown := docker.NewShutdown(r.StopTimeout)
+	r.shutdown, r.cancel = shutdown, shutdown.Done()
+	stop := notifySignals(shutdown.Start)
+	return func() {
+		stop()
+		r.shutdown, r.cancel = nil, nil
+	}
+}
+
+// notifySignals calls onSignal with the name of the first SIGINT or SIGTERM received, after which the default
+// handling of the signals is restored, so that another signal exits at once. It returns the function to call to
+// stop handling the signals.
+func notifySignals(onSignal func(name string)) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			log.Warnf("Received %s, stopping the running steps, send it again to exit at once", signalNames[sig])
+			onSignal(signalNames[sig])
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// withTimeout runs the run with the timeout of `--timeout`, if any. Once it has run for the timeout, it is shut down
+// like on SIGTERM and fails with a timeout error, unless it is already shutting down on a signal. It needs the
+// signals to be handled, for the run to have a shutdown.
+func (r *Runner) withTimeout(run func() error) error {
+	if r.Timeout <= 0 {
+		return run()
+	}
+	var timedOut int32
+	shutdown := r.shutdown
+	timer := time.AfterFunc(r.Timeout, func() {
+		if shutdown.Signal() == "" {
+			atomic.StoreInt32(&timedOut, 1)
+			log.Warnf("Run timed out after %s, stopping the running steps", r.Timeout)
+			shutdown.Start("SIGTERM")
+		}
+	})
+	err := run()
+	timer.Stop()
+	if err != nil && atomic.LoadInt32(&timedOut) == 1 {
+		return &runTimeoutError{timeout: r.Timeout, err: err}
+	}
+	return err
+}
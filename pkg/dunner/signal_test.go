@@ -0,0 +1,101 @@
+package dunner
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestHandleSignalsCancelsSteps(t *testing.T) {
+	r := &Runner{StopTimeout: time.Second}
+	stop := r.handleSignals()
+	defer stop()
+
+	var canceled docker.Step
+	defer stubExecStep(func(s docker.Step) error {
+		process, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := process.Signal(syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-s.Cancel:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected step to be canceled on SIGTERM")
+		}
+		canceled = s
+		return docker.ErrCanceled
+	})()
+	steps := []config.Step{
+		{Name: "serve", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "after", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"dev": {Steps: steps}}}
+
+	err := r.ExecTask(&configs, "dev", nil, nil)
+
+	if err != docker.ErrCanceled {
+		t.Fatalf("expected error: %s, got: %v", docker.ErrCanceled, err)
+	}
+	if canceled.Name != "serve" || canceled.Shutdown == nil || canceled.Shutdown.Signal() != "SIGTERM" {
+		t.Errorf("expected serve step to be shut down with SIGTERM, got: %+v", canceled)
+	}
+	if canceled.Shutdown != nil && canceled.Shutdown.GracePeriod != time.Second {
+		t.Errorf("expected grace period of the stop timeout, got: %s", canceled.Shutdown.GracePeriod)
+	}
+}
+
+func TestWithTimeoutStopsRun(t *testing.T) {
+	r := &Runner{StopTimeout: time.Second, Timeout: 10 * time.Millisecond}
+	stop := r.handleSignals()
+	defer stop()
+
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		select {
+		case <-s.Cancel:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected step to be canceled once the run timed out")
+		}
+		if s.Shutdown.Signal() != "SIGTERM" {
+			t.Errorf("expected step to be shut down with SIGTERM, got: %s", s.Shutdown.Signal())
+		}
+		return docker.ErrCanceled
+	})()
+	steps := []config.Step{
+		{Name: "serve", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "after", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"dev": {Steps: steps}}}
+
+	err := r.withTimeout(func() error { return r.ExecTask(&configs, "dev", nil, nil) })
+
+	expected := "dunner: run timed out after 10ms, the running steps were stopped"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+	if !errors.Is(err, docker.ErrCanceled) {
+		t.Errorf("expected error to wrap the error of the canceled step, got: %v", err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("expected only the first step to run, got: %v", ran)
+	}
+}
+
+func TestWithTimeoutOfRunDoneInTime(t *testing.T) {
+	r := &Runner{Timeout: time.Hour}
+	stop := r.handleSignals()
+	defer stop()
+
+	if err := r.withTimeout(func() error { return nil }); err != nil {
+		t.Errorf("expected no error, got: %s", err)
+	}
+}
@@ -0,0 +1,32 @@
+package dunner
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// dockerSocketPath is the path of the Docker socket on the host, which is mounted at the same path in the container
+var dockerSocketPath = "/var/run/docker.sock"
+
+// mountDockerSocket mounts the Docker socket of the host into the container of the step, adding the user of the
+// container to the group owning the socket. It fails if the Docker socket is disabled with `--no-docker-socket`.
+func (r *Runner) mountDockerSocket(step *docker.Step) error {
+	if r.NoDockerSocket {
+		return fmt.Errorf("dunner: %s needs the Docker socket, which is disabled with --no-docker-socket", describeStep(step))
+	}
+	group, err := dockerSocketGroup()
+	if err != nil {
+		return err
+	}
+	step.ExtMounts = append(step.ExtMounts, mount.Mount{
+		Type:   mount.TypeBind,
+		Source: dockerSocketPath,
+		Target: dockerSocketPath,
+	})
+	if group != "" {
+		step.GroupAdd = append(step.GroupAdd, group)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package dunner
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func stubDockerSocket(t *testing.T) func() {
+	tmpFile, err := ioutil.TempFile("", "docker.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	original := dockerSocketPath
+	dockerSocketPath = tmpFile.Name()
+	return func() {
+		dockerSocketPath = original
+		os.Remove(tmpFile.Name())
+	}
+}
+
+func TestResolveStepWithDockerSocket(t *testing.T) {
+	defer stubDockerSocket(t)()
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Image: "docker", DockerSocket: true}
+
+	step, _, err := new(Runner).resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := mount.Mount{Type: mount.TypeBind, Source: dockerSocketPath, Target: dockerSocketPath}
+	if len(step.ExtMounts) != 1 || step.ExtMounts[0] != expected {
+		t.Errorf("expected docker socket mount: %v, got: %v", expected, step.ExtMounts)
+	}
+	if expected := strconv.Itoa(os.Getgid()); runtime.GOOS != "windows" && !reflect.DeepEqual([]string{expected}, step.GroupAdd) {
+		t.Errorf("expected the group of the docker socket '%s' to be added, got: %v", expected, step.GroupAdd)
+	}
+}
+
+func TestResolveStepWithDockerSocketDisabled(t *testing.T) {
+	defer stubDockerSocket(t)()
+	r := &Runner{NoDockerSocket: true}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {}}}
+	stepDefinition := config.Step{Name: "image", Image: "docker", DockerSocket: true}
+
+	_, _, err := r.resolveStep(&configs, "test", 1, &stepDefinition, nil, nil, nil)
+
+	expectedErr := "dunner: task 'test', step 'image' needs the Docker socket, which is disabled with --no-docker-socket"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
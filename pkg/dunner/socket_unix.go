@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package dunner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// dockerSocketGroup returns the id of the group owning the Docker socket on the host
+func dockerSocketGroup() (string, error) {
+	info, err := os.Stat(dockerSocketPath)
+	if err != nil {
+		return "", fmt.Errorf("dunner: failed to find the Docker socket: %s", err.Error())
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", nil
+	}
+	return strconv.FormatUint(uint64(stat.Gid), 10), nil
+}
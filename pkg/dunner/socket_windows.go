@@ -0,0 +1,6 @@
+package dunner
+
+// dockerSocketGroup returns no group on Windows, where the Docker socket is not owned by a group
+func dockerSocketGroup() (string, error) {
+	return "", nil
+}
@@ -0,0 +1,142 @@
+package dunner
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// stepEnvName is the name of the environment variable with the path of the file that a step writes the
+// environment variables of the steps after it to, as lines of the form KEY=VALUE
+const stepEnvName = "DUNNER_ENV"
+
+// stepEnvTarget is the path in the container of the file of environment variables written by the step
+const stepEnvTarget = "/.dunner_env"
+
+// processStepWithEnv processes the step with the environment variables written by the previous steps of the task,
+// and mounts the file given as DUNNER_ENV for the step to write those of the steps after it. The variables written
+// by the step are added to generated, even if it failed, overriding the ones of the previous steps, as well as its
+// output as the variable of its `captureAs` if it succeeded. Steps run in the existing container of `--exec-in` get
+// the variables of the previous steps, but no file to write to.
+func (r *Runner) processStepWithEnv(configs *config.Configs, step *docker.Step, args []string, stepDefinition *config.Step, generated *[]string) error {
+	if err := r.applyStepEnvs(step, stepDefinition, *generated); err != nil {
+		return err
+	}
+	if stepDefinition.CaptureAs != "" {
+		step.Capture = &bytes.Buffer{}
+	}
+
+	var envs []string
+	var err error
+	if r.ExecIn != "" {
+		// The file cannot be mounted on an existing container, so the variables are only passed on
+		_, err = r.processStep(configs, step, args, stepDefinition)
+	} else {
+		envs, err = r.processStepWithEnvFile(configs, step, args, stepDefinition)
+	}
+	if err == nil && step.Capture != nil {
+		envs = append([]string{stepDefinition.CaptureAs + "=" + capturedValue(step.Capture.String())}, envs...)
+	}
+	*generated = append(envs, *generated...)
+	return err
+}
+
+// processStepWithEnvFile processes the step with the file given as DUNNER_ENV mounted, and returns the environment
+// variables written to it by the step, even if it failed.
+func (r *Runner) processStepWithEnvFile(configs *config.Configs, step *docker.Step, args []string, stepDefinition *config.Step) ([]string, error) {
+	file, err := ioutil.TempFile("", "dunner-env")
+	if err != nil {
+		return nil, fmt.Errorf("dunner: failed to create environment file of %s: %s", describeStep(step), err.Error())
+	}
+	defer os.Remove(file.Name())
+	// The user of the container may not be the one of the host
+	if err := file.Chmod(0666); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("dunner: failed to create environment file of %s: %s", describeStep(step), err.Error())
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("dunner: failed to create environment file of %s: %s", describeStep(step), err.Error())
+	}
+	step.ExtMounts = append(step.ExtMounts, mount.Mount{Type: mount.TypeBind, Source: file.Name(), Target: stepEnvTarget})
+	step.Env = append(step.Env, stepEnvName+"="+stepEnvTarget)
+
+	_, err = r.processStep(configs, step, args, stepDefinition)
+	envs, readErr := readStepEnv(file.Name(), step)
+	if readErr != nil && err == nil {
+		return nil, readErr
+	}
+	return envs, err
+}
+
+// applyStepEnvs adds the environment variables written by the previous steps of the task to the step. They
+// override the variables of the task and the task file, but not those of the step itself or passed with `--env`.
+func (r *Runner) applyStepEnvs(step *docker.Step, stepDefinition *config.Step, generated []string) error {
+	if len(generated) == 0 {
+		return nil
+	}
+	cliEnvs, err := r.getCLIEnvs()
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]bool)
+	for _, env := range append(cliEnvs, stepDefinition.Envs...) {
+		kept[envKey(env)] = true
+	}
+	seen := make(map[string]bool)
+	var envs []string
+	for _, env := range step.Env {
+		if kept[envKey(env)] && !seen[envKey(env)] {
+			envs = append(envs, env)
+			seen[envKey(env)] = true
+		}
+	}
+	for _, env := range append(generated, step.Env...) {
+		if !seen[envKey(env)] {
+			envs = append(envs, env)
+			seen[envKey(env)] = true
+		}
+	}
+	step.Env = envs
+	return nil
+}
+
+// readStepEnv returns the environment variables written by the step to its environment file, skipping empty
+// lines and comments starting with `#`
+func readStepEnv(file string, step *docker.Step) ([]string, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("dunner: failed to read environment file written by %s: %s", describeStep(step), err.Error())
+	}
+	var envs []string
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if envKey(line) == "" || !strings.Contains(line, "=") {
+			return nil, fmt.Errorf("dunner: line %d of the environment file written by %s must be of the form KEY=VALUE, got: %s", i+1, describeStep(step), line)
+		}
+		envs = append(envs, line)
+	}
+	// The last of the variables of the same key written by the step is the one kept
+	for i, j := 0, len(envs)-1; i < j; i, j = i+1, j-1 {
+		envs[i], envs[j] = envs[j], envs[i]
+	}
+	return envs, nil
+}
+
+// capturedValue returns the output captured from a step as the value of an environment variable, without the
+// whitespace around it. Line endings of multi-line output are normalized to newlines.
+func capturedValue(output string) string {
+	return strings.TrimSpace(strings.Replace(output, "\r\n", "\n", -1))
+}
+
+func envKey(env string) string {
+	return strings.SplitN(env, "=", 2)[0]
+}
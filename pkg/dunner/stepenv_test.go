@@ -0,0 +1,154 @@
+package dunner
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// writeStepEnv writes the contents to the environment file mounted on the container of the step
+func writeStepEnv(t *testing.T, s docker.Step, contents string) {
+	for _, m := range s.ExtMounts {
+		if m.Target == stepEnvTarget {
+			if err := ioutil.WriteFile(m.Source, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected environment file to be mounted on %s", describeStep(&s))
+}
+
+func TestExecTaskPassesEnvsWrittenByPreviousSteps(t *testing.T) {
+	envs := map[string][]string{}
+	defer stubExecStep(func(s docker.Step) error {
+		envs[s.Name] = s.Env
+		switch s.Name {
+		case "version":
+			writeStepEnv(t, s, "# Computed version\nVERSION=1.0\nVERSION=1.1\n\nTAG=latest\n")
+		case "tag":
+			writeStepEnv(t, s, "TAG=v1.1\n")
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "version", Image: busyBoxImage, Command: []string{"ls"}},
+		{Name: "tag", Image: busyBoxImage, Command: []string{"ls"}, Envs: []string{"TAG=pinned"}},
+		{Name: "push", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"release": {Envs: []string{"VERSION=0.0"}, Steps: steps}}}
+
+	if err := new(Runner).ExecTask(&configs, "release", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := map[string]string{"VERSION": "1.1", "TAG": "v1.1", stepEnvName: stepEnvTarget}
+	if got := envMap(envs["push"]); !reflect.DeepEqual(expected, filterEnvs(got, expected)) {
+		t.Errorf("expected environment variables of push step: %v, got: %v", expected, envs["push"])
+	}
+	if got := envMap(envs["tag"]); got["TAG"] != "pinned" || got["VERSION"] != "1.1" {
+		t.Errorf("expected environment variables of the step to be kept, got: %v", envs["tag"])
+	}
+	if got := envMap(envs["version"]); got["VERSION"] != "0.0" {
+		t.Errorf("expected environment variables of the task before any is written, got: %v", envs["version"])
+	}
+}
+
+func TestExecTaskWithInvalidStepEnv(t *testing.T) {
+	defer stubExecStep(func(s docker.Step) error {
+		writeStepEnv(t, s, "VERSION\n")
+		return nil
+	})()
+	step := config.Step{Name: "version", Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{"release": {Steps: []config.Step{step}}}}
+
+	err := new(Runner).ExecTask(&configs, "release", nil, nil)
+
+	expectedErr := "dunner: line 1 of the environment file written by task 'release', step 'version' must be of the form KEY=VALUE, got: VERSION"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExecTaskPassesCapturedOutput(t *testing.T) {
+	envs := map[string][]string{}
+	attempts := 0
+	defer stubExecStep(func(s docker.Step) error {
+		envs[s.Name] = s.Env
+		switch s.Name {
+		case "sha":
+			attempts++
+			if attempts == 1 {
+				s.Capture.WriteString("failed attempt\n")
+				return &docker.ExitError{Code: 1}
+			}
+			s.Capture.WriteString("abc123\r\n")
+		case "log":
+			s.Capture.WriteString("\nfirst line\r\nsecond line\n\n")
+			writeStepEnv(t, s, "SHA=overridden\nLOG=overridden\n")
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "sha", Image: busyBoxImage, Command: []string{"git", "rev-parse", "HEAD"}, CaptureAs: "SHA", Retries: 1},
+		{Name: "log", Image: busyBoxImage, Command: []string{"git", "log"}, CaptureAs: "LOG"},
+		{Name: "push", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"release": {Steps: steps}}}
+
+	if err := new(Runner).ExecTask(&configs, "release", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := map[string]string{"SHA": "overridden", "LOG": "first line\nsecond line"}
+	if got := envMap(envs["push"]); !reflect.DeepEqual(expected, filterEnvs(got, expected)) {
+		t.Errorf("expected environment variables of push step: %v, got: %v", expected, envs["push"])
+	}
+	if got := envMap(envs["log"]); got["SHA"] != "abc123" {
+		t.Errorf("expected output of the last attempt of sha step, got: %v", envs["log"])
+	}
+}
+
+func TestExecTaskDoesNotCaptureOutputOfFailedStep(t *testing.T) {
+	envs := map[string][]string{}
+	defer stubExecStep(func(s docker.Step) error {
+		envs[s.Name] = s.Env
+		if s.Name == "sha" {
+			s.Capture.WriteString("abc123")
+			return &docker.ExitError{Code: 1}
+		}
+		return nil
+	})()
+	steps := []config.Step{
+		{Name: "sha", Image: busyBoxImage, Command: []string{"ls"}, CaptureAs: "SHA", ContinueOnError: true},
+		{Name: "push", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"release": {Steps: steps}}}
+
+	new(Runner).ExecTask(&configs, "release", nil, nil)
+
+	if _, exists := envMap(envs["push"])["SHA"]; exists {
+		t.Errorf("expected no output captured from the failed step, got: %v", envs["push"])
+	}
+}
+
+func envMap(envs []string) map[string]string {
+	values := make(map[string]string)
+	for _, env := range envs {
+		if _, exists := values[envKey(env)]; !exists {
+			values[envKey(env)] = env[len(envKey(env))+1:]
+		}
+	}
+	return values
+}
+
+func filterEnvs(values map[string]string, keys map[string]string) map[string]string {
+	filtered := make(map[string]string)
+	for key := range keys {
+		filtered[key] = values[key]
+	}
+	return filtered
+}
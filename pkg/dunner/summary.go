@@ -0,0 +1,95 @@
+package dunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// runSummary records how long the steps of a run took, to be printed at the end of the run unless the
+// `--no-summary` flag is set.
+type runSummary struct {
+	mu    sync.Mutex
+	start time.Time
+	steps []stepTiming
+}
+
+// stepTiming is the time a step took to run. Start and end are in seconds since the start of the run, so that
+// steps running concurrently in asynchronous mode can be seen overlapping.
+type stepTiming struct {
+	Task     string  `json:"task"`
+	Step     string  `json:"step"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"` // In seconds
+	Failed   bool    `json:"failed"`
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{start: time.Now()}
+}
+
+func (s *runSummary) record(step *docker.Step, start time.Time, end time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, stepTiming{
+		Task:     step.Task,
+		Step:     step.Name,
+		Start:    start.Sub(s.start).Seconds(),
+		End:      end.Sub(s.start).Seconds(),
+		Duration: end.Sub(start).Seconds(),
+		Failed:   err != nil,
+	})
+}
+
+// write writes the summary to w as an aligned table, with the start and end of every step in asynchronous mode,
+// or as a JSON object with `--output json`.
+func (s *runSummary) write(w io.Writer, output string, async bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := time.Since(s.start).Seconds()
+
+	if output == jsonOutput {
+		summary := struct {
+			Steps    []stepTiming `json:"steps"`
+			Duration float64      `json:"duration"` // In seconds
+		}{s.steps, total}
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		return json.NewEncoder(w).Encode(map[string]interface{}{"summary": summary})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nSummary:")
+	if async {
+		fmt.Fprintln(tw, "TASK\tSTEP\tSTATUS\tSTART\tEND\tDURATION")
+	} else {
+		fmt.Fprintln(tw, "TASK\tSTEP\tSTATUS\tDURATION")
+	}
+	for _, step := range s.steps {
+		name, status := step.Step, "ok"
+		if name == "" {
+			name = "-"
+		}
+		if step.Failed {
+			status = "failed"
+		}
+		if async {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", step.Task, name, status, seconds(step.Start), seconds(step.End), seconds(step.Duration))
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", step.Task, name, status, seconds(step.Duration))
+		}
+	}
+	fmt.Fprintf(tw, "Total: %s\n", seconds(total))
+	return tw.Flush()
+}
+
+// seconds formats the number of seconds as a duration rounded to milliseconds
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Millisecond).String()
+}
@@ -0,0 +1,111 @@
+package dunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+var summaryTestConfigs = &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{
+	{Name: "build", Image: busyBoxImage, Command: []string{"ls"}},
+	{Follow: "lint"},
+}}, "lint": {Steps: []config.Step{{Image: busyBoxImage, Command: []string{"ls"}}}}}}
+
+func TestDoTasksWritesSummary(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(original io.Writer) { resultWriter = original }(resultWriter)
+	resultWriter = &buf
+	defer stubExecStep(func(docker.Step) error { return nil })()
+
+	if err := new(Runner).doTasks(summaryTestConfigs, "test", []string{}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := regexp.MustCompile(`^
+Summary:
+TASK  STEP   STATUS  DURATION
+test  build  ok      \S+
+lint  -      ok      \S+
+Total: \S+
+$`)
+	if !expected.MatchString(buf.String()) {
+		t.Errorf("expected summary to match %s, got:\n%s", expected, buf.String())
+	}
+}
+
+func TestDoTasksWritesSummaryWithStartAndEndInAsyncMode(t *testing.T) {
+	r := &Runner{Async: true}
+	var buf bytes.Buffer
+	defer func(original io.Writer) { resultWriter = original }(resultWriter)
+	resultWriter = &buf
+	defer stubExecStep(func(docker.Step) error { return nil })()
+
+	if err := r.doTasks(summaryTestConfigs, "test", []string{}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), "TASK  STEP   STATUS  START") {
+		t.Errorf("expected summary with start and end of steps, got:\n%s", buf.String())
+	}
+}
+
+func TestDoTasksWritesJSONSummary(t *testing.T) {
+	r := &Runner{Output: jsonOutput}
+	var buf bytes.Buffer
+	defer func(original io.Writer) { resultWriter = original }(resultWriter)
+	resultWriter = &buf
+	defer stubExecStep(func(docker.Step) error { return &docker.ExitError{Code: 1} })()
+
+	r.doTasks(summaryTestConfigs, "test", []string{})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var summary struct {
+		Summary struct {
+			Steps []stepTiming `json:"steps"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if steps := summary.Summary.Steps; len(steps) != 1 || steps[0].Step != "build" || !steps[0].Failed {
+		t.Errorf("expected summary of the failed step, got: %+v", steps)
+	}
+}
+
+func TestDoTasksWithoutSummary(t *testing.T) {
+	r := &Runner{NoSummary: true}
+	var buf bytes.Buffer
+	defer func(original io.Writer) { resultWriter = original }(resultWriter)
+	resultWriter = &buf
+	defer stubExecStep(func(docker.Step) error { return nil })()
+
+	if err := r.doTasks(summaryTestConfigs, "test", []string{}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no summary, got:\n%s", buf.String())
+	}
+}
+
+func TestDoTasksWithoutSummaryInQuietMode(t *testing.T) {
+	r := &Runner{Quiet: true}
+	var buf bytes.Buffer
+	defer func(original io.Writer) { resultWriter = original }(resultWriter)
+	resultWriter = &buf
+	defer stubExecStep(func(docker.Step) error { return nil })()
+
+	if err := r.doTasks(summaryTestConfigs, "test", []string{}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no summary in quiet mode, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,69 @@
+package dunner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// taskArgs is a task name given in the command line, which can be a glob pattern, along with its arguments
+type taskArgs struct {
+	name string
+	args []string
+}
+
+// taskSeparator separates the tasks given with --tasks, each with its arguments
+const taskSeparator = "+"
+
+// splitTasks splits the arguments given with --tasks into the tasks to run with their own arguments. The tasks are
+// separated by taskSeparator, the first argument of each being the name of the task, or a glob pattern matching
+// some, and the others its arguments, so that `build ./cmd + test:* + lint` runs `build` with `./cmd`, the tasks
+// matching `test:*`, then `lint`. An argument naming a task is passed as it is, like `test` in `deploy test`.
+func splitTasks(args []string) ([]taskArgs, error) {
+	var tasks []taskArgs
+	next := true // Whether the next argument starts a task
+	for _, arg := range args {
+		switch {
+		case arg == taskSeparator && next:
+			return nil, fmt.Errorf("dunner: a task is missing before '%s', the tasks given with --tasks are separated by '%s', like: build ./cmd %s test", taskSeparator, taskSeparator, taskSeparator)
+		case arg == taskSeparator:
+			next = true
+		case next:
+			tasks = append(tasks, taskArgs{name: arg})
+			next = false
+		default:
+			tasks[len(tasks)-1].args = append(tasks[len(tasks)-1].args, arg)
+		}
+	}
+	if next && len(tasks) > 0 {
+		return nil, fmt.Errorf("dunner: a task is missing after the last '%s' of the tasks given with --tasks", taskSeparator)
+	}
+	return tasks, nil
+}
+
+// joinTaskNames returns the names of the tasks joined by the separator
+func joinTaskNames(tasks []taskArgs, sep string) string {
+	names := make([]string, len(tasks))
+	for i, task := range tasks {
+		names[i] = task.name
+	}
+	return strings.Join(names, sep)
+}
+
+// execTasksAtOnce runs the tasks all at once, and returns their errors once they are all done, nil for those that
+// passed, in the order of the tasks
+func (r *Runner) execTasksAtOnce(configs *config.Configs, tasks []taskArgs) []error {
+	errs := make([]error, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task taskArgs) {
+			defer wg.Done()
+			errs[i] = r.ExecTask(configs, task.name, task.args, nil)
+		}(i, task)
+	}
+	wg.Wait()
+	return errs
+}
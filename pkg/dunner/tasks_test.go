@@ -0,0 +1,85 @@
+package dunner
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestSplitTasks(t *testing.T) {
+	split, err := splitTasks([]string{"build", "./cmd", "./pkg", "+", "test:*", "*.go", "+", "lint", "+", "deploy", "test"})
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []taskArgs{
+		{name: "build", args: []string{"./cmd", "./pkg"}},
+		{name: "test:*", args: []string{"*.go"}},
+		{name: "lint"},
+		{name: "deploy", args: []string{"test"}},
+	}
+	if !reflect.DeepEqual(expected, split) {
+		t.Errorf("expected tasks: %+v, got: %+v", expected, split)
+	}
+
+	for _, args := range [][]string{{"+", "build"}, {"build", "+", "+", "test"}, {"build", "+"}} {
+		if _, err := splitTasks(args); err == nil {
+			t.Errorf("expected error of a missing task in %q", args)
+		}
+	}
+}
+
+func TestRunTasksWithTheirOwnArgs(t *testing.T) {
+	var mu sync.Mutex
+	commands := map[string][]string{}
+	defer stubExecStep(func(s docker.Step) error {
+		mu.Lock()
+		defer mu.Unlock()
+		commands[s.Task] = s.Command
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"echo", "${1:-none}"}}
+	tasks := map[string]config.Task{"build": {Steps: []config.Step{step}}, "test": {Steps: []config.Step{step}}}
+	configs := &config.Configs{Tasks: tasks}
+	split, err := splitTasks([]string{"build", "./cmd", "+", "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Runner{Tasks: true, NoSummary: true}).runTasks(configs, split); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := map[string][]string{"build": {"echo", "./cmd"}, "test": {"echo", "none"}}
+	if !reflect.DeepEqual(expected, commands) {
+		t.Errorf("expected commands of the tasks: %v, got: %v", expected, commands)
+	}
+}
+
+func TestRunTasksAtOnceInAsyncMode(t *testing.T) {
+	started := make(chan struct{})
+	defer stubExecStep(func(s docker.Step) error {
+		if s.Task == "test" {
+			close(started)
+			return nil
+		}
+		select {
+		case <-started:
+			return nil
+		case <-time.After(2 * time.Second):
+			return errors.New("test task did not start while build task was running")
+		}
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	tasks := map[string]config.Task{"build": {Steps: []config.Step{step}}, "test": {Steps: []config.Step{step}}}
+	configs := &config.Configs{Tasks: tasks}
+
+	r := &Runner{Tasks: true, Async: true, NoSummary: true, FailFast: true}
+	if err := r.runTasks(configs, []taskArgs{{name: "build"}, {name: "test"}}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
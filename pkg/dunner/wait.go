@@ -0,0 +1,101 @@
+package dunner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+const (
+	defaultWaitTimeout  = 30 * time.Second
+	defaultWaitInterval = time.Second
+)
+
+// processStep processes the step, then waits for what the step sets in `waitFor` to be ready, so that the next
+// steps can rely on it. The time the step takes is recorded in the summary of the run, if any.
+// If the step has `continueOnError` and fails with a non-zero exit code, the error is logged as a warning and
+// returned as a continuedError. The values captured by the task the step follows, if any, are returned as well.
+func (r *Runner) processStep(configs *config.Configs, step *docker.Step, args []string, stepDefinition *config.Step) ([]string, error) {
+	start := time.Now()
+	captured, err := r.process(configs, step, args, stepDefinition)
+	if summary := r.summary; summary != nil && step.Follow == "" {
+		summary.record(step, start, time.Now(), err)
+	}
+	if err != nil {
+		var exitErr *docker.ExitError
+		if stepDefinition.ContinueOnError && (errors.As(err, &exitErr) || isContinued(err)) {
+			log.Warnf("Going on after %s failed, as it has continueOnError: %s", describeStep(step), err.Error())
+			return captured, &continuedError{err: err}
+		}
+		return captured, err
+	}
+	if stepDefinition.WaitFor == nil {
+		return captured, nil
+	}
+	return captured, waitFor(step, stepDefinition.WaitFor)
+}
+
+// waitFor polls the address or the command of waitFor until it is ready, or until its timeout passes. The duration
+// between two polls grows from the interval as per the backoff of waitFor, if any.
+func waitFor(step *docker.Step, w *config.WaitFor) error {
+	timeout, interval := w.Timeout, w.Interval
+	if timeout == 0 {
+		timeout = defaultWaitTimeout
+	}
+	if interval == 0 {
+		interval = defaultWaitInterval
+	}
+	target := describeWaitFor(w)
+	log.Infof("Waiting for %s after %s", target, describeStep(step))
+
+	deadline := time.Now().Add(timeout)
+	delays := newTimeBackoff(interval, w.Backoff)
+	for {
+		if isReady(w, interval) {
+			return nil
+		}
+		delay, ok := delays.next()
+		if !ok {
+			return fmt.Errorf("dunner: %s is not ready after waiting for %s", target, w.Backoff.MaxElapsed)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("dunner: %s is not ready after waiting for %s", target, timeout)
+		}
+		select {
+		case <-step.Cancel:
+			return docker.ErrCanceled
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isReady returns true if the address accepts TCP connections, or if the command exits with a zero exit code.
+// A command given as a single string is run with the shell.
+func isReady(w *config.WaitFor, dialTimeout time.Duration) bool {
+	if w.Address != "" {
+		conn, err := net.DialTimeout("tcp", w.Address, dialTimeout)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	command := []string(w.Command)
+	if len(command) == 1 {
+		command = []string{"sh", "-c", command[0]}
+	}
+	return exec.Command(command[0], command[1:]...).Run() == nil
+}
+
+func describeWaitFor(w *config.WaitFor) string {
+	if w.Address != "" {
+		return fmt.Sprintf("address '%s'", w.Address)
+	}
+	return fmt.Sprintf("command '%s'", strings.Join(w.Command, " "))
+}
@@ -0,0 +1,66 @@
+package dunner
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestWaitForAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	err = waitFor(&docker.Step{Task: "test"}, &config.WaitFor{Address: listener.Addr().String(), Timeout: time.Second})
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
+
+func TestWaitForCommand(t *testing.T) {
+	err := waitFor(&docker.Step{Task: "test"}, &config.WaitFor{Command: config.Command{"exit 0"}, Timeout: time.Second})
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	w := &config.WaitFor{Command: config.Command{"false"}, Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond}
+
+	err := waitFor(&docker.Step{Task: "test"}, w)
+
+	expectedErr := "dunner: command 'false' is not ready after waiting for 50ms"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExecTaskWaitsBetweenSteps(t *testing.T) {
+	var ran []string
+	defer stubExecStep(func(s docker.Step) error {
+		ran = append(ran, s.Name)
+		return nil
+	})()
+	w := &config.WaitFor{Command: config.Command{"false"}, Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond}
+	steps := []config.Step{
+		{Name: "db", Image: busyBoxImage, Command: []string{"ls"}, WaitFor: w},
+		{Name: "migrate", Image: busyBoxImage, Command: []string{"ls"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: steps}}}
+
+	err := ExecTask(&configs, "test", []string{}, nil)
+
+	if err == nil {
+		t.Fatal("expected error of the service not being ready, got none")
+	}
+	if len(ran) != 1 || ran[0] != "db" {
+		t.Errorf("expected only the first step to run, got: %v", ran)
+	}
+}
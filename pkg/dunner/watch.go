@@ -0,0 +1,189 @@
+package dunner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// watchDebounce is the time to wait for after a change of the watched files, so that a burst of changes,
+// like saving many files at once, re-runs the task only once.
+var watchDebounce = 300 * time.Millisecond
+
+// watchRun is a run of the tasks in watch mode, which can be canceled when the watched files change again, or shut
+// down gracefully on a signal or once it timed out.
+type watchRun struct {
+	cancel   chan struct{}
+	done     chan struct{}
+	shutdown *docker.Shutdown
+}
+
+// watchTasks runs the tasks once, then re-runs them whenever files matching any of the glob patterns change.
+// A run still in progress when the files change is canceled before running the tasks again. On SIGINT or SIGTERM,
+// the run in progress is shut down like on `handleSignals` and the watch ends.
+func (r *Runner) watchTasks(configs *config.Configs, tasks []taskArgs, patterns []string) error {
+	for i, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("dunner: invalid watch pattern '%s': %s", pattern, err.Error())
+		}
+		patterns[i] = filepath.Clean(pattern)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("dunner: failed to watch files: %s", err.Error())
+	}
+	defer watcher.Close()
+	dirs, err := watchedDirs(patterns)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("dunner: failed to watch directory '%s': %s", dir, err.Error())
+		}
+	}
+
+	interrupted := make(chan string, 1)
+	defer notifySignals(func(name string) { interrupted <- name })()
+	defer func() { r.shutdown, r.cancel = nil, nil }()
+
+	run := r.startRun(configs, tasks)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case name := <-interrupted:
+			run.shutdown.Start(name)
+			<-run.done
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op != fsnotify.Chmod && matchesWatch(patterns, event.Name) {
+				debounce = time.After(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("dunner: failed to watch files: %s", err.Error())
+		case <-debounce:
+			debounce = nil
+			run.stop()
+			log.Infof("Files changed, running '%s' again", joinTaskNames(tasks, "', '"))
+			run = r.startRun(configs, tasks)
+		}
+	}
+}
+
+// startRun runs the tasks in the background with the timeout of `--timeout`, logging the error of the run if any
+func (r *Runner) startRun(configs *config.Configs, tasks []taskArgs) *watchRun {
+	run := &watchRun{cancel: make(chan struct{}), done: make(chan struct{}), shutdown: docker.NewShutdown(r.StopTimeout)}
+	// The cancel channel and the shutdown of the runner are only changed while no run is in progress
+	r.cancel, r.shutdown = run.canceled(), run.shutdown
+	go func() {
+		defer close(run.done)
+		err := r.withTimeout(func() error { return r.runTasks(configs, tasks) })
+		switch {
+		case errors.Is(err, docker.ErrCanceled) && run.shutdown.Signal() == "":
+			log.Info("Run canceled as the watched files changed")
+		case err != nil:
+			log.Error(err)
+		default:
+			log.Info("Watching for changes...")
+		}
+	}()
+	return run
+}
+
+// canceled returns the channel closed once the run is canceled, as the watched files changed or by its shutdown.
+// The containers of the steps canceled as the files changed are killed at once, as the shutdown has no signal.
+func (run *watchRun) canceled() <-chan struct{} {
+	canceled := make(chan struct{})
+	go func() {
+		select {
+		case <-run.cancel:
+		case <-run.shutdown.Done():
+		case <-run.done:
+			return
+		}
+		close(canceled)
+	}()
+	return canceled
+}
+
+// stop cancels the run if it is still in progress, and waits for it to be done
+func (run *watchRun) stop() {
+	close(run.cancel)
+	<-run.done
+}
+
+// watchedDirs returns the directories to watch for the glob patterns, which are the directories of the files
+// matching the patterns, the matching directories themselves and the directory each pattern starts from.
+func watchedDirs(patterns []string) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, pattern := range patterns {
+		if base := patternBase(pattern); isDir(base) {
+			add(base)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("dunner: invalid watch pattern '%s': %s", pattern, err.Error())
+		}
+		for _, match := range matches {
+			if isDir(match) {
+				add(match)
+			} else {
+				add(filepath.Dir(match))
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("dunner: no files to watch match %s", strings.Join(patterns, ", "))
+	}
+	return dirs, nil
+}
+
+// patternBase returns the leading directories of the glob pattern which have no special characters
+func patternBase(pattern string) string {
+	base := pattern
+	for strings.ContainsAny(base, "*?[") {
+		base = filepath.Dir(base)
+	}
+	return base
+}
+
+// matchesWatch returns true if the changed file, or any of its directories, matches any of the patterns
+func matchesWatch(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		for path := filepath.Clean(name); path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+			if matched, _ := filepath.Match(pattern, path); matched {
+				return true
+			}
+			if filepath.Dir(path) == path {
+				break
+			}
+		}
+	}
+	return false
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,165 @@
+package dunner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestMatchesWatch(t *testing.T) {
+	patterns := []string{"pkg/*.go", "docs"}
+	for name, expected := range map[string]bool{
+		"pkg/dunner.go":    true,
+		"pkg/dunner.yaml":  false,
+		"docs/index.md":    true,
+		"docs/api/main.md": true,
+		"main.go":          false,
+	} {
+		if got := matchesWatch(patterns, name); got != expected {
+			t.Errorf("expected match of '%s' to be %t, got %t", name, expected, got)
+		}
+	}
+}
+
+func TestWatchedDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner_watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "pkg", "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pkg", "config", "config.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := watchedDirs([]string{filepath.Join(dir, "pkg", "*", "*.go")})
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{filepath.Join(dir, "pkg"), filepath.Join(dir, "pkg", "config")}
+	if !reflect.DeepEqual(expected, dirs) {
+		t.Errorf("expected watched directories: %v, got: %v", expected, dirs)
+	}
+}
+
+func TestWatchedDirsWithoutMatches(t *testing.T) {
+	_, err := watchedDirs([]string{"/dunner/not/existing/*.go"})
+
+	expectedErr := "dunner: no files to watch match /dunner/not/existing/*.go"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExecTaskIsCanceled(t *testing.T) {
+	cancel := make(chan struct{})
+	close(cancel)
+	r := &Runner{cancel: cancel}
+	defer stubExecStep(func(docker.Step) error {
+		t.Errorf("expected step not to be run")
+		return nil
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{step}}}}
+
+	err := r.ExecTask(&configs, "test", []string{}, nil)
+
+	if err != docker.ErrCanceled {
+		t.Fatalf("expected error: %s, got: %v", docker.ErrCanceled, err)
+	}
+}
+
+func TestStartRunIsShutDownOrCanceled(t *testing.T) {
+	started, signals := make(chan struct{}), make(chan string, 1)
+	defer stubExecStep(func(s docker.Step) error {
+		started <- struct{}{}
+		select {
+		case <-s.Cancel:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected step to be canceled")
+		}
+		signals <- s.Shutdown.Signal()
+		return docker.ErrCanceled
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{"serve": {Steps: []config.Step{step}}}}
+	tasks := []taskArgs{{name: "serve"}}
+	r := &Runner{StopTimeout: time.Second, NoSummary: true}
+
+	// A run shut down on a signal forwards it to the containers
+	run := r.startRun(&configs, tasks)
+	<-started
+	run.shutdown.Start("SIGINT")
+	if signal := <-signals; signal != "SIGINT" {
+		t.Errorf("expected step to be shut down with SIGINT, got: %q", signal)
+	}
+	<-run.done
+
+	// A run canceled as the files changed kills the containers at once
+	run = r.startRun(&configs, tasks)
+	<-started
+	go run.stop()
+	if signal := <-signals; signal != "" {
+		t.Errorf("expected step to be canceled without a signal, got: %q", signal)
+	}
+	<-run.done
+
+	// A run that timed out is shut down with SIGTERM, the next run getting a shutdown of its own
+	r.Timeout = 10 * time.Millisecond
+	for i := 0; i < 2; i++ {
+		run = r.startRun(&configs, tasks)
+		<-started
+		if signal := <-signals; signal != "SIGTERM" {
+			t.Errorf("expected run %d to be shut down with SIGTERM once timed out, got: %q", i+1, signal)
+		}
+		<-run.done
+	}
+}
+
+func TestWatchTasksEndsOnSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var signal string
+	defer stubExecStep(func(s docker.Step) error {
+		process, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := process.Signal(syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-s.Cancel:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected step to be canceled on SIGTERM")
+		}
+		signal = s.Shutdown.Signal()
+		return docker.ErrCanceled
+	})()
+	step := config.Step{Image: busyBoxImage, Command: []string{"ls"}}
+	configs := config.Configs{Tasks: map[string]config.Task{"serve": {Steps: []config.Step{step}}}}
+	r := &Runner{StopTimeout: time.Second, NoSummary: true}
+
+	if err := r.watchTasks(&configs, []taskArgs{{name: "serve"}}, []string{filepath.Join(dir, "*")}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if signal != "SIGTERM" {
+		t.Errorf("expected step to be shut down with SIGTERM, got: %q", signal)
+	}
+	if r.shutdown != nil || r.cancel != nil {
+		t.Error("expected the shutdown of the runner to be reset once the watch ended")
+	}
+}
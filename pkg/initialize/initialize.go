@@ -22,13 +22,14 @@ type recipeMetadata struct {
 	PostInstallMessage string `yaml:"postInstallMessage"`
 }
 
-// InitProject generates a dunner task file with default template
-func InitProject(filename string, args []string) error {
-	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+// InitProject generates a dunner task file with default template. An existing task file is only overwritten if
+// force is set.
+func InitProject(filename string, args []string, force bool) error {
+	if _, err := os.Stat(filename); !os.IsNotExist(err) && !force {
 		if err != nil {
 			return err
 		}
-		return fmt.Errorf("%s already exists", filename)
+		return fmt.Errorf("%s already exists, use --force to overwrite it", filename)
 	}
 	if len(args) == 1 && args[0] != "" {
 		return InitWithRecipe(filename, args[0])
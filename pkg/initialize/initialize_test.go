@@ -40,7 +40,7 @@ func TestInitProjectSuccess(t *testing.T) {
 	revert := setup(t)
 	defer revert()
 	var filename = ".test_dunner.yml"
-	if err := InitProject(filename, nil); err != nil {
+	if err := InitProject(filename, nil, false); err != nil {
 		t.Errorf("Failed to open dunner task file %s: %s", filename, err.Error())
 	}
 
@@ -66,8 +66,8 @@ func TestInitializeWhenFileExists(t *testing.T) {
 	var filename = ".test_dunner.yml"
 	createFile(t, filename, internal.DefaultTaskFileContents)
 
-	expected := fmt.Sprintf("%s already exists", filename)
-	err := InitProject(filename, nil)
+	expected := fmt.Sprintf("%s already exists, use --force to overwrite it", filename)
+	err := InitProject(filename, nil, false)
 	if err == nil {
 		t.Errorf("expected: %s, got nil", expected)
 	}
@@ -76,13 +76,49 @@ func TestInitializeWhenFileExists(t *testing.T) {
 	}
 }
 
+func TestInitProjectWithForce(t *testing.T) {
+	revert := setup(t)
+	defer revert()
+	var filename = ".test_dunner.yml"
+	createFile(t, filename, "tasks: {}")
+
+	if err := InitProject(filename, nil, true); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read dunner task file %s: %s", filename, err.Error())
+	}
+	if string(contents) != internal.DefaultTaskFileContents {
+		t.Errorf("expected task file to be overwritten with the default one, got: %s", contents)
+	}
+}
+
+func TestInitProjectGeneratesValidTaskFile(t *testing.T) {
+	revert := setup(t)
+	defer revert()
+	var filename = ".test_dunner.yml"
+	if err := InitProject(filename, nil, false); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	configs, err := config.GetConfigs(filename)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Errorf("expected generated task file to be valid, got: %s", errs)
+	}
+}
+
 func TestInitializeFilenameIsInvalid(t *testing.T) {
 	revert := setup(t)
 	defer revert()
 	var filename = "#Q$EJL_doesntexist/.test_dunner.yml"
 
 	expected := fmt.Sprintf("open %s: no such file or directory", filename)
-	err := InitProject(filename, nil)
+	err := InitProject(filename, nil, false)
 	if err == nil {
 		t.Errorf("expected: %s, got nil", expected)
 	}
@@ -191,7 +227,7 @@ func TestInitProjectWithRecipe(t *testing.T) {
 	getDunnerTaskURLOfRecipe = func(string) string { return server.URL }
 	defer server.Close()
 
-	err := InitProject(".test_init_dunner.yaml", []string{"foo"})
+	err := InitProject(".test_init_dunner.yaml", []string{"foo"}, false)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %s", err.Error())